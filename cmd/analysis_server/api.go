@@ -0,0 +1,466 @@
+package main
+
+// HTTP API of the analysis server. Endpoints described in api.Endpoints are served
+// under api.Prefix and under their old unversioned paths for existing clients.
+// Handlers return errors instead of writing them: *api.Error is sent with its
+// status, timeouts become 504 and other errors are logged and sent as 500.
+// Every request goes through access logging, panic recovery, CORS and timeout.
+// Callers of endpoints are authenticated, their roles and courses are checked
+// after parameter validation.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/pseudonymization"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiHandler handles API request. Error is sent to the client if nothing was written yet.
+type apiHandler func(w http.ResponseWriter, r *http.Request) error
+
+// routeHandler serves an endpoint of api.Endpoints. LegacyPath is an optional unversioned
+// path of the endpoint. Requests time out after Timeout, if it isn't zero.
+type routeHandler struct {
+	LegacyPath string
+	Timeout    time.Duration
+	Handler    apiHandler
+}
+
+func endpointKey(method string, path string) string {
+	return method + " " + path
+}
+
+// newRouter returns handler of endpoints wrapped with middlewares. handlers are keyed by
+// endpointKey, every endpoint must have a handler and every handler must have an endpoint.
+// Query parameters are validated against the endpoint description before the handler is called.
+// Callers are authenticated by authenticator, browsers are allowed cross-origin requests from allowedOrigins.
+func newRouter(endpoints []api.Endpoint, handlers map[string]routeHandler, authenticator *auth.Authenticator, allowedOrigins []string) (http.Handler, error) {
+	document, err := json.Marshal(api.OpenAPIDocument(endpoints, api.Version))
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	methodHandlers := map[string]methodHandler{}
+	handledKeys := map[string]bool{}
+	for _, endpoint := range endpoints {
+		key := endpointKey(endpoint.Method, endpoint.Path)
+		route, ok := handlers[key]
+		if !ok {
+			return nil, errors.New("No handler of endpoint " + key)
+		}
+		handledKeys[key] = true
+
+		handler := serveAPI(authenticating(authenticator, validatingParams(endpoint.Params, authorizing(endpoint, route.Handler))))
+		if route.Timeout > 0 {
+			handler = withTimeout(handler, route.Timeout)
+		}
+		paths := []string{api.Prefix + endpoint.Path}
+		if route.LegacyPath != "" {
+			paths = append(paths, route.LegacyPath)
+		}
+		for _, path := range paths {
+			if methodHandlers[path] == nil {
+				methodHandlers[path] = methodHandler{}
+				mux.Handle(path, methodHandlers[path])
+			}
+			methodHandlers[path][endpoint.Method] = handler
+		}
+	}
+	for key := range handlers {
+		if !handledKeys[key] {
+			return nil, errors.New("No endpoint description of handler " + key)
+		}
+	}
+
+	mux.Handle(api.OpenAPIPath, methodHandler{http.MethodGet: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", api.JSONContentType)
+		w.Write(document)
+	})})
+	mux.Handle(api.Prefix+"/", serveAPI(func(w http.ResponseWriter, r *http.Request) error {
+		return &api.Error{Status: http.StatusNotFound, Code: "not_found", Message: "Unknown API path " + r.URL.Path}
+	}))
+	return withAccessLog(withRecovery(withCORS(mux, allowedOrigins))), nil
+}
+
+// authenticating calls handler with principal of the request in its context
+func authenticating(authenticator *auth.Authenticator, handler apiHandler) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="edxlyser"`)
+			return &api.Error{Status: http.StatusUnauthorized, Code: "unauthorized", Message: err.Error()}
+		}
+		if recorder, ok := w.(*statusRecorder); ok {
+			recorder.subject = principal.Subject
+		}
+		return handler(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	}
+}
+
+// authorizing calls handler if the principal can read the endpoint: identifiable endpoints need a role
+// that can see learner usernames, course parameters must be courses of the principal. Principals
+// limited to some courses must set optional course parameters.
+func authorizing(endpoint api.Endpoint, handler apiHandler) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := authorize(endpoint, r); err != nil {
+			return err
+		}
+		return handler(w, r)
+	}
+}
+
+// authorize checks that the principal of request r can read endpoint, see authorizing
+func authorize(endpoint api.Endpoint, r *http.Request) error {
+	principal := auth.FromContext(r.Context())
+	if endpoint.Identifiable && !principal.CanSeeIdentities() {
+		return forbidden("Role %v can't read learner usernames", principal.Role)
+	}
+	for _, param := range endpoint.Params {
+		if param.Type != api.CourseParam {
+			continue
+		}
+		course := strings.TrimSpace(r.URL.Query().Get(param.Name))
+		if course == "" && !principal.HasAllCourses() {
+			return forbidden("%v parameter is required to read only the courses of %v", param.Name, principal.Subject)
+		}
+		if course != "" && !principal.CanAccessCourse(course) {
+			return forbidden("%v can't read course %v", principal.Subject, course)
+		}
+	}
+	return nil
+}
+
+func forbidden(format string, args ...interface{}) *api.Error {
+	return &api.Error{Status: http.StatusForbidden, Code: "forbidden", Message: fmt.Sprintf(format, args...)}
+}
+
+// validatingParams calls handler if query parameters match params
+func validatingParams(params []api.Param, handler apiHandler) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := api.ValidateParams(params, r.URL.Query()); err != nil {
+			return err
+		}
+		return handler(w, r)
+	}
+}
+
+// methodHandler dispatches requests of one path by HTTP method
+type methodHandler map[string]http.Handler
+
+func (handlers methodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := handlers[r.Method]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if r.Method == http.MethodHead {
+		if handler, ok := handlers[http.MethodGet]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	allowed := make([]string, 0, len(handlers))
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, r, &api.Error{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "Method " + r.Method + " is not allowed"})
+}
+
+func serveAPI(handler apiHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := handler(w, r); err != nil {
+			writeError(w, r, err)
+		}
+	})
+}
+
+// writeJSON sends value as JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) error {
+	return writeJSONStatus(w, http.StatusOK, value)
+}
+
+// writeJSONStatus sends value as JSON response with status
+func writeJSONStatus(w http.ResponseWriter, status int, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", api.JSONContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	return err
+}
+
+// writeError sends err to the client. Errors after the response was started are only logged.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	requestID := requestIDFrom(r.Context())
+	if errors.Is(err, context.Canceled) {
+		log.Printf("request %v is canceled by the client\n", requestID)
+		return
+	}
+	response := apiError(err)
+	if response.Status == http.StatusInternalServerError {
+		log.Printf("Error! request %v failed: %v\n", requestID, err)
+	}
+	if recorder, ok := w.(*statusRecorder); ok && recorder.status != 0 {
+		log.Printf("Error! request %v failed after the response was started: %v\n", requestID, err)
+		return
+	}
+	response.RequestID = requestID
+	b, _ := json.Marshal(api.ErrorResponse{Error: response})
+	w.Header().Set("Content-Type", api.JSONContentType)
+	w.WriteHeader(response.Status)
+	w.Write(b)
+}
+
+// apiError returns the response of err, other errors than *api.Error are hidden
+// behind 404, 504 and 500 responses
+func apiError(err error) *api.Error {
+	var response *api.Error
+	switch {
+	case errors.As(err, &response):
+		return &api.Error{Status: response.Status, Code: response.Code, Message: response.Message}
+	case errors.Is(err, database.ErrNotFound):
+		return &api.Error{Status: http.StatusNotFound, Code: "not_found", Message: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &api.Error{Status: http.StatusGatewayTimeout, Code: "timeout", Message: "Request took too long"}
+	}
+	return &api.Error{Status: http.StatusInternalServerError, Code: "internal_error", Message: "Internal server error"}
+}
+
+type requestIDKey struct{}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func requestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// statusRecorder remembers status and size of the response and the authenticated subject for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	bytes   int
+	subject string
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(b []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	n, err := recorder.ResponseWriter.Write(b)
+	recorder.bytes += n
+	return n, err
+}
+
+// Flush sends buffered response, streaming handlers need it
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the original ResponseWriter
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// withAccessLog assigns request id (from X-Request-ID header or a random one) and logs
+// every request. Query strings aren't logged, they can have learner usernames.
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			requestID = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, requestID)))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		subject := recorder.subject
+		if subject == "" {
+			subject = "-"
+		}
+		log.Printf("access: %v %v %v %v %vB %v %v %v\n", requestID, r.Method, r.URL.Path, recorder.status, recorder.bytes, time.Since(start).Round(time.Millisecond), r.RemoteAddr, subject)
+	})
+}
+
+// withRecovery turns panics of handlers into 500 responses
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			writeError(w, r, fmt.Errorf("panic: %v\n%s", recovered, debug.Stack()))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withCORS allows requests from allowedOrigins ("*" allows any origin) and answers preflight requests.
+// Requests from other origins get no CORS headers, so browsers don't let pages read the responses.
+func withCORS(next http.Handler, allowedOrigins []string) http.Handler {
+	origins := map[string]bool{}
+	for _, origin := range allowedOrigins {
+		origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin != "" && (origins["*"] || origins[origin]) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Next-Cursor, Content-Disposition")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withTimeout cancels context of the request after timeout
+func withTimeout(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requiredParam returns non empty query parameter name
+func requiredParam(r *http.Request, name string) (string, error) {
+	value := strings.TrimSpace(r.URL.Query().Get(name))
+	if value == "" {
+		return "", api.InvalidParameter("%v parameter is required", name)
+	}
+	return value, nil
+}
+
+// courseParam returns required "course" parameter in "course-v1:org+CourseCode+CourseRun" format
+func courseParam(r *http.Request) (string, error) {
+	course, err := requiredParam(r, "course")
+	if err != nil {
+		return "", err
+	}
+	if _, err = models.GetCourseCodeFromCourseID(course); err != nil {
+		return "", api.InvalidParameter("course parameter should have \"course-v1:org+CourseCode+CourseRun\" format, \"+\" must be encoded as %%2B")
+	}
+	return course, nil
+}
+
+// positiveIntParam returns positive integer query parameter name or defaultValue if it is missing
+func positiveIntParam(r *http.Request, name string, defaultValue int, maxValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 || number > maxValue {
+		return 0, api.InvalidParameter("%v parameter should be an integer from 1 to %v", name, maxValue)
+	}
+	return number, nil
+}
+
+// dateParam returns "2006-01-02" or RFC3339 date query parameter name, zero time if it is missing
+func dateParam(r *http.Request, name string) (time.Time, error) {
+	date, err := api.ParseDate(r.URL.Query().Get(name))
+	if err != nil {
+		return time.Time{}, api.InvalidParameter("%v parameter should be a date in 2006-01-02 or RFC 3339 format", name)
+	}
+	return date, nil
+}
+
+// filterParams returns filter of "from", "to", "usernames", "enrollment_modes", "platforms"
+// and "min_events" parameters. Usernames are only accepted from callers that can see learner identities.
+func filterParams(r *http.Request, identities *pseudonymization.Identities) (models.Filter, error) {
+	var filter models.Filter
+	var err error
+	if filter.From, filter.To, err = dateRangeParams(r); err != nil {
+		return models.Filter{}, err
+	}
+	for _, username := range listParam(r, "usernames") {
+		storedUsernames, err := identities.Stored(username)
+		if err != nil {
+			return models.Filter{}, err
+		}
+		filter.Usernames = append(filter.Usernames, storedUsernames...)
+	}
+	if principal := auth.FromContext(r.Context()); len(filter.Usernames) > 0 && !principal.CanSeeIdentities() {
+		return models.Filter{}, forbidden("%v can't select learners by usernames", principal.Subject)
+	}
+	filter.EnrollmentModes = listParam(r, "enrollment_modes")
+	filter.Platforms = listParam(r, "platforms")
+	if filter.MinEvents, err = positiveIntParam(r, "min_events", 0, 1000000); err != nil {
+		return models.Filter{}, err
+	}
+	return filter, nil
+}
+
+// listParam returns non empty comma separated values of query parameter name
+func listParam(r *http.Request, name string) []string {
+	var values []string
+	for _, value := range strings.Split(r.URL.Query().Get(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// dateRangeParams returns "from" and "to" dates, "from" must be before "to".
+// Date-only "to" includes the whole day.
+func dateRangeParams(r *http.Request) (time.Time, time.Time, error) {
+	from, err := dateParam(r, "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := api.ParseEndDate(r.URL.Query().Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, api.InvalidParameter("to parameter should be a date in 2006-01-02 or RFC 3339 format")
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, api.InvalidParameter("from parameter should be before to parameter")
+	}
+	return from, to, nil
+}
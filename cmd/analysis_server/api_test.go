@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"kafka-log-processor/pkg/charts"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/jobs"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/rollups"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+// newTestStore returns memory store with a course of two units and events of two learners
+func newTestStore(t *testing.T) *database.MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	structure := edxstruct.Course{DisplayName: "Test course", CourseCode: "C1", CourseRun: "2020", Chapters: []edxstruct.Chapter{{
+		URLName:     "chapter1",
+		DisplayName: "Chapter 1",
+		Sequentials: []edxstruct.Sequential{{
+			URLName:     "sequential1",
+			DisplayName: "Sequential 1",
+			Verticals: []edxstruct.Vertical{
+				{URLName: "vertical1", DisplayName: "Unit 1", Videos: []edxstruct.Video{{URLName: "video1", DisplayName: "Video 1", Duration: "120"}}},
+				{URLName: "vertical2", DisplayName: "Unit 2", Problems: []edxstruct.Problem{{URLName: "problem1", DisplayName: "Problem 1"}}},
+			},
+		}},
+	}}}
+	if err := store.AddCourseStructure(ctx, structure); err != nil {
+		t.Fatalf("can't add course structure: %v", err)
+	}
+
+	for _, username := range []string{"alice", "bob"} {
+		events := []error{
+			store.AddEnrollmentEventDescription(ctx, models.EnrollmentEventDescription{EventTime: "2020-03-01T09:00:00Z", Username: username, EventType: "edx.course.enrollment.activated", Mode: "audit", IsActive: true, CourseID: testCourseID}),
+			store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:00:00Z", VideoTime: 0, Username: username, VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID}),
+			store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:01:00Z", VideoTime: 60, Username: username, VideoID: "video1", EventType: models.PAUSE, CourseID: testCourseID}),
+			store.AddSequentialMoveEventDescription(ctx, models.SequentialMoveEventDescription{EventTime: "2020-03-01T10:02:00Z", Username: username, Old: 1, New: 2, EventType: "seq_next", CourseID: testCourseID,
+				SequentialID: "sequential1", OldVerticalID: "vertical1", OldVerticalName: "Unit 1", NewVerticalID: "vertical2", NewVerticalName: "Unit 2"}),
+			store.AddProblemEventDescription(ctx, models.ProblemEventDescription{EventTime: "2020-03-01T10:03:00Z", Username: username, ProblemID: "problem1", EventType: models.ProblemSubmittedEventType,
+				WeightedEarned: 1, WeightedPossible: 1, CourseID: testCourseID}),
+			store.AddBooksmarkEventDescription(ctx, models.BookmarksEventDescription{EventTime: "2020-03-01T10:04:00Z", Username: username, ID: username + "-bookmark", EventType: "edx.bookmark.added",
+				IsAdded: true, CourseID: testCourseID, BlockID: "vertical2", BlockName: "Unit 2"}),
+			store.AddLinkEventDescription(ctx, models.LinkEventDescription{EventTime: "2020-03-01T10:05:00Z", Username: username, EventType: "edx.ui.lms.link_clicked", CourseID: testCourseID,
+				CurrentURL: "https://lms.example.com/courses/" + testCourseID + "/courseware/chapter1/sequential1/2", TargetURL: "https://docs.python.org/3/tutorial/",
+				LinkType: models.EXTERNAL, TargetDomain: "docs.python.org", TargetPath: "/3/tutorial/", TargetResource: "docs.python.org/3/tutorial", CurrentBlockID: "vertical2", CurrentBlockName: "Unit 2"}),
+		}
+		for _, err := range events {
+			if err != nil {
+				t.Fatalf("can't add event: %v", err)
+			}
+		}
+	}
+	if _, err := rollups.Update(context.Background(), store, time.Now(), 0); err != nil {
+		t.Fatalf("can't roll up events: %v", err)
+	}
+	return store
+}
+
+// newTestRouter returns the API of store without live stream, authentication is disabled if authenticator is nil
+func newTestRouter(t *testing.T, store database.EventStore, authenticator *auth.Authenticator) http.Handler {
+	t.Helper()
+	handlers, err := apiHandlers(*analysers.New(store), store, nil, jobs.NewManager(jobs.Config{}), charts.NewCache(10), nil, time.Minute, time.Minute)
+	if err != nil {
+		t.Fatalf("apiHandlers() error = %v", err)
+	}
+	router, err := newRouter(api.Endpoints, handlers, authenticator, nil)
+	if err != nil {
+		t.Fatalf("newRouter() error = %v", err)
+	}
+	return router
+}
+
+// openAPIDocument returns the OpenAPI document of api.Endpoints decoded from JSON
+func openAPIDocument(t *testing.T) map[string]interface{} {
+	t.Helper()
+	b, err := json.Marshal(api.OpenAPIDocument(api.Endpoints, api.Version))
+	if err != nil {
+		t.Fatalf("can't marshal OpenAPI document: %v", err)
+	}
+	var document map[string]interface{}
+	if err = json.Unmarshal(b, &document); err != nil {
+		t.Fatalf("can't unmarshal OpenAPI document: %v", err)
+	}
+	return document
+}
+
+// responseSchema returns schema of the content of the response of the endpoint with status,
+// nil if the document doesn't describe the response
+func responseSchema(document map[string]interface{}, method string, path string, status int, contentType string) map[string]interface{} {
+	operation, _ := lookup(document, "paths", path, strings.ToLower(method)).(map[string]interface{})
+	schema, _ := lookup(operation, "responses", strconv.Itoa(status), "content", contentType, "schema").(map[string]interface{})
+	return schema
+}
+
+func lookup(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// schemaErrors returns mismatches of value decoded from JSON with numbers and schema,
+// references are resolved in components
+func schemaErrors(components map[string]interface{}, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		component, ok := components[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+		if !ok {
+			return []string{path + ": unknown reference " + ref}
+		}
+		return schemaErrors(components, component, value, path)
+	}
+	if value == nil {
+		if schema["nullable"] == true || len(schema) == 0 {
+			return nil
+		}
+		return []string{path + " is null"}
+	}
+
+	schemaType, _ := schema["type"].(string)
+	mismatch := []string{path + " should be " + schemaType}
+	errs := make([]string, 0)
+	switch schemaType {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				errs = append(errs, path+"."+name.(string)+" is missing")
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propertySchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				switch additional := schema["additionalProperties"].(type) {
+				case map[string]interface{}:
+					propertySchema = additional
+				case bool:
+					if additional {
+						continue
+					}
+				}
+			}
+			if propertySchema == nil {
+				errs = append(errs, path+"."+name+" isn't in the schema")
+				continue
+			}
+			errs = append(errs, schemaErrors(components, propertySchema, object[name], path+"."+name)...)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		items := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			errs = append(errs, schemaErrors(components, items, item, path+"["+strconv.Itoa(i)+"]")...)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				errs = append(errs, path+" isn't date-time: "+err.Error())
+			}
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok {
+			found := false
+			for _, allowed := range enum {
+				found = found || allowed == text
+			}
+			if !found {
+				errs = append(errs, path+" isn't one of the enum values: "+text)
+			}
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return mismatch
+		}
+		if _, err := number.Int64(); err != nil {
+			return mismatch
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return mismatch
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch
+		}
+	}
+	return errs
+}
+
+func TestEndpointsMatchOpenAPIDocument(t *testing.T) {
+	router := newTestRouter(t, newTestStore(t), nil)
+	document := openAPIDocument(t)
+	components := lookup(document, "components", "schemas").(map[string]interface{})
+	course := url.QueryEscape(testCourseID)
+
+	// requests are sent in order, {job} is replaced with id of the submitted job.
+	// Results of jobs are checked against the schema of their analysis.
+	tests := []struct {
+		method       string
+		path         string
+		query        string
+		body         string
+		status       int
+		schemaMethod string
+		schemaPath   string
+	}{
+		{method: http.MethodGet, path: api.CourseIDsPath},
+		{method: http.MethodGet, path: api.CourseRoutesPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.VideoWatchingsPath, query: "video_id=video1"},
+		{method: http.MethodGet, path: api.CourseVideosPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.ExternalResourcesPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.BookmarksPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.CourseActivityPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.ProblemsPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.UserTimelinePath, query: "course=" + course + "&username=alice"},
+		{method: http.MethodGet, path: api.ParquetExportPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.VideoWatchingsChartPath, query: "video_id=video1"},
+		{method: http.MethodGet, path: api.CourseActivityChartPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.CourseRoutesChartPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.ProblemsChartPath, query: "course=" + course},
+		{method: http.MethodGet, path: api.LiveActivityPath, query: "course=" + course, status: http.StatusServiceUnavailable},
+		{method: http.MethodGet, path: api.GraphQLPath, query: "query=" + url.QueryEscape(`{ courses { id } }`)},
+		{method: http.MethodPost, path: api.GraphQLPath, body: `{"query": "query($id: ID!) { course(id: $id) { id } }", "variables": {"id": "` + testCourseID + `"}}`},
+		{method: http.MethodPost, path: api.JobsPath, query: "analysis=problems&course=" + course, status: http.StatusAccepted},
+		{method: http.MethodGet, path: api.JobsPath, query: "id={job}"},
+		{method: http.MethodGet, path: api.JobResultPath, query: "id={job}", schemaMethod: http.MethodGet, schemaPath: api.ProblemsPath},
+		{method: http.MethodDelete, path: api.JobsPath, query: "id={job}"},
+	}
+
+	tested := map[string]bool{}
+	jobID := ""
+	for _, test := range tests {
+		key := endpointKey(test.method, test.path)
+		tested[key] = true
+		t.Run(key, func(t *testing.T) {
+			target := api.Prefix + test.path + "?" + strings.ReplaceAll(test.query, "{job}", jobID)
+			if test.path == api.JobResultPath {
+				waitForJob(t, router, jobID)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(test.method, target, strings.NewReader(test.body)))
+
+			status := test.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if response.Code != status {
+				t.Fatalf("status = %v, want %v, body %s", response.Code, status, response.Body.Bytes())
+			}
+			contentType, _, err := mime.ParseMediaType(response.Header().Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("Content-Type %q: %v", response.Header().Get("Content-Type"), err)
+			}
+			schemaMethod, schemaPath := test.method, test.path
+			if test.schemaPath != "" {
+				schemaMethod, schemaPath = test.schemaMethod, test.schemaPath
+			}
+			schema := responseSchema(document, schemaMethod, schemaPath, status, contentType)
+			if schema == nil {
+				t.Fatalf("document has no %v response with %v", status, contentType)
+			}
+			if contentType != api.JSONContentType {
+				return
+			}
+
+			decoder := json.NewDecoder(response.Body)
+			decoder.UseNumber()
+			var body interface{}
+			if err = decoder.Decode(&body); err != nil {
+				t.Fatalf("can't decode response: %v", err)
+			}
+			for _, schemaErr := range schemaErrors(components, schema, body, "$") {
+				t.Errorf("response doesn't match the schema: %v", schemaErr)
+			}
+			if test.path == api.JobsPath && test.method == http.MethodPost {
+				jobID, _ = lookup(body, "id").(string)
+			}
+		})
+	}
+
+	for _, endpoint := range api.Endpoints {
+		if key := endpointKey(endpoint.Method, endpoint.Path); !tested[key] {
+			t.Errorf("endpoint %v isn't tested", key)
+		}
+	}
+}
+
+// waitForJob polls the status of job id until it is finished
+func waitForJob(t *testing.T, router http.Handler, id string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, api.Prefix+api.JobsPath+"?id="+url.QueryEscape(id), nil))
+		var job models.AnalysisJob
+		if err := json.Unmarshal(response.Body.Bytes(), &job); err != nil {
+			t.Fatalf("can't decode job: %v", err)
+		}
+		if job.Status != jobs.Queued && job.Status != jobs.Running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %v isn't finished in 10 seconds", id)
+}
+
+func TestAuthorization(t *testing.T) {
+	keys := auth.APIKeys{}
+	for _, key := range []auth.APIKey{
+		{Name: "admin", Role: auth.AdminRole},
+		{Name: "staff", Role: auth.CourseStaffRole, Courses: []string{testCourseID}},
+		{Name: "all-staff", Role: auth.CourseStaffRole, Courses: []string{auth.AllCourses}},
+		{Name: "researcher", Role: auth.ResearcherRole, Courses: []string{testCourseID}},
+	} {
+		hash := sha256.Sum256([]byte(key.Name + "-key"))
+		key.SHA256 = hex.EncodeToString(hash[:])
+		keys.Keys = append(keys.Keys, key)
+	}
+	router := newTestRouter(t, newTestStore(t), auth.New(keys, nil))
+	course, otherCourse := url.QueryEscape(testCourseID), url.QueryEscape("course-v1:org+C2+2020")
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		target string
+		status int
+	}{
+		{"without key", "", http.MethodGet, api.ProblemsPath + "?course=" + course, http.StatusUnauthorized},
+		{"wrong key", "wrong-key", http.MethodGet, api.ProblemsPath + "?course=" + course, http.StatusUnauthorized},
+		{"researcher reads aggregates", "researcher-key", http.MethodGet, api.ProblemsPath + "?course=" + course, http.StatusOK},
+		{"researcher reads routes", "researcher-key", http.MethodGet, api.CourseRoutesPath + "?course=" + course, http.StatusForbidden},
+		{"researcher reads timeline", "researcher-key", http.MethodGet, api.UserTimelinePath + "?course=" + course + "&username=alice", http.StatusForbidden},
+		{"researcher exports events", "researcher-key", http.MethodGet, api.ParquetExportPath + "?course=" + course, http.StatusForbidden},
+		{"researcher submits routes job", "researcher-key", http.MethodPost, api.JobsPath + "?analysis=course-routes&course=" + course, http.StatusForbidden},
+		{"researcher reads other course", "researcher-key", http.MethodGet, api.ProblemsPath + "?course=" + otherCourse, http.StatusForbidden},
+		{"staff reads routes", "staff-key", http.MethodGet, api.CourseRoutesPath + "?course=" + course, http.StatusOK},
+		{"staff reads other course", "staff-key", http.MethodGet, api.CourseRoutesPath + "?course=" + otherCourse, http.StatusForbidden},
+		{"staff submits job of other course", "staff-key", http.MethodPost, api.JobsPath + "?analysis=problems&course=" + otherCourse, http.StatusForbidden},
+		{"staff exports every course", "staff-key", http.MethodGet, api.ParquetExportPath, http.StatusForbidden},
+		{"staff of all courses exports every course", "all-staff-key", http.MethodGet, api.ParquetExportPath, http.StatusOK},
+		{"staff of all courses reads other course", "all-staff-key", http.MethodGet, api.ProblemsPath + "?course=" + otherCourse, http.StatusOK},
+		{"admin reads other course", "admin-key", http.MethodGet, api.ProblemsPath + "?course=" + otherCourse, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, api.Prefix+test.target, nil)
+			if test.key != "" {
+				r.Header.Set(api.APIKeyHeader, test.key)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, r)
+			if response.Code != test.status {
+				t.Fatalf("status = %v, want %v, body %s", response.Code, test.status, response.Body.Bytes())
+			}
+			if test.status == http.StatusForbidden && lookup(decodeJSON(t, response.Body.Bytes()), "error", "code") != "forbidden" {
+				t.Errorf("body = %s, want forbidden error", response.Body.Bytes())
+			}
+		})
+	}
+}
+
+func decodeJSON(t *testing.T, b []byte) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		t.Fatalf("can't decode response: %v", err)
+	}
+	return value
+}
@@ -0,0 +1,380 @@
+package main
+
+// Charts of analyses rendered as SVG or PNG for reports and papers. Chart endpoints take
+// the filters of their analyses and "format", "width", "height", "theme" and "scale"
+// parameters. Renders are cached by the request, the courses and identities the caller
+// can read and the data watermark of the event store, like job results.
+
+import (
+	"context"
+	"fmt"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"kafka-log-processor/pkg/charts"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/pseudonymization"
+	"kafka-log-processor/pkg/rollups"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chartOptions are the size and theme of a chart, zero size is the default size of the chart
+type chartOptions struct {
+	Width  int
+	Height int
+	Theme  charts.Theme
+}
+
+// chartBuilder returns chart of request r
+type chartBuilder func(r *http.Request, options chartOptions) (charts.Chart, error)
+
+// chartHandle serves charts made by build as SVG or PNG, files are named after name and the course of the request
+func chartHandle(name string, cache *charts.Cache, watermarks *database.DataWatermarks, build chartBuilder) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		format := responseFormat(r, api.SVGFormat, api.PNGFormat)
+		options := chartOptions{Theme: charts.Themes[r.URL.Query().Get("theme")]}
+		var err error
+		if options.Width, err = positiveIntParam(r, "width", 0, 4000); err != nil {
+			return err
+		}
+		if options.Height, err = positiveIntParam(r, "height", 0, 4000); err != nil {
+			return err
+		}
+		scale, err := positiveIntParam(r, "scale", 2, 4)
+		if err != nil {
+			return err
+		}
+
+		watermark, err := watermarks.Get(r.Context())
+		if err != nil {
+			return err
+		}
+		params := r.URL.Query()
+		params.Set("format", format)
+		key := fmt.Sprintf("%v?%v access=%v data=%v", name, params.Encode(), accessScope(auth.FromContext(r.Context())), watermark)
+		render, cached := cache.Get(key)
+		if !cached {
+			chart, err := build(r, options)
+			if err != nil {
+				return err
+			}
+			if format == api.PNGFormat {
+				if render, err = chart.PNG(scale); err != nil {
+					return err
+				}
+			} else {
+				render = []byte(chart.SVG())
+			}
+			cache.Add(key, render)
+		}
+
+		if courseCode, err := models.GetCourseCodeFromCourseID(r.URL.Query().Get("course")); err == nil {
+			name += "-" + courseCode
+		}
+		w.Header().Set("Content-Type", api.FormatContentTypes[format])
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name + "." + format}))
+		_, err = w.Write(render)
+		return err
+	}
+}
+
+// videoWatchingsChart builds watching curve chart of video "video_id"
+func videoWatchingsChart(analysis analysers.Analyser, es database.EventStore, identities *pseudonymization.Identities) chartBuilder {
+	return func(r *http.Request, options chartOptions) (charts.Chart, error) {
+		videoID, err := requiredParam(r, "video_id")
+		if err != nil {
+			return nil, err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return nil, err
+		}
+		if err = authorizeVideo(r, es, videoID); err != nil {
+			return nil, err
+		}
+		curve, err := analysis.GetAnalyseUserVideoWatchings(r.Context(), videoID, filter)
+		if err != nil {
+			return nil, err
+		}
+		return watchingCurveChart(*curve, videoName(r.Context(), analysis, es, videoID), options), nil
+	}
+}
+
+// courseActivityChart builds heatmap of activity "measure" of the course blocks
+func courseActivityChart(analysis analysers.Analyser, identities *pseudonymization.Identities) chartBuilder {
+	return func(r *http.Request, options chartOptions) (charts.Chart, error) {
+		course, err := courseParam(r)
+		if err != nil {
+			return nil, err
+		}
+		granularity, err := granularityParam(r)
+		if err != nil {
+			return nil, err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return nil, err
+		}
+		activity, err := analysis.GetCourseActivity(r.Context(), course, granularity, filter)
+		if err != nil {
+			return nil, err
+		}
+		structureIndex, err := analysis.GetCourseStructureIndex(r.Context(), course)
+		if err != nil {
+			log.Printf("WARN: blocks of course %v will be named by their ids in the chart: %v\n", course, err)
+		}
+		return activityHeatmap(*activity, stringParam(r, "measure", "active_learners"), structureIndex, options), nil
+	}
+}
+
+// courseRoutesChart builds histogram of route "metric" of the course learners
+func courseRoutesChart(analysis analysers.Analyser, identities *pseudonymization.Identities) chartBuilder {
+	return func(r *http.Request, options chartOptions) (charts.Chart, error) {
+		course, err := courseParam(r)
+		if err != nil {
+			return nil, err
+		}
+		bins, err := positiveIntParam(r, "bins", 10, 100)
+		if err != nil {
+			return nil, err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return nil, err
+		}
+		routes, err := analysis.GetCourseUsersRoute(r.Context(), course, filter)
+		if err != nil {
+			return nil, err
+		}
+		metric := stringParam(r, "metric", "linearity_score")
+		histogram := charts.Histogram{
+			Title:  humanize(metric) + " of learners",
+			XLabel: humanize(metric),
+			YLabel: "Learners",
+			Bins:   bins,
+			Width:  options.Width,
+			Height: options.Height,
+			Theme:  options.Theme,
+		}
+		for _, route := range routes {
+			histogram.Values = append(histogram.Values, routeMetric(route, metric))
+		}
+		return histogram, nil
+	}
+}
+
+// problemsChart builds bar chart of "metric" of the course problems
+func problemsChart(analysis analysers.Analyser, identities *pseudonymization.Identities) chartBuilder {
+	return func(r *http.Request, options chartOptions) (charts.Chart, error) {
+		course, err := courseParam(r)
+		if err != nil {
+			return nil, err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return nil, err
+		}
+		report, err := analysis.GetCourseProblemsReport(r.Context(), course, filter)
+		if err != nil {
+			return nil, err
+		}
+		return problemsBarChart(*report, stringParam(r, "metric", "mean_score"), options), nil
+	}
+}
+
+// watchingCurveChart returns line chart of the watching curve of the video named title
+func watchingCurveChart(curve models.CurveFloatToInt, title string, options chartOptions) charts.LineChart {
+	return charts.LineChart{
+		Title:   title,
+		XLabel:  "Video time",
+		YLabel:  "Watchers",
+		Series:  []charts.Series{charts.CurveFloatToIntSeries("Watchers", curve)},
+		Width:   options.Width,
+		Height:  options.Height,
+		Theme:   options.Theme,
+		FormatX: videoTime,
+	}
+}
+
+// problemsBarChart returns bar chart of metric of every problem of the report, see api.ProblemMetrics
+func problemsBarChart(report models.ProblemsReport, metric string, options chartOptions) charts.BarChart {
+	chart := charts.BarChart{Width: options.Width, Theme: options.Theme, Max: 1, FormatValue: percent}
+	switch metric {
+	case "mean_attempts":
+		chart.Title, chart.XLabel = "Mean attempts of learners", "Submissions per learner"
+		chart.Max, chart.FormatValue = 0, func(value float64) string { return strconv.FormatFloat(value, 'f', 2, 64) }
+	case "solved_share":
+		chart.Title, chart.XLabel = "Learners who solved the problem", "Share of the learners who submitted it"
+	case "first_attempt_solved_share":
+		chart.Title, chart.XLabel = "Learners who solved the problem at the first attempt", "Share of the learners who submitted it"
+	default:
+		chart.Title, chart.XLabel = "Mean score of submissions", "Share of the possible score"
+	}
+	for _, problem := range report.Problems {
+		label := problem.DisplayName
+		if label == "" {
+			label = problem.ProblemID
+		}
+		value := problem.MeanScore
+		switch metric {
+		case "mean_attempts":
+			value = problem.MeanAttempts
+		case "solved_share":
+			value = float64(problem.SolvedLearners) / float64(problem.Learners)
+		case "first_attempt_solved_share":
+			value = float64(problem.FirstAttemptSolvedLearners) / float64(problem.Learners)
+		}
+		chart.Labels, chart.Values = append(chart.Labels, label), append(chart.Values, value)
+	}
+	return chart
+}
+
+// activityHeatmap returns heatmap of measure of the blocks by periods, see api.ActivityMeasures.
+// Blocks are named by their display names and sorted in the course order.
+func activityHeatmap(activity models.CourseActivity, measure string, structureIndex models.CourseStructureIndex, options chartOptions) charts.Heatmap {
+	periodFormat, periodName := "Jan 2", "Date"
+	if activity.Granularity == rollups.HourGranularity {
+		periodFormat, periodName = "Jan 2 15:04", "Hour"
+	}
+	heatmap := charts.Heatmap{
+		Title:       humanize(measure) + " by block",
+		XLabel:      periodName,
+		Width:       options.Width,
+		Height:      options.Height,
+		Theme:       options.Theme,
+		FormatValue: func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) },
+	}
+	if measure == "mean_score" {
+		heatmap.FormatValue = percent
+	}
+
+	periods, blocks := []time.Time{}, []string{}
+	periodColumns, blockRows := map[time.Time]int{}, map[string]int{}
+	for _, blockActivity := range activity.Blocks {
+		if _, ok := periodColumns[blockActivity.Date]; !ok {
+			periodColumns[blockActivity.Date] = 0
+			periods = append(periods, blockActivity.Date)
+		}
+		if _, ok := blockRows[blockActivity.BlockID]; !ok {
+			blockRows[blockActivity.BlockID] = 0
+			blocks = append(blocks, blockActivity.BlockID)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Before(periods[j]) })
+	sort.Slice(blocks, func(i, j int) bool {
+		left, leftFound := structureIndex.Position(blocks[i])
+		right, rightFound := structureIndex.Position(blocks[j])
+		if leftFound != rightFound {
+			return leftFound
+		}
+		return left < right || left == right && blocks[i] < blocks[j]
+	})
+	for column, period := range periods {
+		periodColumns[period] = column
+		heatmap.ColumnLabels = append(heatmap.ColumnLabels, period.UTC().Format(periodFormat))
+	}
+	for row, blockID := range blocks {
+		blockRows[blockID] = row
+		name, ok := structureIndex.DisplayName(blockID)
+		if !ok || name == "" {
+			name = blockID
+		}
+		heatmap.RowLabels = append(heatmap.RowLabels, name)
+		heatmap.Values = append(heatmap.Values, make([]float64, len(periods)))
+	}
+	for _, blockActivity := range activity.Blocks {
+		heatmap.Values[blockRows[blockActivity.BlockID]][periodColumns[blockActivity.Date]] = activityMeasure(blockActivity, measure)
+	}
+	return heatmap
+}
+
+func activityMeasure(activity models.BlockActivity, measure string) float64 {
+	switch measure {
+	case "video_plays":
+		return float64(activity.VideoPlays)
+	case "watch_seconds":
+		return activity.WatchSeconds
+	case "submissions":
+		return float64(activity.Submissions)
+	case "mean_score":
+		return activity.MeanScore
+	case "bookmarks_added":
+		return float64(activity.BookmarksAdded)
+	case "bookmarks_removed":
+		return float64(activity.BookmarksRemoved)
+	case "link_clicks":
+		return float64(activity.LinkClicks)
+	}
+	return float64(activity.ActiveLearners)
+}
+
+func routeMetric(route models.UserRoute, metric string) float64 {
+	switch metric {
+	case "backward_jumps":
+		return float64(route.BackwardJumps)
+	case "revisits":
+		return float64(route.Revisits)
+	case "farthest_position":
+		return float64(route.FarthestPosition)
+	case "steps":
+		return float64(len(route.Steps))
+	}
+	return route.LinearityScore
+}
+
+// videoName returns display name of the video in the structure of a course with its events, videoID if there is none
+func videoName(ctx context.Context, analysis analysers.Analyser, es database.EventStore, videoID string) string {
+	courseIDs, err := es.GetUniqueStringFieldValuesInIndexWithFilter(ctx, database.VideoEventDescriptionIndexName, "course_id", "video_id", videoID)
+	if err != nil {
+		log.Printf("WARN: can't get courses of video %v to name it: %v\n", videoID, err)
+		return videoID
+	}
+	for _, courseID := range courseIDs {
+		structureIndex, err := analysis.GetCourseStructureIndex(ctx, courseID)
+		if err != nil {
+			continue
+		}
+		if name, ok := structureIndex.DisplayName(videoID); ok && name != "" {
+			return name
+		}
+	}
+	return videoID
+}
+
+// stringParam returns query parameter name or defaultValue if it is missing
+func stringParam(r *http.Request, name string, defaultValue string) string {
+	if value := r.URL.Query().Get(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// humanize turns parameter value like "active_learners" into "Active learners"
+func humanize(value string) string {
+	value = strings.ReplaceAll(value, "_", " ")
+	if value == "" {
+		return value
+	}
+	return strings.ToUpper(value[:1]) + value[1:]
+}
+
+func percent(share float64) string {
+	if math.IsNaN(share) {
+		return "-"
+	}
+	return strconv.FormatFloat(share*100, 'f', 1, 64) + "%"
+}
+
+// videoTime formats video seconds as minutes and seconds
+func videoTime(seconds float64) string {
+	duration := time.Duration(seconds) * time.Second
+	return fmt.Sprintf("%d:%02d", int(duration.Minutes()), int(duration.Seconds())%60)
+}
@@ -0,0 +1,550 @@
+package main
+
+// Dashboard is a set of HTML pages for course authors: courses, activity and problem
+// statistics of a course, video watching curves and learner routes. Pages are rendered
+// from embedded templates with SVG charts and need no scripts. Browsers log in with an
+// API key or a JWT once, the server keeps its principal in a short-lived session and the
+// HttpOnly cookie of the dashboard path keeps only the random session id.
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"kafka-log-processor/pkg/charts"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/pseudonymization"
+	"kafka-log-processor/pkg/rollups"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dashboardPath = "/dashboard/"
+
+// sessionCookie keeps the id of the dashboard session of the browser
+const sessionCookie = "edxlyser_session"
+
+// Kinds of credentials of the login form
+const (
+	apiKeyCredentials      = "key"
+	bearerTokenCredentials = "token"
+)
+
+// maxRouteSeries is the number of learners drawn in the routes chart
+const maxRouteSeries = 50
+
+// dashboardFilterParams are the filter parameters kept in the links between pages
+var dashboardFilterParams = []string{"from", "to", "platforms", "enrollment_modes"}
+
+//go:embed templates
+var templatesFS embed.FS
+
+var templateFuncs = template.FuncMap{
+	"percent": percent,
+	"decimal": func(value float64) string { return strconv.FormatFloat(value, 'f', 2, 64) },
+}
+
+// dashboardHandler handles dashboard request, errors are rendered as the error page
+type dashboardHandler func(w http.ResponseWriter, r *http.Request) error
+
+type dashboard struct {
+	analysis      analysers.Analyser
+	es            database.EventStore
+	identities    *pseudonymization.Identities
+	authenticator *auth.Authenticator
+	sessions      *sessionStore
+	secureCookies bool
+	pages         map[string]*template.Template
+}
+
+// newDashboard returns handler of the dashboard pages under dashboardPath.
+// Pages show only the courses the logged in principal can read.
+func newDashboard(analysis analysers.Analyser, es database.EventStore, identities *pseudonymization.Identities, authenticator *auth.Authenticator, sessions *sessionStore, secureCookies bool) (http.Handler, error) {
+	d := &dashboard{
+		analysis:      analysis,
+		es:            es,
+		identities:    identities,
+		authenticator: authenticator,
+		sessions:      sessions,
+		secureCookies: secureCookies,
+		pages:         map[string]*template.Template{},
+	}
+	for _, name := range []string{"index", "course", "video", "routes", "login", "error"} {
+		page, err := template.New(name).Funcs(templateFuncs).ParseFS(templatesFS, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("can't parse dashboard template %v: %w", name, err)
+		}
+		d.pages[name] = page
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(dashboardPath, d.serve(d.authenticated(d.index)))
+	mux.Handle(dashboardPath+"course", d.serve(d.authenticated(d.course)))
+	mux.Handle(dashboardPath+"video", d.serve(d.authenticated(d.video)))
+	mux.Handle(dashboardPath+"routes", d.serve(d.authenticated(d.routes)))
+	mux.Handle(dashboardPath+"login", d.serve(d.login))
+	mux.Handle(dashboardPath+"logout", d.serve(d.logout))
+	return mux, nil
+}
+
+// pageData is the data of the layout, Page is the data of the page template
+type pageData struct {
+	Title    string
+	Subject  string
+	LoggedIn bool
+	Page     interface{}
+}
+
+// filterForm is the filter form of a page, Hidden are the other parameters of the page
+type filterForm struct {
+	Hidden          map[string]string
+	From            string
+	To              string
+	Platforms       string
+	EnrollmentModes string
+}
+
+type link struct {
+	Name string
+	URL  string
+}
+
+type coursePage struct {
+	Course        string
+	Filter        filterForm
+	ActivityChart template.HTML
+	EventsChart   template.HTML
+	ProblemsChart template.HTML
+	Problems      []models.ProblemStatistics
+	Videos        []link
+	RoutesURL     string
+}
+
+type videoPage struct {
+	CourseURL   string
+	Filter      filterForm
+	CurveChart  template.HTML
+	MaxWatchers int
+}
+
+type routesPage struct {
+	CourseURL   string
+	Filter      filterForm
+	RoutesChart template.HTML
+	Routes      []models.UserRoute
+	Drawn       int
+}
+
+type loginPage struct {
+	Message string
+}
+
+type errorPage struct {
+	Status  int
+	Message string
+}
+
+// index lists the courses of the principal
+func (d *dashboard) index(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != dashboardPath {
+		return &api.Error{Status: http.StatusNotFound, Code: "not_found", Message: "Unknown dashboard page " + r.URL.Path}
+	}
+	courseIDs, err := d.es.GetAllCourseIDsWithStructureAndLogs(r.Context())
+	if err != nil {
+		return err
+	}
+	principal := auth.FromContext(r.Context())
+	courses := []link{}
+	for _, courseID := range courseIDs {
+		if principal.CanAccessCourse(courseID) {
+			courses = append(courses, link{Name: courseID, URL: pageURL("course", url.Values{"course": {courseID}})})
+		}
+	}
+	return d.render(w, r, http.StatusOK, "index", "Courses", courses)
+}
+
+// course shows daily activity, problem statistics and videos of the course
+func (d *dashboard) course(w http.ResponseWriter, r *http.Request) error {
+	course, filter, err := d.courseFilter(r)
+	if err != nil {
+		return err
+	}
+	structureIndex, err := d.analysis.GetCourseStructureIndex(r.Context(), course)
+	if err != nil {
+		log.Printf("WARN: dashboard of course %v will show block ids instead of names: %v\n", course, err)
+	}
+
+	activity, err := d.analysis.GetCourseActivity(r.Context(), course, rollups.DayGranularity, filter)
+	if err != nil {
+		return err
+	}
+	learners, events := activitySeries(activity.Course)
+	dates := dateFormat(activity.Course)
+	page := coursePage{
+		Course: course,
+		Filter: newFilterForm(r, "course"),
+		ActivityChart: template.HTML(charts.LineChart{
+			Title: "Active learners", XLabel: "Date", YLabel: "Learners", Series: learners, FormatX: dates,
+		}.SVG()),
+		EventsChart: template.HTML(charts.LineChart{
+			Title: "Video plays and submissions", XLabel: "Date", YLabel: "Events", Series: events, FormatX: dates,
+		}.SVG()),
+	}
+
+	problems, err := d.analysis.GetCourseProblemsReport(r.Context(), course, filter)
+	if err != nil {
+		return err
+	}
+	page.ProblemsChart = template.HTML(problemsBarChart(*problems, "mean_score", chartOptions{}).SVG())
+	page.Problems = problems.Problems
+	for i, problem := range page.Problems {
+		if problem.DisplayName == "" {
+			page.Problems[i].DisplayName = problem.ProblemID
+		}
+	}
+
+	videoIDs, err := d.es.GetUniqueStringFieldValuesInIndexWithFilter(r.Context(), database.VideoEventDescriptionIndexName, "video_id", "course_id", course)
+	if err != nil {
+		return fmt.Errorf("can't get unique videos for course: %w", err)
+	}
+	sort.Slice(videoIDs, func(i, j int) bool {
+		left, _ := structureIndex.Position(videoIDs[i])
+		right, _ := structureIndex.Position(videoIDs[j])
+		return left < right || left == right && videoIDs[i] < videoIDs[j]
+	})
+	for _, videoID := range videoIDs {
+		name, ok := structureIndex.DisplayName(videoID)
+		if !ok || name == "" {
+			name = videoID
+		}
+		page.Videos = append(page.Videos, link{Name: name, URL: pageURL("video", withFilterValues(r, url.Values{"course": {course}, "video_id": {videoID}}))})
+	}
+	if auth.FromContext(r.Context()).CanSeeIdentities() {
+		page.RoutesURL = pageURL("routes", withFilterValues(r, url.Values{"course": {course}}))
+	}
+	return d.render(w, r, http.StatusOK, "course", course, page)
+}
+
+// video shows the watching curve of the video
+func (d *dashboard) video(w http.ResponseWriter, r *http.Request) error {
+	course, filter, err := d.courseFilter(r)
+	if err != nil {
+		return err
+	}
+	videoID, err := requiredParam(r, "video_id")
+	if err != nil {
+		return err
+	}
+	if err = authorizeVideo(r, d.es, videoID); err != nil {
+		return err
+	}
+	curve, err := d.analysis.GetAnalyseUserVideoWatchings(r.Context(), videoID, filter)
+	if err != nil {
+		return err
+	}
+
+	page := videoPage{
+		CourseURL:  pageURL("course", withFilterValues(r, url.Values{"course": {course}})),
+		Filter:     newFilterForm(r, "course", "video_id"),
+		CurveChart: template.HTML(watchingCurveChart(*curve, "Watching curve", chartOptions{}).SVG()),
+	}
+	for _, y := range curve.Y {
+		if y > page.MaxWatchers {
+			page.MaxWatchers = y
+		}
+	}
+	title := videoID
+	if names := displayNames(r.Context(), d.analysis, course); names != nil {
+		if name, ok := names(videoID); ok && name != "" {
+			title = name
+		}
+	}
+	return d.render(w, r, http.StatusOK, "video", title, page)
+}
+
+// routes shows positions of learners in the course structure step by step
+func (d *dashboard) routes(w http.ResponseWriter, r *http.Request) error {
+	if principal := auth.FromContext(r.Context()); !principal.CanSeeIdentities() {
+		return forbidden("Role %v can't read learner usernames", principal.Role)
+	}
+	course, filter, err := d.courseFilter(r)
+	if err != nil {
+		return err
+	}
+	routes, err := d.analysis.GetCourseUsersRoute(r.Context(), course, filter)
+	if err != nil {
+		return err
+	}
+
+	page := routesPage{CourseURL: pageURL("course", withFilterValues(r, url.Values{"course": {course}})), Filter: newFilterForm(r, "course"), Routes: routes}
+	chart := charts.LineChart{Title: "Learner routes", XLabel: "Step", YLabel: "Position in the course", Opacity: 0.6}
+	for i := range routes {
+		if routes[i].Username, err = d.identities.Presented(routes[i].Username); err != nil {
+			return err
+		}
+		if i >= maxRouteSeries {
+			continue
+		}
+		series := charts.Series{Name: routes[i].Username}
+		for step, routeStep := range routes[i].Steps {
+			series.X = append(series.X, float64(step+1))
+			series.Y = append(series.Y, float64(routeStep.Position))
+		}
+		chart.Series = append(chart.Series, series)
+	}
+	page.Drawn = len(chart.Series)
+	page.RoutesChart = template.HTML(chart.SVG())
+	return d.render(w, r, http.StatusOK, "routes", "Learner routes of "+course, page)
+}
+
+// login shows the login form and starts a session for valid credentials
+func (d *dashboard) login(w http.ResponseWriter, r *http.Request) error {
+	if d.authenticator == nil {
+		http.Redirect(w, r, dashboardPath, http.StatusSeeOther)
+		return nil
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return d.render(w, r, http.StatusOK, "login", "Log in", loginPage{})
+	case http.MethodPost:
+	default:
+		return methodNotAllowed(r)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		return api.InvalidParameter("can't read the login form")
+	}
+	kind, credential := r.PostForm.Get("kind"), strings.TrimSpace(r.PostForm.Get("credential"))
+	if kind != apiKeyCredentials && kind != bearerTokenCredentials {
+		return api.InvalidParameter("kind should be %v or %v", apiKeyCredentials, bearerTokenCredentials)
+	}
+	credentialsRequest, err := http.NewRequestWithContext(r.Context(), http.MethodGet, dashboardPath, nil)
+	if err != nil {
+		return err
+	}
+	setCredentials(credentialsRequest, kind, credential)
+	principal, err := d.authenticator.Authenticate(credentialsRequest)
+	if err != nil {
+		return d.render(w, r, http.StatusUnauthorized, "login", "Log in", loginPage{Message: err.Error()})
+	}
+	now := time.Now()
+	sessionID, expires, err := d.sessions.create(principal, now)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sessionID,
+		Path:     dashboardPath,
+		Expires:  expires,
+		MaxAge:   int(expires.Sub(now).Seconds()),
+		HttpOnly: true,
+		Secure:   d.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, dashboardPath, http.StatusSeeOther)
+	return nil
+}
+
+// logout ends the session of the browser
+func (d *dashboard) logout(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return methodNotAllowed(r)
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		d.sessions.delete(cookie.Value)
+		d.clearSession(w)
+	}
+	http.Redirect(w, r, dashboardPath+"login", http.StatusSeeOther)
+	return nil
+}
+
+// authenticated calls handler of a page with the principal of the session in the context,
+// browsers without a valid session are sent to the login page
+func (d *dashboard) authenticated(handler dashboardHandler) dashboardHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return methodNotAllowed(r)
+		}
+		var principal *auth.Principal
+		cookie, cookieErr := r.Cookie(sessionCookie)
+		if cookieErr == nil {
+			principal, _ = d.sessions.get(cookie.Value, time.Now())
+		}
+		if principal == nil {
+			// requests without a session are authenticated by their headers, every request is
+			// authenticated when authentication is disabled
+			var err error
+			if principal, err = d.authenticator.Authenticate(r); err != nil {
+				if cookieErr == nil {
+					d.clearSession(w)
+				}
+				http.Redirect(w, r, dashboardPath+"login", http.StatusSeeOther)
+				return nil
+			}
+		}
+		if recorder, ok := w.(*statusRecorder); ok {
+			recorder.subject = principal.Subject
+		}
+		return handler(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	}
+}
+
+// serve renders errors of handler as the error page
+func (d *dashboard) serve(handler dashboardHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := handler(w, r)
+		if err == nil {
+			return
+		}
+		requestID := requestIDFrom(r.Context())
+		if errors.Is(err, context.Canceled) {
+			log.Printf("request %v is canceled by the client\n", requestID)
+			return
+		}
+		response := apiError(err)
+		if response.Status == http.StatusInternalServerError {
+			log.Printf("Error! request %v failed: %v\n", requestID, err)
+		}
+		if recorder, ok := w.(*statusRecorder); ok && recorder.status != 0 {
+			return
+		}
+		if err = d.render(w, r, response.Status, "error", http.StatusText(response.Status), errorPage{Status: response.Status, Message: response.Message}); err != nil {
+			log.Printf("Error! request %v can't render error page: %v\n", requestID, err)
+		}
+	})
+}
+
+// render sends page template name. Pages aren't cached and can't be framed.
+func (d *dashboard) render(w http.ResponseWriter, r *http.Request, status int, name string, title string, page interface{}) error {
+	data := pageData{Title: title, Page: page}
+	if principal := auth.FromContext(r.Context()); principal != nil && d.authenticator != nil {
+		data.Subject, data.LoggedIn = principal.Subject, true
+	}
+	var buffer bytes.Buffer
+	if err := d.pages[name].ExecuteTemplate(&buffer, "layout", data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// courseFilter returns the course of the page, which the principal must be able to read, and the filter of the page
+func (d *dashboard) courseFilter(r *http.Request) (string, models.Filter, error) {
+	course, err := courseParam(r)
+	if err != nil {
+		return "", models.Filter{}, err
+	}
+	if principal := auth.FromContext(r.Context()); !principal.CanAccessCourse(course) {
+		return "", models.Filter{}, forbidden("%v can't read course %v", principal.Subject, course)
+	}
+	if invalid := api.ValidateParams(filterParamsOf(api.CourseActivityPath), r.URL.Query()); invalid != nil {
+		return "", models.Filter{}, invalid
+	}
+	filter, err := filterParams(r, d.identities)
+	return course, filter, err
+}
+
+// filterParamsOf returns the filter parameters of the endpoint
+func filterParamsOf(path string) []api.Param {
+	endpoint, _ := findEndpoint(http.MethodGet, path)
+	var params []api.Param
+	for _, param := range endpoint.Params {
+		for _, name := range dashboardFilterParams {
+			if param.Name == name {
+				params = append(params, param)
+			}
+		}
+	}
+	return params
+}
+
+func newFilterForm(r *http.Request, hidden ...string) filterForm {
+	query := r.URL.Query()
+	form := filterForm{
+		Hidden:          map[string]string{},
+		From:            query.Get("from"),
+		To:              query.Get("to"),
+		Platforms:       query.Get("platforms"),
+		EnrollmentModes: query.Get("enrollment_modes"),
+	}
+	for _, name := range hidden {
+		form.Hidden[name] = query.Get(name)
+	}
+	return form
+}
+
+// withFilterValues adds the filter parameters of r to params
+func withFilterValues(r *http.Request, params url.Values) url.Values {
+	for _, name := range dashboardFilterParams {
+		if value := r.URL.Query().Get(name); value != "" {
+			params.Set(name, value)
+		}
+	}
+	return params
+}
+
+func pageURL(page string, params url.Values) string {
+	return dashboardPath + page + "?" + params.Encode()
+}
+
+// activitySeries returns series of active learners and of video plays and submissions by days since the first day
+func activitySeries(days []models.BlockActivity) ([]charts.Series, []charts.Series) {
+	learners := charts.Series{Name: "Active learners"}
+	plays, submissions := charts.Series{Name: "Video plays"}, charts.Series{Name: "Submissions"}
+	for _, day := range days {
+		x := math.Round(day.Date.Sub(days[0].Date).Hours() / 24)
+		learners.X, learners.Y = append(learners.X, x), append(learners.Y, float64(day.ActiveLearners))
+		plays.X, plays.Y = append(plays.X, x), append(plays.Y, float64(day.VideoPlays))
+		submissions.X, submissions.Y = append(submissions.X, x), append(submissions.Y, float64(day.Submissions))
+	}
+	return []charts.Series{learners}, []charts.Series{plays, submissions}
+}
+
+// dateFormat formats days since the first day of days as dates
+func dateFormat(days []models.BlockActivity) func(float64) string {
+	return func(x float64) string {
+		if len(days) == 0 || x != math.Trunc(x) {
+			return ""
+		}
+		return days[0].Date.AddDate(0, 0, int(x)).UTC().Format("Jan 2")
+	}
+}
+
+func setCredentials(r *http.Request, kind string, credential string) {
+	switch kind {
+	case apiKeyCredentials:
+		r.Header.Set(api.APIKeyHeader, credential)
+		r.Header.Del("Authorization")
+	case bearerTokenCredentials:
+		r.Header.Set("Authorization", "Bearer "+credential)
+		r.Header.Del(api.APIKeyHeader)
+	}
+}
+
+// clearSession removes the session cookie of the browser
+func (d *dashboard) clearSession(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: dashboardPath, MaxAge: -1, HttpOnly: true, Secure: d.secureCookies, SameSite: http.SameSiteStrictMode})
+}
+
+func methodNotAllowed(r *http.Request) *api.Error {
+	return &api.Error{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "Method " + r.Method + " is not allowed"}
+}
@@ -0,0 +1,94 @@
+package main
+
+// Analysis responses as CSV and XLSX tables for spreadsheets and statistical packages.
+// The format is chosen by "format" parameter or, if it is missing, by Accept header;
+// JSON is sent when neither of them asks for a table format.
+
+import (
+	"context"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/tables"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// responseFormat returns format of the response to r: "format" parameter or the format
+// of the most preferred content type of Accept header among formats, the first of formats by default
+func responseFormat(r *http.Request, formats ...string) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	format, bestQuality := formats[0], 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		for _, candidate := range formats {
+			if mediaType == api.FormatContentTypes[candidate] && quality > bestQuality {
+				format, bestQuality = candidate, quality
+			}
+		}
+	}
+	return format
+}
+
+// writeResult sends value as JSON or, if the request asks for CSV or XLSX, tables made by tabulate.
+// CSV response is the table chosen by "table" parameter, the first one by default; XLSX response
+// has a sheet per table. Files are named after name and the course of the request.
+func writeResult(w http.ResponseWriter, r *http.Request, name string, value interface{}, tabulate func() []tables.Table) error {
+	format := responseFormat(r, api.JSONFormat, api.CSVFormat, api.XLSXFormat)
+	if format != api.CSVFormat && format != api.XLSXFormat {
+		return writeJSON(w, value)
+	}
+	if courseCode, err := models.GetCourseCodeFromCourseID(r.URL.Query().Get("course")); err == nil {
+		name += "-" + courseCode
+	}
+
+	resultTables := tabulate()
+	if format == api.XLSXFormat {
+		setAttachment(w, api.XLSXContentType, name+".xlsx")
+		return tables.WriteXLSX(w, resultTables)
+	}
+	table := resultTables[0]
+	if tableName := r.URL.Query().Get("table"); tableName != "" {
+		found := false
+		for _, resultTable := range resultTables {
+			if resultTable.Name == tableName {
+				table, found = resultTable, true
+			}
+		}
+		if !found {
+			return api.InvalidParameter("unknown table %v in table parameter", tableName)
+		}
+	}
+	if len(resultTables) > 1 {
+		name += "-" + table.Name
+	}
+	setAttachment(w, api.CSVContentType+"; charset=utf-8", name+".csv")
+	return tables.WriteCSV(w, table)
+}
+
+func setAttachment(w http.ResponseWriter, contentType string, fileName string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+}
+
+// displayNames returns display names of the course blocks, nil if the course has no structure
+func displayNames(ctx context.Context, analysis analysers.Analyser, course string) tables.DisplayNames {
+	structureIndex, err := analysis.GetCourseStructureIndex(ctx, course)
+	if err != nil {
+		log.Printf("WARN: can't name blocks of course %v in the table: %v\n", course, err)
+		return nil
+	}
+	return structureIndex.DisplayName
+}
@@ -0,0 +1,696 @@
+package main
+
+// GraphQL API of the analysis server. Object types of the course structure and of the events
+// are reflected from edxstruct and models structs, analyses of the blocks and learners are
+// their fields. Fields are resolved for all the objects of a query level at once, so analyses
+// run once per course of the request instead of once per block: activity and problems reports
+// are cached for the request, watching curves, routes and events are read for all the videos
+// and learners of a course together.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/graphql"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/pseudonymization"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+// graphQLMaxBodySize limits JSON bodies of POST requests
+const graphQLMaxBodySize = 1 << 20
+
+// graphQLCourse is a course of the request with its structure
+type graphQLCourse struct {
+	id        string
+	structure edxstruct.Course
+	index     models.CourseStructureIndex
+}
+
+// graphQLBlock is the course or a block of its structure, block is edxstruct.Course or a block struct
+type graphQLBlock struct {
+	course *graphQLCourse
+	block  interface{}
+}
+
+// id returns url_name of the block, the course id for the course
+func (b graphQLBlock) id() string {
+	if urlName := reflect.ValueOf(b.block).FieldByName("URLName"); urlName.IsValid() {
+		return urlName.String()
+	}
+	return b.course.id
+}
+
+// graphQLLearner is a learner of the course, username is the stored one
+type graphQLLearner struct {
+	course   *graphQLCourse
+	username string
+}
+
+// graphQLReports caches reports made for the request by course, analysis and arguments
+type graphQLReports map[string]interface{}
+
+type graphQLReportsKey struct{}
+
+// graphQLResolvers resolves fields of the schema with analyses
+type graphQLResolvers struct {
+	analysis   analysers.Analyser
+	es         database.EventStore
+	identities *pseudonymization.Identities
+}
+
+var (
+	// dateScalar values are checked and kept as strings, ends of date ranges are parsed by dateRange
+	dateScalar = graphql.NewScalar("Date", "Date in 2006-01-02 or RFC 3339 format.",
+		func(value interface{}) (interface{}, error) {
+			if date, ok := value.(time.Time); ok {
+				return date.Format(time.RFC3339), nil
+			}
+			return nil, fmt.Errorf("Date cannot represent value %v", value)
+		},
+		func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				if _, err := api.ParseDate(s); err == nil {
+					return s, nil
+				}
+			}
+			return nil, fmt.Errorf("Date cannot represent value %v, it should be in 2006-01-02 or RFC 3339 format", value)
+		})
+	granularityEnum = graphql.NewEnum("Granularity", "Period of activity buckets.", "DAY", "HOUR")
+	platformEnum    = graphql.NewEnum("Platform", "Platform the events came from.", "WEB", "MOBILE")
+	filterInput     = graphql.NewInputObject("Filter", "Selects events of analyses, the same as filter parameters of the REST API.",
+		&graphql.InputValue{Name: "from", Type: dateScalar, Description: "Only events since the date"},
+		&graphql.InputValue{Name: "to", Type: dateScalar, Description: "Only events until the date, 2006-01-02 date includes the whole day"},
+		&graphql.InputValue{Name: "usernames", Type: graphql.List(graphql.NonNull(graphql.String)), Description: "Only events of the learners, needs a role that can see learner usernames"},
+		&graphql.InputValue{Name: "enrollmentModes", Type: graphql.List(graphql.NonNull(graphql.String)), Description: "Only learners with the enrollment modes"},
+		&graphql.InputValue{Name: "platforms", Type: graphql.List(graphql.NonNull(platformEnum)), Description: "Only events of the platforms"},
+		&graphql.InputValue{Name: "minEvents", Type: graphql.Int, Description: "Only learners with at least so many events, from 1 to 1000000"},
+	)
+	filterArg      = &graphql.InputValue{Name: "filter", Type: filterInput}
+	granularityArg = &graphql.InputValue{Name: "granularity", Type: granularityEnum, DefaultValue: "DAY"}
+	eventArgs      = []*graphql.InputValue{
+		{Name: "from", Type: dateScalar, Description: "Only events since the date"},
+		{Name: "to", Type: dateScalar, Description: "Only events until the date, 2006-01-02 date includes the whole day"},
+		{Name: "platforms", Type: graphql.List(graphql.NonNull(platformEnum)), Description: "Only events of the platforms"},
+	}
+)
+
+// newGraphQLSchema returns schema of courses, their blocks, learners and events the caller can read.
+// Learners need a role that can see learner usernames.
+func newGraphQLSchema(analysis analysers.Analyser, es database.EventStore, identities *pseudonymization.Identities) (*graphql.Schema, error) {
+	resolvers := graphQLResolvers{analysis: analysis, es: es, identities: identities}
+	objects := graphql.NewObjects()
+
+	courseStruct := reflect.TypeOf(edxstruct.Course{})
+	chapterStruct := fieldItemType(courseStruct, "Chapters")
+	sequentialStruct := fieldItemType(chapterStruct, "Sequentials")
+	verticalStruct := fieldItemType(sequentialStruct, "Verticals")
+	videoStruct := fieldItemType(verticalStruct, "Videos")
+	problemStruct := fieldItemType(verticalStruct, "Problems")
+
+	courseType := objects.Object(edxstruct.Course{}, "Course with its structure and analyses")
+	chapterType := objects.Object(reflect.Zero(chapterStruct).Interface(), "Chapter of the course")
+	sequentialType := objects.Object(reflect.Zero(sequentialStruct).Interface(), "Sequential of the chapter")
+	verticalType := objects.Object(reflect.Zero(verticalStruct).Interface(), "Unit of the sequential")
+	videoType := objects.Object(reflect.Zero(videoStruct).Interface(), "Video of the unit")
+	problemType := objects.Object(reflect.Zero(problemStruct).Interface(), "Problem of the unit")
+
+	blockStructs := map[reflect.Type]bool{courseStruct: true, chapterStruct: true, sequentialStruct: true, verticalStruct: true, videoStruct: true, problemStruct: true}
+	blockTypes := []*graphql.Type{chapterType, sequentialType, verticalType, videoType, problemType}
+	for _, t := range append([]*graphql.Type{courseType}, blockTypes...) {
+		for _, field := range t.Fields {
+			field.Resolve = inCourse(field.Resolve, blockStructs)
+		}
+	}
+
+	courseActivityType := objects.Object(models.CourseActivity{}, "Activity of the course and its blocks by days or hours")
+	blockActivityType := objects.Object(models.BlockActivity{}, "Activity of the course or of a block in a period")
+	curveType := objects.Object(models.CurveFloatToInt{}, "Watching curve of the video: number of watchers y from second x")
+	problemStatisticsType := objects.Object(models.ProblemStatistics{}, "Statistics of problem submissions")
+	routeType := objects.Object(models.UserRoute{}, "Route of the learner through the course with its metrics")
+
+	learnerType := graphql.NewObject("Learner", "Learner of the course",
+		&graphql.Field{
+			Name: "username",
+			Type: graphql.NonNull(graphql.String),
+			Resolve: graphql.Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return identities.Presented(source.(graphQLLearner).username)
+			}),
+		},
+		&graphql.Field{
+			Name:        "route",
+			Description: "Route of the learner through the course",
+			Type:        graphql.NonNull(routeType),
+			Resolve:     resolvers.routes,
+		},
+	)
+	for _, family := range api.EventFamilies {
+		learnerType.AddFields(resolvers.eventsField(objects, family))
+	}
+
+	courseType.AddFields(
+		blockField("id", "Course id in \"course-v1:org+CourseCode+CourseRun\" format", graphql.NonNull(graphql.ID), nil,
+			func(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+				return block.course.id, nil
+			}),
+		blockField("activity", "Activity of the course and its blocks", graphql.NonNull(courseActivityType), []*graphql.InputValue{granularityArg, filterArg},
+			func(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+				return resolvers.courseActivity(ctx, block.course, args)
+			}),
+		blockField("videos", "Videos of the course in the course order", graphql.NonNull(graphql.List(graphql.NonNull(videoType))), nil,
+			func(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+				return courseBlocksOf(block.course, "Videos"), nil
+			}),
+		blockField("problems", "Problems of the course in the course order", graphql.NonNull(graphql.List(graphql.NonNull(problemType))), nil,
+			func(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+				return courseBlocksOf(block.course, "Problems"), nil
+			}),
+		blockField("learners", "Learners with events of the course selected by filter, needs a role that can see learner usernames",
+			graphql.NonNull(graphql.List(graphql.NonNull(learnerType))), []*graphql.InputValue{filterArg}, resolvers.learners),
+	)
+	for _, t := range blockTypes {
+		t.AddFields(
+			blockField("position", "Position of the block in the course order, null if it has no units", graphql.Int, nil,
+				func(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+					if position, ok := block.course.index.Position(block.id()); ok {
+						return position, nil
+					}
+					return nil, nil
+				}),
+			blockField("activity", "Activity of the block", graphql.NonNull(graphql.List(graphql.NonNull(blockActivityType))), []*graphql.InputValue{granularityArg, filterArg},
+				resolvers.blockActivity),
+		)
+	}
+	videoType.AddFields(&graphql.Field{
+		Name:        "watchingCurve",
+		Description: "Watching curve of the video in the course",
+		Type:        graphql.NonNull(curveType),
+		Args:        []*graphql.InputValue{filterArg},
+		Resolve:     resolvers.watchingCurves,
+	})
+	problemType.AddFields(blockField("statistics", "Statistics of the problem submissions, null if it has none", problemStatisticsType, []*graphql.InputValue{filterArg},
+		resolvers.problemStatistics))
+
+	queryType := graphql.NewObject("Query", "",
+		&graphql.Field{
+			Name:        "courses",
+			Description: "Courses with structures and logs the caller can read",
+			Type:        graphql.NonNull(graphql.List(graphql.NonNull(courseType))),
+			Resolve:     graphql.Resolve(resolvers.courses),
+		},
+		&graphql.Field{
+			Name:        "course",
+			Description: "Course by id, null if it has no structure",
+			Type:        courseType,
+			Args:        []*graphql.InputValue{{Name: "id", Type: graphql.NonNull(graphql.ID), Description: "Course id in \"course-v1:org+CourseCode+CourseRun\" format"}},
+			Resolve:     graphql.Resolve(resolvers.course),
+		},
+	)
+
+	schema, err := graphql.NewSchema(queryType)
+	if err != nil {
+		return nil, err
+	}
+	schema.PresentError = presentGraphQLError
+	return schema, nil
+}
+
+// GetGraphQLHandle executes GraphQL request of "query", "variables" and "operationName" parameters
+// or of JSON body. Responses without data are sent with 400.
+func GetGraphQLHandle(schema *graphql.Schema) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var request graphql.Request
+		if r.Method == http.MethodPost {
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, graphQLMaxBodySize))
+			decoder.UseNumber()
+			if err := decoder.Decode(&request); err != nil {
+				return api.InvalidParameter("request body should be a JSON object with query, variables and operationName: %v", err)
+			}
+		} else {
+			request.Query = r.URL.Query().Get("query")
+			request.OperationName = r.URL.Query().Get("operationName")
+			if variables := r.URL.Query().Get("variables"); variables != "" {
+				decoder := json.NewDecoder(strings.NewReader(variables))
+				decoder.UseNumber()
+				if err := decoder.Decode(&request.Variables); err != nil {
+					return api.InvalidParameter("variables parameter should be a JSON object")
+				}
+			}
+		}
+		if strings.TrimSpace(request.Query) == "" {
+			return api.InvalidParameter("query is required")
+		}
+
+		ctx := context.WithValue(r.Context(), graphQLReportsKey{}, graphQLReports{})
+		response := schema.Execute(ctx, request)
+		status := http.StatusOK
+		if response.Data == nil {
+			status = http.StatusBadRequest
+		}
+		return writeJSONStatus(w, status, response)
+	}
+}
+
+// presentGraphQLError returns field error of err the way REST API sends it, with its code and status
+func presentGraphQLError(ctx context.Context, err error) *graphql.Error {
+	response := apiError(err)
+	if response.Status == http.StatusInternalServerError && !errors.Is(err, context.Canceled) {
+		log.Printf("Error! request %v failed: %v\n", requestIDFrom(ctx), err)
+	}
+	return &graphql.Error{
+		Message:    response.Message,
+		Extensions: map[string]interface{}{"code": response.Code, "status": response.Status},
+	}
+}
+
+func (resolvers graphQLResolvers) courses(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+	courseIDs, err := resolvers.es.GetAllCourseIDsWithStructureAndLogs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	principal := auth.FromContext(ctx)
+	courses := make([]graphQLBlock, 0, len(courseIDs))
+	for _, courseID := range courseIDs {
+		if !principal.CanAccessCourse(courseID) {
+			continue
+		}
+		course, err := resolvers.loadCourse(ctx, courseID)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, graphQLBlock{course: course, block: course.structure})
+	}
+	return courses, nil
+}
+
+func (resolvers graphQLResolvers) course(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+	courseID := args["id"].(string)
+	if _, err := models.GetCourseCodeFromCourseID(courseID); err != nil {
+		return nil, api.InvalidParameter("id should have \"course-v1:org+CourseCode+CourseRun\" format")
+	}
+	if principal := auth.FromContext(ctx); !principal.CanAccessCourse(courseID) {
+		return nil, forbidden("%v can't read course %v", principal.Subject, courseID)
+	}
+	course, err := resolvers.loadCourse(ctx, courseID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return graphQLBlock{course: course, block: course.structure}, nil
+}
+
+// loadCourse returns course "course-v1:org+CourseCode+CourseRun" with its structure
+func (resolvers graphQLResolvers) loadCourse(ctx context.Context, courseID string) (*graphQLCourse, error) {
+	courseCode, err := models.GetCourseCodeFromCourseID(courseID)
+	if err != nil {
+		return nil, err
+	}
+	structure, err := resolvers.es.GetCourseStructure(ctx, courseCode)
+	if err != nil {
+		return nil, err
+	}
+	return &graphQLCourse{id: courseID, structure: structure, index: models.NewCourseStructureIndex(structure)}, nil
+}
+
+func (resolvers graphQLResolvers) learners(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+	if principal := auth.FromContext(ctx); !principal.CanSeeIdentities() {
+		return nil, forbidden("Role %v can't read learner usernames", principal.Role)
+	}
+	filter, err := resolvers.filter(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	usernames, err := resolvers.analysis.GetCourseLearners(ctx, block.course.id, filter)
+	if err != nil {
+		return nil, err
+	}
+	learners := make([]graphQLLearner, 0, len(usernames))
+	for _, username := range usernames {
+		learners = append(learners, graphQLLearner{course: block.course, username: username})
+	}
+	return learners, nil
+}
+
+// courseActivity returns activity report of the course, the report is made once per request
+func (resolvers graphQLResolvers) courseActivity(ctx context.Context, course *graphQLCourse, args map[string]interface{}) (*models.CourseActivity, error) {
+	granularity := strings.ToLower(args["granularity"].(string))
+	filter, err := resolvers.filter(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	report, err := cachedReport(ctx, fmt.Sprintf("activity %v %v %+v", course.id, granularity, filter), func() (interface{}, error) {
+		return resolvers.analysis.GetCourseActivity(ctx, course.id, granularity, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report.(*models.CourseActivity), nil
+}
+
+func (resolvers graphQLResolvers) blockActivity(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+	report, err := resolvers.courseActivity(ctx, block.course, args)
+	if err != nil {
+		return nil, err
+	}
+	activity := make([]models.BlockActivity, 0)
+	for _, blockActivity := range report.Blocks {
+		if blockActivity.BlockID == block.id() {
+			activity = append(activity, blockActivity)
+		}
+	}
+	return activity, nil
+}
+
+func (resolvers graphQLResolvers) problemStatistics(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error) {
+	filter, err := resolvers.filter(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	report, err := cachedReport(ctx, fmt.Sprintf("problems %v %+v", block.course.id, filter), func() (interface{}, error) {
+		return resolvers.analysis.GetCourseProblemsReport(ctx, block.course.id, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, statistics := range report.(*models.ProblemsReport).Problems {
+		if statistics.ProblemID == block.id() {
+			return statistics, nil
+		}
+	}
+	return nil, nil
+}
+
+// watchingCurves resolves curves of all the videos of a course with one analysis
+func (resolvers graphQLResolvers) watchingCurves(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	filter, err := resolvers.filter(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(sources))
+	courses, indices := byCourse(sources)
+	for _, course := range courses {
+		videoIDs := make([]string, 0, len(indices[course]))
+		for _, i := range indices[course] {
+			videoIDs = append(videoIDs, sources[i].(graphQLBlock).id())
+		}
+		curves, err := resolvers.analysis.GetCourseVideoWatchings(ctx, course.id, videoIDs, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range indices[course] {
+			values[i] = curves[sources[i].(graphQLBlock).id()]
+		}
+	}
+	return values, nil
+}
+
+// routes resolves routes of all the learners of a course with one analysis
+func (resolvers graphQLResolvers) routes(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(sources))
+	courses, indices := byCourse(sources)
+	for _, course := range courses {
+		routes, err := resolvers.analysis.GetCourseUsersRoute(ctx, course.id, models.Filter{Usernames: learnerUsernames(sources, indices[course])})
+		if err != nil {
+			return nil, err
+		}
+		routesByUsername := map[string]models.UserRoute{}
+		for _, route := range routes {
+			routesByUsername[route.Username] = route
+		}
+		for _, i := range indices[course] {
+			username := sources[i].(graphQLLearner).username
+			route, ok := routesByUsername[username]
+			if !ok {
+				route = models.UserRoute{Steps: make([]models.RouteStep, 0)}
+				route.CalculateMetrics()
+			}
+			if route.Username, err = resolvers.identities.Presented(username); err != nil {
+				return nil, err
+			}
+			values[i] = route
+		}
+	}
+	return values, nil
+}
+
+// eventsField returns field of learners with their events of family, events of all
+// the learners of a course are read with one scan
+func (resolvers graphQLResolvers) eventsField(objects *graphql.Objects, family string) *graphql.Field {
+	indexName := database.EventFamilyIndexNames[family]
+	eventType := objects.Object(database.EventDocumentTypes[indexName], "Event of the "+family+" family")
+	resolvers.presentingUsername(eventType)
+	return &graphql.Field{
+		Name:        family + "Events",
+		Description: "Events of the " + family + " family of the learner sorted by time",
+		Type:        graphql.NonNull(graphql.List(graphql.NonNull(eventType))),
+		Args:        eventArgs,
+		Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+			eventFilter := database.EventFilter{Platforms: platforms(args["platforms"])}
+			var err error
+			if eventFilter.From, eventFilter.To, err = dateRange(args["from"], args["to"]); err != nil {
+				return nil, api.InvalidParameter("from should be before to")
+			}
+			values := make([]interface{}, len(sources))
+			courses, indices := byCourse(sources)
+			for _, course := range courses {
+				events, err := resolvers.analysis.GetLearnersEvents(ctx, course.id, indexName, learnerUsernames(sources, indices[course]), eventFilter)
+				if err != nil {
+					return nil, err
+				}
+				for _, i := range indices[course] {
+					learnerEvents, ok := events[sources[i].(graphQLLearner).username]
+					if !ok {
+						learnerEvents = make([]interface{}, 0)
+					}
+					values[i] = learnerEvents
+				}
+			}
+			return values, nil
+		},
+	}
+}
+
+// presentingUsername makes "username" field of t return presented usernames
+func (resolvers graphQLResolvers) presentingUsername(t *graphql.Type) {
+	field := t.Field("username")
+	if field == nil {
+		return
+	}
+	resolve := field.Resolve
+	field.Resolve = func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		values, err := resolve(ctx, sources, args)
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			username, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if values[i], err = resolvers.identities.Presented(username); err != nil {
+				values[i] = err
+			}
+		}
+		return values, nil
+	}
+}
+
+// dateRange returns dates of "from" and "to" Date values, date-only "to" includes the whole day.
+// Zero dates aren't limits, "from" must be before "to".
+func dateRange(fromValue interface{}, toValue interface{}) (time.Time, time.Time, error) {
+	fromString, _ := fromValue.(string)
+	toString, _ := toValue.(string)
+	from, err := api.ParseDate(fromString)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := api.ParseEndDate(toString)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("From should be before to")
+	}
+	return from, to, nil
+}
+
+// filter returns filter of "filter" argument. Usernames are only accepted from callers
+// that can see learner identities.
+func (resolvers graphQLResolvers) filter(ctx context.Context, args map[string]interface{}) (models.Filter, error) {
+	var filter models.Filter
+	fields, _ := args["filter"].(map[string]interface{})
+	var err error
+	if filter.From, filter.To, err = dateRange(fields["from"], fields["to"]); err != nil {
+		return models.Filter{}, api.InvalidParameter("filter.from should be before filter.to")
+	}
+	for _, username := range stringList(fields["usernames"]) {
+		storedUsernames, err := resolvers.identities.Stored(username)
+		if err != nil {
+			return models.Filter{}, err
+		}
+		filter.Usernames = append(filter.Usernames, storedUsernames...)
+	}
+	if principal := auth.FromContext(ctx); len(filter.Usernames) > 0 && !principal.CanSeeIdentities() {
+		return models.Filter{}, forbidden("%v can't select learners by usernames", principal.Subject)
+	}
+	filter.EnrollmentModes = stringList(fields["enrollmentModes"])
+	filter.Platforms = platforms(fields["platforms"])
+	if minEvents, ok := fields["minEvents"].(int); ok {
+		if minEvents < 1 || minEvents > 1000000 {
+			return models.Filter{}, api.InvalidParameter("filter.minEvents should be an integer from 1 to 1000000")
+		}
+		filter.MinEvents = minEvents
+	}
+	return filter, nil
+}
+
+// cachedReport returns the report made by build for key, reports and their errors are kept for the request
+func cachedReport(ctx context.Context, key string, build func() (interface{}, error)) (interface{}, error) {
+	reports, ok := ctx.Value(graphQLReportsKey{}).(graphQLReports)
+	if !ok {
+		return build()
+	}
+	if report, ok := reports[key]; ok {
+		if err, ok := report.(error); ok {
+			return nil, err
+		}
+		return report, nil
+	}
+	report, err := build()
+	if err != nil {
+		reports[key] = err
+		return nil, err
+	}
+	reports[key] = report
+	return report, nil
+}
+
+// blockField returns field of blocks resolved by resolve for every block
+func blockField(name string, description string, t *graphql.Type, args []*graphql.InputValue, resolve func(ctx context.Context, block graphQLBlock, args map[string]interface{}) (interface{}, error)) *graphql.Field {
+	return &graphql.Field{
+		Name:        name,
+		Description: description,
+		Type:        t,
+		Args:        args,
+		Resolve: graphql.Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return resolve(ctx, source.(graphQLBlock), args)
+		}),
+	}
+}
+
+// inCourse resolves reflected field of blocks by resolve, block structs of the result stay in the course
+func inCourse(resolve graphql.BatchResolveFunc, blockStructs map[reflect.Type]bool) graphql.BatchResolveFunc {
+	return func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		blocks := make([]interface{}, len(sources))
+		for i, source := range sources {
+			blocks[i] = source.(graphQLBlock).block
+		}
+		values, err := resolve(ctx, blocks, args)
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			course := sources[i].(graphQLBlock).course
+			v := reflect.ValueOf(value)
+			switch {
+			case v.Kind() == reflect.Struct && blockStructs[v.Type()]:
+				values[i] = graphQLBlock{course: course, block: value}
+			case v.Kind() == reflect.Slice && blockStructs[v.Type().Elem()]:
+				children := make([]graphQLBlock, v.Len())
+				for j := range children {
+					children[j] = graphQLBlock{course: course, block: v.Index(j).Interface()}
+				}
+				values[i] = children
+			}
+		}
+		return values, nil
+	}
+}
+
+// courseBlocksOf returns blocks of units field of the course in the course order
+func courseBlocksOf(course *graphQLCourse, field string) []graphQLBlock {
+	blocks := make([]graphQLBlock, 0)
+	for _, chapter := range course.structure.Chapters {
+		for _, sequential := range chapter.Sequentials {
+			for _, vertical := range sequential.Verticals {
+				children := reflect.ValueOf(vertical).FieldByName(field)
+				for i := 0; i < children.Len(); i++ {
+					blocks = append(blocks, graphQLBlock{course: course, block: children.Index(i).Interface()})
+				}
+			}
+		}
+	}
+	return blocks
+}
+
+// byCourse groups indices of block or learner sources by their courses, courses are in the order of sources
+func byCourse(sources []interface{}) ([]*graphQLCourse, map[*graphQLCourse][]int) {
+	var courses []*graphQLCourse
+	indices := map[*graphQLCourse][]int{}
+	for i, source := range sources {
+		var course *graphQLCourse
+		switch source := source.(type) {
+		case graphQLBlock:
+			course = source.course
+		case graphQLLearner:
+			course = source.course
+		}
+		if _, ok := indices[course]; !ok {
+			courses = append(courses, course)
+		}
+		indices[course] = append(indices[course], i)
+	}
+	return courses, indices
+}
+
+// learnerUsernames returns stored usernames of learner sources at indices
+func learnerUsernames(sources []interface{}, indices []int) []string {
+	usernames := make([]string, 0, len(indices))
+	for _, i := range indices {
+		usernames = append(usernames, sources[i].(graphQLLearner).username)
+	}
+	return usernames
+}
+
+// fieldItemType returns type of items of slice field name of structType
+func fieldItemType(structType reflect.Type, name string) reflect.Type {
+	field, ok := structType.FieldByName(name)
+	if !ok {
+		panic(fmt.Sprintf("%v has no %v field", structType, name))
+	}
+	return field.Type.Elem()
+}
+
+// stringList returns strings of list argument value
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var values []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			values = append(values, strings.TrimSpace(s))
+		}
+	}
+	return values
+}
+
+// platforms returns platforms of Platform list argument value
+func platforms(value interface{}) []string {
+	var values []string
+	for _, platform := range stringList(value) {
+		values = append(values, strings.ToLower(platform))
+	}
+	return values
+}
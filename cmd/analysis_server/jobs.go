@@ -0,0 +1,197 @@
+package main
+
+// Analysis jobs run handlers of api.JobAnalyses endpoints in background. Parameters
+// and access of the caller are checked on submission, the handler response is the job
+// result. Results are cached by the analysis, its parameters, the courses and identities
+// the caller can read and the data watermark of the event store.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/jobs"
+	"kafka-log-processor/pkg/models"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SubmitJobHandle queues job of the analysis endpoint named by "analysis" parameter,
+// handlers are the handlers of the analyses keyed by endpointKey
+func SubmitJobHandle(jobManager *jobs.Manager, handlers map[string]routeHandler, watermarks *database.DataWatermarks) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		analysis := r.URL.Query().Get("analysis")
+		endpoint, ok := findEndpoint(http.MethodGet, "/"+analysis)
+		route, handled := handlers[endpointKey(http.MethodGet, "/"+analysis)]
+		if !ok || !handled {
+			return api.InvalidParameter("analysis parameter should be one of %v", strings.Join(api.JobAnalyses, ", "))
+		}
+
+		params := r.URL.Query()
+		params.Del("analysis")
+		if err := api.ValidateParams(endpoint.Params, params); err != nil {
+			return err
+		}
+		analysisRequest, err := http.NewRequestWithContext(r.Context(), http.MethodGet, api.Prefix+endpoint.Path+"?"+params.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if err = authorize(endpoint, analysisRequest); err != nil {
+			return err
+		}
+
+		watermark, err := watermarks.Get(r.Context())
+		if err != nil {
+			return err
+		}
+		principal := auth.FromContext(r.Context())
+		key := fmt.Sprintf("%v?%v access=%v data=%v", analysis, params.Encode(), accessScope(principal), watermark)
+		requestID := requestIDFrom(r.Context())
+		run := func(ctx context.Context, progress func(done int, total int)) (jobs.Result, error) {
+			ctx = analysers.WithProgress(auth.NewContext(ctx, principal), progress)
+			ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+			response := &jobResponse{header: http.Header{}}
+			if err := route.Handler(response, analysisRequest.WithContext(ctx)); err != nil {
+				if apiError(err).Status == http.StatusInternalServerError {
+					log.Printf("Error! job of request %v failed: %v\n", requestID, err)
+				}
+				return jobs.Result{}, err
+			}
+			return jobs.Result{Header: response.header, Body: response.body.Bytes()}, nil
+		}
+
+		job, err := jobManager.Submit(principal.Subject, analysis, params, key, run)
+		if errors.Is(err, jobs.ErrQueueFull) {
+			return &api.Error{Status: http.StatusServiceUnavailable, Code: "queue_full", Message: "Too many jobs are waiting, try again later"}
+		}
+		if err != nil {
+			return err
+		}
+		return writeJSONStatus(w, http.StatusAccepted, analysisJob(job))
+	}
+}
+
+// GetJobHandle returns status of the caller's job "id"
+func GetJobHandle(jobManager *jobs.Manager) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		job, ok := jobManager.Get(auth.FromContext(r.Context()).Subject, r.URL.Query().Get("id"))
+		if !ok {
+			return jobNotFound()
+		}
+		return writeJSON(w, analysisJob(job))
+	}
+}
+
+// CancelJobHandle cancels the caller's job "id" and returns its status
+func CancelJobHandle(jobManager *jobs.Manager) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		job, ok := jobManager.Cancel(auth.FromContext(r.Context()).Subject, r.URL.Query().Get("id"))
+		if !ok {
+			return jobNotFound()
+		}
+		return writeJSON(w, analysisJob(job))
+	}
+}
+
+// GetJobResultHandle returns result of the caller's job "id", failed jobs answer with their error
+func GetJobResultHandle(jobManager *jobs.Manager) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		job, ok := jobManager.Get(auth.FromContext(r.Context()).Subject, r.URL.Query().Get("id"))
+		if !ok {
+			return jobNotFound()
+		}
+		switch job.Status {
+		case jobs.Succeeded:
+			for _, name := range []string{"Content-Type", "Content-Disposition", "X-Next-Cursor"} {
+				if value := job.Result.Header.Get(name); value != "" {
+					w.Header().Set(name, value)
+				}
+			}
+			_, err := w.Write(job.Result.Body)
+			return err
+		case jobs.Failed:
+			return apiError(job.Err)
+		}
+		return &api.Error{Status: http.StatusConflict, Code: "job_not_succeeded", Message: "Job is " + job.Status}
+	}
+}
+
+func jobNotFound() *api.Error {
+	return &api.Error{Status: http.StatusNotFound, Code: "not_found", Message: "Job isn't found, finished jobs are kept for a limited time"}
+}
+
+// analysisJob returns API response of job. Errors of failed jobs are described the way
+// the analysis endpoint would describe them.
+func analysisJob(job jobs.Job) models.AnalysisJob {
+	response := models.AnalysisJob{
+		ID:         job.ID,
+		Analysis:   job.Analysis,
+		Params:     map[string]string{},
+		Status:     job.Status,
+		DoneSteps:  job.Done,
+		TotalSteps: job.Total,
+		Cached:     job.Cached,
+		CreatedAt:  job.CreatedAt,
+	}
+	for name := range job.Params {
+		response.Params[name] = job.Params.Get(name)
+	}
+	if job.Total > 0 {
+		response.Progress = float64(job.Done) / float64(job.Total)
+	}
+	if job.Status == jobs.Succeeded {
+		response.Progress = 1
+	}
+	if job.Err != nil {
+		response.Error = apiError(job.Err).Message
+	}
+	if !job.StartedAt.IsZero() {
+		response.StartedAt = timePointer(job.StartedAt)
+	}
+	if !job.FinishedAt.IsZero() {
+		response.FinishedAt = timePointer(job.FinishedAt)
+	}
+	return response
+}
+
+func timePointer(t time.Time) *time.Time {
+	return &t
+}
+
+// accessScope describes data principal can read: results of principals with the same scope are the same
+func accessScope(principal *auth.Principal) string {
+	courses := []string{auth.AllCourses}
+	if !principal.HasAllCourses() {
+		courses = append([]string{}, principal.Courses...)
+		sort.Strings(courses)
+	}
+	return fmt.Sprintf("%v;identities=%v", strings.Join(courses, ","), principal.CanSeeIdentities())
+}
+
+func findEndpoint(method string, path string) (api.Endpoint, bool) {
+	for _, endpoint := range api.Endpoints {
+		if endpoint.Method == method && endpoint.Path == path {
+			return endpoint, true
+		}
+	}
+	return api.Endpoint{}, false
+}
+
+// jobResponse keeps response of the handler run by a job
+type jobResponse struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (response *jobResponse) Header() http.Header { return response.header }
+
+func (response *jobResponse) Write(b []byte) (int, error) { return response.body.Write(b) }
+
+func (response *jobResponse) WriteHeader(status int) {}
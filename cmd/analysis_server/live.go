@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/live"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/tables"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// liveReplayMinutes is the default of "replay_minutes" parameter
+	liveReplayMinutes = 15
+	// liveKeepAlive is the period of comments that keep idle streams open behind proxies
+	liveKeepAlive = 15 * time.Second
+	// liveRetry is how long clients wait before reconnecting
+	liveRetry = 5 * time.Second
+)
+
+// GetLiveActivityHandle streams live activity of the course by minutes as server-sent events.
+// Minutes of "replay_minutes" before the connection, or from Last-Event-ID of a reconnecting
+// client, are sent first. Blocks are named by their display names.
+func GetLiveActivityHandle(hub *live.Hub, analysis analysers.Analyser) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if hub == nil {
+			return &api.Error{Status: http.StatusServiceUnavailable, Code: "live_disabled", Message: "Live activity stream is disabled"}
+		}
+		course, err := courseParam(r)
+		if err != nil {
+			return err
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return errors.New("Response can't be streamed")
+		}
+		query := live.Query{CourseID: course, Blocks: listParam(r, "blocks"), Platforms: listParam(r, "platforms")}
+		replay := liveReplayMinutes
+		if value := r.URL.Query().Get("replay_minutes"); value != "" {
+			// the value is validated against the endpoint description
+			replay, _ = strconv.Atoi(value)
+		}
+		if replay > 0 {
+			query.Since = time.Now().Add(-time.Duration(replay) * time.Minute)
+		}
+		if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+			if since, err := time.Parse(time.RFC3339, lastEventID); err == nil {
+				query.Since = since
+			}
+		}
+		// blocks of courses without structure are left unnamed
+		var names tables.DisplayNames
+		if structureIndex, err := analysis.GetCourseStructureIndex(r.Context(), course); err == nil {
+			names = structureIndex.DisplayName
+		}
+
+		subscription, replayed := hub.Subscribe(query)
+		defer subscription.Close()
+		w.Header().Set("Content-Type", api.EventStreamContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if _, err = fmt.Fprintf(w, "retry: %d\n\n", liveRetry.Milliseconds()); err != nil {
+			return err
+		}
+		for _, activity := range replayed {
+			if err = writeLiveActivity(w, activity, names); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(liveKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case activity, ok := <-subscription.Updates():
+				if !ok {
+					log.Printf("WARN: live activity stream of request %v is dropped, the client reads too slow\n", requestIDFrom(r.Context()))
+					return nil
+				}
+				err = writeLiveActivity(w, activity, names)
+			case <-keepAlive.C:
+				_, err = io.WriteString(w, ": keep-alive\n\n")
+			}
+			if err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeLiveActivity writes activity as "activity" event with the start of its minute as id
+func writeLiveActivity(w io.Writer, activity models.LiveActivity, names tables.DisplayNames) error {
+	if names != nil {
+		for i := range activity.Blocks {
+			activity.Blocks[i].BlockName, _ = names(activity.Blocks[i].BlockID)
+		}
+	}
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: activity\nid: %v\ndata: %s\n\n", activity.Minute.Format(time.RFC3339), data)
+	return err
+}
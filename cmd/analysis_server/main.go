@@ -1,138 +1,552 @@
 package main
 
 import (
-	"encoding/json"
+	"archive/zip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"kafka-log-processor/configs"
 	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"kafka-log-processor/pkg/charts"
 	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/dataset"
+	"kafka-log-processor/pkg/export"
+	"kafka-log-processor/pkg/ingestion"
+	"kafka-log-processor/pkg/jobs"
+	"kafka-log-processor/pkg/live"
+	"kafka-log-processor/pkg/pseudonymization"
+	"kafka-log-processor/pkg/rollups"
+	"kafka-log-processor/pkg/tables"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// dataWatermarkTTL is how long results cached by jobs and charts may miss new events
+const dataWatermarkTTL = 5 * time.Second
+
 func main() {
 	config, err := configs.GetParserConfig("./configs/parser_config.yml")
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	es := database.ElasticService{}
-	err = es.Connect(config.Elastic.Host, config.Elastic.Port)
+	eventStore, err := database.NewEventStore(config)
 	if err != nil {
-		log.Panicf("can't connect to ElasticSearch: %v", err)
+		log.Panicf("can't connect to event store: %v", err)
 	}
 
-	analysis, err := analysers.New(config)
+	pseudonymizer, err := pseudonymization.FromConfig(config)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+	identities, err := pseudonymization.IdentitiesFromConfig(config, pseudonymizer)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+
+	authenticator, err := auth.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up authentication: %v", err)
+	}
+	if authenticator == nil {
+		log.Println("WARN: authentication is disabled, every caller can read all the courses and learner usernames")
+	}
+
+	if config.Storage.Backend == database.MemoryBackend {
+		loadLocalData(eventStore, pseudonymizer, config)
+	}
+
+	analysis := analysers.New(eventStore)
+
+	requestTimeout := time.Duration(config.AnalysisServer.RequestTimeoutSeconds) * time.Second
+	if requestTimeout <= 0 {
+		requestTimeout = 30 * time.Second
+	}
+	exportTimeout := time.Duration(config.AnalysisServer.ExportTimeoutSeconds) * time.Second
+	if exportTimeout <= 0 {
+		exportTimeout = 10 * time.Minute
+	}
+	address := config.AnalysisServer.Address
+	if address == "" {
+		address = ":8080"
+	}
+
+	jobManager := jobs.NewManager(jobs.Config{
+		Workers:   config.AnalysisServer.Jobs.Workers,
+		QueueSize: config.AnalysisServer.Jobs.QueueSize,
+		CacheSize: config.AnalysisServer.Jobs.CacheSize,
+		Timeout:   time.Duration(config.AnalysisServer.Jobs.TimeoutMinutes) * time.Minute,
+		ResultTTL: time.Duration(config.AnalysisServer.Jobs.ResultTTLMinutes) * time.Minute,
+	})
+
+	chartCacheSize := config.AnalysisServer.Charts.CacheSize
+	if chartCacheSize <= 0 {
+		chartCacheSize = 200
+	}
+	chartCache := charts.NewCache(chartCacheSize)
+
+	var liveHub *live.Hub
+	liveCtx, stopLive := context.WithCancel(context.Background())
+	if config.AnalysisServer.Live.Enabled {
+		liveHub = live.NewHub(live.Config{
+			Window:   time.Duration(config.AnalysisServer.Live.WindowMinutes) * time.Minute,
+			Interval: time.Duration(config.AnalysisServer.Live.UpdateSeconds) * time.Second,
+		})
+		topics := config.AnalysisServer.Live.Topics
+		if len(topics) == 0 {
+			topics = live.Topics()
+		}
+		err = live.ConsumeKafka(liveCtx, liveHub, config.Kafka.Host, config.Kafka.Port, topics, eventStore.GetCourseStructure)
+		if err != nil {
+			log.Fatalf("can't set up live activity stream: %v", err)
+		}
+	}
+
+	handlers, err := apiHandlers(*analysis, eventStore, identities, jobManager, chartCache, liveHub, requestTimeout, exportTimeout)
+	if err != nil {
+		log.Fatalf("can't set up API: %v", err)
+	}
+	router, err := newRouter(api.Endpoints, handlers, authenticator, config.AnalysisServer.CORSAllowedOrigins)
+	if err != nil {
+		log.Fatalf("can't set up API: %v", err)
+	}
+	sessionTTL := time.Duration(config.AnalysisServer.Dashboard.SessionMinutes) * time.Minute
+	if sessionTTL <= 0 {
+		sessionTTL = 60 * time.Minute
+	}
+	secureCookies := !config.AnalysisServer.Dashboard.InsecureCookies
+	dashboard, err := newDashboard(*analysis, eventStore, identities, authenticator, newSessionStore(sessionTTL), secureCookies)
+	if err != nil {
+		log.Fatalf("can't set up dashboard: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", router)
+	mux.Handle(dashboardPath, withAccessLog(withRecovery(withTimeout(dashboard, requestTimeout))))
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	err = server.ListenAndServe()
+	stopLive()
+	if liveHub != nil {
+		liveHub.Close()
+	}
+	log.Fatal(err)
+}
+
+// apiHandlers returns handlers of api.Endpoints keyed by endpointKey. Analyses time out after
+// requestTimeout, Parquet exports after exportTimeout. liveHub is nil if the live stream is disabled.
+func apiHandlers(analysis analysers.Analyser, eventStore database.EventStore, identities *pseudonymization.Identities, jobManager *jobs.Manager, chartCache *charts.Cache, liveHub *live.Hub, requestTimeout time.Duration, exportTimeout time.Duration) (map[string]routeHandler, error) {
+	handlers := map[string]routeHandler{
+		endpointKey(http.MethodGet, api.CourseIDsPath):         {LegacyPath: "/course-ids-with-logs-and-structs", Timeout: requestTimeout, Handler: GetCourseIDsHandleFunction(eventStore)},
+		endpointKey(http.MethodGet, api.CourseRoutesPath):      {LegacyPath: "/course-routes", Timeout: requestTimeout, Handler: GetUsersRoutesCurves(analysis, identities)},
+		endpointKey(http.MethodGet, api.VideoWatchingsPath):    {LegacyPath: "/users-watchings", Timeout: requestTimeout, Handler: GetUsersWatchingCurve(analysis, eventStore, identities)},
+		endpointKey(http.MethodGet, api.CourseVideosPath):      {LegacyPath: "/video-ids-by-course", Timeout: requestTimeout, Handler: GetVideoCatalogueByCourseHandle(analysis, eventStore)},
+		endpointKey(http.MethodGet, api.ExternalResourcesPath): {LegacyPath: "/external-resources", Timeout: requestTimeout, Handler: GetExternalResourcesHandle(analysis, identities)},
+		endpointKey(http.MethodGet, api.BookmarksPath):         {LegacyPath: "/bookmarks", Timeout: requestTimeout, Handler: GetBookmarksHandle(analysis, identities)},
+		endpointKey(http.MethodGet, api.CourseActivityPath):    {LegacyPath: "/course-activity", Timeout: requestTimeout, Handler: GetCourseActivityHandle(analysis, identities)},
+		endpointKey(http.MethodGet, api.ProblemsPath):          {Timeout: requestTimeout, Handler: GetProblemsHandle(analysis, identities)},
+		endpointKey(http.MethodGet, api.UserTimelinePath):      {LegacyPath: "/user-timeline", Timeout: requestTimeout, Handler: GetUserTimelineHandle(analysis, identities)},
+		endpointKey(http.MethodGet, api.ParquetExportPath):     {LegacyPath: "/export/parquet", Timeout: exportTimeout, Handler: GetParquetExportHandle(eventStore)},
 	}
+	watermarks := database.NewDataWatermarks(eventStore, dataWatermarkTTL)
+	handlers[endpointKey(http.MethodPost, api.JobsPath)] = routeHandler{Timeout: requestTimeout, Handler: SubmitJobHandle(jobManager, handlers, watermarks)}
+	handlers[endpointKey(http.MethodGet, api.JobsPath)] = routeHandler{Timeout: requestTimeout, Handler: GetJobHandle(jobManager)}
+	handlers[endpointKey(http.MethodDelete, api.JobsPath)] = routeHandler{Timeout: requestTimeout, Handler: CancelJobHandle(jobManager)}
+	handlers[endpointKey(http.MethodGet, api.JobResultPath)] = routeHandler{Timeout: requestTimeout, Handler: GetJobResultHandle(jobManager)}
 
-	courseIDsWithLogsAndStructuresHandle := GetCourseIDsHandleFunction(&es)
-	usersRoutesCurversHandle := GetUsersRoutesCurves(*analysis)
-	usersWatchingsCurveHandle := GetUsersWatchingCurve(*analysis)
-	videoCatalogueByCourseHandle := GetVideoCatalogueByCourseHandle(&es)
+	graphQLSchema, err := newGraphQLSchema(analysis, eventStore, identities)
+	if err != nil {
+		return nil, fmt.Errorf("can't set up GraphQL schema: %w", err)
+	}
+	handlers[endpointKey(http.MethodGet, api.GraphQLPath)] = routeHandler{Timeout: requestTimeout, Handler: GetGraphQLHandle(graphQLSchema)}
+	handlers[endpointKey(http.MethodPost, api.GraphQLPath)] = routeHandler{Timeout: requestTimeout, Handler: GetGraphQLHandle(graphQLSchema)}
+
+	chartBuilders := map[string]chartBuilder{
+		api.VideoWatchingsChartPath: videoWatchingsChart(analysis, eventStore, identities),
+		api.CourseActivityChartPath: courseActivityChart(analysis, identities),
+		api.CourseRoutesChartPath:   courseRoutesChart(analysis, identities),
+		api.ProblemsChartPath:       problemsChart(analysis, identities),
+	}
+	for path, build := range chartBuilders {
+		name := strings.TrimPrefix(path, "/charts/")
+		handlers[endpointKey(http.MethodGet, path)] = routeHandler{Timeout: requestTimeout, Handler: chartHandle(name, chartCache, watermarks, build)}
+	}
+
+	// streams aren't timed out, they last until the client disconnects
+	handlers[endpointKey(http.MethodGet, api.LiveActivityPath)] = routeHandler{Handler: GetLiveActivityHandle(liveHub, analysis)}
+
+	return handlers, nil
+}
 
-	http.HandleFunc("/course-ids-with-logs-and-structs", courseIDsWithLogsAndStructuresHandle)
-	http.HandleFunc("/course-routes", usersRoutesCurversHandle)
-	http.HandleFunc("/users-watchings", usersWatchingsCurveHandle)
-	http.HandleFunc("/video-ids-by-course", videoCatalogueByCourseHandle)
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// loadLocalData fills event store with structures and logs from local directories
+// or with dataset snapshot and rolls them up, so the whole system can run in a single process
+func loadLocalData(eventStore database.EventStore, pseudonymizer *pseudonymization.Pseudonymizer, config configs.ParserConfig) {
+	ctx := context.Background()
+	if config.Local.DatasetDir != "" {
+		if _, err := dataset.Restore(ctx, eventStore, config.Local.DatasetDir); err != nil {
+			log.Fatalf("can't load dataset: %v", err)
+		}
+	} else {
+		ingester := ingestion.New(eventStore, pseudonymizer)
+		if err := ingester.IngestStructuresDir(ctx, config.Local.StructuresDir); err != nil {
+			log.Fatalf("can't load course structures: %v", err)
+		}
+		if err := ingester.IngestLogsDir(ctx, config.Local.LogsDir); err != nil {
+			log.Fatalf("can't load logs: %v", err)
+		}
+	}
+	if _, err := rollups.Update(ctx, eventStore, time.Now(), config.Rollups.LookbackDays); err != nil {
+		log.Printf("WARN: can't roll up local data: %v\n", err)
+	}
 }
 
-// GetUsersWatchingCurve returns points for video watching curve
-func GetUsersWatchingCurve(analysis analysers.Analyser) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		setupResponse(&w, r)
-		if (*r).Method == "OPTIONS" {
-			return
+// GetUsersWatchingCurve returns points for video watching curve of video "video_id".
+// Callers limited to some courses can only read videos of their courses.
+func GetUsersWatchingCurve(analysis analysers.Analyser, es database.EventStore, identities *pseudonymization.Identities) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		videoID, err := requiredParam(r, "video_id")
+		if err != nil {
+			return err
 		}
-		videoID := r.URL.Query()["video_id"]
-		points, err := analysis.GetAnalyseUserVideoWatchings(videoID[0])
-		fmt.Println(videoID[0])
+		filter, err := filterParams(r, identities)
 		if err != nil {
-			log.Println(err)
-			return
+			return err
+		}
+		if err = authorizeVideo(r, es, videoID); err != nil {
+			return err
 		}
-		b, err := json.Marshal(points)
+		points, err := analysis.GetAnalyseUserVideoWatchings(r.Context(), videoID, filter)
 		if err != nil {
-			log.Println(err)
-			return
+			return err
+		}
+		return writeResult(w, r, "video-watchings", points, func() []tables.Table { return tables.VideoWatchings(*points) })
+	}
+}
+
+// authorizeVideo checks that the principal of request r can read every course with events of the video
+func authorizeVideo(r *http.Request, es database.EventStore, videoID string) error {
+	principal := auth.FromContext(r.Context())
+	if principal.HasAllCourses() {
+		return nil
+	}
+	courseIDs, err := es.GetUniqueStringFieldValuesInIndexWithFilter(
+		r.Context(),
+		database.VideoEventDescriptionIndexName,
+		"course_id",
+		"video_id",
+		videoID,
+	)
+	if err != nil {
+		return fmt.Errorf("can't get courses of video: %w", err)
+	}
+	for _, courseID := range courseIDs {
+		if !principal.CanAccessCourse(courseID) {
+			return forbidden("%v can't read course %v of the video", principal.Subject, courseID)
 		}
-		fmt.Fprintf(w, string(b))
 	}
+	return nil
 }
 
 // GetVideoCatalogueByCourseHandle returns video ids of the course videos
-func GetVideoCatalogueByCourseHandle(es *database.ElasticService) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		setupResponse(&w, r)
-		if (*r).Method == "OPTIONS" {
-			return
+func GetVideoCatalogueByCourseHandle(analysis analysers.Analyser, es database.EventStore) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		course, err := courseParam(r)
+		if err != nil {
+			return err
 		}
-		course := r.URL.Query()["course"]
 		videos, err := es.GetUniqueStringFieldValuesInIndexWithFilter(
+			r.Context(),
 			database.VideoEventDescriptionIndexName,
 			"video_id",
 			"course_id",
-			course[0],
+			course,
 		)
 		if err != nil {
-			log.Printf("Error! Can't get unique videos for course: %v\n", err)
-			return
+			return fmt.Errorf("can't get unique videos for course: %w", err)
 		}
+		return writeResult(w, r, "course-videos", videos, func() []tables.Table {
+			return tables.Videos(videos, displayNames(r.Context(), analysis, course))
+		})
+	}
+}
 
-		b, err := json.Marshal(videos)
+// GetCourseIDsHandleFunction generates function that writes response of course ids with logs and structures
+// the caller can read
+func GetCourseIDsHandleFunction(es database.EventStore) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		courseIDs, err := es.GetAllCourseIDsWithStructureAndLogs(r.Context())
 		if err != nil {
-			log.Printf("Error! Can't convert video list to json: %v\n", err)
+			return err
 		}
-		fmt.Fprintf(w, string(b))
+		principal := auth.FromContext(r.Context())
+		readable := make([]string, 0, len(courseIDs))
+		for _, courseID := range courseIDs {
+			if principal.CanAccessCourse(courseID) {
+				readable = append(readable, courseID)
+			}
+		}
+		return writeResult(w, r, "course-ids", readable, func() []tables.Table { return tables.List("courses", "Course id", readable) })
 	}
 }
 
-// GetCourseIDsHandleFunction generates function that writes response of course ids with logs and structures
-func GetCourseIDsHandleFunction(es *database.ElasticService) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		setupResponse(&w, r)
-		if (*r).Method == "OPTIONS" {
-			return
+// GetUsersRoutesCurves returns time-ordered users routes with their metrics
+func GetUsersRoutesCurves(analysis analysers.Analyser, identities *pseudonymization.Identities) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		course, err := courseParam(r)
+		if err != nil {
+			return err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return err
 		}
-		courseIDs, err := es.GetAllCourseIDsWithStructureAndLogs()
+		points, err := analysis.GetCourseUsersRoute(r.Context(), course, filter)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		for i := range points {
+			if points[i].Username, err = identities.Presented(points[i].Username); err != nil {
+				return err
+			}
+		}
+		return writeResult(w, r, "course-routes", points, func() []tables.Table {
+			return tables.Routes(points, displayNames(r.Context(), analysis, course))
+		})
+	}
+}
 
-		b, err := json.Marshal(courseIDs)
+// GetExternalResourcesHandle returns the most clicked external resources of the course and its units
+func GetExternalResourcesHandle(analysis analysers.Analyser, identities *pseudonymization.Identities) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		course, err := courseParam(r)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		fmt.Fprintf(w, string(b))
+		size, err := positiveIntParam(r, "size", 10, 100)
+		if err != nil {
+			return err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return err
+		}
+		report, err := analysis.GetMostClickedExternalResources(r.Context(), course, size, filter)
+		if err != nil {
+			return err
+		}
+		return writeResult(w, r, "external-resources", report, func() []tables.Table { return tables.ExternalResources(*report) })
+	}
+}
+
+// GetBookmarksHandle returns bookmarks analytics of the course
+func GetBookmarksHandle(analysis analysers.Analyser, identities *pseudonymization.Identities) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		course, err := courseParam(r)
+		if err != nil {
+			return err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return err
+		}
+		report, err := analysis.GetCourseBookmarksReport(r.Context(), course, filter)
+		if err != nil {
+			return err
+		}
+		return writeResult(w, r, "bookmarks", report, func() []tables.Table { return tables.Bookmarks(*report) })
+	}
+}
+
+// GetCourseActivityHandle returns activity of the course and its blocks selected by filter
+// parameters by "granularity": "day" (default) or "hour"
+func GetCourseActivityHandle(analysis analysers.Analyser, identities *pseudonymization.Identities) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		course, err := courseParam(r)
+		if err != nil {
+			return err
+		}
+		granularity, err := granularityParam(r)
+		if err != nil {
+			return err
+		}
+		filter, err := filterParams(r, identities)
+		if err != nil {
+			return err
+		}
+		report, err := analysis.GetCourseActivity(r.Context(), course, granularity, filter)
+		if err != nil {
+			return err
+		}
+		return writeResult(w, r, "course-activity", report, func() []tables.Table {
+			return tables.CourseActivity(*report, displayNames(r.Context(), analysis, course))
+		})
 	}
 }
 
-// GetUsersRoutesCurves returns users routes curves
-func GetUsersRoutesCurves(analysis analysers.Analyser) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		setupResponse(&w, r)
-		if (*r).Method == "OPTIONS" {
-			return
+// GetProblemsHandle returns statistics of the course problems of submissions selected by filter parameters
+func GetProblemsHandle(analysis analysers.Analyser, identities *pseudonymization.Identities) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		course, err := courseParam(r)
+		if err != nil {
+			return err
 		}
-		course := r.URL.Query()["course"]
-		points, err := analysis.GetCourseUsersRoute(course[0])
+		filter, err := filterParams(r, identities)
 		if err != nil {
-			log.Println(err)
-			return
+			return err
 		}
-		b, err := json.Marshal(points)
+		report, err := analysis.GetCourseProblemsReport(r.Context(), course, filter)
 		if err != nil {
-			log.Println(err)
-			return
+			return err
 		}
-		fmt.Fprintf(w, string(b))
+		return writeResult(w, r, "problems", report, func() []tables.Table { return tables.Problems(*report) })
 	}
 }
 
-func setupResponse(w *http.ResponseWriter, req *http.Request) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+// GetUserTimelineHandle returns a page of learner's events in the course.
+// Events can be filtered with comma separated "families" and "platforms" and "from"/"to" dates,
+// "cursor" is the "next_cursor" value of the previous page.
+func GetUserTimelineHandle(analysis analysers.Analyser, identities *pseudonymization.Identities) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		username, err := requiredParam(r, "username")
+		if err != nil {
+			return err
+		}
+		course, err := courseParam(r)
+		if err != nil {
+			return err
+		}
+		storedUsernames, err := identities.Stored(username)
+		if err != nil {
+			return err
+		}
+		timelineQuery := database.TimelineQuery{
+			Username:        username,
+			StoredUsernames: storedUsernames,
+			CourseID:        course,
+			Cursor:          r.URL.Query().Get("cursor"),
+		}
+		if timelineQuery.Families, err = familiesParam(r); err != nil {
+			return err
+		}
+		if timelineQuery.From, timelineQuery.To, err = dateRangeParams(r); err != nil {
+			return err
+		}
+		timelineQuery.Platforms = listParam(r, "platforms")
+		if timelineQuery.Size, err = positiveIntParam(r, "size", 0, 1000); err != nil {
+			return err
+		}
+
+		timeline, err := analysis.GetUserTimeline(r.Context(), timelineQuery)
+		if errors.Is(err, database.ErrInvalidCursor) {
+			return api.InvalidParameter("cursor parameter should be next_cursor of the previous page")
+		}
+		if err != nil {
+			return err
+		}
+		if timeline.NextCursor != "" {
+			w.Header().Set("X-Next-Cursor", timeline.NextCursor)
+		}
+		return writeResult(w, r, "user-timeline", timeline, func() []tables.Table { return tables.Timeline(*timeline) })
+	}
+}
+
+// GetParquetExportHandle returns zip archive of partitioned Parquet files with events.
+// Events can be filtered with comma separated "families", "course" and "from"/"to" dates.
+// The archive is built in a temporary file and sent only when it is complete, so a failed
+// export is answered with an error instead of a truncated archive.
+func GetParquetExportHandle(es database.EventStore) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var query export.Query
+		var err error
+		if r.URL.Query().Get("course") != "" {
+			if query.CourseID, err = courseParam(r); err != nil {
+				return err
+			}
+		}
+		if query.Families, err = familiesParam(r); err != nil {
+			return err
+		}
+		if query.From, query.To, err = dateRangeParams(r); err != nil {
+			return err
+		}
+
+		archiveFile, err := os.CreateTemp("", "events-parquet-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(archiveFile.Name())
+		defer archiveFile.Close()
+
+		archive := zip.NewWriter(archiveFile)
+		_, err = export.ExportParquet(r.Context(), es, query, func(filePath string) (io.WriteCloser, error) {
+			file, err := archive.CreateHeader(&zip.FileHeader{Name: filePath, Method: zip.Store, Modified: time.Now()})
+			if err != nil {
+				return nil, err
+			}
+			return nopWriteCloser{file}, nil
+		})
+		if err != nil {
+			return fmt.Errorf("can't export events to parquet: %w", err)
+		}
+		if err = archive.Close(); err != nil {
+			return err
+		}
+		size, err := archiveFile.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err = archiveFile.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		w.Header().Set("Content-Type", api.ZipContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="events-parquet.zip"`)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		if _, err = io.Copy(w, archiveFile); err != nil {
+			log.Printf("WARN: can't send parquet export: %v\n", err)
+		}
+		return nil
+	}
+}
+
+// nopWriteCloser is a zip archive entry, entries are closed by the next entry creation
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// granularityParam returns "granularity" parameter: "day" (default) or "hour"
+func granularityParam(r *http.Request) (string, error) {
+	granularity := stringParam(r, "granularity", rollups.DayGranularity)
+	if granularity != rollups.DayGranularity && granularity != rollups.HourGranularity {
+		return "", api.InvalidParameter("granularity parameter should be day or hour")
+	}
+	return granularity, nil
+}
+
+// familiesParam returns comma separated event families of "families" parameter
+func familiesParam(r *http.Request) ([]string, error) {
+	value := r.URL.Query().Get("families")
+	if value == "" {
+		return nil, nil
+	}
+	families := strings.Split(value, ",")
+	for _, family := range families {
+		if _, ok := database.EventFamilyIndexNames[family]; !ok {
+			return nil, api.InvalidParameter("unknown event family %v in families parameter", family)
+		}
+	}
+	return families, nil
 }
@@ -0,0 +1,79 @@
+package main
+
+// Dashboard sessions. Browsers keep only a random session id in the cookie, principals
+// of the credentials they logged in with are kept in memory until the sessions expire,
+// so API keys and JWTs are sent by the browser only once to log in.
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"kafka-log-processor/pkg/auth"
+	"sync"
+	"time"
+)
+
+// sessionIDBytes is the number of random bytes of a session id
+const sessionIDBytes = 32
+
+type dashboardSession struct {
+	principal *auth.Principal
+	expires   time.Time
+}
+
+// sessionStore keeps principals of logged in browsers by session ids
+type sessionStore struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	sessions map[string]dashboardSession
+}
+
+// newSessionStore returns store of sessions lasting ttl
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: map[string]dashboardSession{}}
+}
+
+// create starts a session of principal at time now and returns its id and expiration time.
+// Sessions end after ttl or when the credentials of principal expire.
+func (store *sessionStore) create(principal *auth.Principal, now time.Time) (string, time.Time, error) {
+	random := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(random)
+	expires := now.Add(store.ttl)
+	if !principal.ExpiresAt.IsZero() && principal.ExpiresAt.Before(expires) {
+		expires = principal.ExpiresAt
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for sessionID, session := range store.sessions {
+		if !now.Before(session.expires) {
+			delete(store.sessions, sessionID)
+		}
+	}
+	store.sessions[id] = dashboardSession{principal: principal, expires: expires}
+	return id, expires, nil
+}
+
+// get returns principal of session id if the session hasn't expired at time now
+func (store *sessionStore) get(id string, now time.Time) (*auth.Principal, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	session, ok := store.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(session.expires) {
+		delete(store.sessions, id)
+		return nil, false
+	}
+	return session.principal, true
+}
+
+// delete ends session id
+func (store *sessionStore) delete(id string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.sessions, id)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"kafka-log-processor/pkg/auth"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		principal   *auth.Principal
+		at          time.Duration
+		wantExpires time.Duration
+		wantFound   bool
+	}{
+		{"API key within ttl", &auth.Principal{Subject: "key"}, 59 * time.Minute, time.Hour, true},
+		{"API key after ttl", &auth.Principal{Subject: "key"}, time.Hour, time.Hour, false},
+		{"JWT expiring before ttl", &auth.Principal{Subject: "jwt", ExpiresAt: now.Add(10 * time.Minute)}, 10 * time.Minute, 10 * time.Minute, false},
+		{"JWT expiring after ttl", &auth.Principal{Subject: "jwt", ExpiresAt: now.Add(2 * time.Hour)}, 30 * time.Minute, time.Hour, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newSessionStore(time.Hour)
+			id, expires, err := store.create(test.principal, now)
+			if err != nil {
+				t.Fatalf("create() error = %v", err)
+			}
+			if !expires.Equal(now.Add(test.wantExpires)) {
+				t.Errorf("expires = %v, want %v", expires, now.Add(test.wantExpires))
+			}
+			principal, found := store.get(id, now.Add(test.at))
+			if found != test.wantFound || (found && principal != test.principal) {
+				t.Errorf("get() = %v, %v, want found %v", principal, found, test.wantFound)
+			}
+		})
+	}
+}
+
+func TestSessionStoreDelete(t *testing.T) {
+	store := newSessionStore(time.Hour)
+	now := time.Now()
+	first, _, err := store.create(&auth.Principal{Subject: "a"}, now)
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+	second, _, _ := store.create(&auth.Principal{Subject: "a"}, now)
+	if first == second {
+		t.Fatalf("sessions have the same id %v", first)
+	}
+	store.delete(first)
+	if _, found := store.get(first, now); found {
+		t.Errorf("deleted session is found")
+	}
+	if _, found := store.get(second, now); !found {
+		t.Errorf("other session of the principal is not found")
+	}
+	if _, found := store.get("unknown", now); found {
+		t.Errorf("unknown session is found")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+// Api_key makes a random API key of the analysis server and prints it with the entry
+// to add to auth.api_keys_file. The key itself is shown once and isn't stored anywhere.
+// Usage: go run cmd/api_key/main.go -name dashboard -role course_staff -courses course-v1:org+Code+Run
+
+import (
+	"flag"
+	"fmt"
+	"kafka-log-processor/pkg/api"
+	"kafka-log-processor/pkg/auth"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+func main() {
+	name := flag.String("name", "", "unique name of the key, e.g. the service using it")
+	role := flag.String("role", "", "role of the key: "+strings.Join(auth.Roles, ", "))
+	courses := flag.String("courses", "", "comma separated course ids the key can read, "+auth.AllCourses+" for all courses")
+	flag.Parse()
+
+	if *name == "" || *role == "" {
+		log.Fatalln("-name and -role are required")
+	}
+	knownRole := false
+	for _, known := range auth.Roles {
+		knownRole = knownRole || known == *role
+	}
+	if !knownRole {
+		log.Fatalf("unknown role %v, roles are %v", *role, strings.Join(auth.Roles, ", "))
+	}
+	entry := auth.APIKey{Name: *name, Role: *role}
+	if *courses != "" {
+		entry.Courses = strings.Split(*courses, ",")
+	}
+	if entry.Role != auth.AdminRole && len(entry.Courses) == 0 {
+		log.Fatalln("-courses are required for role " + entry.Role)
+	}
+
+	key, hash, err := auth.NewAPIKey()
+	if err != nil {
+		log.Fatalf("can't make API key: %v", err)
+	}
+	entry.SHA256 = hash
+	b, err := yaml.Marshal([]auth.APIKey{entry})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Fprintf(os.Stderr, "API key (send it in %v header, it can't be shown again):\n", api.APIKeyHeader)
+	fmt.Println(key)
+	fmt.Fprintln(os.Stderr, "\nAdd to \"keys\" of the API keys file:")
+	fmt.Fprint(os.Stderr, string(b))
+}
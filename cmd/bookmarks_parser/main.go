@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"kafka-log-processor/configs"
 	"kafka-log-processor/pkg/database"
 	"kafka-log-processor/pkg/kafka"
 	"kafka-log-processor/pkg/parsers"
+	"kafka-log-processor/pkg/pseudonymization"
 	"log"
 )
 
@@ -16,17 +18,24 @@ func main() {
 
 	kafkaService := kafka.NewBookmarksTopicKafka(config.Kafka.Host, config.Kafka.Port)
 
-	elastic := database.ElasticService{}
-	err = elastic.Connect(config.Elastic.Host, config.Elastic.Port)
+	elastic, err := database.NewEventStore(config)
 	if err != nil {
-		log.Panicf("can't connect to ElasticSearch: %v", err)
+		log.Panicf("can't connect to storage: %v", err)
 	}
 
-	err = elastic.CreateBookmarksIndexIfNotExists()
+	pseudonymizer, err := pseudonymization.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+
+	ctx := context.Background()
+	err = elastic.CreateBookmarksIndexIfNotExists(ctx)
 	if err != nil {
 		log.Panicf("can't create bookmarks index: %v", err)
 	}
 
+	structureIndices := parsers.NewCourseStructureIndexCache(elastic.GetCourseStructure)
+
 	for {
 		eventLog, err := kafkaService.NextMessage()
 		if err != nil {
@@ -42,7 +51,20 @@ func main() {
 			continue
 		}
 
-		err = elastic.AddBooksmarkEventDescription(bookmarksEvent)
+		bookmarksEvent.Username, err = pseudonymizer.Pseudonymize(bookmarksEvent.Username)
+		if err != nil {
+			log.Printf("can't pseudonymize username: %v\n", err)
+			continue
+		}
+
+		structureIndex, err := structureIndices.Get(ctx, bookmarksEvent.CourseID)
+		if err != nil {
+			log.Printf("can't get structure of course %v: %v\n", bookmarksEvent.CourseID, err)
+		} else {
+			bookmarksEvent.BlockName, _ = structureIndex.DisplayName(bookmarksEvent.BlockID)
+		}
+
+		err = elastic.AddBooksmarkEventDescription(ctx, bookmarksEvent)
 		if err != nil {
 			log.Println("Cannot save parsed bookmarks log in ElasticSearch")
 			log.Println(err)
@@ -0,0 +1,54 @@
+package main
+
+// Dataset dumps all the indices into a directory of gzipped NDJSON files with a manifest
+// and restores them into an empty event store.
+// Usage: go run cmd/dataset/main.go dump -dir ./dataset
+//        go run cmd/dataset/main.go restore -dir ./dataset
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/dataset"
+	"log"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "dump" && os.Args[1] != "restore") {
+		fmt.Fprintln(os.Stderr, "usage: dataset dump|restore -dir directory")
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	dir := flags.String("dir", "./dataset", "directory of the dataset files")
+	flags.Parse(os.Args[2:])
+
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if config.Storage.Backend == database.MemoryBackend {
+		log.Fatalln("memory store doesn't outlive this command, set local.dataset_dir to load the dataset into analysis server")
+	}
+
+	eventStore, err := database.NewEventStore(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var manifest dataset.Manifest
+	if command == "dump" {
+		manifest, err = dataset.Dump(context.Background(), eventStore, *dir)
+	} else {
+		manifest, err = dataset.Restore(context.Background(), eventStore, *dir)
+	}
+	if err != nil {
+		log.Fatalf("%v failed: %v", command, err)
+	}
+	for _, index := range manifest.Indices {
+		log.Printf("%v: %v documents\n", index.Name, index.Documents)
+	}
+}
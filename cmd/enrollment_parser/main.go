@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/kafka"
+	"kafka-log-processor/pkg/parsers"
+	"kafka-log-processor/pkg/pseudonymization"
+	"log"
+)
+
+func main() {
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	kafkaService := kafka.NewEnrollmentTopicKafka(config.Kafka.Host, config.Kafka.Port)
+	es, err := database.NewEventStore(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pseudonymizer, err := pseudonymization.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+
+	ctx := context.Background()
+	err = es.CreateEnrollmentIndexIfNotExists(ctx)
+	if err != nil {
+		log.Panicf("can't create enrollment index: %v", err)
+	}
+
+	for {
+		eventLog, err := kafkaService.NextMessage()
+		if err != nil {
+			log.Println("Cannot read next message from Kafka")
+			log.Println(err)
+			continue
+		}
+
+		enrollmentEvent, err := parsers.ParseEnrollmentEvent(eventLog)
+		if err != nil {
+			log.Println("Cannot parse message from Kafka")
+			log.Println(err)
+			continue
+		}
+
+		enrollmentEvent.Username, err = pseudonymizer.Pseudonymize(enrollmentEvent.Username)
+		if err != nil {
+			log.Printf("can't pseudonymize username: %v\n", err)
+			continue
+		}
+
+		if err = es.AddEnrollmentEventDescription(ctx, enrollmentEvent); err != nil {
+			log.Println("Cannot send enrollment event to the event store")
+			log.Println(err)
+			continue
+		}
+	}
+}
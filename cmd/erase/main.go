@@ -0,0 +1,121 @@
+package main
+
+// Erase deletes all the events of learners from every event index and writes an audit record.
+// If pseudonymization is enabled, events of all the pseudonyms of the learners are deleted.
+// Usage: go run cmd/erase/main.go -usernames name1,name2 [-file usernames.txt] -reason "request #12" [-dry-run]
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/pseudonymization"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	usernamesFlag := flag.String("usernames", "", "comma separated usernames to erase")
+	usernamesFile := flag.String("file", "", "file with a username on every line")
+	reason := flag.String("reason", "", "reason of the erasure, e.g. deletion request number")
+	dryRun := flag.Bool("dry-run", false, "only count events of the learners")
+	flag.Parse()
+
+	usernames, err := readUsernames(*usernamesFlag, *usernamesFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(usernames) == 0 {
+		log.Fatalln("no usernames to erase, use -usernames or -file")
+	}
+	if *reason == "" && !*dryRun {
+		log.Fatalln("reason of the erasure is required")
+	}
+
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	auditKey, err := database.ReadAuditKey(config.Erasure.AuditKeyFile)
+	if err != nil {
+		log.Fatalf("can't read erasure.audit_key_file: %v", err)
+	}
+
+	eventStore, err := database.NewEventStore(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pseudonymizer, err := pseudonymization.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+	storedUsernames := usernames
+	if pseudonymizer != nil {
+		storedUsernames = make([]string, 0, len(usernames))
+		for _, username := range usernames {
+			pseudonyms, err := pseudonymizer.AllPseudonyms(username)
+			if err != nil {
+				log.Fatalf("can't get pseudonyms of learners: %v", err)
+			}
+			storedUsernames = append(storedUsernames, pseudonyms...)
+		}
+	}
+
+	record, err := database.EraseLearners(context.Background(), eventStore, storedUsernames, auditKey, *reason, *dryRun)
+	// audit record identifies learners by their usernames, not pseudonyms
+	record.UsernameHashes = record.UsernameHashes[:0]
+	for _, username := range usernames {
+		record.UsernameHashes = append(record.UsernameHashes, database.HashUsername(auditKey, username))
+	}
+	for indexName, result := range record.Indices {
+		log.Printf("%v: %v found, %v deleted, %v remaining\n", indexName, result.Matched, result.Deleted, result.Remaining)
+	}
+	if auditErr := database.WriteErasureAudit(config.Erasure.AuditLog, record); auditErr != nil {
+		log.Printf("Error! Can't write erasure audit record: %v\n", auditErr)
+	}
+	if err != nil {
+		log.Fatalf("erasure failed: %v", err)
+	}
+	if *dryRun {
+		return
+	}
+	if !record.Verified {
+		log.Fatalln("erasure is not verified: some events remain")
+	}
+
+	// learners can't be re-identified by pseudonyms after erasure
+	for _, username := range usernames {
+		if err = pseudonymizer.Forget(username); err != nil {
+			log.Fatalf("can't delete pseudonyms of learners: %v", err)
+		}
+	}
+}
+
+// readUsernames joins comma separated usernames and non empty lines of file fileName
+func readUsernames(usernames string, fileName string) ([]string, error) {
+	result := make([]string, 0)
+	for _, username := range strings.Split(usernames, ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			result = append(result, username)
+		}
+	}
+	if fileName == "" {
+		return result, nil
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if username := strings.TrimSpace(scanner.Text()); username != "" {
+			result = append(result, username)
+		}
+	}
+	return result, scanner.Err()
+}
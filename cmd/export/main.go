@@ -0,0 +1,59 @@
+package main
+
+// Export writes event description indices to partitioned Parquet files.
+// Usage: go run cmd/export/main.go -out ./export [-families video,problem] [-course id] [-from 2020-01-01] [-to 2020-02-01]
+
+import (
+	"context"
+	"flag"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/export"
+	"log"
+	"strings"
+	"time"
+)
+
+func main() {
+	outDir := flag.String("out", "./export", "directory to write Parquet files to")
+	families := flag.String("families", "", "comma separated event families to export (all families if empty)")
+	courseID := flag.String("course", "", "course id to export (all courses if empty)")
+	from := flag.String("from", "", "export events since this date (2006-01-02)")
+	to := flag.String("to", "", "export events until this date including it (2006-01-02)")
+	flag.Parse()
+
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	eventStore, err := database.NewEventStore(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	query := export.Query{CourseID: *courseID}
+	if *families != "" {
+		query.Families = strings.Split(*families, ",")
+	}
+	if *from != "" {
+		if query.From, err = time.Parse("2006-01-02", *from); err != nil {
+			log.Fatalf("from should be a date: %v", err)
+		}
+	}
+	if *to != "" {
+		if query.To, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("to should be a date: %v", err)
+		}
+		query.To = query.To.AddDate(0, 0, 1)
+	}
+
+	filePaths, err := export.ExportParquet(context.Background(), eventStore, query, export.DirectoryFileCreator(*outDir))
+	for _, filePath := range filePaths {
+		log.Println(filePath)
+	}
+	if err != nil {
+		log.Fatalf("export failed: %v", err)
+	}
+	log.Printf("%v files written to %v\n", len(filePaths), *outDir)
+}
@@ -0,0 +1,56 @@
+package main
+
+// Migrate moves ElasticSearch indices to the current versions of their mappings.
+// Usage: go run cmd/migrate/main.go [-index name1,name2] [-dry-run] [-keep-old]
+
+import (
+	"context"
+	"flag"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"log"
+	"strings"
+)
+
+func main() {
+	indexNames := flag.String("index", "", "comma separated names of indices to migrate (all indices if empty)")
+	dryRun := flag.Bool("dry-run", false, "only show outdated indices")
+	keepOld := flag.Bool("keep-old", false, "don't delete old versions of indices")
+	flag.Parse()
+
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	es := database.ElasticService{}
+	if err = es.Connect(config.Elastic.Host, config.Elastic.Port); err != nil {
+		log.Fatal(err)
+	}
+
+	selectedIndices := map[string]bool{}
+	if *indexNames != "" {
+		for _, indexName := range strings.Split(*indexNames, ",") {
+			selectedIndices[indexName] = true
+		}
+	}
+
+	options := database.MigrationOptions{DryRun: *dryRun, KeepOldIndex: *keepOld}
+	for _, definition := range database.IndexDefinitions {
+		if len(selectedIndices) > 0 && !selectedIndices[definition.Name] {
+			continue
+		}
+		result, err := es.MigrateIndex(context.Background(), definition, options)
+		if err != nil {
+			log.Fatalf("can't migrate index %v: %v", definition.Name, err)
+		}
+		switch {
+		case result.FromVersion >= result.ToVersion:
+			log.Printf("%v: up to date (version %v)\n", result.Name, result.FromVersion)
+		case *dryRun:
+			log.Printf("%v: outdated, version %v -> %v\n", result.Name, result.FromVersion, result.ToVersion)
+		default:
+			log.Printf("%v: migrated from version %v to %v, %v documents reindexed\n", result.Name, result.FromVersion, result.ToVersion, result.ReindexedDocuments)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"kafka-log-processor/configs"
 	"kafka-log-processor/pkg/database"
 	"kafka-log-processor/pkg/kafka"
 	"kafka-log-processor/pkg/parsers"
+	"kafka-log-processor/pkg/pseudonymization"
 	"log"
 )
 
@@ -15,13 +17,18 @@ func main() {
 	}
 
 	kafkaService := kafka.NewProblemTopicKafka(config.Kafka.Host, config.Kafka.Port)
-	es := database.ElasticService{}
-	err = es.Connect(config.Elastic.Host, config.Elastic.Port)
+	es, err := database.NewEventStore(config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = es.CreateProblemIndexIfNotExists()
+	pseudonymizer, err := pseudonymization.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+
+	ctx := context.Background()
+	err = es.CreateProblemIndexIfNotExists(ctx)
 	if err != nil {
 		log.Panicf("can't create problem index: %v", err)
 	}
@@ -41,7 +48,13 @@ func main() {
 			continue
 		}
 
-		if err = es.AddProblemEventDescription(problemEvent); err != nil {
+		problemEvent.Username, err = pseudonymizer.Pseudonymize(problemEvent.Username)
+		if err != nil {
+			log.Printf("can't pseudonymize username: %v\n", err)
+			continue
+		}
+
+		if err = es.AddProblemEventDescription(ctx, problemEvent); err != nil {
 			log.Println("Cannton send problem event to elastic")
 			log.Println(err)
 			continue
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"log"
+	"time"
+)
+
+func main() {
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	es := database.ElasticService{}
+	if err = es.Connect(config.Elastic.Host, config.Elastic.Port); err != nil {
+		log.Fatal(err)
+	}
+
+	for family := range config.Retention.Families {
+		if _, ok := database.EventFamilyIndexNames[family]; !ok {
+			log.Fatalf("unknown event family %v in retention config\n", family)
+		}
+	}
+
+	checkInterval := time.Duration(config.Retention.CheckIntervalHours) * time.Hour
+	if checkInterval <= 0 {
+		checkInterval = 24 * time.Hour
+	}
+
+	for {
+		for family, policy := range config.Retention.Families {
+			indexName := database.EventFamilyIndexNames[family]
+			processed, err := es.ApplyRetention(context.Background(), indexName, policy.MaxAgeMonths, policy.Action, time.Now().UTC())
+			if err != nil {
+				log.Printf("can't apply retention to %v: %v\n", indexName, err)
+			}
+			for _, partitionName := range processed {
+				log.Printf("retention: %v partition %v\n", policy.Action, partitionName)
+			}
+		}
+		time.Sleep(checkInterval)
+	}
+}
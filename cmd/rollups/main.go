@@ -0,0 +1,43 @@
+package main
+
+// Rollups keeps daily per-course and per-block activity up to date. Every run
+// recomputes days from lookback_days before the watermark to the current day.
+
+import (
+	"context"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/rollups"
+	"log"
+	"time"
+)
+
+func main() {
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if config.Storage.Backend == database.MemoryBackend {
+		log.Fatalln("memory store is rolled up by analysis server itself")
+	}
+
+	eventStore, err := database.NewEventStore(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	interval := time.Duration(config.Rollups.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	for {
+		watermark, err := rollups.Update(context.Background(), eventStore, time.Now(), config.Rollups.LookbackDays)
+		if err != nil {
+			log.Printf("can't update rollups: %v\n", err)
+		} else {
+			log.Printf("rollups are updated up to %v\n", watermark.Format("2006-01-02"))
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+// Rotate pseudonyms replaces pseudonyms made with old keys in stored events with pseudonyms
+// made with the current key of the keys file. Parsers must be restarted with the new current
+// key before the rotation. Old keys can be removed from the keys file after it.
+// With -backfill usernames stored before pseudonymization was enabled are replaced too.
+// Usage: go run cmd/rotate_pseudonyms/main.go [-batch 500] [-backfill]
+
+import (
+	"context"
+	"flag"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/pseudonymization"
+	"log"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 500, "number of learners renamed at once")
+	backfill := flag.Bool("backfill", false, "replace usernames stored before pseudonymization was enabled")
+	flag.Parse()
+
+	config, err := configs.GetParserConfig("./configs/parser_config.yml")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if !config.Pseudonymization.Enabled {
+		log.Fatalln("pseudonymization is disabled")
+	}
+
+	eventStore, err := database.NewEventStore(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pseudonymizer, err := pseudonymization.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+
+	if *backfill {
+		backfilled, err := pseudonymizer.Backfill(context.Background(), eventStore, *batchSize)
+		log.Printf("%v usernames replaced with pseudonyms\n", backfilled)
+		if err != nil {
+			log.Fatalf("backfill failed, run it again to continue: %v", err)
+		}
+	}
+
+	rotated, err := pseudonymizer.Rotate(context.Background(), eventStore, *batchSize)
+	log.Printf("%v pseudonyms replaced\n", rotated)
+	if err != nil {
+		log.Fatalf("rotation failed, run it again to continue: %v", err)
+	}
+}
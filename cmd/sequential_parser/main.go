@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"kafka-log-processor/configs"
 	"kafka-log-processor/pkg/database"
 	"kafka-log-processor/pkg/kafka"
 	"kafka-log-processor/pkg/parsers"
+	"kafka-log-processor/pkg/pseudonymization"
 	"log"
 )
 
@@ -15,16 +17,24 @@ func main() {
 	}
 
 	kafkaService := kafka.NewSequentialTopicKafka(config.Kafka.Host, config.Kafka.Port)
-	es := database.ElasticService{}
-	if err = es.Connect(config.Elastic.Host, config.Elastic.Port); err != nil {
+	es, err := database.NewEventStore(config)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = es.CreateSequentialIndexIfNotExists()
+	pseudonymizer, err := pseudonymization.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+
+	ctx := context.Background()
+	err = es.CreateSequentialIndexIfNotExists(ctx)
 	if err != nil {
 		log.Panicf("can't create sequential index: %v", err)
 	}
 
+	structureIndices := parsers.NewCourseStructureIndexCache(es.GetCourseStructure)
+
 	for {
 		eventLog, err := kafkaService.NextMessage()
 		if err != nil {
@@ -40,7 +50,20 @@ func main() {
 			continue
 		}
 
-		if err = es.AddSequentialMoveEventDescription(sequentialEvent); err != nil {
+		sequentialEvent.Username, err = pseudonymizer.Pseudonymize(sequentialEvent.Username)
+		if err != nil {
+			log.Printf("can't pseudonymize username: %v\n", err)
+			continue
+		}
+
+		structureIndex, err := structureIndices.Get(ctx, sequentialEvent.CourseID)
+		if err != nil {
+			log.Printf("can't get structure of course %v: %v\n", sequentialEvent.CourseID, err)
+		} else if !parsers.ResolveSequentialEventVerticals(&sequentialEvent, structureIndex) {
+			log.Printf("can't resolve tabs of sequential %v to verticals\n", sequentialEvent.SequentialID)
+		}
+
+		if err = es.AddSequentialMoveEventDescription(ctx, sequentialEvent); err != nil {
 			log.Println("cannot save event to elasticsearch")
 			log.Println(err)
 			continue
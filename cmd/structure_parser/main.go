@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"kafka-log-processor/configs"
 	"log"
@@ -37,12 +38,13 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	es := database.ElasticService{}
-	if err = es.Connect(config.Elastic.Host, config.Elastic.Port); err != nil {
+	es, err := database.NewEventStore(config)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = es.CreateStructureIndexIfNotExists()
+	ctx := context.Background()
+	err = es.CreateStructureIndexIfNotExists(ctx)
 	if err != nil {
 		log.Panicf("can't create structure index: %v", err)
 	}
@@ -61,7 +63,7 @@ func main() {
 			continue
 		}
 
-		if err = es.AddCourseStructure(course); err != nil {
+		if err = es.AddCourseStructure(ctx, course); err != nil {
 			log.Println(err)
 		}
 
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"kafka-log-processor/configs"
 	"kafka-log-processor/pkg/database"
 	"kafka-log-processor/pkg/kafka"
 	"kafka-log-processor/pkg/parsers"
+	"kafka-log-processor/pkg/pseudonymization"
 	"log"
 )
 
@@ -15,12 +17,18 @@ func main() {
 	}
 
 	kafkaService := kafka.NewVideoTopicKafka(config.Kafka.Host, config.Kafka.Port)
-	elastic := database.ElasticService{}
-	err = elastic.Connect(config.Elastic.Host, config.Elastic.Port)
+	elastic, err := database.NewEventStore(config)
 	if err != nil {
-		log.Panicf("cannot connect to ElasticSearch: %v", err)
+		log.Panicf("cannot connect to storage: %v", err)
 	}
-	err = elastic.CreateVideoIndexIfNotExists()
+
+	pseudonymizer, err := pseudonymization.FromConfig(config)
+	if err != nil {
+		log.Fatalf("can't set up pseudonymization: %v", err)
+	}
+
+	ctx := context.Background()
+	err = elastic.CreateVideoIndexIfNotExists(ctx)
 	if err != nil {
 		log.Panicf("cannot create video index: %v", err)
 	}
@@ -40,7 +48,13 @@ func main() {
 			continue
 		}
 
-		err = elastic.AddVideoEventDescription(videoEvent)
+		videoEvent.Username, err = pseudonymizer.Pseudonymize(videoEvent.Username)
+		if err != nil {
+			log.Printf("can't pseudonymize username: %v\n", err)
+			continue
+		}
+
+		err = elastic.AddVideoEventDescription(ctx, videoEvent)
 		if err != nil {
 			log.Println("Cannot save parsed log in ElasticSearch")
 			log.Println(err)
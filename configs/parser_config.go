@@ -1,6 +1,7 @@
 package configs
 
 import (
+	"fmt"
 	"os"
 
 	"gopkg.in/yaml.v2"
@@ -16,6 +17,87 @@ type ParserConfig struct {
 		Host string `yaml:"host"`
 		Port int    `yaml:"port"`
 	} `yaml:"elastic"`
+	Storage struct {
+		Backend    string `yaml:"backend"`
+		SQLitePath string `yaml:"sqlite_path"`
+	} `yaml:"storage"`
+	AnalysisServer struct {
+		Address               string   `yaml:"address"`
+		RequestTimeoutSeconds int      `yaml:"request_timeout_seconds"`
+		ExportTimeoutSeconds  int      `yaml:"export_timeout_seconds"`
+		CORSAllowedOrigins    []string `yaml:"cors_allowed_origins"`
+		Jobs                  struct {
+			Workers          int `yaml:"workers"`
+			QueueSize        int `yaml:"queue_size"`
+			CacheSize        int `yaml:"cache_size"`
+			TimeoutMinutes   int `yaml:"timeout_minutes"`
+			ResultTTLMinutes int `yaml:"result_ttl_minutes"`
+		} `yaml:"jobs"`
+		Charts struct {
+			CacheSize int `yaml:"cache_size"`
+		} `yaml:"charts"`
+		Live struct {
+			Enabled       bool     `yaml:"enabled"`
+			Topics        []string `yaml:"topics"`
+			WindowMinutes int      `yaml:"window_minutes"`
+			UpdateSeconds int      `yaml:"update_seconds"`
+		} `yaml:"live"`
+		Dashboard struct {
+			SessionMinutes  int  `yaml:"session_minutes"`
+			InsecureCookies bool `yaml:"insecure_cookies"`
+		} `yaml:"dashboard"`
+	} `yaml:"analysis_server"`
+	Auth struct {
+		Enabled     bool   `yaml:"enabled"`
+		APIKeysFile string `yaml:"api_keys_file"`
+		JWT         struct {
+			HS256SecretFile    string `yaml:"hs256_secret_file"`
+			RS256PublicKeyFile string `yaml:"rs256_public_key_file"`
+			Issuer             string `yaml:"issuer"`
+			Audience           string `yaml:"audience"`
+		} `yaml:"jwt"`
+	} `yaml:"auth"`
+	Local struct {
+		LogsDir       string `yaml:"logs_dir"`
+		StructuresDir string `yaml:"structures_dir"`
+		DatasetDir    string `yaml:"dataset_dir"`
+	} `yaml:"local"`
+	Retention struct {
+		CheckIntervalHours int                        `yaml:"check_interval_hours"`
+		Families           map[string]RetentionPolicy `yaml:"families"`
+	} `yaml:"retention"`
+	Rollups struct {
+		IntervalHours int `yaml:"interval_hours"`
+		LookbackDays  int `yaml:"lookback_days"`
+	} `yaml:"rollups"`
+	Erasure struct {
+		AuditLog     string `yaml:"audit_log"`
+		AuditKeyFile string `yaml:"audit_key_file"`
+	} `yaml:"erasure"`
+	Pseudonymization struct {
+		Enabled               bool   `yaml:"enabled"`
+		KeysFile              string `yaml:"keys_file"`
+		ReidentificationTable string `yaml:"reidentification_table"`
+		APIUsernames          string `yaml:"api_usernames"`
+	} `yaml:"pseudonymization"`
+}
+
+// RetentionPolicy determines how long partitions of event family are kept.
+// Action is "delete" or "close".
+type RetentionPolicy struct {
+	MaxAgeMonths int    `yaml:"max_age_months"`
+	Action       string `yaml:"action"`
+}
+
+// Validate checks that partitions are kept for at least a month and the action is known
+func (policy RetentionPolicy) Validate() error {
+	if policy.MaxAgeMonths <= 0 {
+		return fmt.Errorf("Retention max_age_months must be positive, got %v", policy.MaxAgeMonths)
+	}
+	if policy.Action != "delete" && policy.Action != "close" {
+		return fmt.Errorf("Unknown retention action %q", policy.Action)
+	}
+	return nil
 }
 
 // GetParserConfig returns config object. It takes an configFileName to
@@ -34,6 +116,11 @@ func GetParserConfig(configFileName string) (ParserConfig, error) {
 	if err != nil {
 		return ParserConfig{}, err
 	}
+	for family, policy := range cfg.Retention.Families {
+		if err = policy.Validate(); err != nil {
+			return ParserConfig{}, fmt.Errorf("retention of %v: %w", family, err)
+		}
+	}
 
 	return cfg, nil
 }
@@ -0,0 +1,35 @@
+package configs
+
+import "testing"
+
+func TestRetentionPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		wantErr bool
+	}{
+		{"delete", RetentionPolicy{MaxAgeMonths: 12, Action: "delete"}, false},
+		{"close", RetentionPolicy{MaxAgeMonths: 1, Action: "close"}, false},
+		{"zero age", RetentionPolicy{MaxAgeMonths: 0, Action: "delete"}, true},
+		{"negative age", RetentionPolicy{MaxAgeMonths: -1, Action: "close"}, true},
+		{"unknown action", RetentionPolicy{MaxAgeMonths: 12, Action: "archive"}, true},
+		{"no action", RetentionPolicy{MaxAgeMonths: 12}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.policy.Validate(); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetParserConfig(t *testing.T) {
+	config, err := GetParserConfig("parser_config.yml")
+	if err != nil {
+		t.Fatalf("GetParserConfig() error = %v", err)
+	}
+	if len(config.Retention.Families) == 0 {
+		t.Errorf("config has no retention policies")
+	}
+}
@@ -0,0 +1,191 @@
+package analysers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"log"
+	"sort"
+	"time"
+)
+
+type addedBookmark struct {
+	username string
+	blockID  string
+	time     time.Time
+}
+
+// GetCourseBookmarksReport returns bookmarks analytics of the course: net active bookmarks
+// of every block over time, the most bookmarked blocks and how often and how fast
+// learners return to the blocks they have bookmarked. Only events matching filter are used.
+// course must have format: "course-v1:org+CourseCode+CourseRun"
+func (a *Analyser) GetCourseBookmarksReport(ctx context.Context, course string, filter models.Filter) (*models.BookmarksReport, error) {
+	eventFilter, err := a.getEventFilter(ctx, course, filter)
+	if err != nil {
+		return nil, err
+	}
+	bookmarksEvents, err := a.eventStore.GetCourseBookmarkEventsSortedByTime(ctx, course, eventFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	structureIndex, err := a.GetCourseStructureIndex(ctx, course)
+	if err != nil {
+		log.Printf("WARN: bookmarks of course %v will have no display names: %v\n", course, err)
+	}
+
+	blocks := map[string]*models.BlockBookmarks{}
+	timelines := map[string]*models.BookmarksTimeline{}
+	activeBookmarks := map[string]bool{}
+	addedBookmarks := make([]addedBookmark, 0)
+	for _, bookmarksEvent := range bookmarksEvents {
+		eventTime, err := models.ParseEventTime(bookmarksEvent.EventTime)
+		if err != nil {
+			log.Printf("WARN: bookmark event has incorrect time %v\n", bookmarksEvent.EventTime)
+			continue
+		}
+		blockID := bookmarksEvent.BlockID
+		if blockID == "" {
+			blockID = models.GetBlockIDFromUsageKey(bookmarksEvent.ID)
+		}
+		block, ok := blocks[blockID]
+		if !ok {
+			displayName, _ := structureIndex.DisplayName(blockID)
+			block = &models.BlockBookmarks{BlockID: blockID, DisplayName: displayName}
+			blocks[blockID] = block
+			timelines[blockID] = &models.BookmarksTimeline{BlockID: blockID, DisplayName: displayName}
+		}
+
+		bookmarkKey := bookmarksEvent.Username + "\n" + blockID
+		if bookmarksEvent.IsAdded {
+			block.AddedBookmarks++
+			addedBookmarks = append(addedBookmarks, addedBookmark{username: bookmarksEvent.Username, blockID: blockID, time: eventTime})
+			if !activeBookmarks[bookmarkKey] {
+				block.ActiveBookmarks++
+			}
+		} else if activeBookmarks[bookmarkKey] {
+			block.ActiveBookmarks--
+		}
+		activeBookmarks[bookmarkKey] = bookmarksEvent.IsAdded
+
+		timeline := timelines[blockID]
+		date := eventTime.UTC().Format("2006-01-02")
+		if len(timeline.Dates) > 0 && timeline.Dates[len(timeline.Dates)-1] == date {
+			timeline.ActiveBookmarks[len(timeline.ActiveBookmarks)-1] = block.ActiveBookmarks
+		} else {
+			timeline.Dates = append(timeline.Dates, date)
+			timeline.ActiveBookmarks = append(timeline.ActiveBookmarks, block.ActiveBookmarks)
+		}
+	}
+
+	returnDelays, err := a.getBookmarkReturnDelays(ctx, course, addedBookmarks, structureIndex, eventFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := models.BookmarksReport{
+		Blocks:    make([]models.BlockBookmarks, 0, len(blocks)),
+		Timelines: make([]models.BookmarksTimeline, 0, len(timelines)),
+	}
+	allReturnDelays := make([]float64, 0)
+	for blockID, block := range blocks {
+		block.Returns = len(returnDelays[blockID])
+		block.MedianReturnDelaySeconds = median(returnDelays[blockID])
+		allReturnDelays = append(allReturnDelays, returnDelays[blockID]...)
+		report.Blocks = append(report.Blocks, *block)
+		report.Timelines = append(report.Timelines, *timelines[blockID])
+	}
+	sort.Slice(report.Blocks, func(i, j int) bool {
+		if report.Blocks[i].ActiveBookmarks != report.Blocks[j].ActiveBookmarks {
+			return report.Blocks[i].ActiveBookmarks > report.Blocks[j].ActiveBookmarks
+		}
+		return report.Blocks[i].AddedBookmarks > report.Blocks[j].AddedBookmarks
+	})
+	sort.Slice(report.Timelines, func(i, j int) bool {
+		iPosition, _ := structureIndex.Position(report.Timelines[i].BlockID)
+		jPosition, _ := structureIndex.Position(report.Timelines[j].BlockID)
+		return iPosition < jPosition
+	})
+	if len(addedBookmarks) > 0 {
+		report.ReturnRate = float64(len(allReturnDelays)) / float64(len(addedBookmarks))
+	}
+	report.MedianReturnDelaySeconds = median(allReturnDelays)
+
+	return &report, nil
+}
+
+// getBookmarkReturnDelays finds for every added bookmark the first time learner came back
+// to the bookmarked unit after leaving it. It returns delays in seconds grouped by block.
+// Progress is reported by learners.
+func (a *Analyser) getBookmarkReturnDelays(ctx context.Context, course string, addedBookmarks []addedBookmark, structureIndex models.CourseStructureIndex, eventFilter database.EventFilter) (map[string][]float64, error) {
+	userBookmarks := map[string][]addedBookmark{}
+	for _, bookmark := range addedBookmarks {
+		userBookmarks[bookmark.username] = append(userBookmarks[bookmark.username], bookmark)
+	}
+
+	returnDelays := map[string][]float64{}
+	done := 0
+	for username, bookmarks := range userBookmarks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		reportProgress(ctx, done, len(userBookmarks))
+		done++
+		userActions, err := a.eventStore.GetUserCourseEventsSortedByTime(ctx, username, course, eventFilter)
+		if err != nil {
+			return nil, err
+		}
+
+		actionUnits := make([]string, len(userActions))
+		currentBlockID := ""
+		for i, action := range userActions {
+			if action.Index == database.BookmarsEventDescriptionIndexName {
+				continue
+			}
+			blockID, ok := resolveRouteBlock(action, currentBlockID, structureIndex)
+			if !ok {
+				continue
+			}
+			currentBlockID = blockID
+			actionUnits[i] = unitOf(blockID, structureIndex)
+		}
+
+		for _, bookmark := range bookmarks {
+			bookmarkUnit := unitOf(bookmark.blockID, structureIndex)
+			hasLeft := false
+			for i, action := range userActions {
+				if !action.Time.After(bookmark.time) || actionUnits[i] == "" {
+					continue
+				}
+				if actionUnits[i] != bookmarkUnit {
+					hasLeft = true
+				} else if hasLeft {
+					returnDelays[bookmark.blockID] = append(returnDelays[bookmark.blockID], action.Time.Sub(bookmark.time).Seconds())
+					break
+				}
+			}
+		}
+	}
+	return returnDelays, nil
+}
+
+// unitOf returns vertical that contains the block or the block itself if it is unknown
+func unitOf(blockID string, structureIndex models.CourseStructureIndex) string {
+	if vertical, ok := structureIndex.VerticalOf(blockID); ok {
+		return vertical
+	}
+	return blockID
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sortedValues := append([]float64(nil), values...)
+	sort.Float64s(sortedValues)
+	middle := len(sortedValues) / 2
+	if len(sortedValues)%2 == 0 {
+		return (sortedValues[middle-1] + sortedValues[middle]) / 2
+	}
+	return sortedValues[middle]
+}
@@ -0,0 +1,73 @@
+package analysers
+
+import (
+	"context"
+	"errors"
+	"kafka-log-processor/pkg/models"
+	"kafka-log-processor/pkg/rollups"
+	"time"
+)
+
+// GetCourseActivity returns activity of the course and its blocks by days or hours from filter.From
+// to filter.To. Zero From and To aren't limits. Daily activity of all the learners is read from
+// the rollups of the days before the rollup watermark, later days, hourly activity and activity
+// of selected learners or platforms are computed from the events.
+// Days of daily activity always start at midnight UTC, so From is truncated to the day.
+func (a *Analyser) GetCourseActivity(ctx context.Context, course string, granularity string, filter models.Filter) (*models.CourseActivity, error) {
+	from, to := filter.From, filter.To
+	activities := make([]models.BlockActivity, 0)
+	eventsFrom := from
+	switch granularity {
+	case rollups.DayGranularity:
+		from = from.UTC().Truncate(24 * time.Hour)
+		eventsFrom = from
+		if filter.SelectsLearners() {
+			break
+		}
+		watermark, err := a.eventStore.GetRollupWatermark(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !watermark.IsZero() && watermark.After(from) {
+			rollupsTo := watermark
+			if !to.IsZero() && to.Before(watermark) {
+				rollupsTo = to
+			}
+			if activities, err = a.eventStore.GetDailyRollups(ctx, course, from, rollupsTo); err != nil {
+				return nil, err
+			}
+			eventsFrom = watermark
+		}
+	case rollups.HourGranularity:
+	default:
+		return nil, errors.New("Unknown granularity " + granularity)
+	}
+
+	if to.IsZero() || eventsFrom.Before(to) {
+		eventFilter, err := a.getEventFilter(ctx, course, filter)
+		if err != nil {
+			return nil, err
+		}
+		eventFilter.From = eventsFrom
+		aggregator := rollups.NewAggregator(granularity)
+		if err = rollups.Aggregate(ctx, a.eventStore, course, eventFilter, aggregator); err != nil {
+			return nil, err
+		}
+		activities = append(activities, aggregator.Activities()...)
+	}
+
+	report := &models.CourseActivity{
+		CourseID:    course,
+		Granularity: granularity,
+		Course:      make([]models.BlockActivity, 0),
+		Blocks:      make([]models.BlockActivity, 0),
+	}
+	for _, activity := range activities {
+		if activity.BlockID == "" {
+			report.Course = append(report.Course, activity)
+		} else {
+			report.Blocks = append(report.Blocks, activity)
+		}
+	}
+	return report, nil
+}
@@ -1,109 +1,134 @@
 package analysers
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"kafka-log-processor/pkg/database"
 	"kafka-log-processor/pkg/models"
 	"log"
-	"strings"
+	"sort"
 )
 
-// GetCourseUsersRoute returns points for plot that shows users route on specified course.
+// GetCourseUsersRoute returns time-ordered routes of every learner on specified course.
+// Video, problem, sequential, bookmark and link events matching filter are used, each step
+// is resolved to a position in the course structure.
+// Progress is reported by learners.
 // course must have format: "course-v1:org+CourseCode+CourseRun"
-func (a *Analyser) GetCourseUsersRoute(course string) ([]models.Curve, error) {
-	videoUsernames, err := a.elasticService.GetUniqueStringFieldValuesInIndexWithFilter(database.VideoEventDescriptionIndexName, "username", "course_id", course)
+func (a *Analyser) GetCourseUsersRoute(ctx context.Context, course string, filter models.Filter) ([]models.UserRoute, error) {
+	eventFilter, err := a.getEventFilter(ctx, course, filter)
 	if err != nil {
 		return nil, err
 	}
-
-	problemUsernames, err := a.elasticService.GetUniqueStringFieldValuesInIndexWithFilter(database.ProblemEventDescriptionIndexName, "username", "course_id", course)
+	usernames, err := a.getCourseUsernames(ctx, course, eventFilter)
 	if err != nil {
 		return nil, err
 	}
 
-	usernames := append(videoUsernames, problemUsernames...)
-	fmt.Printf("usernames:%v", len(usernames))
-	itemOrdersMap, err := a.getItemOrdersMap(course)
+	structureIndex, err := a.GetCourseStructureIndex(ctx, course)
 	if err != nil {
 		return nil, err
 	}
 
-	curves := []models.Curve{}
-
-	for _, username := range usernames {
-		X := make([]int, 0)
-		Y := make([]int, 0)
-		actionNumber := 0
-		userActions, err := a.elasticService.GetUserVideoAndProblemEventsTimes(username, course)
+	routes := make([]models.UserRoute, 0, len(usernames))
+	for i, username := range usernames {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		reportProgress(ctx, i, len(usernames))
+		userActions, err := a.eventStore.GetUserCourseEventsSortedByTime(ctx, username, course, eventFilter)
 		if err != nil {
 			return nil, err
 		}
-		prevActionID := ""
+
+		route := models.UserRoute{Username: username, Steps: make([]models.RouteStep, 0)}
+		currentBlockID := ""
 		for _, action := range userActions {
-			if action.ProblemID != "" {
-				if action.ProblemID != prevActionID {
-					problemOrder, ok := itemOrdersMap[action.ProblemID]
-					if !ok {
-						log.Printf("WARN: couldn't get order of item with ID %v\n", action.ProblemID)
-						continue
-					}
-					X = append(X, problemOrder)
-					Y = append(Y, actionNumber)
-					actionNumber++
-					prevActionID = action.ProblemID
-				}
+			blockID, ok := resolveRouteBlock(action, currentBlockID, structureIndex)
+			if !ok {
+				log.Printf("WARN: couldn't resolve %v event of user %v to the course structure\n", action.Index, username)
+				continue
 			}
-
-			if action.VideoID != "" {
-				if action.VideoID != prevActionID {
-					videoOrder, ok := itemOrdersMap[action.VideoID]
-					if !ok {
-						log.Printf("WARN: couldn't get order of item with ID %v\n", action.VideoID)
-						continue
-					}
-					X = append(X, videoOrder)
-					Y = append(Y, actionNumber)
-					actionNumber++
-					prevActionID = action.VideoID
-				}
+			if blockID == currentBlockID {
+				continue
 			}
+			position, _ := structureIndex.Position(blockID)
+			route.Steps = append(route.Steps, models.RouteStep{
+				Position:  position,
+				BlockID:   blockID,
+				EventType: action.EventType,
+				Index:     action.Index,
+				Time:      action.Time,
+			})
+			currentBlockID = blockID
 		}
 
-		curves = append(curves, models.Curve{X: X, Y: Y})
+		route.CalculateMetrics()
+		routes = append(routes, route)
 	}
-	return curves, nil
+	return routes, nil
 }
 
-func (a *Analyser) getItemOrdersMap(course string) (map[string]int, error) {
-	courseIDSplit := strings.Split(course, "+")
-	if len(courseIDSplit) < 3 {
-		return nil, errors.New("CourseID had incorrect format")
+// resolveRouteBlock returns url_name of the block event action happened on.
+// Old sequential events don't have sequential ID, so for them the tab is looked
+// up in the sequential of the learner's current block.
+func resolveRouteBlock(action database.UserCourseEvent, currentBlockID string, structureIndex models.CourseStructureIndex) (string, bool) {
+	var blockID string
+	switch action.Index {
+	case database.VideoEventDescriptionIndexName:
+		blockID = action.VideoID
+	case database.ProblemEventDescriptionIndexName:
+		blockID = action.ProblemID
+	case database.BookmarsEventDescriptionIndexName:
+		blockID = models.GetBlockIDFromUsageKey(action.BookmarkID)
+	case database.LinkEventDescriptionIndexName:
+		return structureIndex.BlockFromCoursewareURL(action.TargetURL)
+	case database.SequentialEventDescriptionIndexName:
+		if action.SequentialID != "" {
+			return structureIndex.SequentialVertical(models.GetBlockIDFromUsageKey(action.SequentialID), action.New)
+		}
+		sequential, ok := structureIndex.SequentialOf(currentBlockID)
+		if !ok {
+			return "", false
+		}
+		return structureIndex.SequentialVertical(sequential, action.New)
 	}
+	_, ok := structureIndex.Position(blockID)
+	return blockID, ok
+}
 
-	result := map[string]int{}
-	currentItemNumber := 0
-	courseCode := courseIDSplit[1]
+// GetCourseLearners returns sorted usernames of learners of course with events selected by filter
+func (a *Analyser) GetCourseLearners(ctx context.Context, course string, filter models.Filter) ([]string, error) {
+	eventFilter, err := a.getEventFilter(ctx, course, filter)
+	if err != nil {
+		return nil, err
+	}
+	return a.getCourseUsernames(ctx, course, eventFilter)
+}
 
-	courseStructure, err := a.elasticService.GetCourseStructure(courseCode)
+// getCourseUsernames returns sorted usernames of learners with events of the course matching eventFilter
+func (a *Analyser) getCourseUsernames(ctx context.Context, course string, eventFilter database.EventFilter) ([]string, error) {
+	counts, err := a.countCourseUserEvents(ctx, course, eventFilter)
 	if err != nil {
 		return nil, err
 	}
+	usernames := make([]string, 0, len(counts))
+	for username := range counts {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
 
-	for _, chapter := range courseStructure.Chapters {
-		for _, sequential := range chapter.Sequentials {
-			for _, vertical := range sequential.Verticals {
-				for _, video := range vertical.Videos {
-					result[video.URLName] = currentItemNumber
-					currentItemNumber++
-				}
-				for _, problem := range vertical.Problems {
-					result[problem.URLName] = currentItemNumber
-					currentItemNumber++
-				}
-			}
-		}
+// GetCourseStructureIndex returns index of the structure of course "course-v1:org+CourseCode+CourseRun"
+func (a *Analyser) GetCourseStructureIndex(ctx context.Context, course string) (models.CourseStructureIndex, error) {
+	courseCode, err := models.GetCourseCodeFromCourseID(course)
+	if err != nil {
+		return models.CourseStructureIndex{}, err
+	}
+
+	courseStructure, err := a.eventStore.GetCourseStructure(ctx, courseCode)
+	if err != nil {
+		return models.CourseStructureIndex{}, err
 	}
 
-	return result, nil
+	return models.NewCourseStructureIndex(courseStructure), nil
 }
@@ -0,0 +1,69 @@
+package analysers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"log"
+	"sort"
+)
+
+// GetMostClickedExternalResources returns size most clicked external resources of the course
+// and of every course unit links were clicked in. Only clicks matching filter are counted.
+// course must have format: "course-v1:org+CourseCode+CourseRun"
+func (a *Analyser) GetMostClickedExternalResources(ctx context.Context, course string, size int, filter models.Filter) (*models.ExternalResourcesReport, error) {
+	filters := map[string]interface{}{
+		"course_id": course,
+		"link_type": models.EXTERNAL,
+	}
+	eventFilter, err := a.getEventFilter(ctx, course, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	courseCounts, err := a.eventStore.GetStringFieldValuesCountsWithFilters(ctx, database.LinkEventDescriptionIndexName, "target_resource", filters, eventFilter, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	unitsCounts, err := a.eventStore.GetNestedStringFieldValuesCountsWithFilters(ctx, database.LinkEventDescriptionIndexName, "current_block_id", "target_resource", filters, eventFilter, size)
+	if err != nil {
+		return nil, err
+	}
+
+	structureIndex, err := a.GetCourseStructureIndex(ctx, course)
+	if err != nil {
+		log.Printf("WARN: units of course %v will have no display names: %v\n", course, err)
+	}
+
+	report := models.ExternalResourcesReport{
+		Course: toResourceClicks(courseCounts),
+		Units:  make([]models.UnitResourceClicks, 0, len(unitsCounts)),
+	}
+	for blockID, counts := range unitsCounts {
+		displayName, _ := structureIndex.DisplayName(blockID)
+		report.Units = append(report.Units, models.UnitResourceClicks{
+			BlockID:     blockID,
+			DisplayName: displayName,
+			Resources:   toResourceClicks(counts),
+		})
+	}
+	sort.Slice(report.Units, func(i, j int) bool {
+		iPosition, _ := structureIndex.Position(report.Units[i].BlockID)
+		jPosition, _ := structureIndex.Position(report.Units[j].BlockID)
+		return iPosition < jPosition
+	})
+
+	return &report, nil
+}
+
+func toResourceClicks(counts []database.FieldValueCount) []models.ResourceClicks {
+	result := make([]models.ResourceClicks, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, models.ResourceClicks{Resource: count.Value, Clicks: count.Count})
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package analysers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"sort"
+	"time"
+)
+
+// getEventFilter resolves filter of the analysis of course to the filter of the event store
+// searches: enrollment modes and minimum number of events become the list of selected learners.
+func (a *Analyser) getEventFilter(ctx context.Context, course string, filter models.Filter) (database.EventFilter, error) {
+	eventFilter := database.EventFilter{From: filter.From, To: filter.To, Platforms: filter.Platforms}
+	if len(filter.Usernames) > 0 {
+		eventFilter.Usernames = filter.Usernames
+	}
+
+	if len(filter.EnrollmentModes) > 0 {
+		modes, err := a.getEnrollmentModes(ctx, course, filter.To)
+		if err != nil {
+			return database.EventFilter{}, err
+		}
+		usernames := make([]string, 0)
+		for username, mode := range modes {
+			if containsString(filter.EnrollmentModes, mode) && (eventFilter.Usernames == nil || containsString(eventFilter.Usernames, username)) {
+				usernames = append(usernames, username)
+			}
+		}
+		sort.Strings(usernames)
+		eventFilter.Usernames = usernames
+	}
+
+	if filter.MinEvents > 0 {
+		counts, err := a.countCourseUserEvents(ctx, course, eventFilter)
+		if err != nil {
+			return database.EventFilter{}, err
+		}
+		usernames := make([]string, 0)
+		for username, count := range counts {
+			if count >= int64(filter.MinEvents) {
+				usernames = append(usernames, username)
+			}
+		}
+		sort.Strings(usernames)
+		eventFilter.Usernames = usernames
+	}
+	return eventFilter, nil
+}
+
+// getEnrollmentModes returns mode of the last enrollment event before to (if to isn't zero)
+// of every learner of the course. Learners keep the mode of their last enrollment after unenrolling.
+// Events are matched to learners by user ids, usernames of the ids are taken from the events
+// the learners made themselves, events without user ids are matched by usernames.
+func (a *Analyser) getEnrollmentModes(ctx context.Context, course string, to time.Time) (map[string]string, error) {
+	modes := map[string]string{}
+	userModes := map[int64]string{}
+	usernames := map[int64]string{}
+	query := database.CourseEventsQuery{
+		IndexName:   database.EnrollmentEventDescriptionIndexName,
+		CourseID:    course,
+		EventFilter: database.EventFilter{To: to},
+	}
+	err := a.eventStore.ScanCourseEvents(ctx, query, func(event database.CourseEvent) error {
+		enrollmentEvent, ok := event.Document.(models.EnrollmentEventDescription)
+		if !ok {
+			return nil
+		}
+		if enrollmentEvent.UserID != 0 && enrollmentEvent.Username != "" {
+			usernames[enrollmentEvent.UserID] = enrollmentEvent.Username
+		}
+		switch {
+		case enrollmentEvent.Mode == "":
+		case enrollmentEvent.UserID != 0:
+			userModes[enrollmentEvent.UserID] = enrollmentEvent.Mode
+		case enrollmentEvent.Username != "":
+			modes[enrollmentEvent.Username] = enrollmentEvent.Mode
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for userID, mode := range userModes {
+		if username, ok := usernames[userID]; ok {
+			modes[username] = mode
+		}
+	}
+	return modes, nil
+}
+
+// countCourseUserEvents returns numbers of activity events of every learner of the course matching eventFilter
+func (a *Analyser) countCourseUserEvents(ctx context.Context, course string, eventFilter database.EventFilter) (map[string]int64, error) {
+	counts := map[string]int64{}
+	for _, indexName := range database.ActivityIndexNames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		indexCounts, err := a.eventStore.CountUserEvents(ctx, indexName, course, eventFilter)
+		if err != nil {
+			return nil, err
+		}
+		for username, count := range indexCounts {
+			counts[username] += count
+		}
+	}
+	return counts, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package analysers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestGetEnrollmentModes(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	enrollmentEvents := []models.EnrollmentEventDescription{
+		{EventTime: "2020-03-01T10:00:00Z", Username: "a", UserID: 1, Mode: "audit", IsActive: true, CourseID: testCourseID},
+		// staff upgraded learner a, the event has no username
+		{EventTime: "2020-03-02T10:00:00Z", UserID: 1, Mode: "verified", IsActive: true, CourseID: testCourseID},
+		{EventTime: "2020-03-01T10:00:00Z", Username: "b", UserID: 2, Mode: "audit", IsActive: true, CourseID: testCourseID},
+		// staff enrolled learner 3, who never made an enrollment event themselves
+		{EventTime: "2020-03-01T10:00:00Z", UserID: 3, Mode: "verified", IsActive: true, CourseID: testCourseID},
+		// event logged without user ids
+		{EventTime: "2020-03-01T10:00:00Z", Username: "c", Mode: "honor", IsActive: true, CourseID: testCourseID},
+	}
+	for _, enrollmentEvent := range enrollmentEvents {
+		if err := store.AddEnrollmentEventDescription(ctx, enrollmentEvent); err != nil {
+			t.Fatalf("can't add event: %v", err)
+		}
+	}
+
+	modes, err := New(store).getEnrollmentModes(ctx, testCourseID, time.Time{})
+	if err != nil {
+		t.Fatalf("getEnrollmentModes() error = %v", err)
+	}
+	want := map[string]string{"a": "verified", "b": "audit", "c": "honor"}
+	if len(modes) != len(want) {
+		t.Fatalf("got = %v, want %v", modes, want)
+	}
+	for username, mode := range want {
+		if modes[username] != mode {
+			t.Errorf("got = %v, want %v", modes, want)
+		}
+	}
+}
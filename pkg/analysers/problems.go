@@ -0,0 +1,94 @@
+package analysers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"log"
+	"sort"
+)
+
+// problemLearner is the progress of a learner on a problem
+type problemLearner struct {
+	attempts           int
+	firstAttemptSolved bool
+	lastSolved         bool
+}
+
+// GetCourseProblemsReport returns statistics of graded submissions of every course problem.
+// Only submissions matching filter are counted.
+// course must have format: "course-v1:org+CourseCode+CourseRun"
+func (a *Analyser) GetCourseProblemsReport(ctx context.Context, course string, filter models.Filter) (*models.ProblemsReport, error) {
+	eventFilter, err := a.getEventFilter(ctx, course, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := map[string]*models.ProblemStatistics{}
+	scoreSums := map[string]float64{}
+	learners := map[string]map[string]*problemLearner{}
+	query := database.CourseEventsQuery{IndexName: database.ProblemEventDescriptionIndexName, CourseID: course, EventFilter: eventFilter}
+	err = a.eventStore.ScanCourseEvents(ctx, query, func(event database.CourseEvent) error {
+		problemEvent, ok := event.Document.(models.ProblemEventDescription)
+		if !ok || problemEvent.EventType != models.ProblemSubmittedEventType {
+			return nil
+		}
+		problem, ok := problems[problemEvent.ProblemID]
+		if !ok {
+			problem = &models.ProblemStatistics{ProblemID: problemEvent.ProblemID}
+			problems[problemEvent.ProblemID] = problem
+			learners[problemEvent.ProblemID] = map[string]*problemLearner{}
+		}
+		problem.Submissions++
+		solved := false
+		if problemEvent.WeightedPossible > 0 {
+			scoreSums[problemEvent.ProblemID] += problemEvent.WeightedEarned / problemEvent.WeightedPossible
+			solved = problemEvent.WeightedEarned >= problemEvent.WeightedPossible
+		}
+		learner, ok := learners[problemEvent.ProblemID][problemEvent.Username]
+		if !ok {
+			learner = &problemLearner{firstAttemptSolved: solved}
+			learners[problemEvent.ProblemID][problemEvent.Username] = learner
+		}
+		learner.attempts++
+		learner.lastSolved = solved
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	structureIndex, err := a.GetCourseStructureIndex(ctx, course)
+	if err != nil {
+		log.Printf("WARN: problems of course %v will have no display names: %v\n", course, err)
+	}
+	report := &models.ProblemsReport{CourseID: course, Problems: make([]models.ProblemStatistics, 0, len(problems))}
+	inStructure := map[string]bool{}
+	for problemID, problem := range problems {
+		problem.DisplayName, _ = structureIndex.DisplayName(problemID)
+		problem.Position, inStructure[problemID] = structureIndex.Position(problemID)
+		problem.Learners = len(learners[problemID])
+		problem.MeanScore = scoreSums[problemID] / float64(problem.Submissions)
+		problem.MeanAttempts = float64(problem.Submissions) / float64(problem.Learners)
+		for _, learner := range learners[problemID] {
+			if learner.lastSolved {
+				problem.SolvedLearners++
+			}
+			if learner.firstAttemptSolved {
+				problem.FirstAttemptSolvedLearners++
+			}
+		}
+		report.Problems = append(report.Problems, *problem)
+	}
+	sort.Slice(report.Problems, func(i, j int) bool {
+		left, right := report.Problems[i], report.Problems[j]
+		if inStructure[left.ProblemID] != inStructure[right.ProblemID] {
+			return inStructure[left.ProblemID]
+		}
+		if left.Position != right.Position {
+			return left.Position < right.Position
+		}
+		return left.ProblemID < right.ProblemID
+	})
+	return report, nil
+}
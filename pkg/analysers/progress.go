@@ -0,0 +1,20 @@
+package analysers
+
+import "context"
+
+// ProgressFunc is told how many of total steps of a long analysis are done
+type ProgressFunc func(done int, total int)
+
+type progressKey struct{}
+
+// WithProgress returns ctx whose analyses report their progress to report
+func WithProgress(ctx context.Context, report ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// reportProgress tells progress function of ctx, if there is one, that done of total steps are done
+func reportProgress(ctx context.Context, done int, total int) {
+	if report, ok := ctx.Value(progressKey{}).(ProgressFunc); ok {
+		report(done, total)
+	}
+}
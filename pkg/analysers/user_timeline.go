@@ -0,0 +1,95 @@
+package analysers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"log"
+)
+
+const defaultTimelinePageSize = 100
+
+// GetUserTimeline returns a page of the learner's events from every event index,
+// sorted by time and with display names of the course blocks attached.
+func (a *Analyser) GetUserTimeline(ctx context.Context, timelineQuery database.TimelineQuery) (*models.Timeline, error) {
+	if timelineQuery.Size <= 0 {
+		timelineQuery.Size = defaultTimelinePageSize
+	}
+	events, nextCursor, err := a.eventStore.GetUserTimeline(ctx, timelineQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	structureIndex, err := a.GetCourseStructureIndex(ctx, timelineQuery.CourseID)
+	if err != nil {
+		log.Printf("WARN: timeline of course %v will have no display names: %v\n", timelineQuery.CourseID, err)
+	}
+
+	familiesByIndex := map[string]string{}
+	for family, indexName := range database.EventFamilyIndexNames {
+		familiesByIndex[indexName] = family
+	}
+
+	timeline := models.Timeline{
+		Username:   timelineQuery.Username,
+		CourseID:   timelineQuery.CourseID,
+		Events:     make([]models.TimelineEvent, 0, len(events)),
+		NextCursor: nextCursor,
+	}
+	for _, event := range events {
+		blockID := eventBlockID(event)
+		displayName, _ := structureIndex.DisplayName(blockID)
+		timeline.Events = append(timeline.Events, models.TimelineEvent{
+			Family:      familiesByIndex[event.Index],
+			EventType:   event.EventType,
+			Time:        event.Time,
+			BlockID:     blockID,
+			DisplayName: displayName,
+			Details:     event.Source,
+		})
+	}
+	return &timeline, nil
+}
+
+// GetLearnersEvents returns documents of events of index indexName of learners usernames in course
+// by usernames, sorted by event time. From, To and Platforms of eventFilter limit the events,
+// its Usernames are ignored. All the learners are read with one scan of the index.
+func (a *Analyser) GetLearnersEvents(ctx context.Context, course string, indexName string, usernames []string, eventFilter database.EventFilter) (map[string][]interface{}, error) {
+	events := map[string][]interface{}{}
+	if len(usernames) == 0 {
+		return events, nil
+	}
+	eventFilter.Usernames = usernames
+	query := database.CourseEventsQuery{IndexName: indexName, CourseID: course, EventFilter: eventFilter}
+	err := a.eventStore.ScanCourseEvents(ctx, query, func(event database.CourseEvent) error {
+		events[event.Username] = append(events[event.Username], event.Document)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// eventBlockID returns url_name of the block stored in the event description
+func eventBlockID(event database.UserCourseEvent) string {
+	switch event.Index {
+	case database.VideoEventDescriptionIndexName:
+		return event.VideoID
+	case database.ProblemEventDescriptionIndexName:
+		return event.ProblemID
+	case database.SequentialEventDescriptionIndexName:
+		return event.NewVerticalID
+	case database.LinkEventDescriptionIndexName:
+		return event.TargetBlockID
+	case database.BookmarsEventDescriptionIndexName:
+		if event.BlockID != "" {
+			return event.BlockID
+		}
+		return models.GetBlockIDFromUsageKey(event.BookmarkID)
+	}
+	return ""
+}
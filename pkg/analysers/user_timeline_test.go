@@ -0,0 +1,77 @@
+package analysers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"testing"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+func newTestAnalyser(t *testing.T, videoEvents []models.VideoEventDescription) *Analyser {
+	t.Helper()
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	for _, videoEvent := range videoEvents {
+		if err := store.AddVideoEventDescription(ctx, videoEvent); err != nil {
+			t.Fatalf("can't add event: %v", err)
+		}
+	}
+	return New(store)
+}
+
+func TestGetUserTimelinePages(t *testing.T) {
+	// Events are added out of order, two of them in the same millisecond
+	analyser := newTestAnalyser(t, []models.VideoEventDescription{
+		{EventTime: "2020-03-01T10:00:00.000900Z", Username: "p-k1-a", VideoID: "v3", EventType: models.PAUSE, CourseID: testCourseID},
+		{EventTime: "2020-03-01T10:00:00.000100Z", Username: "p-k1-a", VideoID: "v2", EventType: models.PLAY, CourseID: testCourseID},
+		{EventTime: "2020-03-01T09:00:00Z", Username: "p-k0-a", VideoID: "v1", EventType: models.PLAY, CourseID: testCourseID},
+		{EventTime: "2020-03-01T11:00:00Z", Username: "p-k1-b", VideoID: "v4", EventType: models.PLAY, CourseID: testCourseID},
+		{EventTime: "2020-03-01T12:00:00Z", Username: "p-k1-a", VideoID: "v5", EventType: models.PLAY, CourseID: "course-v1:org+C2+2020"},
+	})
+
+	tests := []struct {
+		name            string
+		storedUsernames []string
+		size            int
+		want            []string
+	}{
+		{"one page", []string{"p-k1-a"}, 10, []string{"v2", "v3"}},
+		{"pages of one event", []string{"p-k1-a"}, 1, []string{"v2", "v3"}},
+		{"pseudonyms of old and new keys", []string{"p-k0-a", "p-k1-a"}, 2, []string{"v1", "v2", "v3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := database.TimelineQuery{Username: "a", StoredUsernames: test.storedUsernames, CourseID: testCourseID, Size: test.size}
+			videoIDs := make([]string, 0)
+			for pages := 0; ; pages++ {
+				if pages > len(test.want) {
+					t.Fatalf("timeline has more pages than events")
+				}
+				timeline, err := analyser.GetUserTimeline(context.Background(), query)
+				if err != nil {
+					t.Fatalf("GetUserTimeline() error = %v", err)
+				}
+				if timeline.Username != "a" {
+					t.Errorf("Username = %v, want a", timeline.Username)
+				}
+				for _, event := range timeline.Events {
+					videoIDs = append(videoIDs, event.BlockID)
+				}
+				if timeline.NextCursor == "" {
+					break
+				}
+				query.Cursor = timeline.NextCursor
+			}
+			if len(videoIDs) != len(test.want) {
+				t.Fatalf("events of videos %v, want %v", videoIDs, test.want)
+			}
+			for i := range videoIDs {
+				if videoIDs[i] != test.want[i] {
+					t.Fatalf("events of videos %v, want %v", videoIDs, test.want)
+				}
+			}
+		})
+	}
+}
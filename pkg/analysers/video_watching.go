@@ -1,19 +1,71 @@
 package analysers
 
 import (
-	"fmt"
+	"context"
+	"kafka-log-processor/pkg/database"
 	"kafka-log-processor/pkg/models"
+	"sort"
 )
 
 // GetAnalyseUserVideoWatchings represents intervals and values of how much people
 // watched that fragment (if one person watches this fragment for two times, then
-// it counts as two)
-func (a *Analyser) GetAnalyseUserVideoWatchings(videoID string) (*models.CurveFloatToInt, error) {
-	videoEvents, err := a.elasticService.GetSortedVideoEventsForVideo(videoID)
-	fmt.Println(videoEvents)
+// it counts as two). Only events matching filter are counted. Curve of a video
+// without events is empty.
+func (a *Analyser) GetAnalyseUserVideoWatchings(ctx context.Context, videoID string, filter models.Filter) (*models.CurveFloatToInt, error) {
+	eventFilter, err := a.getVideoEventFilter(ctx, videoID, filter)
 	if err != nil {
 		return nil, err
 	}
+	videoEvents, err := a.eventStore.GetSortedVideoEventsForVideo(ctx, videoID, eventFilter)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return watchingCurve(videoEvents), nil
+}
+
+// GetCourseVideoWatchings returns watching curves of course videos videoIDs from a single
+// scan of the course video events matching filter. Unlike GetAnalyseUserVideoWatchings only
+// the events of the course are counted. Videos without events have empty curves.
+func (a *Analyser) GetCourseVideoWatchings(ctx context.Context, course string, videoIDs []string, filter models.Filter) (map[string]*models.CurveFloatToInt, error) {
+	eventFilter, err := a.getEventFilter(ctx, course, filter)
+	if err != nil {
+		return nil, err
+	}
+	videoEvents := map[string][]models.VideoEventDescription{}
+	for _, videoID := range videoIDs {
+		videoEvents[videoID] = nil
+	}
+	query := database.CourseEventsQuery{IndexName: database.VideoEventDescriptionIndexName, CourseID: course, EventFilter: eventFilter}
+	err = a.eventStore.ScanCourseEvents(ctx, query, func(event database.CourseEvent) error {
+		videoEvent, ok := event.Document.(models.VideoEventDescription)
+		if !ok {
+			return nil
+		}
+		if events, ok := videoEvents[videoEvent.VideoID]; ok {
+			videoEvents[videoEvent.VideoID] = append(events, videoEvent)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	curves := make(map[string]*models.CurveFloatToInt, len(videoEvents))
+	for videoID, events := range videoEvents {
+		sort.SliceStable(events, func(i, j int) bool { return events[i].VideoTime < events[j].VideoTime })
+		curves[videoID] = watchingCurve(events)
+	}
+	return curves, nil
+}
+
+// watchingCurve counts watchers of video fragments from the video events sorted by video time
+func watchingCurve(videoEvents []models.VideoEventDescription) *models.CurveFloatToInt {
+	if len(videoEvents) == 0 {
+		return &models.CurveFloatToInt{X: []float64{}, Y: []int{}}
+	}
 
 	X := make([]float64, 0)
 	Y := make([]int, 0)
@@ -44,5 +96,26 @@ func (a *Analyser) GetAnalyseUserVideoWatchings(videoID string) (*models.CurveFl
 	X = append(X, previousX)
 	Y = append(Y, currentWatchers)
 
-	return &models.CurveFloatToInt{X: X, Y: Y}, nil
+	return &models.CurveFloatToInt{X: X, Y: Y}
+}
+
+// getVideoEventFilter resolves filter of the video. Learners are selected in every course
+// the video is used in.
+func (a *Analyser) getVideoEventFilter(ctx context.Context, videoID string, filter models.Filter) (database.EventFilter, error) {
+	if len(filter.EnrollmentModes) == 0 && filter.MinEvents == 0 {
+		return a.getEventFilter(ctx, "", filter)
+	}
+	courses, err := a.eventStore.GetUniqueStringFieldValuesInIndexWithFilter(ctx, database.VideoEventDescriptionIndexName, "course_id", "video_id", videoID)
+	if err != nil {
+		return database.EventFilter{}, err
+	}
+	eventFilter := database.EventFilter{From: filter.From, To: filter.To, Platforms: filter.Platforms, Usernames: []string{}}
+	for _, course := range courses {
+		courseFilter, err := a.getEventFilter(ctx, course, filter)
+		if err != nil {
+			return database.EventFilter{}, err
+		}
+		eventFilter.Usernames = append(eventFilter.Usernames, courseFilter.Usernames...)
+	}
+	return eventFilter, nil
 }
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kafka-log-processor/pkg/graphql"
+	"kafka-log-processor/pkg/jobs"
+	"kafka-log-processor/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the version of the API in the OpenAPI document
+const Version = "1.0.0"
+
+// Client calls the analysis API. Errors returned by the server are *Error.
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	apiKey      string
+	bearerToken string
+}
+
+// NewClient constructs Client of the server at baseURL, e.g. "http://analysis_server:8080".
+// http.DefaultClient is used if httpClient is nil.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// WithAPIKey returns copy of the client that authenticates with API key
+func (c *Client) WithAPIKey(key string) *Client {
+	authenticated := *c
+	authenticated.apiKey, authenticated.bearerToken = key, ""
+	return &authenticated
+}
+
+// WithBearerToken returns copy of the client that authenticates with JWT token
+func (c *Client) WithBearerToken(token string) *Client {
+	authenticated := *c
+	authenticated.apiKey, authenticated.bearerToken = "", token
+	return &authenticated
+}
+
+// TimelineQuery describes a page of the learner timeline. Zero values are left to the server defaults.
+type TimelineQuery struct {
+	Username  string
+	CourseID  string
+	Families  []string
+	From      time.Time
+	To        time.Time
+	Platforms []string
+	Size      int
+	Cursor    string
+}
+
+// LiveActivityQuery selects live activity of a course, empty Blocks and Platforms aren't filters.
+// ReplayMinutes are minutes before the connection to receive first, 0 replays nothing.
+type LiveActivityQuery struct {
+	CourseID      string
+	Blocks        []string
+	Platforms     []string
+	ReplayMinutes int
+}
+
+// ExportQuery describes events to export, zero values aren't filters
+type ExportQuery struct {
+	Families []string
+	CourseID string
+	From     time.Time
+	To       time.Time
+}
+
+// CourseIDs returns ids of the courses with logs and structures
+func (c *Client) CourseIDs(ctx context.Context) ([]string, error) {
+	var courseIDs []string
+	err := c.getJSON(ctx, CourseIDsPath, url.Values{}, &courseIDs)
+	return courseIDs, err
+}
+
+// CourseRoutes returns routes of every learner of the course selected by filter
+func (c *Client) CourseRoutes(ctx context.Context, courseID string, filter models.Filter) ([]models.UserRoute, error) {
+	var routes []models.UserRoute
+	err := c.getJSON(ctx, CourseRoutesPath, filterParamValues(url.Values{"course": {courseID}}, filter), &routes)
+	return routes, err
+}
+
+// VideoWatchings returns watching curve of the video of events selected by filter
+func (c *Client) VideoWatchings(ctx context.Context, videoID string, filter models.Filter) (*models.CurveFloatToInt, error) {
+	var curve models.CurveFloatToInt
+	if err := c.getJSON(ctx, VideoWatchingsPath, filterParamValues(url.Values{"video_id": {videoID}}, filter), &curve); err != nil {
+		return nil, err
+	}
+	return &curve, nil
+}
+
+// CourseVideos returns ids of the course videos
+func (c *Client) CourseVideos(ctx context.Context, courseID string) ([]string, error) {
+	var videoIDs []string
+	err := c.getJSON(ctx, CourseVideosPath, url.Values{"course": {courseID}}, &videoIDs)
+	return videoIDs, err
+}
+
+// ExternalResources returns size most clicked external resources of the course, size 0 is the server default.
+// Only clicks selected by filter are counted.
+func (c *Client) ExternalResources(ctx context.Context, courseID string, size int, filter models.Filter) (*models.ExternalResourcesReport, error) {
+	params := filterParamValues(url.Values{"course": {courseID}}, filter)
+	if size > 0 {
+		params.Set("size", strconv.Itoa(size))
+	}
+	var report models.ExternalResourcesReport
+	if err := c.getJSON(ctx, ExternalResourcesPath, params, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Bookmarks returns bookmarks analytics of the course of events selected by filter
+func (c *Client) Bookmarks(ctx context.Context, courseID string, filter models.Filter) (*models.BookmarksReport, error) {
+	var report models.BookmarksReport
+	if err := c.getJSON(ctx, BookmarksPath, filterParamValues(url.Values{"course": {courseID}}, filter), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Problems returns statistics of the course problems of submissions selected by filter
+func (c *Client) Problems(ctx context.Context, courseID string, filter models.Filter) (*models.ProblemsReport, error) {
+	var report models.ProblemsReport
+	if err := c.getJSON(ctx, ProblemsPath, filterParamValues(url.Values{"course": {courseID}}, filter), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// CourseActivity returns activity of the course by "day" or "hour" granularity of events selected by filter
+func (c *Client) CourseActivity(ctx context.Context, courseID string, granularity string, filter models.Filter) (*models.CourseActivity, error) {
+	params := filterParamValues(url.Values{"course": {courseID}}, filter)
+	if granularity != "" {
+		params.Set("granularity", granularity)
+	}
+	var activity models.CourseActivity
+	if err := c.getJSON(ctx, CourseActivityPath, params, &activity); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+// UserTimeline returns a page of the learner timeline
+func (c *Client) UserTimeline(ctx context.Context, query TimelineQuery) (*models.Timeline, error) {
+	params := url.Values{"username": {query.Username}, "course": {query.CourseID}}
+	if len(query.Families) > 0 {
+		params.Set("families", strings.Join(query.Families, ","))
+	}
+	setDateParam(params, "from", query.From)
+	setDateParam(params, "to", query.To)
+	if len(query.Platforms) > 0 {
+		params.Set("platforms", strings.Join(query.Platforms, ","))
+	}
+	if query.Size > 0 {
+		params.Set("size", strconv.Itoa(query.Size))
+	}
+	if query.Cursor != "" {
+		params.Set("cursor", query.Cursor)
+	}
+	var timeline models.Timeline
+	if err := c.getJSON(ctx, UserTimelinePath, params, &timeline); err != nil {
+		return nil, err
+	}
+	return &timeline, nil
+}
+
+// ExportParquet writes zip archive of Parquet files with events of query to w
+func (c *Client) ExportParquet(ctx context.Context, query ExportQuery, w io.Writer) error {
+	params := url.Values{}
+	if len(query.Families) > 0 {
+		params.Set("families", strings.Join(query.Families, ","))
+	}
+	if query.CourseID != "" {
+		params.Set("course", query.CourseID)
+	}
+	setDateParam(params, "from", query.From)
+	setDateParam(params, "to", query.To)
+	res, err := c.get(ctx, ParquetExportPath, params)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// LiveActivity calls handle with activity of every minute of the live stream until ctx is done,
+// the server closes the stream or handle returns an error. Minutes are sent again when they get new events.
+func (c *Client) LiveActivity(ctx context.Context, query LiveActivityQuery, handle func(models.LiveActivity) error) error {
+	params := url.Values{"course": {query.CourseID}, "replay_minutes": {strconv.Itoa(query.ReplayMinutes)}}
+	setListParam(params, "blocks", query.Blocks)
+	setListParam(params, "platforms", query.Platforms)
+	res, err := c.get(ctx, LiveActivityPath, params)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event == "activity" && data != "" {
+				var activity models.LiveActivity
+				if err = json.Unmarshal([]byte(data), &activity); err != nil {
+					return err
+				}
+				if err = handle(activity); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// SubmitJob starts analysis (one of JobAnalyses) with params of its endpoint in background
+func (c *Client) SubmitJob(ctx context.Context, analysis string, params url.Values) (*models.AnalysisJob, error) {
+	jobParams := url.Values{"analysis": {analysis}}
+	for name, values := range params {
+		jobParams[name] = values
+	}
+	return c.jobRequest(ctx, http.MethodPost, JobsPath, jobParams)
+}
+
+// Job returns status of job id
+func (c *Client) Job(ctx context.Context, id string) (*models.AnalysisJob, error) {
+	return c.jobRequest(ctx, http.MethodGet, JobsPath, url.Values{"id": {id}})
+}
+
+// CancelJob cancels job id and returns its status
+func (c *Client) CancelJob(ctx context.Context, id string) (*models.AnalysisJob, error) {
+	return c.jobRequest(ctx, http.MethodDelete, JobsPath, url.Values{"id": {id}})
+}
+
+// WaitJob polls status of job id every interval until the job is finished
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*models.AnalysisJob, error) {
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status != jobs.Queued && job.Status != jobs.Running {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// JobResult unmarshals result of succeeded job id into result, it has the type of
+// the analysis endpoint response. Errors of failed jobs are returned as *Error.
+func (c *Client) JobResult(ctx context.Context, id string, result interface{}) error {
+	return c.getJSON(ctx, JobResultPath, url.Values{"id": {id}}, result)
+}
+
+func (c *Client) jobRequest(ctx context.Context, method string, path string, params url.Values) (*models.AnalysisJob, error) {
+	res, err := c.do(ctx, method, path, params)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var job models.AnalysisJob
+	if err = json.NewDecoder(res.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GraphQL executes GraphQL request. Errors of fields come in the response with the data,
+// requests the server couldn't execute come with errors and without data.
+func (c *Client) GraphQL(ctx context.Context, request graphql.Request) (*graphql.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, GraphQLPath, nil, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", JSONContentType)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if body, err = io.ReadAll(res.Body); err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusBadRequest {
+		var response graphql.Response
+		if err = json.Unmarshal(body, &response); err == nil && (response.Data != nil || len(response.Errors) > 0) {
+			return &response, nil
+		}
+	}
+	return nil, responseError(res.Status, body)
+}
+
+// filterParamValues adds parameters of filter to params and returns them
+func filterParamValues(params url.Values, filter models.Filter) url.Values {
+	setDateParam(params, "from", filter.From)
+	setDateParam(params, "to", filter.To)
+	setListParam(params, "usernames", filter.Usernames)
+	setListParam(params, "enrollment_modes", filter.EnrollmentModes)
+	setListParam(params, "platforms", filter.Platforms)
+	if filter.MinEvents > 0 {
+		params.Set("min_events", strconv.Itoa(filter.MinEvents))
+	}
+	return params
+}
+
+func setListParam(params url.Values, name string, values []string) {
+	if len(values) > 0 {
+		params.Set(name, strings.Join(values, ","))
+	}
+}
+
+func setDateParam(params url.Values, name string, date time.Time) {
+	if !date.IsZero() {
+		params.Set(name, date.UTC().Format(time.RFC3339))
+	}
+}
+
+// getJSON requests endpoint path and unmarshals its response into result
+func (c *Client) getJSON(ctx context.Context, path string, params url.Values, result interface{}) error {
+	res, err := c.get(ctx, path, params)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// get requests endpoint path, responses with error status are returned as *Error
+func (c *Client) get(ctx context.Context, path string, params url.Values) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, path, params)
+}
+
+// do requests endpoint path with method, responses with error status are returned as *Error
+func (c *Client) do(ctx context.Context, method string, path string, params url.Values) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return nil, responseError(res.Status, body)
+}
+
+// newRequest returns authenticated request of endpoint path
+func (c *Client) newRequest(ctx context.Context, method string, path string, params url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+Prefix+path+"?"+params.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set(APIKeyHeader, c.apiKey)
+	}
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	return req, nil
+}
+
+// responseError returns *Error of error response body, bodies without it become errors of status
+func responseError(status string, body []byte) error {
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(body, &errorResponse); err != nil || errorResponse.Error == nil {
+		return fmt.Errorf("analysis server responded with %v", status)
+	}
+	return errorResponse.Error
+}
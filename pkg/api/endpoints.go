@@ -0,0 +1,455 @@
+package api
+
+// Description of the analysis server API shared by the server, its OpenAPI
+// document and the Go client. The server refuses to start if a handler is
+// missing for any of Endpoints, so the document always matches the handlers.
+
+import (
+	"encoding/json"
+	"kafka-log-processor/pkg/graphql"
+	"kafka-log-processor/pkg/models"
+	"net/http"
+)
+
+// Paths of the API. Endpoint paths are relative to Prefix.
+const (
+	Prefix      = "/api/v1"
+	OpenAPIPath = "/api/openapi.json"
+
+	CourseIDsPath         = "/course-ids"
+	CourseRoutesPath      = "/course-routes"
+	VideoWatchingsPath    = "/video-watchings"
+	CourseVideosPath      = "/course-videos"
+	ExternalResourcesPath = "/external-resources"
+	BookmarksPath         = "/bookmarks"
+	CourseActivityPath    = "/course-activity"
+	ProblemsPath          = "/problems"
+	UserTimelinePath      = "/user-timeline"
+	ParquetExportPath     = "/export/parquet"
+	JobsPath              = "/jobs"
+	JobResultPath         = "/jobs/result"
+
+	VideoWatchingsChartPath = "/charts/video-watchings"
+	CourseActivityChartPath = "/charts/course-activity"
+	CourseRoutesChartPath   = "/charts/course-routes"
+	ProblemsChartPath       = "/charts/problems"
+
+	LiveActivityPath = "/live/course-activity"
+
+	GraphQLPath = "/graphql"
+)
+
+// Types of query parameters
+const (
+	StringParam  = "string"
+	IntegerParam = "integer"
+	DateParam    = "date"
+	CourseParam  = "course"
+	ListParam    = "list"
+)
+
+// APIKeyHeader is the header of API keys, JWTs are sent in "Authorization: Bearer <token>" header
+const APIKeyHeader = "X-API-Key"
+
+// Content types of responses
+const (
+	JSONContentType = "application/json"
+	ZipContentType  = "application/zip"
+	CSVContentType  = "text/csv"
+	XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	SVGContentType  = "image/svg+xml"
+	PNGContentType  = "image/png"
+
+	EventStreamContentType = "text/event-stream"
+)
+
+// Formats of "format" parameter, they are chosen by Accept header if the parameter is missing.
+// Analyses are sent as JSON, CSV or XLSX, charts as SVG or PNG.
+const (
+	JSONFormat = "json"
+	CSVFormat  = "csv"
+	XLSXFormat = "xlsx"
+	SVGFormat  = "svg"
+	PNGFormat  = "png"
+)
+
+// FormatContentTypes maps formats to content types of their responses
+var FormatContentTypes = map[string]string{
+	JSONFormat: JSONContentType,
+	CSVFormat:  CSVContentType,
+	XLSXFormat: XLSXContentType,
+	SVGFormat:  SVGContentType,
+	PNGFormat:  PNGContentType,
+}
+
+// ChartThemes are the colour themes of charts
+var ChartThemes = []string{"light", "dark"}
+
+// EventFamilies are families of learner events accepted by "families" parameters
+var EventFamilies = []string{"video", "problem", "sequential", "bookmarks", "link", "enrollment"}
+
+// ActivityMeasures are the measures of course activity charts
+var ActivityMeasures = []string{"active_learners", "video_plays", "watch_seconds", "submissions", "mean_score", "bookmarks_added", "bookmarks_removed", "link_clicks"}
+
+// RouteMetrics are the metrics of learner route charts
+var RouteMetrics = []string{"linearity_score", "backward_jumps", "revisits", "farthest_position", "steps"}
+
+// ProblemMetrics are the metrics of problem charts, shares are shares of the learners who submitted the problem
+var ProblemMetrics = []string{"mean_score", "mean_attempts", "solved_share", "first_attempt_solved_share"}
+
+// JobAnalyses are the endpoints that can run as jobs, "analysis" parameter of jobs is the endpoint path without "/"
+var JobAnalyses = []string{"course-routes", "video-watchings", "external-resources", "bookmarks", "course-activity", "problems"}
+
+// Param describes a query parameter. Integer parameters must be from Minimum to Maximum,
+// values of list parameters are comma separated, Enum lists all the allowed values.
+type Param struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+	Enum        []string
+	Minimum     int
+	Maximum     int
+}
+
+// Endpoint describes an API endpoint. Request is a value of the type of JSON request body,
+// nil if the endpoint has no body. Response is a value of the type of JSON response,
+// responses of other content types aren't described. Status is the status of successful
+// responses, 200 if it is zero, ErrorStatuses are statuses of errors specific to the endpoint.
+// Identifiable endpoints return learner usernames and are only served to roles allowed
+// to see identifiable data.
+type Endpoint struct {
+	Method        string
+	Path          string
+	Summary       string
+	Description   string
+	Params        []Param
+	Request       interface{}
+	ContentType   string
+	Response      interface{}
+	Status        int
+	ErrorStatuses []int
+	Identifiable  bool
+}
+
+var courseParam = Param{
+	Name:        "course",
+	Type:        CourseParam,
+	Required:    true,
+	Description: `Course id "course-v1:org+CourseCode+CourseRun", "+" must be encoded as %2B`,
+}
+
+var fromParam = Param{Name: "from", Type: DateParam, Description: "Start of the period, 2006-01-02 or RFC 3339 date"}
+
+var toParam = Param{Name: "to", Type: DateParam, Description: "End of the period, 2006-01-02 date includes the whole day, RFC 3339 date is exclusive"}
+
+var familiesParam = Param{Name: "families", Type: ListParam, Enum: EventFamilies, Description: "Comma separated event families, all by default"}
+
+var jobIDParam = Param{Name: "id", Type: StringParam, Required: true, Description: "Job id"}
+
+var platformsParam = Param{Name: "platforms", Type: ListParam, Enum: models.Platforms, Description: "Comma separated platforms of the events, all by default"}
+
+// filterParams select events and learners of analyses, see models.Filter
+var filterParams = []Param{
+	fromParam,
+	toParam,
+	{Name: "usernames", Type: ListParam, Description: "Comma separated usernames of the learners, all by default"},
+	{Name: "enrollment_modes", Type: ListParam, Description: `Comma separated enrollment modes of the learners ("audit", "verified", ...) at the end of the period, all by default`},
+	platformsParam,
+	{Name: "min_events", Type: IntegerParam, Minimum: 1, Maximum: 1000000, Description: "Minimum number of the learner's events matching the other filters"},
+}
+
+// withFormatParams returns params followed by "format" parameter and, if the response has
+// several tables, "table" parameter choosing the table of CSV responses
+func withFormatParams(params []Param, tables ...string) []Param {
+	params = append(params, Param{
+		Name:        "format",
+		Type:        StringParam,
+		Enum:        []string{JSONFormat, CSVFormat, XLSXFormat},
+		Description: "Format of the response, Accept header is used if it is missing",
+	})
+	if len(tables) > 1 {
+		params = append(params, Param{
+			Name:        "table",
+			Type:        StringParam,
+			Enum:        tables,
+			Description: "Table of CSV response, " + tables[0] + " by default. XLSX responses have a sheet per table.",
+		})
+	}
+	return params
+}
+
+// withChartParams returns params followed by the format, size and theme of chart renders
+func withChartParams(params []Param) []Param {
+	return append(params,
+		Param{Name: "format", Type: StringParam, Enum: []string{SVGFormat, PNGFormat}, Description: "Format of the chart, Accept header is used if it is missing, svg by default"},
+		Param{Name: "width", Type: IntegerParam, Minimum: 200, Maximum: 4000, Description: "Width of the chart, 720 by default"},
+		Param{Name: "height", Type: IntegerParam, Minimum: 100, Maximum: 4000, Description: "Height of the chart, 320 by default, bar charts and heatmaps grow with their rows"},
+		Param{Name: "theme", Type: StringParam, Enum: ChartThemes, Description: "Colour theme, light by default"},
+		Param{Name: "scale", Type: IntegerParam, Minimum: 1, Maximum: 4, Description: "Image pixels per chart pixel of PNG charts, 2 by default"},
+	)
+}
+
+// withFilterParams returns params followed by filterParams
+func withFilterParams(params ...Param) []Param {
+	return append(params, filterParams...)
+}
+
+// Endpoints are all the endpoints of the analysis API
+var Endpoints = []Endpoint{
+	{
+		Method:      http.MethodGet,
+		Path:        CourseIDsPath,
+		Summary:     "Courses with logs and structures",
+		Description: "Ids of the courses that have video or problem events and a stored course structure and that the caller can read.",
+		Params:      withFormatParams(nil),
+		ContentType: JSONContentType,
+		Response:    []string{},
+	},
+	{
+		Method:       http.MethodGet,
+		Path:         CourseRoutesPath,
+		Summary:      "Learner routes through the course",
+		Description:  "Time-ordered route of every learner through the course structure with linearity metrics.",
+		Params:       withFormatParams(withFilterParams(courseParam), "steps", "learners"),
+		ContentType:  JSONContentType,
+		Response:     []models.UserRoute{},
+		Identifiable: true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        VideoWatchingsPath,
+		Summary:     "Video watching curve",
+		Description: "Number of learners watching every fragment of the video: x are video seconds, y are watchers.",
+		Params:      withFormatParams(withFilterParams(Param{Name: "video_id", Type: StringParam, Required: true, Description: "Video block url_name"})),
+		ContentType: JSONContentType,
+		Response:    models.CurveFloatToInt{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        CourseVideosPath,
+		Summary:     "Videos of the course",
+		Description: "Ids of the course videos that have events.",
+		Params:      withFormatParams([]Param{courseParam}),
+		ContentType: JSONContentType,
+		Response:    []string{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        ExternalResourcesPath,
+		Summary:     "Most clicked external resources",
+		Description: "The most clicked external resources of the course and of every unit links were clicked in.",
+		Params: withFormatParams(withFilterParams(
+			courseParam,
+			Param{Name: "size", Type: IntegerParam, Minimum: 1, Maximum: 100, Description: "Number of resources, 10 by default"},
+		)),
+		ContentType: JSONContentType,
+		Response:    models.ExternalResourcesReport{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        BookmarksPath,
+		Summary:     "Bookmarks analytics",
+		Description: "Active bookmarks of the course blocks over time and how often learners return to bookmarked blocks.",
+		Params:      withFormatParams(withFilterParams(courseParam), "blocks", "timelines", "summary"),
+		ContentType: JSONContentType,
+		Response:    models.BookmarksReport{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        CourseActivityPath,
+		Summary:     "Course activity by days or hours",
+		Description: "Active learners, video plays, watch time, submissions, bookmarks and link clicks of the course and its blocks.",
+		Params: withFormatParams(withFilterParams(
+			courseParam,
+			Param{Name: "granularity", Type: StringParam, Enum: []string{"day", "hour"}, Description: "Period of activity, day by default"},
+		)),
+		ContentType: JSONContentType,
+		Response:    models.CourseActivity{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        ProblemsPath,
+		Summary:     "Problem statistics",
+		Description: "Submissions, attempts, mean score and learners who solved every course problem, in the course order.",
+		Params:      withFormatParams(withFilterParams(courseParam)),
+		ContentType: JSONContentType,
+		Response:    models.ProblemsReport{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        VideoWatchingsChartPath,
+		Summary:     "Video watching curve chart",
+		Description: "Line chart of the number of learners watching every second of the video, titled by the display name of the video.",
+		Params:      withChartParams(withFilterParams(Param{Name: "video_id", Type: StringParam, Required: true, Description: "Video block url_name"})),
+		ContentType: SVGContentType,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        CourseActivityChartPath,
+		Summary:     "Course activity heatmap",
+		Description: "Heatmap of the measure of every course block by days or hours, blocks are named by their display names in the course order.",
+		Params: withChartParams(withFilterParams(
+			courseParam,
+			Param{Name: "measure", Type: StringParam, Enum: ActivityMeasures, Description: "Measure of activity, active_learners by default"},
+			Param{Name: "granularity", Type: StringParam, Enum: []string{"day", "hour"}, Description: "Period of activity, day by default"},
+		)),
+		ContentType: SVGContentType,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        CourseRoutesChartPath,
+		Summary:     "Learner route metric histogram",
+		Description: "Histogram of the route metric of the course learners.",
+		Params: withChartParams(withFilterParams(
+			courseParam,
+			Param{Name: "metric", Type: StringParam, Enum: RouteMetrics, Description: "Route metric, linearity_score by default"},
+			Param{Name: "bins", Type: IntegerParam, Minimum: 1, Maximum: 100, Description: "Number of bins, 10 by default"},
+		)),
+		ContentType: SVGContentType,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        ProblemsChartPath,
+		Summary:     "Problem statistics chart",
+		Description: "Bar chart of the metric of every course problem, problems are named by their display names in the course order.",
+		Params: withChartParams(withFilterParams(
+			courseParam,
+			Param{Name: "metric", Type: StringParam, Enum: ProblemMetrics, Description: "Problem metric, mean_score by default"},
+		)),
+		ContentType: SVGContentType,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    LiveActivityPath,
+		Summary: "Live course activity",
+		Description: "Server-sent events with the activity of the course by minutes: active learners, video plays and problem submissions " +
+			"of the course and its blocks. Every \"activity\" event has the activity of a minute as JSON and the start of the minute as id, " +
+			"a minute is sent again when it gets new events. Minutes of replay_minutes before the connection are sent first, " +
+			"Last-Event-ID header replays minutes from the given one. 503 if the live stream is disabled.",
+		Params: []Param{
+			courseParam,
+			{Name: "blocks", Type: ListParam, Description: "Comma separated url_names of the blocks, all by default"},
+			platformsParam,
+			{Name: "replay_minutes", Type: IntegerParam, Minimum: 0, Maximum: 1440, Description: "Minutes before the connection to replay, 15 by default, limited by the replay window of the server"},
+		},
+		ContentType:   EventStreamContentType,
+		Response:      models.LiveActivity{},
+		ErrorStatuses: []int{http.StatusServiceUnavailable},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    GraphQLPath,
+		Summary: "GraphQL query",
+		Description: "Executes GraphQL query over courses, their blocks, learners and events, see the schema with introspection. " +
+			"Responses with data are sent with 200 even if some fields failed, their errors are in \"errors\" with the paths of the fields. " +
+			"Requests that can't be executed get 400 with errors and without data. Fields of learners need a role that can see learner usernames.",
+		Params: []Param{
+			{Name: "query", Type: StringParam, Required: true, Description: "GraphQL query document"},
+			{Name: "variables", Type: StringParam, Description: "Variables of the query as JSON object"},
+			{Name: "operationName", Type: StringParam, Description: "Operation to execute if the query has several"},
+		},
+		ContentType: JSONContentType,
+		Response:    graphql.Response{},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        GraphQLPath,
+		Summary:     "GraphQL query",
+		Description: "Executes GraphQL request sent as JSON body, see GET " + GraphQLPath + ".",
+		Request:     graphql.Request{},
+		ContentType: JSONContentType,
+		Response:    graphql.Response{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        UserTimelinePath,
+		Summary:     "Learner timeline",
+		Description: "A page of the learner's events in the course sorted by time.",
+		Params: withFormatParams([]Param{
+			{Name: "username", Type: StringParam, Required: true, Description: "Learner username"},
+			courseParam,
+			familiesParam,
+			fromParam,
+			toParam,
+			platformsParam,
+			{Name: "size", Type: IntegerParam, Minimum: 1, Maximum: 1000, Description: "Page size, 100 by default"},
+			{Name: "cursor", Type: StringParam, Description: "next_cursor of the previous page, CSV and XLSX responses send the next one in X-Next-Cursor header"},
+		}),
+		ContentType:  JSONContentType,
+		Response:     models.Timeline{},
+		Identifiable: true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        ParquetExportPath,
+		Summary:     "Parquet export",
+		Description: "Zip archive of Parquet files with events partitioned by family, course and month.",
+		Params: []Param{
+			familiesParam,
+			{Name: "course", Type: CourseParam, Description: courseParam.Description + ", all courses by default"},
+			fromParam,
+			toParam,
+		},
+		ContentType:  ZipContentType,
+		Identifiable: true,
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    JobsPath,
+		Summary: "Submit analysis job",
+		Description: "Runs the analysis in background. Other query parameters are the parameters of the analysis endpoint. " +
+			"Results are cached, the job of an analysis already computed on the same data succeeds at once.",
+		Params: []Param{
+			{Name: "analysis", Type: StringParam, Required: true, Enum: JobAnalyses, Description: "Path of the analysis endpoint without \"/\""},
+		},
+		ContentType:   JSONContentType,
+		Response:      models.AnalysisJob{},
+		Status:        http.StatusAccepted,
+		ErrorStatuses: []int{http.StatusServiceUnavailable},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        JobsPath,
+		Summary:     "Analysis job status",
+		Description: "Status and progress of the caller's job. Finished jobs are kept for analysis_server.jobs.result_ttl_minutes.",
+		Params:      []Param{jobIDParam},
+		ContentType: JSONContentType,
+		Response:    models.AnalysisJob{},
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        JobsPath,
+		Summary:     "Cancel analysis job",
+		Description: "Cancels the caller's job if it isn't finished yet.",
+		Params:      []Param{jobIDParam},
+		ContentType: JSONContentType,
+		Response:    models.AnalysisJob{},
+	},
+	{
+		Method:        http.MethodGet,
+		Path:          JobResultPath,
+		Summary:       "Analysis job result",
+		Description:   "Response of the analysis endpoint computed by the job. Failed jobs answer with the error of the analysis, unfinished and canceled jobs with 409.",
+		Params:        []Param{jobIDParam},
+		ContentType:   JSONContentType,
+		Response:      json.RawMessage{},
+		ErrorStatuses: []int{http.StatusConflict},
+	},
+}
+
+// Error is an error response of the API:
+// {"error": {"status": 400, "code": "invalid_parameter", "message": "...", "request_id": "..."}}
+type Error struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (err *Error) Error() string { return err.Message }
+
+// ErrorResponse is a body of error responses
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
@@ -0,0 +1,256 @@
+package api
+
+// OpenAPI 3 document of Endpoints. Request and response schemas are made from the Go
+// types of the bodies by reflection: JSON names of struct fields become properties,
+// named structs become components. Components of structs with names already taken
+// by structs of other packages are prefixed with their package names.
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIDocument returns OpenAPI 3 document of endpoints served under Prefix
+func OpenAPIDocument(endpoints []Endpoint, version string) map[string]interface{} {
+	generator := &schemaGenerator{components: map[string]interface{}{}, componentTypes: map[string]reflect.Type{}}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			JSONContentType: map[string]interface{}{"schema": generator.schemaOf(reflect.TypeOf(ErrorResponse{}))},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	for _, endpoint := range endpoints {
+		operations, ok := paths[endpoint.Path].(map[string]interface{})
+		if !ok {
+			operations = map[string]interface{}{}
+			paths[endpoint.Path] = operations
+		}
+
+		parameters := make([]interface{}, 0, len(endpoint.Params))
+		for _, param := range endpoint.Params {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        param.Name,
+				"in":          "query",
+				"required":    param.Required,
+				"description": param.Description,
+				"schema":      paramSchema(param),
+				"explode":     false,
+			})
+		}
+
+		content := map[string]interface{}{}
+		if endpoint.Response != nil {
+			content[endpoint.ContentType] = map[string]interface{}{"schema": generator.schemaOf(reflect.TypeOf(endpoint.Response))}
+		} else {
+			content[endpoint.ContentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}
+		}
+		for _, param := range endpoint.Params {
+			if param.Name != "format" {
+				continue
+			}
+			for _, format := range param.Enum {
+				contentType := FormatContentTypes[format]
+				if _, described := content[contentType]; described {
+					continue
+				}
+				schema := map[string]interface{}{"type": "string"}
+				if format == XLSXFormat || format == PNGFormat {
+					schema["format"] = "binary"
+				}
+				content[contentType] = map[string]interface{}{"schema": schema}
+			}
+		}
+		status := endpoint.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		responses := map[string]interface{}{
+			strconv.Itoa(status): map[string]interface{}{"description": endpoint.Summary, "content": content},
+		}
+		errorStatuses := []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError, http.StatusGatewayTimeout}
+		for _, status := range append(errorStatuses, endpoint.ErrorStatuses...) {
+			responses[strconv.Itoa(status)] = errorResponse
+		}
+
+		description := endpoint.Description
+		if endpoint.Identifiable {
+			description += " Returns learner usernames, only admin and course_staff roles can read it."
+		}
+		operation := map[string]interface{}{
+			"operationId": operationID(endpoint),
+			"summary":     endpoint.Summary,
+			"description": description,
+			"parameters":  parameters,
+			"responses":   responses,
+		}
+		if endpoint.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					JSONContentType: map[string]interface{}{"schema": generator.schemaOf(reflect.TypeOf(endpoint.Request))},
+				},
+			}
+		}
+		operations[strings.ToLower(endpoint.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "edxlyser analysis API",
+			"version": version,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": Prefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": generator.components,
+			"securitySchemes": map[string]interface{}{
+				"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"apiKey": []string{}},
+			map[string]interface{}{"bearerAuth": []string{}},
+		},
+	}
+}
+
+// operationID makes camel case id from the endpoint path: "/export/parquet" -> "getExportParquet"
+func operationID(endpoint Endpoint) string {
+	id := strings.ToLower(endpoint.Method)
+	for _, word := range strings.FieldsFunc(endpoint.Path, func(r rune) bool { return r == '/' || r == '-' }) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
+
+func paramSchema(param Param) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+	switch param.Type {
+	case IntegerParam:
+		schema = map[string]interface{}{"type": "integer", "minimum": param.Minimum, "maximum": param.Maximum}
+	case DateParam:
+		schema["format"] = "date-time"
+	case ListParam:
+		items := map[string]interface{}{"type": "string"}
+		if len(param.Enum) > 0 {
+			items["enum"] = param.Enum
+		}
+		return map[string]interface{}{"type": "array", "items": items}
+	}
+	if len(param.Enum) > 0 {
+		schema["enum"] = param.Enum
+	}
+	return schema
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+type schemaGenerator struct {
+	components     map[string]interface{}
+	componentTypes map[string]reflect.Type
+}
+
+// schemaOf returns JSON schema of values of type valueType the way encoding/json marshals them
+func (generator *schemaGenerator) schemaOf(valueType reflect.Type) map[string]interface{} {
+	switch valueType {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{"type": "object", "additionalProperties": true}
+	}
+
+	switch valueType.Kind() {
+	case reflect.Ptr:
+		return generator.schemaOf(valueType.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": generator.schemaOf(valueType.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": generator.schemaOf(valueType.Elem())}
+	case reflect.Struct:
+		if valueType.Name() == "" {
+			return generator.structSchema(valueType)
+		}
+		name := generator.componentName(valueType)
+		if _, ok := generator.components[name]; !ok {
+			// placeholder stops recursion of self-referencing types
+			generator.components[name] = nil
+			generator.componentTypes[name] = valueType
+			generator.components[name] = generator.structSchema(valueType)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// componentName returns name of the component of named struct structType: the name of the type,
+// prefixed with the package name if a type of another package has it
+func (generator *schemaGenerator) componentName(structType reflect.Type) string {
+	name := structType.Name()
+	if taken, ok := generator.componentTypes[name]; ok && taken != structType {
+		packageName := path.Base(structType.PkgPath())
+		name = strings.ToUpper(packageName[:1]) + packageName[1:] + name
+	}
+	return name
+}
+
+func (generator *schemaGenerator) structSchema(structType reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := make([]string, 0)
+	generator.addFields(structType, properties, &required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds JSON fields of struct structType to properties, fields of embedded structs are added inline
+func (generator *schemaGenerator) addFields(structType reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			generator.addFields(field.Type, properties, required)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = generator.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
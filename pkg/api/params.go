@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidateParams checks query parameters against their descriptions.
+// Parameters that aren't described are ignored.
+func ValidateParams(params []Param, query url.Values) *Error {
+	for _, param := range params {
+		value := strings.TrimSpace(query.Get(param.Name))
+		if value == "" {
+			if param.Required {
+				return InvalidParameter("%v parameter is required", param.Name)
+			}
+			continue
+		}
+		if err := validateParam(param, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateParam(param Param, value string) *Error {
+	switch param.Type {
+	case IntegerParam:
+		number, err := strconv.Atoi(value)
+		if err != nil || number < param.Minimum || number > param.Maximum {
+			return InvalidParameter("%v parameter should be an integer from %v to %v", param.Name, param.Minimum, param.Maximum)
+		}
+	case DateParam:
+		if _, err := ParseDate(value); err != nil {
+			return InvalidParameter("%v parameter should be a date in 2006-01-02 or RFC 3339 format", param.Name)
+		}
+	case CourseParam:
+		if _, err := models.GetCourseCodeFromCourseID(value); err != nil {
+			return InvalidParameter("%v parameter should have \"course-v1:org+CourseCode+CourseRun\" format, \"+\" must be encoded as %%2B", param.Name)
+		}
+	}
+	if len(param.Enum) == 0 {
+		return nil
+	}
+	values := []string{value}
+	if param.Type == ListParam {
+		values = strings.Split(value, ",")
+	}
+	for _, value := range values {
+		if !contains(param.Enum, value) {
+			return InvalidParameter("%v parameter should be one of %v, got %v", param.Name, strings.Join(param.Enum, ", "), value)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidParameter returns 400 error with formatted message
+func InvalidParameter(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: "invalid_parameter", Message: fmt.Sprintf(format, args...)}
+}
+
+// ParseDate parses "2006-01-02" or RFC3339 date. Empty value is a zero time.
+func ParseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ParseEndDate parses end of a date range, which is exclusive: "2006-01-02" date includes
+// the whole day, so it ends at the start of the next day, RFC3339 date ends at itself.
+// Empty value is a zero time.
+func ParseEndDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date.AddDate(0, 0, 1), nil
+	}
+	return ParseDate(value)
+}
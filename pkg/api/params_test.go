@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEndDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"2020-03-01", time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"2020-12-31", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"2020-03-01T00:00:00Z", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2020-03-01T12:30:00+02:00", time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseEndDate(test.value)
+			if err != nil {
+				t.Fatalf("ParseEndDate() error = %v", err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("got = %v, want %v", got, test.want)
+			}
+		})
+	}
+	if _, err := ParseEndDate("2020-03"); err == nil {
+		t.Errorf("ParseEndDate() of a month didn't fail")
+	}
+}
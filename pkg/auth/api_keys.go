@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// APIKey is an entry of the API keys file. Keys themselves aren't stored, only their SHA-256 hashes.
+type APIKey struct {
+	Name    string   `yaml:"name"`
+	SHA256  string   `yaml:"sha256"`
+	Role    string   `yaml:"role"`
+	Courses []string `yaml:"courses"`
+}
+
+// APIKeys is the API keys file:
+//
+//	keys:
+//	    - name: "dashboard"
+//	      sha256: "<hex SHA-256 of the key>"
+//	      role: "course_staff"
+//	      courses: ["course-v1:org+Code+Run"]
+type APIKeys struct {
+	Keys []APIKey `yaml:"keys"`
+}
+
+// ReadAPIKeys reads API keys file and checks its entries
+func ReadAPIKeys(fileName string) (APIKeys, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return APIKeys{}, err
+	}
+	defer f.Close()
+
+	var keys APIKeys
+	if err = yaml.NewDecoder(f).Decode(&keys); err != nil {
+		return APIKeys{}, err
+	}
+	names := map[string]bool{}
+	for _, key := range keys.Keys {
+		if key.Name == "" || names[key.Name] {
+			return APIKeys{}, errors.New("API key names should be non empty and unique, got \"" + key.Name + "\"")
+		}
+		names[key.Name] = true
+		if hash, err := hex.DecodeString(key.SHA256); err != nil || len(hash) != sha256.Size {
+			return APIKeys{}, errors.New("sha256 of API key " + key.Name + " should be 64 hex digits")
+		}
+		if !isRole(key.Role) {
+			return APIKeys{}, errors.New("Unknown role " + key.Role + " of API key " + key.Name)
+		}
+	}
+	return keys, nil
+}
+
+// principal returns principal of key, nil if key isn't in keys
+func (keys APIKeys) principal(key string) *Principal {
+	hash := sha256.Sum256([]byte(key))
+	for _, entry := range keys.Keys {
+		expected, _ := hex.DecodeString(entry.SHA256)
+		if subtle.ConstantTimeCompare(hash[:], expected) == 1 {
+			return &Principal{Subject: "key:" + entry.Name, Role: entry.Role, Courses: entry.Courses}
+		}
+	}
+	return nil
+}
+
+// NewAPIKey returns a random API key and its hex SHA-256 hash for the keys file
+func NewAPIKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(key))
+	return key, hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/api"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNoCredentials is returned for requests without API key or bearer token
+var ErrNoCredentials = errors.New("API key or bearer token is required")
+
+// ErrInvalidCredentials is returned for unknown API keys and invalid tokens
+var ErrInvalidCredentials = errors.New("API key or bearer token is invalid")
+
+// Authenticator finds principals of requests. Nil Authenticator lets every request in as Anonymous,
+// that is the case when authentication is disabled.
+type Authenticator struct {
+	keys APIKeys
+	jwt  *JWTVerifier
+}
+
+// New constructs Authenticator of keys and JWTs verified by jwt, jwt can be nil
+func New(keys APIKeys, jwt *JWTVerifier) *Authenticator {
+	return &Authenticator{keys: keys, jwt: jwt}
+}
+
+// FromConfig constructs Authenticator of auth config. It returns nil if authentication is disabled.
+func FromConfig(config configs.ParserConfig) (*Authenticator, error) {
+	if !config.Auth.Enabled {
+		return nil, nil
+	}
+	var keys APIKeys
+	var err error
+	if config.Auth.APIKeysFile != "" {
+		if keys, err = ReadAPIKeys(config.Auth.APIKeysFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var secret []byte
+	var publicKey *rsa.PublicKey
+	if config.Auth.JWT.HS256SecretFile != "" {
+		if secret, err = ReadJWTSecret(config.Auth.JWT.HS256SecretFile); err != nil {
+			return nil, err
+		}
+	}
+	if config.Auth.JWT.RS256PublicKeyFile != "" {
+		if publicKey, err = ReadRSAPublicKey(config.Auth.JWT.RS256PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	var verifier *JWTVerifier
+	if secret != nil || publicKey != nil {
+		if verifier, err = NewJWTVerifier(secret, publicKey, config.Auth.JWT.Issuer, config.Auth.JWT.Audience); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(keys.Keys) == 0 && verifier == nil {
+		return nil, errors.New("Authentication is enabled, but there are no API keys and no JWT keys")
+	}
+	return New(keys, verifier), nil
+}
+
+// Authenticate returns principal of request r with API key or bearer token
+func (authenticator *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if authenticator == nil {
+		return Anonymous, nil
+	}
+	if key := r.Header.Get(api.APIKeyHeader); key != "" {
+		if principal := authenticator.keys.principal(key); principal != nil {
+			return principal, nil
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return nil, ErrNoCredentials
+	}
+	scheme, token, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, "Bearer") || authenticator.jwt == nil {
+		return nil, ErrInvalidCredentials
+	}
+	principal, err := authenticator.jwt.Verify(strings.TrimSpace(token), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return principal, nil
+}
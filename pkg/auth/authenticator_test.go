@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"kafka-log-processor/pkg/api"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthenticatorAuthenticate(t *testing.T) {
+	hash := sha256.Sum256([]byte("staff-key"))
+	keys := APIKeys{Keys: []APIKey{{Name: "staff", SHA256: hex.EncodeToString(hash[:]), Role: CourseStaffRole, Courses: []string{"course-v1:org+C1+2020"}}}}
+	verifier, err := NewJWTVerifier(testSecret, nil, "", "")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error = %v", err)
+	}
+	token := signJWT(t, "HS256", map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "role": ResearcherRole}, testSecret, nil)
+
+	tests := []struct {
+		name          string
+		authenticator *Authenticator
+		headers       map[string]string
+		wantSubject   string
+		wantErr       error
+	}{
+		{"API key", New(keys, verifier), map[string]string{api.APIKeyHeader: "staff-key"}, "key:staff", nil},
+		{"wrong API key", New(keys, verifier), map[string]string{api.APIKeyHeader: "other-key"}, "", ErrInvalidCredentials},
+		{"wrong API key with valid token", New(keys, verifier), map[string]string{api.APIKeyHeader: "other-key", "Authorization": "Bearer " + token}, "", ErrInvalidCredentials},
+		{"bearer token", New(keys, verifier), map[string]string{"Authorization": "Bearer " + token}, "jwt:alice", nil},
+		{"lower case scheme", New(keys, verifier), map[string]string{"Authorization": "bearer " + token}, "jwt:alice", nil},
+		{"basic scheme", New(keys, verifier), map[string]string{"Authorization": "Basic " + token}, "", ErrInvalidCredentials},
+		{"invalid token", New(keys, verifier), map[string]string{"Authorization": "Bearer " + token + "x"}, "", ErrInvalidCredentials},
+		{"token without JWT verifier", New(keys, nil), map[string]string{"Authorization": "Bearer " + token}, "", ErrInvalidCredentials},
+		{"no credentials", New(keys, verifier), nil, "", ErrNoCredentials},
+		{"authentication disabled", nil, nil, Anonymous.Subject, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/course-ids", nil)
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			principal, err := test.authenticator.Authenticate(r)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if principal.Subject != test.wantSubject {
+				t.Errorf("Subject = %v, want %v", principal.Subject, test.wantSubject)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package auth
+
+// Verification of JWT bearer tokens signed with HS256 (shared secret) or RS256
+// (public key of the identity provider). Tokens must have "exp", "sub" and
+// "role" claims, "courses" lists the course ids the token gives access to.
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// Tokens are accepted this long after their expiration because of clock skew
+const jwtLeeway = time.Minute
+
+// JWTVerifier checks signatures and claims of JWTs
+type JWTVerifier struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	issuer    string
+	audience  string
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+	Role      string          `json:"role"`
+	Courses   []string        `json:"courses"`
+}
+
+// NewJWTVerifier constructs JWTVerifier of HS256 tokens signed with secret and of RS256
+// tokens signed with the key of publicKey, one of them can be nil. Issuer and audience
+// are checked if they aren't empty.
+func NewJWTVerifier(secret []byte, publicKey *rsa.PublicKey, issuer string, audience string) (*JWTVerifier, error) {
+	if secret == nil && publicKey == nil {
+		return nil, errors.New("JWT secret or public key is required")
+	}
+	if secret != nil && len(secret) < sha256.Size {
+		return nil, errors.New("JWT secret is shorter than 32 bytes")
+	}
+	return &JWTVerifier{secret: secret, publicKey: publicKey, issuer: issuer, audience: audience}, nil
+}
+
+// ReadJWTSecret reads base64 encoded HS256 secret from file
+func ReadJWTSecret(fileName string) ([]byte, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, errors.New("JWT secret in " + fileName + " is not base64 encoded")
+	}
+	return secret, nil
+}
+
+// ReadRSAPublicKey reads PEM encoded RSA public key from file
+func ReadRSAPublicKey(fileName string) (*rsa.PublicKey, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("No PEM block in " + fileName)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if rsaKey, rsaErr := x509.ParsePKCS1PublicKey(block.Bytes); rsaErr == nil {
+			return rsaKey, nil
+		}
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Public key in " + fileName + " is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// Verify returns principal of valid token at time now
+func (verifier *JWTVerifier) Verify(token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Token is not a JWT")
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("Token signature is not base64url encoded")
+	}
+	if err = verifier.verifySignature(header.Algorithm, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return nil, errors.New("Token is expired")
+	}
+	if claims.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, errors.New("Token is not valid yet")
+	}
+	if verifier.issuer != "" && claims.Issuer != verifier.issuer {
+		return nil, errors.New("Token has unexpected issuer")
+	}
+	if verifier.audience != "" && !hasAudience(claims.Audience, verifier.audience) {
+		return nil, errors.New("Token has unexpected audience")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("Token has no subject")
+	}
+	if !isRole(claims.Role) {
+		return nil, errors.New("Token has unknown role " + claims.Role)
+	}
+	return &Principal{Subject: "jwt:" + claims.Subject, Role: claims.Role, Courses: claims.Courses, ExpiresAt: time.Unix(claims.ExpiresAt, 0)}, nil
+}
+
+func (verifier *JWTVerifier) verifySignature(algorithm string, signed string, signature []byte) error {
+	switch {
+	case algorithm == "HS256" && verifier.secret != nil:
+		mac := hmac.New(sha256.New, verifier.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("Token signature is invalid")
+		}
+		return nil
+	case algorithm == "RS256" && verifier.publicKey != nil:
+		hash := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(verifier.publicKey, crypto.SHA256, hash[:], signature); err != nil {
+			return errors.New("Token signature is invalid")
+		}
+		return nil
+	}
+	return errors.New("Token algorithm " + algorithm + " is not accepted")
+}
+
+func decodeJWTPart(part string, value interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("Token is not base64url encoded")
+	}
+	if err = json.Unmarshal(b, value); err != nil {
+		return errors.New("Token is not valid JSON")
+	}
+	return nil
+}
+
+// hasAudience tells if "aud" claim, a string or an array of strings, has audience
+func hasAudience(claim json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(claim, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(claim, &list) != nil {
+		return false
+	}
+	for _, value := range list {
+		if value == audience {
+			return true
+		}
+	}
+	return false
+}
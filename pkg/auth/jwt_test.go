@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte(strings.Repeat("s", 32))
+
+// signJWT returns token with claims signed by algorithm: HS256 with secret, RS256 with key
+// or "none" without signature
+func signJWT(t *testing.T, algorithm string, claims map[string]interface{}, secret []byte, key *rsa.PrivateKey) string {
+	t.Helper()
+	encode := func(value interface{}) string {
+		b, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := encode(map[string]string{"alg": algorithm, "typ": "JWT"}) + "." + encode(claims)
+	var signature []byte
+	switch algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		hash := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifierVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256Verifier, err := NewJWTVerifier(testSecret, nil, "lms", "edxlyser")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error = %v", err)
+	}
+	rs256Verifier, err := NewJWTVerifier(nil, &key.PublicKey, "lms", "edxlyser")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error = %v", err)
+	}
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		result := map[string]interface{}{
+			"sub": "alice", "iss": "lms", "aud": "edxlyser", "exp": now.Add(time.Hour).Unix(),
+			"role": CourseStaffRole, "courses": []string{"course-v1:org+C1+2020"},
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(result, name)
+			} else {
+				result[name] = value
+			}
+		}
+		return result
+	}
+	publicKeyBytes, err := json.Marshal(key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// claims of an admin token with the signature of a course staff token
+	staffParts := strings.Split(signJWT(t, "HS256", claims(nil), testSecret, nil), ".")
+	adminParts := strings.Split(signJWT(t, "HS256", claims(map[string]interface{}{"role": AdminRole}), testSecret, nil), ".")
+	forged := staffParts[0] + "." + adminParts[1] + "." + staffParts[2]
+
+	tests := []struct {
+		name     string
+		verifier *JWTVerifier
+		token    string
+		wantErr  string
+	}{
+		{"HS256", hs256Verifier, signJWT(t, "HS256", claims(nil), testSecret, nil), ""},
+		{"RS256", rs256Verifier, signJWT(t, "RS256", claims(nil), nil, key), ""},
+		{"HS256 to RS256 only verifier", rs256Verifier, signJWT(t, "HS256", claims(nil), testSecret, nil), "Token algorithm HS256 is not accepted"},
+		{"HS256 signed with the public key", rs256Verifier, signJWT(t, "HS256", claims(nil), publicKeyBytes, nil), "Token algorithm HS256 is not accepted"},
+		{"RS256 to HS256 only verifier", hs256Verifier, signJWT(t, "RS256", claims(nil), nil, key), "Token algorithm RS256 is not accepted"},
+		{"none to HS256 verifier", hs256Verifier, signJWT(t, "none", claims(nil), nil, nil), "Token algorithm none is not accepted"},
+		{"none to RS256 verifier", rs256Verifier, signJWT(t, "none", claims(nil), nil, nil), "Token algorithm none is not accepted"},
+		{"wrong secret", hs256Verifier, signJWT(t, "HS256", claims(nil), []byte(strings.Repeat("x", 32)), nil), "Token signature is invalid"},
+		{"changed claims", hs256Verifier, forged, "Token signature is invalid"},
+		{"not a JWT", hs256Verifier, "token", "Token is not a JWT"},
+		{"expired within leeway", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"exp": now.Add(-59 * time.Second).Unix()}), testSecret, nil), ""},
+		{"expired after leeway", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"exp": now.Add(-61 * time.Second).Unix()}), testSecret, nil), "Token is expired"},
+		{"without expiration", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"exp": nil}), testSecret, nil), "Token is expired"},
+		{"not before within leeway", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"nbf": now.Add(59 * time.Second).Unix()}), testSecret, nil), ""},
+		{"not before after leeway", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"nbf": now.Add(61 * time.Second).Unix()}), testSecret, nil), "Token is not valid yet"},
+		{"audience array", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"aud": []string{"other", "edxlyser"}}), testSecret, nil), ""},
+		{"other audience", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"aud": "other"}), testSecret, nil), "Token has unexpected audience"},
+		{"other audience array", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"aud": []string{"other"}}), testSecret, nil), "Token has unexpected audience"},
+		{"without audience", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"aud": nil}), testSecret, nil), "Token has unexpected audience"},
+		{"other issuer", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"iss": "other"}), testSecret, nil), "Token has unexpected issuer"},
+		{"without subject", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"sub": nil}), testSecret, nil), "Token has no subject"},
+		{"unknown role", hs256Verifier, signJWT(t, "HS256", claims(map[string]interface{}{"role": "root"}), testSecret, nil), "Token has unknown role root"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := test.verifier.Verify(test.token, now)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("Verify() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if principal.Subject != "jwt:alice" || principal.Role != CourseStaffRole || len(principal.Courses) != 1 || principal.ExpiresAt.IsZero() {
+				t.Errorf("principal = %+v", principal)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+// Authentication and authorization of the analysis API. Callers authenticate with an
+// API key in the X-API-Key header or with a JWT in the "Authorization: Bearer" header.
+// Both give a Principal with a role and a list of courses it can read.
+
+import (
+	"context"
+	"time"
+)
+
+// Roles of principals
+const (
+	// AdminRole reads every course and identifiable data
+	AdminRole = "admin"
+	// CourseStaffRole reads its courses and identifiable data of their learners
+	CourseStaffRole = "course_staff"
+	// ResearcherRole reads only aggregated data of its courses
+	ResearcherRole = "researcher"
+)
+
+// AllCourses in the course list of a principal gives access to every course
+const AllCourses = "*"
+
+// Roles are all the known roles
+var Roles = []string{AdminRole, CourseStaffRole, ResearcherRole}
+
+// Principal is an authenticated caller of the API. ExpiresAt is the time its credentials
+// expire, it is zero for credentials that don't expire.
+type Principal struct {
+	Subject   string
+	Role      string
+	Courses   []string
+	ExpiresAt time.Time
+}
+
+// Anonymous is the principal of every request when authentication is disabled
+var Anonymous = &Principal{Subject: "anonymous", Role: AdminRole}
+
+// HasAllCourses tells if principal can read every course
+func (principal *Principal) HasAllCourses() bool {
+	if principal.Role == AdminRole {
+		return true
+	}
+	for _, course := range principal.Courses {
+		if course == AllCourses {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessCourse tells if principal can read data of course courseID
+func (principal *Principal) CanAccessCourse(courseID string) bool {
+	if principal.HasAllCourses() {
+		return true
+	}
+	for _, course := range principal.Courses {
+		if course == courseID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSeeIdentities tells if principal can read data with learner usernames
+func (principal *Principal) CanSeeIdentities() bool {
+	return principal.Role == AdminRole || principal.Role == CourseStaffRole
+}
+
+func isRole(role string) bool {
+	for _, known := range Roles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns ctx with principal
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns principal of ctx, nil if there is none
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
@@ -0,0 +1,53 @@
+package charts
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache keeps size recently used renders by their keys, it is safe for concurrent use
+type Cache struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key    string
+	render []byte
+}
+
+// NewCache constructs Cache of size renders
+func NewCache(size int) *Cache {
+	return &Cache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Get returns render of key
+func (cache *Cache) Get(key string) ([]byte, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).render, true
+}
+
+// Add saves render of key, the least recently used render is removed if the cache is full
+func (cache *Cache) Add(key string, render []byte) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*cacheEntry).render = render
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&cacheEntry{key: key, render: render})
+	if cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,374 @@
+package charts
+
+// Charts of analysis results rendered on the server, so pages can show them without
+// scripts and reports can include them as images. Charts lay themselves out on a canvas,
+// the canvas writes the output format: SVG or PNG.
+
+import (
+	"kafka-log-processor/pkg/models"
+	"math"
+	"strconv"
+)
+
+// Default size of charts
+const (
+	DefaultWidth  = 720
+	DefaultHeight = 320
+)
+
+const (
+	marginLeft   = 64
+	marginRight  = 24
+	marginTop    = 40
+	marginBottom = 48
+	fontSize     = 12
+	titleSize    = 14
+	tickCount    = 6
+	// maxLegendSeries is the largest number of series listed in the legend
+	maxLegendSeries = 8
+	// maxLabelLength is the longest bar label, longer labels are cut
+	maxLabelLength = 32
+	// charWidth is the approximate width of a character of fontSize
+	charWidth = fontSize * 0.6
+)
+
+// Chart is a chart that can be rendered as SVG element or PNG image
+type Chart interface {
+	SVG() string
+	// PNG renders the chart with every pixel of the layout scaled to scale x scale pixels
+	PNG(scale int) ([]byte, error)
+}
+
+// layout is a chart drawn on a canvas
+type layout interface {
+	size() (int, int)
+	title() string
+	draw(c canvas, width int, height int)
+}
+
+func renderSVG(chart layout) string {
+	width, height := chart.size()
+	c := newSVGCanvas(width, height, chart.title())
+	chart.draw(c, width, height)
+	return c.String()
+}
+
+func renderPNG(chart layout, scale int) ([]byte, error) {
+	width, height := chart.size()
+	c := newPNGCanvas(width, height, scale)
+	chart.draw(c, width, height)
+	return c.encode()
+}
+
+// Series is a named line of points with X and Y coordinates
+type Series struct {
+	Name string
+	X    []float64
+	Y    []float64
+}
+
+// CurveSeries returns series of the points of curve
+func CurveSeries(name string, curve models.Curve) Series {
+	series := Series{Name: name}
+	for i := range curve.X {
+		if i < len(curve.Y) {
+			series.X, series.Y = append(series.X, float64(curve.X[i])), append(series.Y, float64(curve.Y[i]))
+		}
+	}
+	return series
+}
+
+// CurveFloatToIntSeries returns series of the points of curve
+func CurveFloatToIntSeries(name string, curve models.CurveFloatToInt) Series {
+	series := Series{Name: name}
+	for i := range curve.X {
+		if i < len(curve.Y) {
+			series.X, series.Y = append(series.X, curve.X[i]), append(series.Y, float64(curve.Y[i]))
+		}
+	}
+	return series
+}
+
+// LineChart draws series as lines. Series are listed in the legend if there are few of them,
+// Opacity below 1 makes crossing lines of many series readable. FormatX and FormatY format
+// tick labels, numbers are formatted by default.
+type LineChart struct {
+	Title   string
+	XLabel  string
+	YLabel  string
+	Series  []Series
+	Width   int
+	Height  int
+	Theme   Theme
+	Opacity float64
+	FormatX func(float64) string
+	FormatY func(float64) string
+}
+
+// SVG returns the chart as SVG element
+func (chart LineChart) SVG() string { return renderSVG(chart) }
+
+// PNG returns the chart as PNG image
+func (chart LineChart) PNG(scale int) ([]byte, error) { return renderPNG(chart, scale) }
+
+func (chart LineChart) size() (int, int) { return size(chart.Width, chart.Height) }
+
+func (chart LineChart) title() string { return chart.Title }
+
+func (chart LineChart) draw(c canvas, width int, height int) {
+	theme := chart.Theme.orDefault()
+	drawBackground(c, theme, width, height)
+	drawTitle(c, theme, chart.Title, width)
+	minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), 0.0, math.Inf(-1)
+	for _, series := range chart.Series {
+		for i := range series.X {
+			if i >= len(series.Y) {
+				break
+			}
+			minX, maxX = math.Min(minX, series.X[i]), math.Max(maxX, series.X[i])
+			minY, maxY = math.Min(minY, series.Y[i]), math.Max(maxY, series.Y[i])
+		}
+	}
+	if math.IsInf(minX, 1) {
+		drawNoData(c, theme, width, height)
+		return
+	}
+
+	plot := area{left: marginLeft, top: marginTop, right: float64(width - marginRight), bottom: float64(height - marginBottom)}
+	xTicks, yTicks := niceTicks(minX, maxX, tickCount), niceTicks(minY, maxY, tickCount)
+	scaleX, scaleY := drawAxes(c, theme, plot, xTicks, yTicks, chart.FormatX, chart.FormatY)
+	drawAxisLabels(c, theme, plot, chart.XLabel, chart.YLabel)
+
+	opacity := chart.Opacity
+	if opacity <= 0 || opacity > 1 {
+		opacity = 1
+	}
+	for i, series := range chart.Series {
+		points := make([]point, 0, len(series.X))
+		for j := range series.X {
+			if j < len(series.Y) {
+				points = append(points, point{scaleX(series.X[j]), scaleY(series.Y[j])})
+			}
+		}
+		c.polyline(points, theme.color(i), 2, opacity)
+	}
+	if len(chart.Series) > 1 && len(chart.Series) <= maxLegendSeries {
+		drawLegend(c, theme, plot, chart.Series)
+	}
+}
+
+// BarChart draws horizontal bars of values with their labels. The bar of Max fills the
+// plot width, the largest value does if Max is 0. Height grows with the number of bars.
+type BarChart struct {
+	Title       string
+	XLabel      string
+	Labels      []string
+	Values      []float64
+	Max         float64
+	Width       int
+	Theme       Theme
+	FormatValue func(float64) string
+}
+
+const (
+	barHeight        = 22
+	barLabelsWidth   = 220
+	barValueWidth    = 56
+	barChartMinWidth = 360
+)
+
+// SVG returns the chart as SVG element
+func (chart BarChart) SVG() string { return renderSVG(chart) }
+
+// PNG returns the chart as PNG image
+func (chart BarChart) PNG(scale int) ([]byte, error) { return renderPNG(chart, scale) }
+
+func (chart BarChart) size() (int, int) {
+	width, _ := size(chart.Width, 0)
+	if width < barChartMinWidth {
+		width = barChartMinWidth
+	}
+	if len(chart.Values) == 0 {
+		return width, DefaultHeight / 2
+	}
+	return width, marginTop + marginBottom + barHeight*len(chart.Values)
+}
+
+func (chart BarChart) title() string { return chart.Title }
+
+func (chart BarChart) draw(c canvas, width int, height int) {
+	theme := chart.Theme.orDefault()
+	drawBackground(c, theme, width, height)
+	drawTitle(c, theme, chart.Title, width)
+	if len(chart.Values) == 0 {
+		drawNoData(c, theme, width, height)
+		return
+	}
+	maxValue := chart.Max
+	if maxValue <= 0 {
+		for _, value := range chart.Values {
+			maxValue = math.Max(maxValue, value)
+		}
+	}
+	if maxValue <= 0 {
+		maxValue = 1
+	}
+	formatValue := chart.FormatValue
+	if formatValue == nil {
+		formatValue = func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) }
+	}
+
+	plot := area{left: barLabelsWidth, top: marginTop, right: float64(width - barValueWidth), bottom: float64(height - marginBottom)}
+	for i, value := range chart.Values {
+		top := plot.top + float64(i*barHeight)
+		label := ""
+		if i < len(chart.Labels) {
+			label = cut(chart.Labels[i], maxLabelLength)
+		}
+		c.text(plot.left-6, top+barHeight/2+fontSize/3, label, textStyle{size: fontSize, anchor: anchorEnd, color: theme.Text})
+		barWidth := math.Max(0, math.Min(value, maxValue)) / maxValue * plot.width()
+		c.rect(plot.left, top+3, barWidth, barHeight-6, theme.color(0))
+		c.text(plot.left+barWidth+4, top+barHeight/2+fontSize/3, formatValue(value), textStyle{size: fontSize, color: theme.Text})
+	}
+	c.line(plot.left, plot.top, plot.left, plot.bottom, theme.Axis, 1)
+	drawAxisLabels(c, theme, plot, chart.XLabel, "")
+}
+
+// area is a rectangle of the canvas
+type area struct {
+	left, top, right, bottom float64
+}
+
+func (a area) width() float64  { return a.right - a.left }
+func (a area) height() float64 { return a.bottom - a.top }
+
+func size(width int, height int) (int, int) {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	if height <= 0 {
+		height = DefaultHeight
+	}
+	return width, height
+}
+
+func drawBackground(c canvas, theme Theme, width int, height int) {
+	c.rect(0, 0, float64(width), float64(height), theme.Background)
+}
+
+func drawTitle(c canvas, theme Theme, title string, width int) {
+	if title != "" {
+		c.text(float64(width)/2, marginTop/2+titleSize/3, title, textStyle{size: titleSize, anchor: anchorMiddle, color: theme.Text, bold: true})
+	}
+}
+
+func drawNoData(c canvas, theme Theme, width int, height int) {
+	c.text(float64(width)/2, float64(height)/2, "No data", textStyle{size: fontSize, anchor: anchorMiddle, color: theme.Axis})
+}
+
+// drawAxes draws grid, ticks and axes of the plot and returns scales from values to canvas coordinates.
+// The axes span from the first to the last tick.
+func drawAxes(c canvas, theme Theme, plot area, xTicks []float64, yTicks []float64, formatX func(float64) string, formatY func(float64) string) (func(float64) float64, func(float64) float64) {
+	minX, maxX := xTicks[0], xTicks[len(xTicks)-1]
+	minY, maxY := yTicks[0], yTicks[len(yTicks)-1]
+	scaleX := func(x float64) float64 { return plot.left + (x-minX)/(maxX-minX)*plot.width() }
+	scaleY := func(y float64) float64 { return plot.bottom - (y-minY)/(maxY-minY)*plot.height() }
+	if formatX == nil {
+		formatX = numberFormat(xTicks)
+	}
+	if formatY == nil {
+		formatY = numberFormat(yTicks)
+	}
+	for _, tick := range yTicks {
+		y := scaleY(tick)
+		c.line(plot.left, y, plot.right, y, theme.Grid, 1)
+		c.text(plot.left-6, y+fontSize/3, formatY(tick), textStyle{size: fontSize, anchor: anchorEnd, color: theme.Text})
+	}
+	for _, tick := range xTicks {
+		x := scaleX(tick)
+		c.line(x, plot.bottom, x, plot.bottom+4, theme.Axis, 1)
+		c.text(x, plot.bottom+fontSize+6, formatX(tick), textStyle{size: fontSize, anchor: anchorMiddle, color: theme.Text})
+	}
+	c.line(plot.left, plot.top, plot.left, plot.bottom, theme.Axis, 1)
+	c.line(plot.left, plot.bottom, plot.right, plot.bottom, theme.Axis, 1)
+	return scaleX, scaleY
+}
+
+func drawAxisLabels(c canvas, theme Theme, plot area, xLabel string, yLabel string) {
+	if xLabel != "" {
+		c.text(plot.left+plot.width()/2, plot.bottom+2*fontSize+12, xLabel, textStyle{size: fontSize, anchor: anchorMiddle, color: theme.Text})
+	}
+	if yLabel != "" {
+		c.text(fontSize+2, plot.top+plot.height()/2, yLabel, textStyle{size: fontSize, anchor: anchorMiddle, color: theme.Text, vertical: true})
+	}
+}
+
+// drawLegend lists series names in the top right corner of the plot
+func drawLegend(c canvas, theme Theme, plot area, series []Series) {
+	const lineHeight, swatchWidth = fontSize + 6, 16
+	legendWidth := 0
+	for _, s := range series {
+		if length := len([]rune(cut(s.Name, maxLabelLength))); length > legendWidth {
+			legendWidth = length
+		}
+	}
+	width := float64(legendWidth)*charWidth + swatchWidth + 16
+	left, top := plot.right-width-4, plot.top+4
+	c.rect(left, top, width, float64(len(series)*lineHeight)+8, theme.Background)
+	for i, s := range series {
+		y := top + 4 + float64(i*lineHeight) + lineHeight/2
+		c.line(left+6, y, left+6+swatchWidth, y, theme.color(i), 3)
+		c.text(left+10+swatchWidth, y+fontSize/3, cut(s.Name, maxLabelLength), textStyle{size: fontSize, color: theme.Text})
+	}
+}
+
+// niceTicks returns about count evenly spaced round values from below min to above max
+func niceTicks(min float64, max float64, count int) []float64 {
+	if min == max {
+		if min == 0 {
+			max = 1
+		} else {
+			min, max = min-math.Abs(min)/2, max+math.Abs(max)/2
+		}
+	}
+	step := niceNumber((max - min) / float64(count-1))
+	start, end := math.Floor(min/step)*step, math.Ceil(max/step)*step
+	ticks := []float64{}
+	for tick := start; tick <= end+step/2; tick += step {
+		ticks = append(ticks, math.Round(tick/step)*step)
+	}
+	return ticks
+}
+
+// niceNumber returns 1, 2 or 5 multiplied by a power of 10 not less than x
+func niceNumber(x float64) float64 {
+	power := math.Pow(10, math.Floor(math.Log10(x)))
+	switch fraction := x / power; {
+	case fraction <= 1:
+		return power
+	case fraction <= 2:
+		return 2 * power
+	case fraction <= 5:
+		return 5 * power
+	}
+	return 10 * power
+}
+
+// numberFormat formats ticks with as many decimals as their step needs
+func numberFormat(ticks []float64) func(float64) string {
+	decimals := 0
+	if len(ticks) > 1 {
+		step := ticks[1] - ticks[0]
+		decimals = int(math.Max(0, -math.Floor(math.Log10(step))))
+	}
+	return func(value float64) string {
+		return strconv.FormatFloat(value, 'f', decimals, 64)
+	}
+}
+
+func cut(text string, length int) string {
+	if runes := []rune(text); len(runes) > length {
+		return string(runes[:length-1]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,203 @@
+package charts
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingCanvas keeps rectangles and texts drawn on it
+type recordingCanvas struct {
+	rects []rectCall
+	texts []string
+}
+
+type rectCall struct {
+	width float64
+	color string
+}
+
+func (c *recordingCanvas) line(x1, y1, x2, y2 float64, color string, width float64) {}
+
+func (c *recordingCanvas) polyline(points []point, color string, width float64, opacity float64) {}
+
+func (c *recordingCanvas) rect(x, y, width, height float64, color string) {
+	c.rects = append(c.rects, rectCall{width: width, color: color})
+}
+
+func (c *recordingCanvas) text(x, y float64, value string, style textStyle) {
+	c.texts = append(c.texts, value)
+}
+
+func record(chart layout) *recordingCanvas {
+	c := &recordingCanvas{}
+	width, height := chart.size()
+	chart.draw(c, width, height)
+	return c
+}
+
+var testCharts = []struct {
+	name       string
+	chart      Chart
+	wantWidth  int
+	wantHeight int
+}{
+	{"line chart", LineChart{Title: "Plays & <pauses>", Series: []Series{
+		{Name: "video1", X: []float64{0, 10, 20}, Y: []float64{3, 5, 1}},
+		{Name: "video2", X: []float64{0, 10}, Y: []float64{2}},
+	}}, DefaultWidth, DefaultHeight},
+	{"empty line chart", LineChart{Width: 400, Height: 200}, 400, 200},
+	{"bar chart", BarChart{Title: "Blocks", Labels: []string{"a", "b"}, Values: []float64{1, 2}, Width: 100}, barChartMinWidth, marginTop + marginBottom + 2*barHeight},
+	{"histogram", Histogram{Values: []float64{1, 1, 2, 7}, Bins: 3, Theme: DarkTheme}, DefaultWidth, DefaultHeight},
+	{"heatmap", Heatmap{RowLabels: []string{"r1", "r2"}, ColumnLabels: []string{"c1", "c2"}, Values: [][]float64{{0, 1}, {2, 3}}}, DefaultWidth, DefaultHeight / 2},
+}
+
+func TestSVG(t *testing.T) {
+	for _, test := range testCharts {
+		t.Run(test.name, func(t *testing.T) {
+			var root struct {
+				XMLName xml.Name `xml:"svg"`
+				Width   int      `xml:"width,attr"`
+				Height  int      `xml:"height,attr"`
+				Title   string   `xml:"title"`
+			}
+			svg := test.chart.SVG()
+			if err := xml.Unmarshal([]byte(svg), &root); err != nil {
+				t.Fatalf("SVG() isn't valid XML: %v", err)
+			}
+			if root.Width != test.wantWidth || root.Height != test.wantHeight {
+				t.Errorf("SVG() size = %vx%v, want %vx%v", root.Width, root.Height, test.wantWidth, test.wantHeight)
+			}
+			if layout, ok := test.chart.(layout); ok && root.Title != layout.title() {
+				t.Errorf("SVG() title = %q, want %q", root.Title, layout.title())
+			}
+		})
+	}
+}
+
+func TestPNG(t *testing.T) {
+	for _, test := range testCharts {
+		t.Run(test.name, func(t *testing.T) {
+			for _, scale := range []int{0, 2} {
+				encoded, err := test.chart.PNG(scale)
+				if err != nil {
+					t.Fatalf("PNG() error = %v", err)
+				}
+				decoded, err := png.Decode(bytes.NewReader(encoded))
+				if err != nil {
+					t.Fatalf("PNG() isn't valid image: %v", err)
+				}
+				wantScale := scale
+				if wantScale < 1 {
+					wantScale = 1
+				}
+				bounds := decoded.Bounds()
+				if bounds.Dx() != test.wantWidth*wantScale || bounds.Dy() != test.wantHeight*wantScale {
+					t.Errorf("PNG(%v) size = %vx%v, want %vx%v", scale, bounds.Dx(), bounds.Dy(), test.wantWidth*wantScale, test.wantHeight*wantScale)
+				}
+				theme := LightTheme
+				if test.name == "histogram" {
+					theme = DarkTheme
+				}
+				r, g, b, _ := decoded.At(0, 0).RGBA()
+				if want := rgba(theme.Background); uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+					t.Errorf("PNG(%v) corner colour = %v %v %v, want background %v", scale, r>>8, g>>8, b>>8, theme.Background)
+				}
+			}
+		})
+	}
+}
+
+func TestBarChart(t *testing.T) {
+	plotWidth := float64(DefaultWidth - barLabelsWidth - barValueWidth)
+	tests := []struct {
+		name       string
+		chart      BarChart
+		wantWidths []float64
+	}{
+		{"largest value fills the plot", BarChart{Values: []float64{10, 5, 20}}, []float64{plotWidth / 2, plotWidth / 4, plotWidth}},
+		{"max", BarChart{Values: []float64{10, 40, -1}, Max: 20}, []float64{plotWidth / 2, plotWidth, 0}},
+		{"zero values", BarChart{Values: []float64{0}}, []float64{0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := record(test.chart)
+			// the first rectangle is the background
+			widths := make([]float64, 0)
+			for _, rect := range c.rects[1:] {
+				widths = append(widths, rect.width)
+			}
+			if !reflect.DeepEqual(widths, test.wantWidths) {
+				t.Errorf("bar widths = %v, want %v", widths, test.wantWidths)
+			}
+		})
+	}
+
+	c := record(BarChart{Labels: []string{strings.Repeat("x", 40)}, Values: []float64{1}})
+	if want := strings.Repeat("x", maxLabelLength-1) + "…"; c.texts[0] != want {
+		t.Errorf("label = %q, want %q", c.texts[0], want)
+	}
+}
+
+func TestNoData(t *testing.T) {
+	for _, chart := range []layout{LineChart{}, LineChart{Series: []Series{{Name: "empty"}}}, BarChart{}, Histogram{}} {
+		c := record(chart)
+		if len(c.texts) != 1 || c.texts[0] != "No data" {
+			t.Errorf("texts of %T without data = %v, want No data", chart, c.texts)
+		}
+	}
+}
+
+func TestNiceTicks(t *testing.T) {
+	tests := []struct {
+		min, max float64
+		want     []float64
+	}{
+		{0, 10, []float64{0, 2, 4, 6, 8, 10}},
+		{3, 97, []float64{0, 20, 40, 60, 80, 100}},
+		{0, 0.3, []float64{0, 0.1, 0.2, 0.3}},
+		{0, 0, []float64{0, 0.2, 0.4, 0.6, 0.8, 1}},
+		{4, 4, []float64{2, 3, 4, 5, 6}},
+	}
+	for _, test := range tests {
+		got := niceTicks(test.min, test.max, tickCount)
+		equal := len(got) == len(test.want)
+		for i := 0; equal && i < len(got); i++ {
+			equal = math.Abs(got[i]-test.want[i]) < 1e-9
+		}
+		if !equal {
+			t.Errorf("niceTicks(%v, %v) = %v, want %v", test.min, test.max, got, test.want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(2)
+	cache.Add("a", []byte("a"))
+	cache.Add("b", []byte("b"))
+	cache.Get("a")
+	cache.Add("c", []byte("c"))
+	cache.Add("a", []byte("new a"))
+
+	tests := []struct {
+		key    string
+		want   []byte
+		wantOk bool
+	}{
+		{"a", []byte("new a"), true},
+		{"b", nil, false},
+		{"c", []byte("c"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			got, ok := cache.Get(test.key)
+			if !bytes.Equal(got, test.want) || ok != test.wantOk {
+				t.Errorf("Get(%q) = %q, %v, want %q, %v", test.key, got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
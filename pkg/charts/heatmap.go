@@ -0,0 +1,124 @@
+package charts
+
+import (
+	"math"
+	"strconv"
+)
+
+const (
+	heatmapRowHeight   = 18
+	heatmapLegendWidth = 72
+	heatmapLegendSteps = 5
+)
+
+// Heatmap draws Values[row][column] as cells coloured from the background to the first
+// palette colour by their share of the largest value. Height grows with the number of
+// rows if it is 0. Labels that don't fit are skipped.
+type Heatmap struct {
+	Title        string
+	XLabel       string
+	RowLabels    []string
+	ColumnLabels []string
+	Values       [][]float64
+	Width        int
+	Height       int
+	Theme        Theme
+	FormatValue  func(float64) string
+}
+
+// SVG returns the chart as SVG element
+func (chart Heatmap) SVG() string { return renderSVG(chart) }
+
+// PNG returns the chart as PNG image
+func (chart Heatmap) PNG(scale int) ([]byte, error) { return renderPNG(chart, scale) }
+
+func (chart Heatmap) size() (int, int) {
+	height := chart.Height
+	if height <= 0 {
+		height = int(math.Max(DefaultHeight/2, float64(marginTop+marginBottom+heatmapRowHeight*len(chart.Values))))
+	}
+	return size(chart.Width, height)
+}
+
+func (chart Heatmap) title() string { return chart.Title }
+
+func (chart Heatmap) draw(c canvas, width int, height int) {
+	theme := chart.Theme.orDefault()
+	drawBackground(c, theme, width, height)
+	drawTitle(c, theme, chart.Title, width)
+	columns, maxValue := 0, 0.0
+	for _, row := range chart.Values {
+		if len(row) > columns {
+			columns = len(row)
+		}
+		for _, value := range row {
+			maxValue = math.Max(maxValue, value)
+		}
+	}
+	if columns == 0 {
+		drawNoData(c, theme, width, height)
+		return
+	}
+	if maxValue <= 0 {
+		maxValue = 1
+	}
+	formatValue := chart.FormatValue
+	if formatValue == nil {
+		formatValue = func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) }
+	}
+
+	labelsWidth := float64(longest(chart.RowLabels, maxLabelLength))*charWidth + 12
+	plot := area{
+		left:   math.Max(marginLeft, labelsWidth),
+		top:    marginTop,
+		right:  float64(width - marginRight - heatmapLegendWidth),
+		bottom: float64(height - marginBottom),
+	}
+	cellWidth, cellHeight := plot.width()/float64(columns), plot.height()/float64(len(chart.Values))
+	for i, row := range chart.Values {
+		for j, value := range row {
+			c.rect(plot.left+float64(j)*cellWidth, plot.top+float64(i)*cellHeight, cellWidth, cellHeight, mix(theme.Background, theme.color(0), value/maxValue))
+		}
+	}
+
+	rowStep := labelStep(fontSize+2, cellHeight)
+	for i := 0; i < len(chart.Values) && i < len(chart.RowLabels); i += rowStep {
+		y := plot.top + (float64(i)+0.5)*cellHeight + fontSize/3
+		c.text(plot.left-6, y, cut(chart.RowLabels[i], maxLabelLength), textStyle{size: fontSize, anchor: anchorEnd, color: theme.Text})
+	}
+	columnStep := labelStep(float64(longest(chart.ColumnLabels, maxLabelLength))*charWidth+8, cellWidth)
+	for j := 0; j < columns && j < len(chart.ColumnLabels); j += columnStep {
+		x := plot.left + (float64(j)+0.5)*cellWidth
+		c.text(x, plot.bottom+fontSize+6, cut(chart.ColumnLabels[j], maxLabelLength), textStyle{size: fontSize, anchor: anchorMiddle, color: theme.Text})
+	}
+	c.line(plot.left, plot.bottom, plot.right, plot.bottom, theme.Axis, 1)
+	drawAxisLabels(c, theme, plot, chart.XLabel, "")
+
+	// legend of colours from the largest value down to 0
+	const swatch = 12
+	for step := 0; step < heatmapLegendSteps; step++ {
+		share := 1 - float64(step)/(heatmapLegendSteps-1)
+		y := plot.top + float64(step)*(swatch+6)
+		c.rect(plot.right+12, y, swatch, swatch, mix(theme.Background, theme.color(0), share))
+		c.text(plot.right+16+swatch, y+swatch-2, formatValue(share*maxValue), textStyle{size: fontSize, color: theme.Text})
+	}
+}
+
+// labelStep returns how many cells of size cellSize a label of size labelSize needs
+func labelStep(labelSize float64, cellSize float64) int {
+	return int(math.Max(1, math.Ceil(labelSize/cellSize)))
+}
+
+// longest returns number of characters of the longest label, at most limit
+func longest(labels []string, limit int) int {
+	length := 0
+	for _, label := range labels {
+		if n := len([]rune(label)); n > length {
+			length = n
+		}
+	}
+	if length > limit {
+		return limit
+	}
+	return length
+}
@@ -0,0 +1,74 @@
+package charts
+
+import "math"
+
+// defaultBins is the number of histogram bins if Bins is 0
+const defaultBins = 10
+
+// Histogram draws numbers of Values in Bins equal bins from the smallest to the largest value
+type Histogram struct {
+	Title   string
+	XLabel  string
+	YLabel  string
+	Values  []float64
+	Bins    int
+	Width   int
+	Height  int
+	Theme   Theme
+	FormatX func(float64) string
+}
+
+// SVG returns the chart as SVG element
+func (chart Histogram) SVG() string { return renderSVG(chart) }
+
+// PNG returns the chart as PNG image
+func (chart Histogram) PNG(scale int) ([]byte, error) { return renderPNG(chart, scale) }
+
+func (chart Histogram) size() (int, int) { return size(chart.Width, chart.Height) }
+
+func (chart Histogram) title() string { return chart.Title }
+
+func (chart Histogram) draw(c canvas, width int, height int) {
+	theme := chart.Theme.orDefault()
+	drawBackground(c, theme, width, height)
+	drawTitle(c, theme, chart.Title, width)
+	if len(chart.Values) == 0 {
+		drawNoData(c, theme, width, height)
+		return
+	}
+	bins := chart.Bins
+	if bins <= 0 {
+		bins = defaultBins
+	}
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, value := range chart.Values {
+		minValue, maxValue = math.Min(minValue, value), math.Max(maxValue, value)
+	}
+	if minValue == maxValue {
+		maxValue = minValue + 1
+	}
+	binWidth := (maxValue - minValue) / float64(bins)
+	counts := make([]int, bins)
+	maxCount := 0
+	for _, value := range chart.Values {
+		bin := int((value - minValue) / binWidth)
+		if bin >= bins {
+			bin = bins - 1
+		}
+		counts[bin]++
+		if counts[bin] > maxCount {
+			maxCount = counts[bin]
+		}
+	}
+
+	plot := area{left: marginLeft, top: marginTop, right: float64(width - marginRight), bottom: float64(height - marginBottom)}
+	// counts are integers, so the y step is at least 1
+	yTicks := niceTicks(0, math.Max(float64(maxCount), tickCount-1), tickCount)
+	scaleX, scaleY := drawAxes(c, theme, plot, niceTicks(minValue, maxValue, tickCount), yTicks, chart.FormatX, nil)
+	for bin, count := range counts {
+		left, right := scaleX(minValue+float64(bin)*binWidth), scaleX(minValue+float64(bin+1)*binWidth)
+		top := scaleY(float64(count))
+		c.rect(left+1, top, math.Max(1, right-left-2), plot.bottom-top, theme.color(0))
+	}
+	drawAxisLabels(c, theme, plot, chart.XLabel, chart.YLabel)
+}
@@ -0,0 +1,134 @@
+package charts
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// maxPNGScale limits the size of PNG images
+const maxPNGScale = 4
+
+// pngCanvas draws RGBA image. Coordinates of the layout are multiplied by scale,
+// so charts keep their layout at every resolution.
+type pngCanvas struct {
+	image *image.RGBA
+	scale float64
+}
+
+func newPNGCanvas(width int, height int, scale int) *pngCanvas {
+	if scale < 1 {
+		scale = 1
+	}
+	if scale > maxPNGScale {
+		scale = maxPNGScale
+	}
+	return &pngCanvas{image: image.NewRGBA(image.Rect(0, 0, width*scale, height*scale)), scale: float64(scale)}
+}
+
+func (c *pngCanvas) line(x1, y1, x2, y2 float64, color string, width float64) {
+	c.polyline([]point{{x1, y1}, {x2, y2}}, color, width, 1)
+}
+
+// polyline stamps square brush along the segments on a mask, so the joints
+// of lines with opacity aren't blended twice
+func (c *pngCanvas) polyline(points []point, color string, width float64, opacity float64) {
+	if len(points) == 0 {
+		return
+	}
+	brush := math.Max(1, math.Round(width*c.scale))
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		minX, minY = math.Min(minX, p.x*c.scale), math.Min(minY, p.y*c.scale)
+		maxX, maxY = math.Max(maxX, p.x*c.scale), math.Max(maxY, p.y*c.scale)
+	}
+	bounds := image.Rect(int(minX-brush), int(minY-brush), int(maxX+brush)+1, int(maxY+brush)+1).Intersect(c.image.Bounds())
+	if bounds.Empty() {
+		return
+	}
+	mask := image.NewAlpha(bounds)
+	alpha := uint8(math.Round(math.Max(0, math.Min(1, opacity)) * 255))
+	stamp := func(x float64, y float64) {
+		left, top := int(math.Round(x-brush/2)), int(math.Round(y-brush/2))
+		square := image.Rect(left, top, left+int(brush), top+int(brush)).Intersect(bounds)
+		for py := square.Min.Y; py < square.Max.Y; py++ {
+			for px := square.Min.X; px < square.Max.X; px++ {
+				mask.Pix[mask.PixOffset(px, py)] = alpha
+			}
+		}
+	}
+	stamp(points[0].x*c.scale, points[0].y*c.scale)
+	for i := 1; i < len(points); i++ {
+		x1, y1 := points[i-1].x*c.scale, points[i-1].y*c.scale
+		x2, y2 := points[i].x*c.scale, points[i].y*c.scale
+		steps := math.Max(math.Abs(x2-x1), math.Abs(y2-y1))
+		for step := 1.0; step <= steps; step++ {
+			stamp(x1+(x2-x1)*step/steps, y1+(y2-y1)*step/steps)
+		}
+		stamp(x2, y2)
+	}
+	draw.DrawMask(c.image, bounds, image.NewUniform(rgba(color)), image.Point{}, mask, bounds.Min, draw.Over)
+}
+
+func (c *pngCanvas) rect(x, y, width, height float64, color string) {
+	c.fill(x*c.scale, y*c.scale, width*c.scale, height*c.scale, rgba(color))
+}
+
+// text draws value with the bitmap font, a dot of glyphs is a square of size/fontSize layout pixels
+func (c *pngCanvas) text(x, y float64, value string, style textStyle) {
+	runes := []rune(strings.ReplaceAll(value, "…", "..."))
+	dot := math.Max(1, math.Round(style.size/fontSize*c.scale))
+	advance := (glyphColumns + 1) * dot
+	start := 0.0
+	switch style.anchor {
+	case anchorMiddle:
+		start = -(float64(len(runes))*advance - dot) / 2
+	case anchorEnd:
+		start = -(float64(len(runes))*advance - dot)
+	}
+	dotWidth, dotHeight := dot, dot
+	if style.bold {
+		dotWidth++
+	}
+	textColor := rgba(style.color)
+	originX, originY := x*c.scale, y*c.scale
+	for i, r := range runes {
+		bitmap := glyph(r)
+		for row := 0; row < glyphRows; row++ {
+			for column := 0; column < glyphColumns; column++ {
+				if bitmap[row]&(1<<(glyphColumns-1-column)) == 0 {
+					continue
+				}
+				along := start + float64(i)*advance + float64(column)*dot
+				across := float64(row-glyphRows) * dot
+				if style.vertical {
+					c.fill(originX+across, originY-along-dotWidth, dotHeight, dotWidth, textColor)
+				} else {
+					c.fill(originX+along, originY+across, dotWidth, dotHeight, textColor)
+				}
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) fill(x, y, width, height float64, fillColor color.Color) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+width)), int(math.Round(y+height)))
+	draw.Draw(c.image, r, image.NewUniform(fillColor), image.Point{}, draw.Over)
+}
+
+func (c *pngCanvas) encode() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, c.image); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func rgba(hex string) color.RGBA {
+	r, g, b := parseColor(hex)
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
@@ -0,0 +1,92 @@
+package charts
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Anchors of text, the start of text is at its point by default
+const (
+	anchorMiddle = "middle"
+	anchorEnd    = "end"
+)
+
+type point struct {
+	x, y float64
+}
+
+type textStyle struct {
+	size     float64
+	anchor   string
+	color    string
+	bold     bool
+	vertical bool
+}
+
+// canvas is a drawing surface of charts, coordinates are pixels from the top left corner
+type canvas interface {
+	line(x1, y1, x2, y2 float64, color string, width float64)
+	polyline(points []point, color string, width float64, opacity float64)
+	rect(x, y, width, height float64, color string)
+	text(x, y float64, value string, style textStyle)
+}
+
+// svgCanvas draws SVG element
+type svgCanvas struct {
+	builder strings.Builder
+}
+
+func newSVGCanvas(width int, height int, title string) *svgCanvas {
+	c := &svgCanvas{}
+	fmt.Fprintf(&c.builder, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v" role="img" font-family="sans-serif">`,
+		width, height, width, height)
+	if title != "" {
+		fmt.Fprintf(&c.builder, "<title>%v</title>", escape(title))
+	}
+	return c
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 float64, color string, width float64) {
+	fmt.Fprintf(&c.builder, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%v" stroke-width="%v"/>`, x1, y1, x2, y2, color, width)
+}
+
+func (c *svgCanvas) polyline(points []point, color string, width float64, opacity float64) {
+	c.builder.WriteString(`<polyline fill="none" points="`)
+	for i, p := range points {
+		if i > 0 {
+			c.builder.WriteByte(' ')
+		}
+		fmt.Fprintf(&c.builder, "%.1f,%.1f", p.x, p.y)
+	}
+	fmt.Fprintf(&c.builder, `" stroke="%v" stroke-width="%v" stroke-opacity="%v" stroke-linejoin="round"/>`, color, width, opacity)
+}
+
+func (c *svgCanvas) rect(x, y, width, height float64, color string) {
+	fmt.Fprintf(&c.builder, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%v"/>`, x, y, width, height, color)
+}
+
+func (c *svgCanvas) text(x, y float64, value string, style textStyle) {
+	fmt.Fprintf(&c.builder, `<text x="%.1f" y="%.1f" font-size="%v" fill="%v"`, x, y, style.size, style.color)
+	if style.anchor != "" {
+		fmt.Fprintf(&c.builder, ` text-anchor="%v"`, style.anchor)
+	}
+	if style.bold {
+		c.builder.WriteString(` font-weight="bold"`)
+	}
+	if style.vertical {
+		fmt.Fprintf(&c.builder, ` transform="rotate(-90 %.1f %.1f)"`, x, y)
+	}
+	fmt.Fprintf(&c.builder, ">%v</text>", escape(value))
+}
+
+// String returns the whole SVG element
+func (c *svgCanvas) String() string {
+	return c.builder.String() + "</svg>"
+}
+
+func escape(value string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(value))
+	return builder.String()
+}
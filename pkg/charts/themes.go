@@ -0,0 +1,70 @@
+package charts
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Theme is a set of chart colours in "#rrggbb" format, series are coloured by Palette in their order
+type Theme struct {
+	Background string
+	Text       string
+	Axis       string
+	Grid       string
+	Palette    []string
+}
+
+// Themes of charts by their names
+var (
+	LightTheme = Theme{
+		Background: "#ffffff",
+		Text:       "#333333",
+		Axis:       "#666666",
+		Grid:       "#e5e5e5",
+		Palette:    []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"},
+	}
+	DarkTheme = Theme{
+		Background: "#1e1e1e",
+		Text:       "#e0e0e0",
+		Axis:       "#a0a0a0",
+		Grid:       "#3a3a3a",
+		Palette:    []string{"#4ea8de", "#ffa94d", "#69db7c", "#ff6b6b", "#b197fc", "#e599f7", "#ffd43b", "#ced4da", "#63e6be", "#ff8787"},
+	}
+	Themes = map[string]Theme{"light": LightTheme, "dark": DarkTheme}
+)
+
+// orDefault returns the theme or LightTheme if the theme is zero
+func (theme Theme) orDefault() Theme {
+	if theme.Background == "" || len(theme.Palette) == 0 {
+		return LightTheme
+	}
+	return theme
+}
+
+// color returns colour of series i
+func (theme Theme) color(i int) string {
+	return theme.Palette[i%len(theme.Palette)]
+}
+
+// mix returns colour share of the way from colour from to colour to
+func mix(from string, to string, share float64) string {
+	r1, g1, b1 := parseColor(from)
+	r2, g2, b2 := parseColor(to)
+	channel := func(a uint8, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*share))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", channel(r1, r2), channel(g1, g2), channel(b1, b2))
+}
+
+// parseColor returns channels of "#rrggbb" colour, black if color has another format
+func parseColor(color string) (uint8, uint8, uint8) {
+	if len(color) != 7 || color[0] != '#' {
+		return 0, 0, 0
+	}
+	value, err := strconv.ParseUint(color[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0
+	}
+	return uint8(value >> 16), uint8(value >> 8), uint8(value)
+}
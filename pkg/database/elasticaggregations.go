@@ -12,45 +12,72 @@ import (
 
 // GetUniqueStringFieldValuesInIndex returns all possible values of field fieldName in index indexName
 // Field fieldName should have type keyword (string)
-func (es *ElasticService) GetUniqueStringFieldValuesInIndex(indexName string, fieldName string) ([]string, error) {
+func (es *ElasticService) GetUniqueStringFieldValuesInIndex(ctx context.Context, indexName string, fieldName string) ([]string, error) {
+	return es.getAllStringFieldValues(ctx, indexName, fieldName, elastic.NewMatchAllQuery())
+}
+
+// GetUniqueStringFieldValuesInIndexWithFilter is a GetUniqueStringFieldValuesInIndex but with ability to filter the field filteredFieldName
+func (es *ElasticService) GetUniqueStringFieldValuesInIndexWithFilter(ctx context.Context, indexName string, fieldName string, filteredFieldName string, filteredFieldValue interface{}) ([]string, error) {
+	return es.getAllStringFieldValues(ctx, indexName, fieldName, elastic.NewTermQuery(filteredFieldName, filteredFieldValue))
+}
+
+// getAllStringFieldValues returns all values of field fieldName in documents found by query.
+// Values are requested page by page with composite aggregation, so none of them is lost.
+func (es *ElasticService) getAllStringFieldValues(ctx context.Context, indexName string, fieldName string, query elastic.Query) ([]string, error) {
 	if es.client == nil {
 		return nil, errors.New("You need to connect to ElasticSearch first")
 	}
-	searchResults, err := es.client.Search().
-		Index(indexName).
-		Aggregation("custom_aggregation", elastic.NewTermsAggregation().
-			Field(fieldName)).
-		Do(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	aggregationResults, ok := searchResults.Aggregations.Terms("custom_aggregation")
-	if !ok {
-		return nil, errors.New("Nothing was found")
-	}
 	result := make([]string, 0)
-	for _, bucket := range aggregationResults.Buckets {
-		if fieldValue, ok := bucket.Key.(string); ok {
-			result = append(result, fieldValue)
-		} else {
-			return nil, fmt.Errorf("Field %v should be a keyword", fieldName)
+	var afterKey map[string]interface{}
+	for {
+		aggregation := elastic.NewCompositeAggregation().
+			Sources(elastic.NewCompositeAggregationTermsValuesSource("value").Field(fieldName)).
+			Size(scrollPageSize)
+		if afterKey != nil {
+			aggregation = aggregation.AggregateAfter(afterKey)
+		}
+		searchResults, err := es.client.Search().
+			Index(indexName).
+			Query(query).
+			Size(0).
+			Aggregation("custom_aggregation", aggregation).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		aggregationResults, ok := searchResults.Aggregations.Composite("custom_aggregation")
+		if !ok {
+			return nil, errors.New("Nothing was found")
+		}
+		for _, bucket := range aggregationResults.Buckets {
+			if fieldValue, ok := bucket.Key["value"].(string); ok {
+				result = append(result, fieldValue)
+			} else {
+				return nil, fmt.Errorf("Field %v should be a keyword", fieldName)
+			}
 		}
+		if len(aggregationResults.Buckets) < scrollPageSize || aggregationResults.AfterKey == nil {
+			return result, nil
+		}
+		afterKey = aggregationResults.AfterKey
 	}
-	return result, nil
 }
 
-// GetUniqueStringFieldValuesInIndexWithFilter is a GetUniqueStringFieldValuesInIndex but with ability to filter the field filteredFieldName
-func (es *ElasticService) GetUniqueStringFieldValuesInIndexWithFilter(indexName string, fieldName string, filteredFieldName string, filteredFieldValue interface{}) ([]string, error) {
+// GetStringFieldValuesCountsWithFilters returns size most frequent values of field fieldName in index indexName
+// and numbers of documents with them. Only documents that have all the filters field values and match
+// eventFilter are counted. Field fieldName should have type keyword (string)
+func (es *ElasticService) GetStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) ([]FieldValueCount, error) {
 	if es.client == nil {
 		return nil, errors.New("You need to connect to ElasticSearch first")
 	}
 	searchResults, err := es.client.Search().
 		Index(indexName).
-		Query(elastic.NewTermQuery(filteredFieldName, filteredFieldValue)).
+		Query(termFiltersQuery(filters).Filter(eventFilterQueries(eventFilter)...)).
+		Size(0).
 		Aggregation("custom_aggregation", elastic.NewTermsAggregation().
 			Field(fieldName).
-			Size(1e8)).
-		Do(context.Background())
+			Size(size)).
+		Do(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -58,13 +85,126 @@ func (es *ElasticService) GetUniqueStringFieldValuesInIndexWithFilter(indexName
 	if !ok {
 		return nil, errors.New("Nothing was found")
 	}
-	result := make([]string, 0)
-	for _, bucket := range aggregationResults.Buckets {
-		if fieldValue, ok := bucket.Key.(string); ok {
-			result = append(result, fieldValue)
-		} else {
+	return termsBucketsToFieldValueCounts(fieldName, aggregationResults.Buckets)
+}
+
+// GetNestedStringFieldValuesCountsWithFilters groups documents of index indexName by field groupFieldName and
+// returns size most frequent values of field fieldName within every group. Only documents that have all the
+// filters field values and match eventFilter are counted. Both fields should have type keyword (string).
+// Groups are requested page by page with composite aggregation, so none of them is lost.
+func (es *ElasticService) GetNestedStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, groupFieldName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) (map[string][]FieldValueCount, error) {
+	if es.client == nil {
+		return nil, errors.New("You need to connect to ElasticSearch first")
+	}
+	query := termFiltersQuery(filters).Filter(eventFilterQueries(eventFilter)...)
+	result := map[string][]FieldValueCount{}
+	var afterKey map[string]interface{}
+	for {
+		aggregation := elastic.NewCompositeAggregation().
+			Sources(elastic.NewCompositeAggregationTermsValuesSource("group").Field(groupFieldName)).
+			Size(scrollPageSize).
+			SubAggregation("custom_aggregation", elastic.NewTermsAggregation().
+				Field(fieldName).
+				Size(size))
+		if afterKey != nil {
+			aggregation = aggregation.AggregateAfter(afterKey)
+		}
+		searchResults, err := es.client.Search().
+			Index(indexName).
+			Query(query).
+			Size(0).
+			Aggregation("groups_aggregation", aggregation).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		groupsResults, ok := searchResults.Aggregations.Composite("groups_aggregation")
+		if !ok {
+			return nil, errors.New("Nothing was found")
+		}
+		for _, groupBucket := range groupsResults.Buckets {
+			groupValue, ok := groupBucket.Key["group"].(string)
+			if !ok {
+				return nil, fmt.Errorf("Field %v should be a keyword", groupFieldName)
+			}
+			aggregationResults, ok := groupBucket.Terms("custom_aggregation")
+			if !ok {
+				return nil, errors.New("Nothing was found")
+			}
+			result[groupValue], err = termsBucketsToFieldValueCounts(fieldName, aggregationResults.Buckets)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(groupsResults.Buckets) < scrollPageSize || groupsResults.AfterKey == nil {
+			return result, nil
+		}
+		afterKey = groupsResults.AfterKey
+	}
+}
+
+// CountUserEvents returns numbers of events of every learner in course courseID of index indexName
+// matching filter. Learners are requested page by page with composite aggregation.
+func (es *ElasticService) CountUserEvents(ctx context.Context, indexName string, courseID string, filter EventFilter) (map[string]int64, error) {
+	if es.client == nil {
+		return nil, errors.New("You need to connect to ElasticSearch first")
+	}
+	query := elastic.NewBoolQuery().Filter(elastic.NewTermQuery("course_id", courseID)).Filter(eventFilterQueries(filter)...)
+	result := map[string]int64{}
+	var afterKey map[string]interface{}
+	for {
+		aggregation := elastic.NewCompositeAggregation().
+			Sources(elastic.NewCompositeAggregationTermsValuesSource("username").Field("username")).
+			Size(scrollPageSize)
+		if afterKey != nil {
+			aggregation = aggregation.AggregateAfter(afterKey)
+		}
+		searchResults, err := es.client.Search().
+			Index(indexName).
+			Query(query).
+			Size(0).
+			Aggregation("users_aggregation", aggregation).
+			Do(ctx)
+		if err != nil {
+			if elastic.IsNotFound(err) {
+				return result, nil
+			}
+			return nil, err
+		}
+		aggregationResults, ok := searchResults.Aggregations.Composite("users_aggregation")
+		if !ok {
+			return nil, errors.New("Nothing was found")
+		}
+		for _, bucket := range aggregationResults.Buckets {
+			username, ok := bucket.Key["username"].(string)
+			if !ok {
+				return nil, errors.New("Field username should be a keyword")
+			}
+			result[username] = bucket.DocCount
+		}
+		if len(aggregationResults.Buckets) < scrollPageSize || aggregationResults.AfterKey == nil {
+			return result, nil
+		}
+		afterKey = aggregationResults.AfterKey
+	}
+}
+
+func termFiltersQuery(filters map[string]interface{}) *elastic.BoolQuery {
+	query := elastic.NewBoolQuery()
+	for fieldName, fieldValue := range filters {
+		query = query.Filter(elastic.NewTermQuery(fieldName, fieldValue))
+	}
+	return query
+}
+
+func termsBucketsToFieldValueCounts(fieldName string, buckets []*elastic.AggregationBucketKeyItem) ([]FieldValueCount, error) {
+	result := make([]FieldValueCount, 0, len(buckets))
+	for _, bucket := range buckets {
+		fieldValue, ok := bucket.Key.(string)
+		if !ok {
 			return nil, fmt.Errorf("Field %v should be a keyword", fieldName)
 		}
+		result = append(result, FieldValueCount{Value: fieldValue, Count: bucket.DocCount})
 	}
 	return result, nil
 }
@@ -0,0 +1,129 @@
+package database
+
+// Erasure of learner events in ElasticSearch. Events are deleted from every
+// physical index of the event index: legacy, all versions and all partitions,
+// including partitions closed by retention, which are reopened for the deletion,
+// and indices retired by migrations, whose write block is lifted meanwhile.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/olivere/elastic"
+)
+
+// EraseUserEvents deletes all the events of users with usernames from index indexName.
+// Events are only counted if dryRun is true.
+func (es *ElasticService) EraseUserEvents(ctx context.Context, indexName string, usernames []string, dryRun bool) (ErasureResult, error) {
+	if es.client == nil {
+		return ErasureResult{}, errors.New("You need to connect to ElasticSearch first")
+	}
+	if len(usernames) == 0 {
+		return ErasureResult{}, nil
+	}
+
+	var result ErasureResult
+	err := es.withAllPhysicalIndices(ctx, indexName, func(physicalIndexNames []string) error {
+		values := make([]interface{}, 0, len(usernames))
+		for _, username := range usernames {
+			values = append(values, username)
+		}
+		query := elastic.NewTermsQuery("username", values...)
+
+		var err error
+		if result.Matched, err = es.client.Count(physicalIndexNames...).Query(query).Do(ctx); err != nil {
+			return err
+		}
+		if !dryRun && result.Matched > 0 {
+			res, err := es.client.
+				DeleteByQuery(physicalIndexNames...).
+				Query(query).
+				ProceedOnVersionConflict().
+				Refresh("true").
+				Do(ctx)
+			if err != nil {
+				return err
+			}
+			result.Deleted = res.Deleted
+
+			// deleted documents stay in segments until they are merged
+			if _, err = es.client.Forcemerge(physicalIndexNames...).OnlyExpungeDeletes(true).Do(ctx); err != nil {
+				log.Printf("WARN: can't expunge deleted documents of %v: %v\n", indexName, err)
+			}
+		}
+		result.Remaining, err = es.client.Count(physicalIndexNames...).Query(query).Do(ctx)
+		return err
+	})
+	return result, err
+}
+
+// withAllPhysicalIndices calls handle with names of all the physical indices of index indexName:
+// legacy index, all versions and all partitions. Closed indices are opened for handle and
+// write blocks of retired indices are lifted, both are restored after it.
+func (es *ElasticService) withAllPhysicalIndices(ctx context.Context, indexName string, handle func(physicalIndexNames []string) error) error {
+	indices, err := es.client.CatIndices().Index(indexName+"*").Columns("index", "status").Do(ctx)
+	if err != nil {
+		return err
+	}
+	physicalIndexNames := make([]string, 0, len(indices))
+	closedIndexNames := make([]string, 0)
+	for _, index := range indices {
+		physicalIndexNames = append(physicalIndexNames, index.Index)
+		if index.Status != "open" {
+			closedIndexNames = append(closedIndexNames, index.Index)
+		}
+	}
+	if len(physicalIndexNames) == 0 {
+		return nil
+	}
+
+	// write blocks are restored and closed indices are closed again even if handle fails
+	writeBlockedIndexNames := make([]string, 0)
+	defer func() {
+		for _, blockedIndexName := range writeBlockedIndexNames {
+			if err := es.setWriteBlock(context.Background(), blockedIndexName, true); err != nil {
+				log.Printf("WARN: can't restore write block of index %v: %v\n", blockedIndexName, err)
+			}
+		}
+		for _, closedIndexName := range closedIndexNames {
+			if _, err := es.client.CloseIndex(closedIndexName).Do(context.Background()); err != nil {
+				log.Printf("WARN: can't close index %v: %v\n", closedIndexName, err)
+			}
+		}
+	}()
+	for _, closedIndexName := range closedIndexNames {
+		if _, err = es.client.OpenIndex(closedIndexName).Do(ctx); err != nil {
+			return err
+		}
+	}
+	if len(closedIndexNames) > 0 {
+		if _, err = es.client.ClusterHealth().Index(closedIndexNames...).WaitForYellowStatus().Do(ctx); err != nil {
+			return err
+		}
+	}
+
+	settings, err := es.client.IndexGetSettings(physicalIndexNames...).Name("index.blocks.write").FlatSettings(true).Do(ctx)
+	if err != nil {
+		return err
+	}
+	for physicalIndexName, indexSettings := range settings {
+		if fmt.Sprint(indexSettings.Settings["index.blocks.write"]) != "true" {
+			continue
+		}
+		if err = es.setWriteBlock(ctx, physicalIndexName, false); err != nil {
+			return err
+		}
+		writeBlockedIndexNames = append(writeBlockedIndexNames, physicalIndexName)
+	}
+	return handle(physicalIndexNames)
+}
+
+// setWriteBlock sets or lifts write block of physical index physicalIndexName
+func (es *ElasticService) setWriteBlock(ctx context.Context, physicalIndexName string, blocked bool) error {
+	_, err := es.client.IndexPutSettings(physicalIndexName).
+		BodyJson(map[string]interface{}{"index": map[string]interface{}{"blocks.write": blocked}}).
+		Do(ctx)
+	return err
+}
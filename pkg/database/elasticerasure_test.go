@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeIndices is a fake ElasticSearch cluster with physical indices of an event index,
+// each holding a number of documents of the erased learner
+type fakeIndices struct {
+	mutex        sync.Mutex
+	documents    map[string]int64
+	closed       map[string]bool
+	writeBlocked map[string]bool
+	failDeletion bool
+}
+
+func (fake *fakeIndices) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	indexNames := strings.Split(parts[0], ",")
+	action := parts[len(parts)-1]
+	switch {
+	case parts[0] == "_cat":
+		rows := make([]map[string]string, 0)
+		for indexName := range fake.documents {
+			status := "open"
+			if fake.closed[indexName] {
+				status = "close"
+			}
+			rows = append(rows, map[string]string{"index": indexName, "status": status})
+		}
+		json.NewEncoder(w).Encode(rows)
+	case parts[0] == "_cluster":
+		fmt.Fprint(w, `{"status":"yellow"}`)
+	case action == "_open" || action == "_close":
+		fake.closed[indexNames[0]] = action == "_close"
+		fmt.Fprint(w, `{"acknowledged":true}`)
+	case len(parts) > 1 && parts[1] == "_settings" && r.Method == http.MethodGet:
+		settings := map[string]interface{}{}
+		for _, indexName := range indexNames {
+			indexSettings := map[string]string{}
+			if fake.writeBlocked[indexName] {
+				indexSettings["index.blocks.write"] = "true"
+			}
+			settings[indexName] = map[string]interface{}{"settings": indexSettings}
+		}
+		json.NewEncoder(w).Encode(settings)
+	case action == "_settings":
+		var body struct {
+			Index map[string]bool `json:"index"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fake.writeBlocked[indexNames[0]] = body.Index["blocks.write"]
+		fmt.Fprint(w, `{"acknowledged":true}`)
+	case action == "_count":
+		var count int64
+		for _, indexName := range indexNames {
+			count += fake.documents[indexName]
+		}
+		fmt.Fprintf(w, `{"count":%v}`, count)
+	case action == "_delete_by_query":
+		for _, indexName := range indexNames {
+			if fake.closed[indexName] || fake.writeBlocked[indexName] || fake.failDeletion {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"error":{"type":"cluster_block_exception","reason":"index [%v] blocked"},"status":403}`, indexName)
+				return
+			}
+		}
+		var deleted int64
+		for _, indexName := range indexNames {
+			deleted += fake.documents[indexName]
+			fake.documents[indexName] = 0
+		}
+		fmt.Fprintf(w, `{"deleted":%v}`, deleted)
+	case action == "_forcemerge":
+		fmt.Fprint(w, `{}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEraseUserEvents(t *testing.T) {
+	tests := []struct {
+		name          string
+		dryRun        bool
+		failDeletion  bool
+		wantResult    ErasureResult
+		wantErr       bool
+		wantDocuments int64
+	}{
+		{"erase", false, false, ErasureResult{Matched: 6, Deleted: 6, Remaining: 0}, false, 0},
+		{"dry run", true, false, ErasureResult{Matched: 6, Deleted: 0, Remaining: 6}, false, 6},
+		{"failed deletion", false, true, ErasureResult{Matched: 6}, true, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the legacy index and its "_v0" clone were retired by migration, a partition was closed by retention
+			fake := &fakeIndices{
+				documents: map[string]int64{
+					VideoEventDescriptionIndexName:                 1,
+					VideoEventDescriptionIndexName + "_v0":         1,
+					VideoEventDescriptionIndexName + "_v3-2020.03": 2,
+					VideoEventDescriptionIndexName + "_v3-2020.04": 2,
+				},
+				closed: map[string]bool{VideoEventDescriptionIndexName + "_v3-2020.03": true},
+				writeBlocked: map[string]bool{
+					VideoEventDescriptionIndexName:         true,
+					VideoEventDescriptionIndexName + "_v0": true,
+				},
+				failDeletion: test.failDeletion,
+			}
+			es := newTestElasticService(t, fake.ServeHTTP)
+
+			result, err := es.EraseUserEvents(context.Background(), VideoEventDescriptionIndexName, []string{"alice"}, test.dryRun)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("EraseUserEvents() error = %v, want error %v", err, test.wantErr)
+			}
+			if result != test.wantResult {
+				t.Errorf("EraseUserEvents() = %+v, want %+v", result, test.wantResult)
+			}
+
+			var documents int64
+			for _, count := range fake.documents {
+				documents += count
+			}
+			if documents != test.wantDocuments {
+				t.Errorf("%v documents are left, want %v", documents, test.wantDocuments)
+			}
+			for _, indexName := range []string{VideoEventDescriptionIndexName, VideoEventDescriptionIndexName + "_v0"} {
+				if !fake.writeBlocked[indexName] {
+					t.Errorf("write block of %v is not restored", indexName)
+				}
+			}
+			if fake.writeBlocked[VideoEventDescriptionIndexName+"_v3-2020.04"] {
+				t.Errorf("partition got write block")
+			}
+			if !fake.closed[VideoEventDescriptionIndexName+"_v3-2020.03"] {
+				t.Errorf("closed partition is left open")
+			}
+		})
+	}
+}
@@ -1,17 +1,91 @@
 package database
 
-// Index creation rules and mappings
+// Index definitions and mappings. Every index is a physical index with version
+// suffix (e.g. "course_structure_v1") behind two aliases: the read alias
+// has the index name used in searches and the write alias gets new documents.
+// Event indices are partitioned by month instead: every partition
+// (e.g. "video_event_description_v2-2026.10") is created from the index template
+// and joins the read alias, documents are written directly into partitions.
+// The template attaches the read alias too, so partitions created by reindex or by
+// ElasticSearch for a new month are searched, unless an older version still waits
+// for migration: then partitions of the reindex join the alias at the switch.
+// Mapping changes must increase the version, `cmd/migrate` moves existing data
+// to the new version.
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 
-// CreateVideoIndexIfNotExists creates index for video events
-func (es *ElasticService) CreateVideoIndexIfNotExists() error {
-	exists, err := es.client.IndexExists(VideoEventDescriptionIndexName).Do(context.Background())
-	if err != nil {
-		return err
+	"github.com/olivere/elastic"
+)
+
+// IndexDefinition describes current version of the index.
+// Transform is an optional painless script applied to documents while they
+// are reindexed from the older versions. Partitioned indices are split by
+// event_time month: "video_event_description_v2-2026.10".
+type IndexDefinition struct {
+	Name        string
+	Version     int
+	Body        string
+	Transform   string
+	Partitioned bool
+}
+
+// PhysicalIndexName returns name of the index that stores documents of this version
+func (definition IndexDefinition) PhysicalIndexName() string {
+	return fmt.Sprintf("%v_v%v", definition.Name, definition.Version)
+}
+
+// PartitionName returns name of the partition for events that happened at eventTime
+func (definition IndexDefinition) PartitionName(eventTime time.Time) string {
+	return definition.PhysicalIndexName() + "-" + eventTime.UTC().Format(partitionMonthFormat)
+}
+
+// WriteAlias returns name of the alias new documents are written to
+func (definition IndexDefinition) WriteAlias() string {
+	return WriteAlias(definition.Name)
+}
+
+// WriteAlias returns name of the write alias of index indexName
+func WriteAlias(indexName string) string {
+	return indexName + "_write"
+}
+
+// logicalIndexName returns the index name used in searches for physical index
+// physicalIndexName: "video_event_description" for "video_event_description_v2-2026.10"
+func logicalIndexName(physicalIndexName string) string {
+	name := physicalIndexName
+	if i := strings.LastIndex(name, "-"); i != -1 {
+		if _, err := time.Parse(partitionMonthFormat, name[i+1:]); err == nil {
+			name = name[:i]
+		}
 	}
-	if !exists {
-		mapping := `
+	if i := strings.LastIndex(name, "_v"); i != -1 {
+		if _, err := strconv.Atoi(name[i+2:]); err == nil {
+			name = name[:i]
+		}
+	}
+	return name
+}
+
+const partitionMonthFormat = "2006.01"
+
+// unversionedRecheckInterval is how long an index is trusted to stay unversioned
+// before its version is checked again
+const unversionedRecheckInterval = 30 * time.Second
+
+var videoIndexDefinition = IndexDefinition{
+	Name:        VideoEventDescriptionIndexName,
+	Version:     3,
+	Partitioned: true,
+	Body: `
 {
 	"settings":{
 		"number_of_shards":1,
@@ -24,27 +98,19 @@ func (es *ElasticService) CreateVideoIndexIfNotExists() error {
 			"username": { "type": "keyword" },
 			"video_id": { "type": "keyword" },
 			"video_time": { "type": "double" },
-			"course_id": { "type": "keyword" }
+			"course_id": { "type": "keyword" },
+			"platform": { "type": "keyword" }
 		}
 	}
 }
-`
-		_, err := es.client.CreateIndex(VideoEventDescriptionIndexName).Body(mapping).Do(context.Background())
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+`,
 }
 
-// CreateBookmarksIndexIfNotExists creates index for booksmark events
-func (es *ElasticService) CreateBookmarksIndexIfNotExists() error {
-	exists, err := es.client.IndexExists(BookmarsEventDescriptionIndexName).Do(context.Background())
-	if err != nil {
-		return err
-	}
-	if !exists {
-		mapping := `
+var bookmarksIndexDefinition = IndexDefinition{
+	Name:        BookmarsEventDescriptionIndexName,
+	Version:     4,
+	Partitioned: true,
+	Body: `
 {
 	"settings":{
 		"number_of_shards":1,
@@ -56,28 +122,29 @@ func (es *ElasticService) CreateBookmarksIndexIfNotExists() error {
 			"event_type": { "type": "keyword" },
 			"username": { "type": "keyword" },
 			"id": { "type": "keyword" },
-			"is_added": { "type": "binary" },
-			"course_id": { "type": "keyword" }
+			"is_added": { "type": "boolean" },
+			"course_id": { "type": "keyword" },
+			"block_id": { "type": "keyword" },
+			"block_name": { "type": "keyword" },
+			"platform": { "type": "keyword" }
 		}
 	}
 }
-`
-		_, err := es.client.CreateIndex(BookmarsEventDescriptionIndexName).Body(mapping).Do(context.Background())
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+`,
+	// is_added was mapped as binary in version 1, block_id is extracted from usage key
+	Transform: `
+if (ctx._source.id != null) {
+	def usageKeyParts = ctx._source.id.splitOnToken('@');
+	ctx._source.block_id = usageKeyParts[usageKeyParts.length - 1];
+}
+`,
 }
 
-// CreateLinksIndexIfNotExists creates index for link events
-func (es *ElasticService) CreateLinksIndexIfNotExists() error {
-	exists, err := es.client.IndexExists(LinkEventDescriptionIndexName).Do(context.Background())
-	if err != nil {
-		return err
-	}
-	if !exists {
-		mapping := `
+var linksIndexDefinition = IndexDefinition{
+	Name:        LinkEventDescriptionIndexName,
+	Version:     4,
+	Partitioned: true,
+	Body: `
 {
 	"settings":{
 		"number_of_shards":1,
@@ -90,27 +157,28 @@ func (es *ElasticService) CreateLinksIndexIfNotExists() error {
 			"username": { "type": "keyword" },
 			"current_url": { "type": "keyword" },
 			"target_url": { "type": "keyword" },
-			"course_id": { "type": "keyword" }
+			"course_id": { "type": "keyword" },
+			"link_type": { "type": "keyword" },
+			"target_section": { "type": "keyword" },
+			"target_domain": { "type": "keyword" },
+			"target_path": { "type": "keyword" },
+			"target_resource": { "type": "keyword" },
+			"target_block_id": { "type": "keyword" },
+			"target_block_name": { "type": "keyword" },
+			"current_block_id": { "type": "keyword" },
+			"current_block_name": { "type": "keyword" },
+			"platform": { "type": "keyword" }
 		}
 	}
 }
-`
-		_, err := es.client.CreateIndex(LinkEventDescriptionIndexName).Body(mapping).Do(context.Background())
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+`,
 }
 
-// CreateProblemIndexIfNotExists creates index for problem events
-func (es *ElasticService) CreateProblemIndexIfNotExists() error {
-	exists, err := es.client.IndexExists(ProblemEventDescriptionIndexName).Do(context.Background())
-	if err != nil {
-		return err
-	}
-	if !exists {
-		mapping := `
+var problemIndexDefinition = IndexDefinition{
+	Name:        ProblemEventDescriptionIndexName,
+	Version:     3,
+	Partitioned: true,
+	Body: `
 {
 	"settings":{
 		"number_of_shards":1,
@@ -124,27 +192,19 @@ func (es *ElasticService) CreateProblemIndexIfNotExists() error {
 			"problem_id": { "type": "keyword" },
 			"weighted_earned": { "type": "double" },
 			"weighted_possible": { "type": "double" },
-			"course_id": { "type": "keyword" }
+			"course_id": { "type": "keyword" },
+			"platform": { "type": "keyword" }
 		}
 	}
 }
-`
-		_, err := es.client.CreateIndex(ProblemEventDescriptionIndexName).Body(mapping).Do(context.Background())
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+`,
 }
 
-// CreateSequentialIndexIfNotExists creates index for sequential events
-func (es *ElasticService) CreateSequentialIndexIfNotExists() error {
-	exists, err := es.client.IndexExists(SequentialEventDescriptionIndexName).Do(context.Background())
-	if err != nil {
-		return err
-	}
-	if !exists {
-		mapping := `
+var sequentialIndexDefinition = IndexDefinition{
+	Name:        SequentialEventDescriptionIndexName,
+	Version:     4,
+	Partitioned: true,
+	Body: `
 {
 	"settings":{
 		"number_of_shards":1,
@@ -157,27 +217,49 @@ func (es *ElasticService) CreateSequentialIndexIfNotExists() error {
 			"username": { "type": "keyword" },
 			"old": { "type": "integer" },
 			"new": { "type": "integer" },
-			"course_id": { "type": "keyword" }
+			"course_id": { "type": "keyword" },
+			"sequential_id": { "type": "keyword" },
+			"old_vertical_id": { "type": "keyword" },
+			"old_vertical_name": { "type": "keyword" },
+			"new_vertical_id": { "type": "keyword" },
+			"new_vertical_name": { "type": "keyword" },
+			"platform": { "type": "keyword" }
 		}
 	}
 }
-`
-		_, err := es.client.CreateIndex(SequentialEventDescriptionIndexName).Body(mapping).Do(context.Background())
-		if err != nil {
-			return err
+`,
+}
+
+var enrollmentIndexDefinition = IndexDefinition{
+	Name:        EnrollmentEventDescriptionIndexName,
+	Version:     2,
+	Partitioned: true,
+	Body: `
+{
+	"settings":{
+		"number_of_shards":1,
+		"number_of_replicas":0
+	},
+	"mappings":{
+		"properties":{
+			"event_time": { "type": "date" },
+			"event_type": { "type": "keyword" },
+			"username": { "type": "keyword" },
+			"user_id": { "type": "long" },
+			"mode": { "type": "keyword" },
+			"is_active": { "type": "boolean" },
+			"course_id": { "type": "keyword" },
+			"platform": { "type": "keyword" }
 		}
 	}
-	return nil
+}
+`,
 }
 
-// CreateStructureIndexIfNotExists craetes index for course structures
-func (es *ElasticService) CreateStructureIndexIfNotExists() error {
-	exists, err := es.client.IndexExists(CourseStructureIndexName).Do(context.Background())
-	if err != nil {
-		return err
-	}
-	if !exists {
-		mapping := `
+var structureIndexDefinition = IndexDefinition{
+	Name:    CourseStructureIndexName,
+	Version: 1,
+	Body: `
 {
 	"settings":{
 		"number_of_shards":1,
@@ -254,11 +336,236 @@ func (es *ElasticService) CreateStructureIndexIfNotExists() error {
 		}
 	}
 }
-`
-		_, err := es.client.CreateIndex(CourseStructureIndexName).Body(mapping).Do(context.Background())
+`,
+}
+
+// rollupIndexDefinition keeps the watermark of daily rollups in mapping "_meta"
+var rollupIndexDefinition = IndexDefinition{
+	Name:    DailyRollupIndexName,
+	Version: 1,
+	Body: `
+{
+	"settings":{
+		"number_of_shards":1,
+		"number_of_replicas":0
+	},
+	"mappings":{
+		"properties":{
+			"date": { "type": "date" },
+			"course_id": { "type": "keyword" },
+			"block_id": { "type": "keyword" },
+			"active_learners": { "type": "long" },
+			"video_plays": { "type": "long" },
+			"watch_seconds": { "type": "double" },
+			"submissions": { "type": "long" },
+			"score_sum": { "type": "double" },
+			"mean_score": { "type": "double" },
+			"bookmarks_added": { "type": "long" },
+			"bookmarks_removed": { "type": "long" },
+			"link_clicks": { "type": "long" }
+		}
+	}
+}
+`,
+}
+
+// IndexDefinitions are definitions of all the indices of this project
+var IndexDefinitions = []IndexDefinition{
+	structureIndexDefinition,
+	videoIndexDefinition,
+	bookmarksIndexDefinition,
+	linksIndexDefinition,
+	problemIndexDefinition,
+	sequentialIndexDefinition,
+	enrollmentIndexDefinition,
+	rollupIndexDefinition,
+}
+
+// CreateVideoIndexIfNotExists creates index for video events
+func (es *ElasticService) CreateVideoIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, videoIndexDefinition)
+}
+
+// CreateBookmarksIndexIfNotExists creates index for booksmark events
+func (es *ElasticService) CreateBookmarksIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, bookmarksIndexDefinition)
+}
+
+// CreateLinksIndexIfNotExists creates index for link events
+func (es *ElasticService) CreateLinksIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, linksIndexDefinition)
+}
+
+// CreateProblemIndexIfNotExists creates index for problem events
+func (es *ElasticService) CreateProblemIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, problemIndexDefinition)
+}
+
+// CreateSequentialIndexIfNotExists creates index for sequential events
+func (es *ElasticService) CreateSequentialIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, sequentialIndexDefinition)
+}
+
+// CreateEnrollmentIndexIfNotExists creates index for enrollment events
+func (es *ElasticService) CreateEnrollmentIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, enrollmentIndexDefinition)
+}
+
+// CreateStructureIndexIfNotExists craetes index for course structures
+func (es *ElasticService) CreateStructureIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, structureIndexDefinition)
+}
+
+// CreateRollupIndexIfNotExists creates index for daily rollups
+func (es *ElasticService) CreateRollupIndexIfNotExists(ctx context.Context) error {
+	return es.createIndexIfNotExists(ctx, rollupIndexDefinition)
+}
+
+// createIndexIfNotExists creates current version of the index with its aliases.
+// For partitioned indices the template and the partition of the current month are created.
+// If older version exists, it is left as is until migration.
+func (es *ElasticService) createIndexIfNotExists(ctx context.Context, definition IndexDefinition) error {
+	version, err := es.GetIndexVersion(ctx, definition.Name)
+	if err != nil {
+		return err
+	}
+	if definition.Partitioned {
+		// partitions join the read alias only when no older version is waiting for migration
+		withReadAlias := version == -1 || version >= definition.Version
+		if err = es.putIndexTemplate(ctx, definition, withReadAlias); err != nil {
+			return err
+		}
+	}
+	if version == -1 {
+		if definition.Partitioned {
+			return es.ensurePartition(ctx, definition.Name, definition.PartitionName(time.Now()))
+		}
+		return es.createIndexVersion(ctx, definition, true)
+	}
+	if version == 0 {
+		// Index created before versioning gets write alias, so insertions work until migration
+		_, err = es.client.Alias().
+			Action(elastic.NewAliasAddAction(definition.WriteAlias()).Index(definition.Name).IsWriteIndex(true)).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		es.state.setUnversioned(definition.Name, time.Now())
+	}
+	if version < definition.Version {
+		log.Printf("WARN: index %v has version %v, but %v is required. Run migrate command.\n", definition.Name, version, definition.Version)
+	}
+	return nil
+}
+
+// GetIndexMapping returns mapping of index indexName as it is in ElasticSearch. If the read alias
+// has several physical indices, the mapping of the newest version is returned.
+func (es *ElasticService) GetIndexMapping(ctx context.Context, indexName string) (json.RawMessage, error) {
+	if es.client == nil {
+		return nil, errors.New("You need to connect to ElasticSearch first")
+	}
+	mappings, err := es.client.GetMapping().Index(indexName).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newestIndexName, newestVersion := "", -1
+	for physicalIndexName := range mappings {
+		version, err := parseIndexVersion(indexName, physicalIndexName)
 		if err != nil {
+			continue
+		}
+		if version > newestVersion || (version == newestVersion && physicalIndexName > newestIndexName) {
+			newestIndexName, newestVersion = physicalIndexName, version
+		}
+	}
+	indexMapping, ok := mappings[newestIndexName].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("No mapping found for index " + indexName)
+	}
+	return json.Marshal(indexMapping["mappings"])
+}
+
+// putIndexTemplate creates or updates template of the partitions of the current index version.
+// With withReadAlias every new partition joins the read alias, including partitions created
+// by reindex.
+func (es *ElasticService) putIndexTemplate(ctx context.Context, definition IndexDefinition, withReadAlias bool) error {
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(definition.Body), &template); err != nil {
+		return err
+	}
+	template["index_patterns"] = []string{definition.PhysicalIndexName() + "-*"}
+	if withReadAlias {
+		template["aliases"] = map[string]interface{}{definition.Name: map[string]interface{}{}}
+	}
+	_, err := es.client.IndexPutTemplate(definition.PhysicalIndexName()).BodyJson(template).Do(ctx)
+	return err
+}
+
+// ensurePartition creates partition in read alias indexName if it doesn't exist yet.
+// Mappings of the partition are taken from the index template.
+func (es *ElasticService) ensurePartition(ctx context.Context, indexName string, partitionName string) error {
+	if es.state.isKnownPartition(partitionName) {
+		return nil
+	}
+	exists, err := es.client.IndexExists(partitionName).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = es.client.CreateIndex(partitionName).
+			BodyJson(map[string]interface{}{"aliases": map[string]interface{}{indexName: map[string]interface{}{}}}).
+			Do(ctx)
+		if err != nil && !isAlreadyExistsError(err) {
 			return err
 		}
 	}
+	es.state.setKnownPartition(partitionName)
 	return nil
 }
+
+// isAlreadyExistsError tells if err is returned for index created concurrently by another writer
+func isAlreadyExistsError(err error) bool {
+	elasticErr, ok := err.(*elastic.Error)
+	return ok && elasticErr.Details != nil && elasticErr.Details.Type == "resource_already_exists_exception"
+}
+
+// isUnversioned tells if the index of definition was created before versioning.
+// It is checked again every unversionedRecheckInterval, so writers follow a migration
+// done by another process.
+func (es *ElasticService) isUnversioned(ctx context.Context, definition IndexDefinition) bool {
+	checkedAt, ok := es.state.unversionedCheckedAt(definition.Name)
+	if !ok {
+		return false
+	}
+	if time.Since(checkedAt) < unversionedRecheckInterval {
+		return true
+	}
+	version, err := es.GetIndexVersion(ctx, definition.Name)
+	if err != nil {
+		log.Printf("WARN: can't check version of index %v: %v\n", definition.Name, err)
+		return true
+	}
+	if version != 0 {
+		es.state.clearUnversioned(definition.Name)
+		return false
+	}
+	es.state.setUnversioned(definition.Name, time.Now())
+	return true
+}
+
+// eventIndexName returns name of the index a new event with eventTime should be written to
+func (es *ElasticService) eventIndexName(ctx context.Context, definition IndexDefinition, eventTime string) (string, error) {
+	if !definition.Partitioned || es.isUnversioned(ctx, definition) {
+		return definition.WriteAlias(), nil
+	}
+	parsedEventTime, err := models.ParseEventTime(eventTime)
+	if err != nil {
+		log.Printf("WARN: event has incorrect time %v, it is saved into the current partition\n", eventTime)
+		parsedEventTime = time.Now()
+	}
+	partitionName := definition.PartitionName(parsedEventTime)
+	if err = es.ensurePartition(ctx, definition.Name, partitionName); err != nil {
+		return "", err
+	}
+	return partitionName, nil
+}
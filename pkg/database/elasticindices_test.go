@@ -0,0 +1,25 @@
+package database
+
+import "testing"
+
+func TestLogicalIndexName(t *testing.T) {
+	tests := []struct {
+		physicalIndexName string
+		want              string
+	}{
+		{"video_event_description", "video_event_description"},
+		{"video_event_description_v0", "video_event_description"},
+		{"video_event_description_v12", "video_event_description"},
+		{"video_event_description_v3-2026.10", "video_event_description"},
+		{"course_structure_v1", "course_structure"},
+		{"video_event_description_vX", "video_event_description_vX"},
+		{"video_event_description_v3-backup", "video_event_description_v3-backup"},
+	}
+	for _, test := range tests {
+		t.Run(test.physicalIndexName, func(t *testing.T) {
+			if got := logicalIndexName(test.physicalIndexName); got != test.want {
+				t.Errorf("logicalIndexName() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
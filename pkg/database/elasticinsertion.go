@@ -4,17 +4,21 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"kafka-log-processor/pkg/models"
 
+	"github.com/olivere/elastic"
 	edxstruct "github.com/veotani/edx-structure-json"
 )
 
 // AddCourseStructure adds information of course structure
-func (es ElasticService) AddCourseStructure(course edxstruct.Course) error {
+func (es ElasticService) AddCourseStructure(ctx context.Context, course edxstruct.Course) error {
 	_, err := es.client.Index().
-		Index(CourseStructureIndexName).
+		Index(structureIndexDefinition.WriteAlias()).
 		BodyJson(course).
-		Do(context.Background())
+		Do(ctx)
 	if err != nil {
 		return err
 	}
@@ -22,61 +26,91 @@ func (es ElasticService) AddCourseStructure(course edxstruct.Course) error {
 }
 
 // AddVideoEventDescription adds information of a parsed log into elasticsearch
-func (es ElasticService) AddVideoEventDescription(videoEventDescription models.VideoEventDescription) error {
-	_, err := es.client.Index().
-		Index(VideoEventDescriptionIndexName).
-		BodyJson(videoEventDescription).
-		Do(context.Background())
-	if err != nil {
-		return err
-	}
-	return nil
+func (es ElasticService) AddVideoEventDescription(ctx context.Context, videoEventDescription models.VideoEventDescription) error {
+	return es.addEventDescription(ctx, videoIndexDefinition, videoEventDescription.EventTime, videoEventDescription)
 }
 
 // AddBooksmarkEventDescription adds information of a parsed log into elasticsearch
-func (es ElasticService) AddBooksmarkEventDescription(booksmarkEventDescription models.BookmarksEventDescription) error {
-	_, err := es.client.Index().
-		Index(BookmarsEventDescriptionIndexName).
-		BodyJson(booksmarkEventDescription).
-		Do(context.Background())
-	if err != nil {
-		return err
-	}
-	return nil
+func (es ElasticService) AddBooksmarkEventDescription(ctx context.Context, booksmarkEventDescription models.BookmarksEventDescription) error {
+	return es.addEventDescription(ctx, bookmarksIndexDefinition, booksmarkEventDescription.EventTime, booksmarkEventDescription)
 }
 
 // AddLinkEventDescription adds information of a parsed log into elasticsearch
-func (es ElasticService) AddLinkEventDescription(linkEventDescription models.LinkEventDescription) error {
-	_, err := es.client.Index().
-		Index(LinkEventDescriptionIndexName).
-		BodyJson(linkEventDescription).
-		Do(context.Background())
-	if err != nil {
-		return err
-	}
-	return nil
+func (es ElasticService) AddLinkEventDescription(ctx context.Context, linkEventDescription models.LinkEventDescription) error {
+	return es.addEventDescription(ctx, linksIndexDefinition, linkEventDescription.EventTime, linkEventDescription)
 }
 
 // AddProblemEventDescription adds information of a parsed log into elasticsearch
-func (es ElasticService) AddProblemEventDescription(problemEventDescription models.ProblemEventDescription) error {
-	_, err := es.client.Index().
-		Index(ProblemEventDescriptionIndexName).
-		BodyJson(problemEventDescription).
-		Do(context.Background())
+func (es ElasticService) AddProblemEventDescription(ctx context.Context, problemEventDescription models.ProblemEventDescription) error {
+	return es.addEventDescription(ctx, problemIndexDefinition, problemEventDescription.EventTime, problemEventDescription)
+}
+
+// AddSequentialMoveEventDescription adds information of a parsed log into elasticsearch
+func (es ElasticService) AddSequentialMoveEventDescription(ctx context.Context, sequentialMoveEventDescription models.SequentialMoveEventDescription) error {
+	return es.addEventDescription(ctx, sequentialIndexDefinition, sequentialMoveEventDescription.EventTime, sequentialMoveEventDescription)
+}
+
+// AddEnrollmentEventDescription adds information of a parsed log into elasticsearch
+func (es ElasticService) AddEnrollmentEventDescription(ctx context.Context, enrollmentEventDescription models.EnrollmentEventDescription) error {
+	return es.addEventDescription(ctx, enrollmentIndexDefinition, enrollmentEventDescription.EventTime, enrollmentEventDescription)
+}
+
+// addEventDescription adds event into the partition of its event time
+func (es ElasticService) addEventDescription(ctx context.Context, definition IndexDefinition, eventTime string, eventDescription interface{}) error {
+	indexName, err := es.eventIndexName(ctx, definition, eventTime)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = es.client.Index().
+		Index(indexName).
+		BodyJson(eventDescription).
+		Do(ctx)
+	return err
 }
 
-// AddSequentialMoveEventDescription adds information of a parsed log into elasticsearch
-func (es ElasticService) AddSequentialMoveEventDescription(sequentialMoveEventDescription models.SequentialMoveEventDescription) error {
-	_, err := es.client.Index().
-		Index(SequentialEventDescriptionIndexName).
-		BodyJson(sequentialMoveEventDescription).
-		Do(context.Background())
+// AddEventDescriptions adds events of index indexName with a single bulk request
+func (es ElasticService) AddEventDescriptions(ctx context.Context, indexName string, eventDescriptions []interface{}) error {
+	definition, ok := indexDefinitionByName(indexName)
+	if !ok || !definition.Partitioned {
+		return errors.New("Unknown event index " + indexName)
+	}
+	if len(eventDescriptions) == 0 {
+		return nil
+	}
+
+	bulk := es.client.Bulk()
+	for _, eventDescription := range eventDescriptions {
+		source, err := json.Marshal(eventDescription)
+		if err != nil {
+			return err
+		}
+		var fields struct {
+			EventTime string `json:"event_time"`
+		}
+		if err = json.Unmarshal(source, &fields); err != nil {
+			return err
+		}
+		partitionName, err := es.eventIndexName(ctx, definition, fields.EventTime)
+		if err != nil {
+			return err
+		}
+		bulk.Add(elastic.NewBulkIndexRequest().Index(partitionName).Doc(json.RawMessage(source)))
+	}
+	res, err := bulk.Do(ctx)
 	if err != nil {
 		return err
 	}
+	if failed := res.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%v of %v events weren't saved: %v", len(failed), len(eventDescriptions), failed[0].Error.Reason)
+	}
 	return nil
 }
+
+func indexDefinitionByName(indexName string) (IndexDefinition, bool) {
+	for _, definition := range IndexDefinitions {
+		if definition.Name == indexName {
+			return definition, true
+		}
+	}
+	return IndexDefinition{}, false
+}
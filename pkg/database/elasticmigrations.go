@@ -0,0 +1,355 @@
+package database
+
+// Index migrations. Outdated indices are copied into the indices of the current
+// version with reindex API, then aliases are switched to the new indices in a
+// single atomic request, so searches and insertions keep working meanwhile.
+// Documents of partitioned indices are routed to the partitions of their UTC month
+// by the reindex script. Months that already got new events into the current
+// version partition may show reindexed events twice until aliases are switched.
+// The partition template attaches the read alias only after the switch, so partitions
+// created by the reindex are hidden until then.
+// An index created before versioning has the name of the read alias, so it can't
+// stay next to the alias: writes are moved away from it and blocked before the last
+// catch-up, and it is kept as a copy named "<name>_v0" with KeepOldIndex.
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+// MigrationOptions change migration behaviour.
+// DryRun only detects outdated indices, KeepOldIndex doesn't delete the old version.
+type MigrationOptions struct {
+	DryRun       bool
+	KeepOldIndex bool
+}
+
+// MigrationResult describes what migration has done with the index.
+// FromVersion is -1 if index didn't exist and 0 if it wasn't versioned.
+type MigrationResult struct {
+	Name               string
+	FromVersion        int
+	ToVersion          int
+	ReindexedDocuments int64
+}
+
+// GetIndexVersion returns the oldest version of indices behind read alias indexName.
+// It returns -1 if there is no such index and 0 if indexName is an index created
+// before versioning.
+func (es *ElasticService) GetIndexVersion(ctx context.Context, indexName string) (int, error) {
+	if es.client == nil {
+		return 0, errors.New("You need to connect to ElasticSearch first")
+	}
+	exists, err := es.client.IndexExists(indexName).Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return -1, nil
+	}
+	physicalIndexNames, err := es.getPhysicalIndexNames(ctx, indexName)
+	if err != nil {
+		return 0, err
+	}
+	oldestVersion := -1
+	for _, physicalIndexName := range physicalIndexNames {
+		version, err := parseIndexVersion(indexName, physicalIndexName)
+		if err != nil {
+			return 0, err
+		}
+		if oldestVersion == -1 || version < oldestVersion {
+			oldestVersion = version
+		}
+	}
+	return oldestVersion, nil
+}
+
+// parseIndexVersion gets version from "name_v2" or "name_v2-2026.10" physical index name.
+// Index with the name of read alias has version 0.
+func parseIndexVersion(indexName string, physicalIndexName string) (int, error) {
+	if physicalIndexName == indexName {
+		return 0, nil
+	}
+	versionSuffix := strings.SplitN(strings.TrimPrefix(physicalIndexName, indexName+"_v"), "-", 2)[0]
+	version, err := strconv.Atoi(versionSuffix)
+	if err != nil {
+		return 0, errors.New("Index " + physicalIndexName + " has no version suffix")
+	}
+	return version, nil
+}
+
+// getPhysicalIndexNames returns the names of the indices behind read alias indexName
+// (or indexName itself if it is not an alias)
+func (es *ElasticService) getPhysicalIndexNames(ctx context.Context, indexName string) ([]string, error) {
+	aliases, err := es.client.Aliases().Index(indexName).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	physicalIndexNames := make([]string, 0, len(aliases.Indices))
+	for name := range aliases.Indices {
+		physicalIndexNames = append(physicalIndexNames, name)
+	}
+	if len(physicalIndexNames) == 0 {
+		return nil, errors.New("No index found behind alias " + indexName)
+	}
+	return physicalIndexNames, nil
+}
+
+// getPartitionNames returns names of the existing partitions of the definition version
+func (es *ElasticService) getPartitionNames(ctx context.Context, definition IndexDefinition) ([]string, error) {
+	return es.getIndexNamesByPattern(ctx, definition.PhysicalIndexName()+"-*")
+}
+
+func (es *ElasticService) getIndexNamesByPattern(ctx context.Context, pattern string) ([]string, error) {
+	indices, err := es.client.IndexGet(pattern).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexNames := make([]string, 0, len(indices))
+	for indexName := range indices {
+		indexNames = append(indexNames, indexName)
+	}
+	return indexNames, nil
+}
+
+// createIndexVersion creates physical index of the definition version,
+// aliases are pointed to it if withAliases is true
+func (es *ElasticService) createIndexVersion(ctx context.Context, definition IndexDefinition, withAliases bool) error {
+	_, err := es.client.CreateIndex(definition.PhysicalIndexName()).Body(definition.Body).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !withAliases {
+		return nil
+	}
+	_, err = es.client.Alias().
+		Action(
+			elastic.NewAliasAddAction(definition.Name).Index(definition.PhysicalIndexName()),
+			elastic.NewAliasAddAction(definition.WriteAlias()).Index(definition.PhysicalIndexName()).IsWriteIndex(true),
+		).
+		Do(ctx)
+	return err
+}
+
+// MigrateIndex moves index to the current version of the definition
+func (es *ElasticService) MigrateIndex(ctx context.Context, definition IndexDefinition, options MigrationOptions) (MigrationResult, error) {
+	result := MigrationResult{Name: definition.Name, ToVersion: definition.Version}
+	version, err := es.GetIndexVersion(ctx, definition.Name)
+	if err != nil {
+		return result, err
+	}
+	result.FromVersion = version
+	if options.DryRun || version >= definition.Version {
+		return result, nil
+	}
+	if definition.Partitioned {
+		if err = es.putIndexTemplate(ctx, definition, version == -1); err != nil {
+			return result, err
+		}
+	}
+	if version == -1 {
+		if definition.Partitioned {
+			return result, es.ensurePartition(ctx, definition.Name, definition.PartitionName(time.Now()))
+		}
+		return result, es.createIndexVersion(ctx, definition, true)
+	}
+
+	physicalIndexNames, err := es.getPhysicalIndexNames(ctx, definition.Name)
+	if err != nil {
+		return result, err
+	}
+	oldIndexNames := make([]string, 0)
+	for _, physicalIndexName := range physicalIndexNames {
+		if physicalVersion, _ := parseIndexVersion(definition.Name, physicalIndexName); physicalVersion < definition.Version {
+			oldIndexNames = append(oldIndexNames, physicalIndexName)
+		}
+	}
+
+	destinationIndexName, script := definition.PhysicalIndexName(), definition.Transform
+	if definition.Partitioned {
+		// events with incorrect time and writes moved from an index before versioning go
+		// to the current partition, so it must exist even if no old event is routed there
+		destinationIndexName = definition.PartitionName(time.Now())
+		if _, err = es.client.CreateIndex(destinationIndexName).Do(ctx); err != nil && !isAlreadyExistsError(err) {
+			return result, err
+		}
+		script += `
+if (ctx._source.event_time != null) {
+	try {
+		ZonedDateTime eventTime = ZonedDateTime.parse(ctx._source.event_time).withZoneSameInstant(ZoneOffset.UTC);
+		ctx._index = '` + definition.PhysicalIndexName() + `-' + DateTimeFormatter.ofPattern('yyyy.MM').format(eventTime);
+	} catch (Exception e) {
+		// events with incorrect time stay in the current partition, as new ones do
+	}
+}
+`
+	} else if err = es.createIndexVersion(ctx, definition, false); err != nil {
+		return result, err
+	}
+
+	for _, oldIndexName := range oldIndexNames {
+		reindexed, err := es.reindex(ctx, oldIndexName, destinationIndexName, script, false)
+		if err != nil {
+			return result, err
+		}
+		result.ReindexedDocuments += reindexed
+	}
+
+	// Index without version has the name of read alias, so it is removed in the same
+	// request that switches aliases. Its writes are stopped and caught up before.
+	unversionedCopyName := ""
+	if version == 0 {
+		caughtUp, copyName, err := es.retireUnversionedIndex(ctx, definition, destinationIndexName, script, options)
+		if err != nil {
+			return result, err
+		}
+		result.ReindexedDocuments += caughtUp
+		unversionedCopyName = copyName
+	}
+
+	aliasActions, err := es.getAliasSwitchActions(ctx, definition, oldIndexNames)
+	if err != nil {
+		return result, err
+	}
+	if _, err = es.client.Alias().Action(aliasActions...).Do(ctx); err != nil {
+		return result, err
+	}
+	// from now on partitions created by the catch-up or new months join the read alias
+	if definition.Partitioned {
+		if err = es.putIndexTemplate(ctx, definition, true); err != nil {
+			return result, err
+		}
+	}
+
+	// Documents written into the old indices during the first reindex are copied now
+	for _, oldIndexName := range oldIndexNames {
+		if oldIndexName == definition.Name {
+			if unversionedCopyName == "" {
+				continue
+			}
+			oldIndexName = unversionedCopyName
+		}
+		caughtUp, err := es.reindex(ctx, oldIndexName, destinationIndexName, script, true)
+		if err != nil {
+			return result, err
+		}
+		result.ReindexedDocuments += caughtUp
+		if !options.KeepOldIndex && oldIndexName != unversionedCopyName {
+			if _, err = es.client.DeleteIndex(oldIndexName).Do(ctx); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// retireUnversionedIndex prepares index created before versioning for removal by the alias switch:
+// its write alias is moved to the current version, writes into it are blocked and documents
+// written meanwhile are copied to destinationIndexName. With KeepOldIndex the index is cloned
+// into "<name>_v0", its name is returned.
+func (es *ElasticService) retireUnversionedIndex(ctx context.Context, definition IndexDefinition, destinationIndexName string, script string, options MigrationOptions) (int64, string, error) {
+	writeIndexName := definition.PhysicalIndexName()
+	if definition.Partitioned {
+		writeIndexName = destinationIndexName
+	}
+	actions := []elastic.AliasAction{
+		elastic.NewAliasAddAction(definition.WriteAlias()).Index(writeIndexName).IsWriteIndex(true),
+	}
+	aliases, err := es.client.Aliases().Index(definition.Name).Do(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	for _, alias := range aliases.Indices[definition.Name].Aliases {
+		if alias.AliasName == definition.WriteAlias() {
+			actions = append([]elastic.AliasAction{elastic.NewAliasRemoveAction(alias.AliasName).Index(definition.Name)}, actions...)
+		}
+	}
+	if _, err = es.client.Alias().Action(actions...).Do(ctx); err != nil {
+		return 0, "", err
+	}
+
+	if err = es.setWriteBlock(ctx, definition.Name, true); err != nil {
+		return 0, "", err
+	}
+	caughtUp, err := es.reindex(ctx, definition.Name, destinationIndexName, script, true)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if !options.KeepOldIndex {
+		return caughtUp, "", nil
+	}
+	copyName := definition.Name + "_v0"
+	_, err = es.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "POST",
+		Path:   "/" + definition.Name + "/_clone/" + copyName,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return caughtUp, copyName, nil
+}
+
+// getAliasSwitchActions returns alias actions that move read and write aliases from
+// old indices to the indices of the current version
+func (es *ElasticService) getAliasSwitchActions(ctx context.Context, definition IndexDefinition, oldIndexNames []string) ([]elastic.AliasAction, error) {
+	actions := make([]elastic.AliasAction, 0)
+	for _, oldIndexName := range oldIndexNames {
+		if oldIndexName == definition.Name {
+			actions = append(actions, elastic.NewAliasRemoveIndexAction(oldIndexName))
+			continue
+		}
+		aliases, err := es.client.Aliases().Index(oldIndexName).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, alias := range aliases.Indices[oldIndexName].Aliases {
+			if alias.AliasName == definition.Name || alias.AliasName == definition.WriteAlias() {
+				actions = append(actions, elastic.NewAliasRemoveAction(alias.AliasName).Index(oldIndexName))
+			}
+		}
+	}
+
+	if !definition.Partitioned {
+		return append(actions,
+			elastic.NewAliasAddAction(definition.Name).Index(definition.PhysicalIndexName()),
+			elastic.NewAliasAddAction(definition.WriteAlias()).Index(definition.PhysicalIndexName()).IsWriteIndex(true),
+		), nil
+	}
+	partitionNames, err := es.getPartitionNames(ctx, definition)
+	if err != nil {
+		return nil, err
+	}
+	for _, partitionName := range partitionNames {
+		actions = append(actions, elastic.NewAliasAddAction(definition.Name).Index(partitionName))
+	}
+	return actions, nil
+}
+
+// reindex copies documents of index sourceIndexName into index destinationIndexName applying
+// script. With onlyMissing set, documents that are already copied are skipped.
+func (es *ElasticService) reindex(ctx context.Context, sourceIndexName string, destinationIndexName string, script string, onlyMissing bool) (int64, error) {
+	destination := elastic.NewReindexDestination().Index(destinationIndexName)
+	if onlyMissing {
+		destination = destination.OpType("create")
+	}
+	reindex := es.client.Reindex().
+		SourceIndex(sourceIndexName).
+		Destination(destination).
+		Conflicts("proceed").
+		WaitForCompletion(true).
+		Refresh("true")
+	if script != "" {
+		reindex = reindex.Script(elastic.NewScript(script))
+	}
+	response, err := reindex.Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return response.Created, nil
+}
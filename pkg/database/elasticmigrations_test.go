@@ -0,0 +1,335 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCluster is a fake ElasticSearch with indices, aliases and templates. Documents are
+// identified by the month of their event, reindex with the partitioning script routes them
+// to the partitions of their months, creating partitions from templates as ElasticSearch does.
+type fakeCluster struct {
+	mutex     sync.Mutex
+	indices   map[string]*fakeIndex
+	templates map[string]fakeTemplate
+	// templateAliases records for every put template if it had aliases
+	templateAliases []bool
+	// afterReindex is called after reindex from sourceIndexName
+	afterReindex func(sourceIndexName string)
+}
+
+type fakeIndex struct {
+	aliases map[string]bool
+	months  map[string]bool
+}
+
+type fakeTemplate struct {
+	IndexPatterns []string               `json:"index_patterns"`
+	Aliases       map[string]interface{} `json:"aliases"`
+}
+
+var partitionScriptPattern = regexp.MustCompile(`ctx\._index = '([^']+)-'`)
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{indices: map[string]*fakeIndex{}, templates: map[string]fakeTemplate{}}
+}
+
+// addIndex adds index with events of months behind aliases
+func (fake *fakeCluster) addIndex(indexName string, aliases []string, months ...string) {
+	index := &fakeIndex{aliases: map[string]bool{}, months: map[string]bool{}}
+	for _, alias := range aliases {
+		index.aliases[alias] = true
+	}
+	for _, month := range months {
+		index.months[month] = true
+	}
+	fake.indices[indexName] = index
+}
+
+// indicesOf returns sorted names of indices behind alias or index name
+func (fake *fakeCluster) indicesOf(name string) []string {
+	indexNames := make([]string, 0)
+	for indexName, index := range fake.indices {
+		if indexName == name || index.aliases[name] {
+			indexNames = append(indexNames, indexName)
+		}
+	}
+	sort.Strings(indexNames)
+	return indexNames
+}
+
+// createIndex creates index with aliases and aliases of the matching templates
+func (fake *fakeCluster) createIndex(indexName string, aliases map[string]interface{}) error {
+	if _, ok := fake.indices[indexName]; ok {
+		return fmt.Errorf("resource_already_exists_exception")
+	}
+	allAliases := make([]string, 0)
+	for alias := range aliases {
+		allAliases = append(allAliases, alias)
+	}
+	for _, template := range fake.templates {
+		for _, pattern := range template.IndexPatterns {
+			if matched, _ := path.Match(pattern, indexName); matched {
+				for alias := range template.Aliases {
+					allAliases = append(allAliases, alias)
+				}
+			}
+		}
+	}
+	for _, alias := range allAliases {
+		if _, ok := fake.indices[alias]; ok {
+			return fmt.Errorf("invalid_alias_name_exception")
+		}
+	}
+	fake.addIndex(indexName, allAliases)
+	return nil
+}
+
+func (fake *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(status int, errorType string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error":{"type":%q,"reason":%q},"status":%v}`, errorType, errorType, status)
+	}
+	var body map[string]json.RawMessage
+	json.NewDecoder(r.Body).Decode(&body)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case parts[0] == "_template":
+		var template fakeTemplate
+		raw, _ := json.Marshal(body)
+		json.Unmarshal(raw, &template)
+		fake.templates[parts[1]] = template
+		fake.templateAliases = append(fake.templateAliases, len(template.Aliases) > 0)
+		fmt.Fprint(w, `{"acknowledged":true}`)
+
+	case parts[0] == "_aliases":
+		var actions []map[string]struct {
+			Index interface{} `json:"index"`
+			Alias string      `json:"alias"`
+		}
+		json.Unmarshal(body["actions"], &actions)
+		for _, action := range actions {
+			for actionType, parameters := range action {
+				indexName := fmt.Sprint(parameters.Index)
+				index, ok := fake.indices[indexName]
+				if !ok {
+					fail(http.StatusNotFound, "index_not_found_exception")
+					return
+				}
+				switch actionType {
+				case "add":
+					index.aliases[parameters.Alias] = true
+				case "remove":
+					delete(index.aliases, parameters.Alias)
+				case "remove_index":
+					delete(fake.indices, indexName)
+				}
+			}
+		}
+		fmt.Fprint(w, `{"acknowledged":true}`)
+
+	case parts[0] == "_reindex":
+		var request struct {
+			Source struct {
+				Index string `json:"index"`
+			} `json:"source"`
+			Dest struct {
+				Index string `json:"index"`
+			} `json:"dest"`
+		}
+		raw, _ := json.Marshal(body)
+		json.Unmarshal(raw, &request)
+		source, ok := fake.indices[request.Source.Index]
+		if !ok {
+			fail(http.StatusNotFound, "index_not_found_exception")
+			return
+		}
+		partitionPrefix := partitionScriptPattern.FindStringSubmatch(string(body["script"]))
+		created := 0
+		for month := range source.months {
+			destinationIndexName := request.Dest.Index
+			if partitionPrefix != nil {
+				destinationIndexName = partitionPrefix[1] + "-" + month
+			}
+			if _, ok := fake.indices[destinationIndexName]; !ok {
+				if err := fake.createIndex(destinationIndexName, nil); err != nil {
+					fail(http.StatusBadRequest, err.Error())
+					return
+				}
+			}
+			if destination := fake.indices[destinationIndexName]; !destination.months[month] {
+				destination.months[month] = true
+				created++
+			}
+		}
+		fmt.Fprintf(w, `{"created":%v,"total":%v}`, created, len(source.months))
+		if fake.afterReindex != nil {
+			fake.afterReindex(request.Source.Index)
+		}
+
+	case len(parts) == 3 && parts[1] == "_clone":
+		source, ok := fake.indices[parts[0]]
+		if !ok {
+			fail(http.StatusNotFound, "index_not_found_exception")
+			return
+		}
+		fake.addIndex(parts[2], nil)
+		for month := range source.months {
+			fake.indices[parts[2]].months[month] = true
+		}
+		fmt.Fprint(w, `{"acknowledged":true}`)
+
+	case len(parts) == 2 && parts[1] == "_settings":
+		fmt.Fprint(w, `{"acknowledged":true}`)
+
+	case len(parts) == 2 && parts[1] == "_alias":
+		indexNames := fake.indicesOf(parts[0])
+		if len(indexNames) == 0 {
+			fail(http.StatusNotFound, "index_not_found_exception")
+			return
+		}
+		result := map[string]interface{}{}
+		for _, indexName := range indexNames {
+			aliases := map[string]interface{}{}
+			for alias := range fake.indices[indexName].aliases {
+				aliases[alias] = map[string]interface{}{}
+			}
+			result[indexName] = map[string]interface{}{"aliases": aliases}
+		}
+		json.NewEncoder(w).Encode(result)
+
+	case len(parts) == 1 && r.Method == http.MethodHead:
+		if len(fake.indicesOf(parts[0])) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		result := map[string]interface{}{}
+		for indexName := range fake.indices {
+			if matched, _ := path.Match(parts[0], indexName); matched {
+				result[indexName] = map[string]interface{}{}
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var aliases map[string]interface{}
+		json.Unmarshal(body["aliases"], &aliases)
+		if err := fake.createIndex(parts[0], aliases); err != nil {
+			fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		fmt.Fprint(w, `{"acknowledged":true}`)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		delete(fake.indices, parts[0])
+		fmt.Fprint(w, `{"acknowledged":true}`)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCreateIndexIfNotExistsTemplateAlias(t *testing.T) {
+	definition := videoIndexDefinition
+	tests := []struct {
+		name          string
+		existingIndex string
+		wantAlias     bool
+	}{
+		{"no index", "", true},
+		{"current version", definition.PhysicalIndexName() + "-2020.03", true},
+		{"older version", VideoEventDescriptionIndexName + "_v1-2020.03", false},
+		{"index before versioning", VideoEventDescriptionIndexName, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeCluster()
+			if test.existingIndex == VideoEventDescriptionIndexName {
+				fake.addIndex(test.existingIndex, nil, "2020.03")
+			} else if test.existingIndex != "" {
+				fake.addIndex(test.existingIndex, []string{VideoEventDescriptionIndexName}, "2020.03")
+			}
+			es := newTestElasticService(t, fake.ServeHTTP)
+
+			if err := es.createIndexIfNotExists(context.Background(), definition); err != nil {
+				t.Fatalf("createIndexIfNotExists() error = %v", err)
+			}
+			if len(fake.templateAliases) != 1 || fake.templateAliases[0] != test.wantAlias {
+				t.Errorf("templates with aliases %v, want [%v]", fake.templateAliases, test.wantAlias)
+			}
+		})
+	}
+}
+
+func TestMigrateIndexPartitions(t *testing.T) {
+	definition := videoIndexDefinition
+	oldPartitionName := VideoEventDescriptionIndexName + "_v1-2020.03"
+	tests := []struct {
+		name          string
+		oldIndexName  string
+		oldAliases    []string
+		options       MigrationOptions
+		wantRemaining []string
+	}{
+		{"older version", oldPartitionName, []string{VideoEventDescriptionIndexName}, MigrationOptions{}, nil},
+		{"older version kept", oldPartitionName, []string{VideoEventDescriptionIndexName}, MigrationOptions{KeepOldIndex: true}, []string{oldPartitionName}},
+		{"index before versioning", VideoEventDescriptionIndexName, []string{WriteAlias(VideoEventDescriptionIndexName)}, MigrationOptions{KeepOldIndex: true},
+			[]string{VideoEventDescriptionIndexName + "_v0"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeCluster()
+			fake.addIndex(test.oldIndexName, test.oldAliases, "2020.03", "2020.04")
+			// an event of a new month is written into the old index after it is reindexed
+			fake.afterReindex = func(sourceIndexName string) {
+				if sourceIndexName == test.oldIndexName {
+					fake.indices[sourceIndexName].months["2020.05"] = true
+				}
+			}
+			es := newTestElasticService(t, fake.ServeHTTP)
+
+			result, err := es.MigrateIndex(context.Background(), definition, test.options)
+			if err != nil {
+				t.Fatalf("MigrateIndex() error = %v", err)
+			}
+			if result.ToVersion != definition.Version {
+				t.Errorf("ToVersion = %v, want %v", result.ToVersion, definition.Version)
+			}
+
+			wantPartitions := []string{
+				definition.PhysicalIndexName() + "-2020.03",
+				definition.PhysicalIndexName() + "-2020.04",
+				definition.PhysicalIndexName() + "-2020.05",
+				definition.PartitionName(time.Now()),
+			}
+			if got := fake.indicesOf(VideoEventDescriptionIndexName); strings.Join(got, ",") != strings.Join(wantPartitions, ",") {
+				t.Errorf("read alias has indices %v, want %v", got, wantPartitions)
+			}
+			for _, remaining := range test.wantRemaining {
+				if index, ok := fake.indices[remaining]; !ok || index.aliases[VideoEventDescriptionIndexName] {
+					t.Errorf("old index %v is not kept outside of the read alias", remaining)
+				}
+			}
+			if len(fake.indices) != len(wantPartitions)+len(test.wantRemaining) {
+				t.Errorf("indices after migration: %v", len(fake.indices))
+			}
+			if last := len(fake.templateAliases) - 1; last < 0 || fake.templateAliases[0] || !fake.templateAliases[last] {
+				t.Errorf("templates with aliases %v, want without alias before the switch and with it after", fake.templateAliases)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+// Iterating over all the search results page by page. Searches in ElasticSearch
+// return at most 10000 documents, so every search that needs complete results
+// goes through the scroll API, which also keeps results consistent while pages
+// are requested.
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/olivere/elastic"
+)
+
+const (
+	scrollPageSize  = 1000
+	scrollKeepAlive = "1m"
+)
+
+// DocumentsSearch describes a search over all the documents of indices.
+// Query matches all the documents if it is nil, documents are returned in
+// index order if there are no sorters.
+type DocumentsSearch struct {
+	IndexNames []string
+	Query      elastic.Query
+	Sorters    []elastic.Sorter
+}
+
+// ScrollHits iterates over every hit found by search page by page and calls handleHit for it,
+// which decodes the source of the hit into the type it expects.
+// Iteration stops on the first handleHit error, which is returned.
+func (es *ElasticService) ScrollHits(ctx context.Context, search DocumentsSearch, handleHit func(hit *elastic.SearchHit) error) error {
+	if es.client == nil {
+		return errors.New("You need to connect to ElasticSearch first")
+	}
+	query := search.Query
+	if query == nil {
+		query = elastic.NewMatchAllQuery()
+	}
+	sorters := search.Sorters
+	if len(sorters) == 0 {
+		sorters = []elastic.Sorter{elastic.NewFieldSort("_doc")}
+	}
+
+	scroll := es.client.
+		Scroll(search.IndexNames...).
+		Query(query).
+		SortBy(sorters...).
+		Size(scrollPageSize).
+		KeepAlive(scrollKeepAlive)
+	defer scroll.Clear(context.Background())
+
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, hit := range res.Hits.Hits {
+			if err = handleHit(hit); err != nil {
+				return err
+			}
+		}
+	}
+}
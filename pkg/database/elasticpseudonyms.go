@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/olivere/elastic"
+)
+
+// RenameUsers replaces usernames of events in index indexName, renames map old usernames
+// to new ones. It is used to replace pseudonyms after key rotation. Number of updated
+// events is returned.
+func (es *ElasticService) RenameUsers(ctx context.Context, indexName string, renames map[string]string) (int64, error) {
+	if es.client == nil {
+		return 0, errors.New("You need to connect to ElasticSearch first")
+	}
+	if len(renames) == 0 {
+		return 0, nil
+	}
+
+	oldUsernames := make([]interface{}, 0, len(renames))
+	for oldUsername := range renames {
+		oldUsernames = append(oldUsernames, oldUsername)
+	}
+	script := elastic.NewScript("ctx._source.username = params.renames[ctx._source.username]").
+		Lang("painless").
+		Param("renames", renames)
+
+	var updated int64
+	err := es.withAllPhysicalIndices(ctx, indexName, func(physicalIndexNames []string) error {
+		res, err := es.client.
+			UpdateByQuery(physicalIndexNames...).
+			Query(elastic.NewTermsQuery("username", oldUsernames...)).
+			Script(script).
+			ProceedOnVersionConflict().
+			Refresh("true").
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		updated = res.Updated
+		return nil
+	})
+	return updated, err
+}
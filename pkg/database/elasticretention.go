@@ -0,0 +1,64 @@
+package database
+
+// Retention of partitioned event indices. Partitions older than the configured
+// age are deleted or closed. Closed partitions are removed from the read alias
+// first, because searches fail on closed indices.
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+// Retention actions
+const (
+	RetentionDelete = "delete"
+	RetentionClose  = "close"
+)
+
+// ApplyRetention deletes or closes (depending on action) every partition of the index
+// indexName, of any version, whose month ended more than maxAgeMonths months before now.
+// It returns names of the processed partitions.
+func (es *ElasticService) ApplyRetention(ctx context.Context, indexName string, maxAgeMonths int, action string, now time.Time) ([]string, error) {
+	if es.client == nil {
+		return nil, errors.New("You need to connect to ElasticSearch first")
+	}
+	if action != RetentionDelete && action != RetentionClose {
+		return nil, errors.New("Unknown retention action " + action)
+	}
+	if maxAgeMonths <= 0 {
+		return nil, errors.New("Retention max age must be at least one month")
+	}
+	partitionNames, err := es.getIndexNamesByPattern(ctx, indexName+"_v*-*")
+	if err != nil {
+		return nil, err
+	}
+
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	oldestKeptMonth := currentMonth.AddDate(0, -maxAgeMonths, 0)
+	processed := make([]string, 0)
+	for _, partitionName := range partitionNames {
+		monthSuffix := partitionName[strings.LastIndex(partitionName, "-")+1:]
+		partitionMonth, err := time.Parse(partitionMonthFormat, monthSuffix)
+		if err != nil || !partitionMonth.Before(oldestKeptMonth) {
+			continue
+		}
+
+		if action == RetentionDelete {
+			_, err = es.client.DeleteIndex(partitionName).Do(ctx)
+		} else {
+			_, err = es.client.Alias().Action(elastic.NewAliasRemoveAction(indexName).Index(partitionName)).Do(ctx)
+			if err == nil || elastic.IsNotFound(err) {
+				_, err = es.client.CloseIndex(partitionName).Do(ctx)
+			}
+		}
+		if err != nil {
+			return processed, err
+		}
+		processed = append(processed, partitionName)
+	}
+	return processed, nil
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestApplyRetentionRejectsPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAgeMonths int
+		action       string
+	}{
+		{"zero age", 0, RetentionDelete},
+		{"negative age", -3, RetentionClose},
+		{"unknown action", 12, "archive"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			es := newTestElasticService(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+				http.NotFound(w, r)
+			})
+			processed, err := es.ApplyRetention(context.Background(), VideoEventDescriptionIndexName, test.maxAgeMonths, test.action, time.Now())
+			if err == nil || len(processed) != 0 {
+				t.Errorf("ApplyRetention() = %v, %v, want error", processed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package database
+
+// Daily rollups in ElasticSearch. Rollup documents have ids made of their
+// date, course and block, so recomputed rollups replace the old ones in place.
+// The watermark is kept in "_meta" of the rollup index mapping, it is lost
+// on migration to a new version, which makes the job roll up all the events again.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+// AddDailyRollups saves rollups with a single bulk request
+func (es *ElasticService) AddDailyRollups(ctx context.Context, rollups []models.BlockActivity) error {
+	if es.client == nil {
+		return errors.New("You need to connect to ElasticSearch first")
+	}
+	if len(rollups) == 0 {
+		return nil
+	}
+	bulk := es.client.Bulk().Refresh("true")
+	for _, rollup := range rollups {
+		bulk.Add(elastic.NewBulkIndexRequest().Index(rollupIndexDefinition.WriteAlias()).Id(rollupID(rollup)).Doc(rollup))
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+	if failed := res.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%v of %v rollups weren't saved: %v", len(failed), len(rollups), failed[0].Error.Reason)
+	}
+	return nil
+}
+
+// ReplaceDailyRollups replaces rollups of days from from to to with rollups. The new rollups
+// overwrite the old ones with the same ids first, then the old rollups that weren't computed
+// again are deleted, so searches never miss the days meanwhile.
+func (es *ElasticService) ReplaceDailyRollups(ctx context.Context, from time.Time, to time.Time, rollups []models.BlockActivity) error {
+	if err := es.AddDailyRollups(ctx, rollups); err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(rollups))
+	for _, rollup := range rollups {
+		ids = append(ids, rollupID(rollup))
+	}
+	_, err := es.client.
+		DeleteByQuery(DailyRollupIndexName).
+		Query(rollupsQuery("", from, to).MustNot(elastic.NewIdsQuery().Ids(ids...))).
+		ProceedOnVersionConflict().
+		Refresh("true").
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func rollupID(rollup models.BlockActivity) string {
+	return rollup.Date.UTC().Format("2006-01-02") + "|" + rollup.CourseID + "|" + rollup.BlockID
+}
+
+// GetDailyRollups returns rollups of course courseID (of all courses if it is empty) of days
+// from from to to sorted by date, course and block. Zero from and to aren't limits.
+func (es *ElasticService) GetDailyRollups(ctx context.Context, courseID string, from time.Time, to time.Time) ([]models.BlockActivity, error) {
+	search := DocumentsSearch{
+		IndexNames: []string{DailyRollupIndexName},
+		Query:      rollupsQuery(courseID, from, to),
+		Sorters: []elastic.Sorter{
+			elastic.NewFieldSort("date"),
+			elastic.NewFieldSort("course_id"),
+			elastic.NewFieldSort("block_id"),
+		},
+	}
+	rollups := make([]models.BlockActivity, 0)
+	err := es.ScrollHits(ctx, search, func(hit *elastic.SearchHit) error {
+		var rollup models.BlockActivity
+		if err := json.Unmarshal(hit.Source, &rollup); err != nil {
+			return err
+		}
+		rollups = append(rollups, rollup)
+		return nil
+	})
+	if elastic.IsNotFound(err) {
+		return rollups, nil
+	}
+	return rollups, err
+}
+
+func rollupsQuery(courseID string, from time.Time, to time.Time) *elastic.BoolQuery {
+	query := elastic.NewBoolQuery()
+	if courseID != "" {
+		query.Filter(elastic.NewTermQuery("course_id", courseID))
+	}
+	dateRange := elastic.NewRangeQuery("date")
+	if !from.IsZero() {
+		dateRange.Gte(from.UTC().Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		dateRange.Lt(to.UTC().Format(time.RFC3339))
+	}
+	return query.Filter(dateRange)
+}
+
+// GetRollupWatermark returns the time all the rollups are computed before, zero if there are no rollups
+func (es *ElasticService) GetRollupWatermark(ctx context.Context) (time.Time, error) {
+	if es.client == nil {
+		return time.Time{}, errors.New("You need to connect to ElasticSearch first")
+	}
+	res, err := es.client.GetMapping().Index(DailyRollupIndexName).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var indexMappings map[string]struct {
+		Mappings struct {
+			Meta struct {
+				RollupWatermark time.Time `json:"rollup_watermark"`
+			} `json:"_meta"`
+		} `json:"mappings"`
+	}
+	if err = json.Unmarshal(b, &indexMappings); err != nil {
+		return time.Time{}, err
+	}
+	for _, indexMapping := range indexMappings {
+		return indexMapping.Mappings.Meta.RollupWatermark, nil
+	}
+	return time.Time{}, nil
+}
+
+// SetRollupWatermark saves the time all the rollups are computed before
+func (es *ElasticService) SetRollupWatermark(ctx context.Context, watermark time.Time) error {
+	if es.client == nil {
+		return errors.New("You need to connect to ElasticSearch first")
+	}
+	_, err := es.client.PutMapping().
+		Index(rollupIndexDefinition.WriteAlias()).
+		BodyJson(map[string]interface{}{"_meta": map[string]interface{}{"rollup_watermark": watermark.UTC()}}).
+		Do(ctx)
+	return err
+}
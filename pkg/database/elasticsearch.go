@@ -7,9 +7,11 @@ package database
 
 import (
 	"context"
+	"kafka-log-processor/pkg/models"
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/olivere/elastic"
@@ -23,11 +25,94 @@ const (
 	LinkEventDescriptionIndexName       = "link_event_description"
 	ProblemEventDescriptionIndexName    = "problem_event_description"
 	SequentialEventDescriptionIndexName = "sequential_event_description"
+	EnrollmentEventDescriptionIndexName = "enrollment_event_description"
+	DailyRollupIndexName                = "daily_rollup"
 )
 
+// ActivityIndexNames are names of indices with events of learners working in the course
+var ActivityIndexNames = []string{
+	VideoEventDescriptionIndexName,
+	ProblemEventDescriptionIndexName,
+	SequentialEventDescriptionIndexName,
+	BookmarsEventDescriptionIndexName,
+	LinkEventDescriptionIndexName,
+}
+
+// EventDescriptionIndexNames are names of all indices with parsed learner events:
+// activity indices and enrollments
+var EventDescriptionIndexNames = append(append([]string{}, ActivityIndexNames...), EnrollmentEventDescriptionIndexName)
+
+// EventFamilyIndexNames maps event families to their event description indices
+var EventFamilyIndexNames = map[string]string{
+	"video":      VideoEventDescriptionIndexName,
+	"problem":    ProblemEventDescriptionIndexName,
+	"sequential": SequentialEventDescriptionIndexName,
+	"bookmarks":  BookmarsEventDescriptionIndexName,
+	"link":       LinkEventDescriptionIndexName,
+	"enrollment": EnrollmentEventDescriptionIndexName,
+}
+
+// EventDocumentTypes maps event description indices to types of their documents
+var EventDocumentTypes = map[string]interface{}{
+	VideoEventDescriptionIndexName:      models.VideoEventDescription{},
+	ProblemEventDescriptionIndexName:    models.ProblemEventDescription{},
+	SequentialEventDescriptionIndexName: models.SequentialMoveEventDescription{},
+	BookmarsEventDescriptionIndexName:   models.BookmarksEventDescription{},
+	LinkEventDescriptionIndexName:       models.LinkEventDescription{},
+	EnrollmentEventDescriptionIndexName: models.EnrollmentEventDescription{},
+}
+
 // ElasticService to complete all the elasticsearch requests
 type ElasticService struct {
 	client *elastic.Client
+	state  *serviceState
+}
+
+// serviceState is shared between copies of ElasticService. It remembers
+// created partitions and indices that were created before versioning,
+// with the time they were last seen unversioned.
+type serviceState struct {
+	mutex              sync.Mutex
+	knownPartitions    map[string]bool
+	unversionedIndices map[string]time.Time
+}
+
+func newServiceState() *serviceState {
+	return &serviceState{
+		knownPartitions:    map[string]bool{},
+		unversionedIndices: map[string]time.Time{},
+	}
+}
+
+func (state *serviceState) isKnownPartition(partitionName string) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.knownPartitions[partitionName]
+}
+
+func (state *serviceState) setKnownPartition(partitionName string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.knownPartitions[partitionName] = true
+}
+
+func (state *serviceState) unversionedCheckedAt(indexName string) (time.Time, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	checkedAt, ok := state.unversionedIndices[indexName]
+	return checkedAt, ok
+}
+
+func (state *serviceState) setUnversioned(indexName string, checkedAt time.Time) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.unversionedIndices[indexName] = checkedAt
+}
+
+func (state *serviceState) clearUnversioned(indexName string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	delete(state.unversionedIndices, indexName)
 }
 
 // Setting up a retry policy
@@ -72,5 +157,6 @@ func (es *ElasticService) Connect(host string, port int) error {
 		return err
 	}
 	es.client = client
+	es.state = newServiceState()
 	return nil
 }
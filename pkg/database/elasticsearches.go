@@ -3,12 +3,16 @@ package database
 // Saved searches in ElasticSearch used in this project
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"kafka-log-processor/pkg/models"
 	"log"
 	"reflect"
+	"time"
 
 	"github.com/olivere/elastic"
 	edxparser "github.com/veotani/edx-structure-json"
@@ -16,12 +20,12 @@ import (
 )
 
 // GetCourseStructure gets structure for course with course code = courseCode and course run = courseRun
-func (es *ElasticService) GetCourseStructure(courseCode string) (edxstructure.Course, error) {
+func (es *ElasticService) GetCourseStructure(ctx context.Context, courseCode string) (edxstructure.Course, error) {
 	searchResults, err := es.client.
 		Search().
 		Index(CourseStructureIndexName).
 		Query(elastic.NewTermQuery("course_code.keyword", courseCode)).
-		Do(context.Background())
+		Do(ctx)
 	if err != nil {
 		return edxstructure.Course{}, err
 	}
@@ -29,183 +33,422 @@ func (es *ElasticService) GetCourseStructure(courseCode string) (edxstructure.Co
 	for _, course := range searchResults.Each(reflect.TypeOf(course)) {
 		return course.(edxstructure.Course), nil
 	}
-	return edxstructure.Course{}, fmt.Errorf("No structures for course %v was found", courseCode)
+	return edxstructure.Course{}, notFoundf("No structures for course %v was found", courseCode)
 }
 
 // GetUserVideoEvents returns all video events for specific user and a video
-func (es *ElasticService) GetUserVideoEvents(username string, videoID string) ([]models.VideoEventDescription, error) {
-	res, err := es.client.
-		Search().
-		Index(VideoEventDescriptionIndexName).
-		Query(elastic.NewBoolQuery().Must(
-			elastic.NewTermQuery("username", username),
-			elastic.NewTermQuery("video_id", videoID),
-		)).
-		Size(1e4).
-		Do(
-			context.Background(),
-		)
+func (es *ElasticService) GetUserVideoEvents(ctx context.Context, username string, videoID string) ([]models.VideoEventDescription, error) {
+	result := make([]models.VideoEventDescription, 0)
+	err := es.ScrollHits(
+		ctx,
+		DocumentsSearch{
+			IndexNames: []string{VideoEventDescriptionIndexName},
+			Query: elastic.NewBoolQuery().Must(
+				elastic.NewTermQuery("username", username),
+				elastic.NewTermQuery("video_id", videoID),
+			),
+		},
+		func(hit *elastic.SearchHit) error {
+			var videoEvent models.VideoEventDescription
+			if err := json.Unmarshal(hit.Source, &videoEvent); err != nil {
+				return err
+			}
+			result = append(result, videoEvent)
+			return nil
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
-	if res.Hits.TotalHits.Relation == "gte" {
-		log.Println("WARN: Query doesnt get all the documents at the moment. It's time to add iterating over pages.")
-	}
-
-	result := make([]models.VideoEventDescription, 0)
-	var videoEventDescription models.VideoEventDescription
-	for _, r := range res.Each(reflect.TypeOf(videoEventDescription)) {
-		videoEventDescription, ok := r.(models.VideoEventDescription)
-		if !ok {
-			log.Println("WARN: error while converting search results")
-		} else {
-			result = append(result, videoEventDescription)
-		}
-	}
-
 	return result, nil
 }
 
 // GetUserVideoAndProblemEventsTimes gets all video events and problem events logs for user with username and gets
 // their IDs and timestamps
-func (es *ElasticService) GetUserVideoAndProblemEventsTimes(username string, courseID string) ([]UserProblemAndVideoEventsIDsAndTime, error) {
-	res, err := es.client.
-		Search().
-		Index(VideoEventDescriptionIndexName).
-		Index(ProblemEventDescriptionIndexName).
-		Query(elastic.NewBoolQuery().Must(
-			elastic.NewTermQuery("username", username),
-			elastic.NewTermQuery("course_id", courseID),
-		)).
-		Size(1e4).
-		Do(context.Background())
+func (es *ElasticService) GetUserVideoAndProblemEventsTimes(ctx context.Context, username string, courseID string) ([]UserProblemAndVideoEventsIDsAndTime, error) {
+	videoAndProblemIDsAdnEventTimes := make([]UserProblemAndVideoEventsIDsAndTime, 0)
+	err := es.ScrollHits(
+		ctx,
+		DocumentsSearch{
+			IndexNames: []string{VideoEventDescriptionIndexName, ProblemEventDescriptionIndexName},
+			Query: elastic.NewBoolQuery().Must(
+				elastic.NewTermQuery("username", username),
+				elastic.NewTermQuery("course_id", courseID),
+			),
+		},
+		func(hit *elastic.SearchHit) error {
+			var event UserProblemAndVideoEventsIDsAndTime
+			if err := json.Unmarshal(hit.Source, &event); err != nil {
+				return err
+			}
+			videoAndProblemIDsAdnEventTimes = append(videoAndProblemIDsAdnEventTimes, event)
+			return nil
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
-	if res.Hits.TotalHits.Relation == "gte" {
-		log.Println("WARN: Query doesnt get all the documents at the moment. It's time to add iterating over pages.")
-	}
-	var a UserProblemAndVideoEventsIDsAndTime
-
-	videoAndProblemIDsAdnEventTimes := make([]UserProblemAndVideoEventsIDsAndTime, 0)
-	for _, r := range res.Each(reflect.TypeOf(a)) {
-		result, ok := r.(UserProblemAndVideoEventsIDsAndTime)
-		if !ok {
-			log.Println("WARN: error while converting search results")
-		} else {
-			videoAndProblemIDsAdnEventTimes = append(videoAndProblemIDsAdnEventTimes, result)
-		}
-	}
 	return videoAndProblemIDsAdnEventTimes, nil
 }
 
-// GetAllCourseCodesWithStructure returns all possible course_code values in course structures index
-func (es *ElasticService) GetAllCourseCodesWithStructure() ([]string, error) {
-	if es.client == nil {
-		return nil, errors.New("You need to connect to ElasticSearch first")
-	}
-	searchResult, err := es.client.
-		Search().
-		Index(CourseStructureIndexName).
-		Query(elastic.NewMatchAllQuery()).
-		Do(context.Background())
+// GetUserCourseEventsSortedByTime gets events of user with username in course courseID
+// matching filter from every activity index and sorts them by ascending event time.
+func (es *ElasticService) GetUserCourseEventsSortedByTime(ctx context.Context, username string, courseID string, filter EventFilter) ([]UserCourseEvent, error) {
+	result := make([]UserCourseEvent, 0)
+	err := es.ScrollHits(
+		ctx,
+		DocumentsSearch{
+			IndexNames: ActivityIndexNames,
+			Query: elastic.NewBoolQuery().Must(
+				elastic.NewTermQuery("username", username),
+				elastic.NewTermQuery("course_id", courseID),
+			).Filter(eventFilterQueries(filter)...),
+			Sorters: []elastic.Sorter{elastic.NewFieldSort("event_time").Asc()},
+		},
+		func(hit *elastic.SearchHit) error {
+			var event UserCourseEvent
+			if err := json.Unmarshal(hit.Source, &event); err != nil {
+				log.Println("WARN: error while converting search results")
+				return nil
+			}
+			event.Index = logicalIndexName(hit.Index)
+			event.Source = hit.Source
+			result = append(result, event)
+			return nil
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
+	return result, nil
+}
 
+// GetAllCourseCodesWithStructure returns all possible course_code values in course structures index
+func (es *ElasticService) GetAllCourseCodesWithStructure(ctx context.Context) ([]string, error) {
 	result := make([]string, 0)
-	var course edxparser.Course
-	for _, c := range searchResult.Each(reflect.TypeOf(course)) {
-		if currentCourse, ok := c.(edxparser.Course); ok {
-			result = append(result, currentCourse.CourseCode)
-		} else {
-			return nil, errors.New("Couldn't parse course structure index")
-		}
+	err := es.ScrollHits(
+		ctx,
+		DocumentsSearch{IndexNames: []string{CourseStructureIndexName}},
+		func(hit *elastic.SearchHit) error {
+			var course edxparser.Course
+			if err := json.Unmarshal(hit.Source, &course); err != nil {
+				return err
+			}
+			result = append(result, course.CourseCode)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
 
+// ScanCourseStructures passes every document of course structures index to handleStructure,
+// all runs and revisions of the courses
+func (es *ElasticService) ScanCourseStructures(ctx context.Context, handleStructure func(course edxstructure.Course) error) error {
+	return es.ScrollHits(
+		ctx,
+		DocumentsSearch{IndexNames: []string{CourseStructureIndexName}},
+		func(hit *elastic.SearchHit) error {
+			var course edxstructure.Course
+			if err := json.Unmarshal(hit.Source, &course); err != nil {
+				return err
+			}
+			return handleStructure(course)
+		},
+	)
+}
+
 // GetAllCourseIDsWithStructureAndLogs gets all course ids met in logs, then
 // scans for courses in structure index and returns their union.
 // The returned type is in "course-v1:org+CourseCode+CourseRun" notation.
-func (es *ElasticService) GetAllCourseIDsWithStructureAndLogs() ([]string, error) {
-	courseStructureCourses, err := es.GetAllCourseCodesWithStructure()
+func (es *ElasticService) GetAllCourseIDsWithStructureAndLogs(ctx context.Context) ([]string, error) {
+	return getAllCourseIDsWithStructureAndLogs(ctx, es)
+}
+
+// GetSortedVideoEventsForVideo gets video events matching filter where video_id is videoID and
+// sorts them by ascending video time.
+func (es *ElasticService) GetSortedVideoEventsForVideo(ctx context.Context, videoID string, filter EventFilter) ([]models.VideoEventDescription, error) {
+	result := make([]models.VideoEventDescription, 0)
+	err := es.ScrollHits(
+		ctx,
+		DocumentsSearch{
+			IndexNames: []string{VideoEventDescriptionIndexName},
+			Query:      elastic.NewBoolQuery().Filter(elastic.NewTermQuery("video_id", videoID)).Filter(eventFilterQueries(filter)...),
+			Sorters:    []elastic.Sorter{elastic.NewFieldSort("video_time").Asc()},
+		},
+		func(hit *elastic.SearchHit) error {
+			var videoEvent models.VideoEventDescription
+			if err := json.Unmarshal(hit.Source, &videoEvent); err != nil {
+				return err
+			}
+			result = append(result, videoEvent)
+			return nil
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
-	videoEventsCourses, err := es.GetUniqueStringFieldValuesInIndex(VideoEventDescriptionIndexName, "course_id")
+
+	return result, nil
+}
+
+// GetCourseBookmarkEventsSortedByTime gets bookmark events of course courseID matching filter and
+// sorts them by ascending event time.
+func (es *ElasticService) GetCourseBookmarkEventsSortedByTime(ctx context.Context, courseID string, filter EventFilter) ([]models.BookmarksEventDescription, error) {
+	result := make([]models.BookmarksEventDescription, 0)
+	err := es.ScrollHits(
+		ctx,
+		DocumentsSearch{
+			IndexNames: []string{BookmarsEventDescriptionIndexName},
+			Query:      elastic.NewBoolQuery().Filter(elastic.NewTermQuery("course_id", courseID)).Filter(eventFilterQueries(filter)...),
+			Sorters:    []elastic.Sorter{elastic.NewFieldSort("event_time").Asc()},
+		},
+		func(hit *elastic.SearchHit) error {
+			var bookmarksEvent models.BookmarksEventDescription
+			if err := json.Unmarshal(hit.Source, &bookmarksEvent); err != nil {
+				return err
+			}
+			result = append(result, bookmarksEvent)
+			return nil
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
-	problemEventsCourses, err := es.GetUniqueStringFieldValuesInIndex(ProblemEventDescriptionIndexName, "course_id")
-	if err != nil {
-		return nil, err
+
+	return result, nil
+}
+
+// TimelineQuery describes what part of learner timeline to get.
+// StoredUsernames are all the forms events of the learner are stored with, e.g. pseudonyms
+// of the old and the new key during rotation; Username is used if it is empty.
+// Families are keys of EventFamilyIndexNames (all families if empty), From and To
+// limit event time if not zero, Platforms limit platforms if not empty.
+// Cursor is NextCursor of the previous page.
+type TimelineQuery struct {
+	Username        string
+	StoredUsernames []string
+	CourseID        string
+	Families        []string
+	From            time.Time
+	To              time.Time
+	Platforms       []string
+	Size            int
+	Cursor          string
+}
+
+// storedUsernames returns usernames events of the timeline learner are stored with
+func (timelineQuery TimelineQuery) storedUsernames() []string {
+	if len(timelineQuery.StoredUsernames) == 0 {
+		return []string{timelineQuery.Username}
 	}
+	return timelineQuery.StoredUsernames
+}
 
-	log.Println(courseStructureCourses)
-	log.Println(videoEventsCourses)
+// eventFilter returns filter of the timeline events
+func (timelineQuery TimelineQuery) eventFilter() EventFilter {
+	return EventFilter{From: timelineQuery.From, To: timelineQuery.To, Platforms: timelineQuery.Platforms}
+}
 
-	result := make([]string, 0)
+// GetUserTimeline gets a page of events of the user in the course from event description
+// indices sorted by ascending event time. The second returned value is the cursor of the
+// next page, it is empty if there are no more events.
+func (es *ElasticService) GetUserTimeline(ctx context.Context, timelineQuery TimelineQuery) ([]UserCourseEvent, string, error) {
+	if es.client == nil {
+		return nil, "", errors.New("You need to connect to ElasticSearch first")
+	}
 
-	for _, videoEventsCourse := range videoEventsCourses {
-		for _, coursecourseStructureCourse := range courseStructureCourses {
-			videoEventsCourseCode, err := models.GetCourseCodeFromCourseID(videoEventsCourse)
-			if err != nil {
-				log.Println("Skipping video event because it had invalid course_id. Please check the data!")
-				continue
-			}
-			if coursecourseStructureCourse == videoEventsCourseCode {
-				result = append(result, videoEventsCourse)
+	indexNames := EventDescriptionIndexNames
+	if len(timelineQuery.Families) > 0 {
+		indexNames = make([]string, 0, len(timelineQuery.Families))
+		for _, family := range timelineQuery.Families {
+			indexName, ok := EventFamilyIndexNames[family]
+			if !ok {
+				return nil, "", fmt.Errorf("Unknown event family %v", family)
 			}
+			indexNames = append(indexNames, indexName)
 		}
 	}
 
-	for _, problemEventsCourse := range problemEventsCourses {
-		for _, coursecourseStructureCourse := range courseStructureCourses {
-			problemEventsCourseCode, err := models.GetCourseCodeFromCourseID(problemEventsCourse)
-			if err != nil {
-				log.Println("Skipping problem event because it had invalid course_id. Please check the data!")
-				continue
-			}
-			if coursecourseStructureCourse == problemEventsCourseCode {
-				result = append(result, problemEventsCourse)
-			}
+	query := elastic.NewBoolQuery().Filter(
+		elastic.NewTermsQuery("username", toInterfaces(timelineQuery.storedUsernames())...),
+		elastic.NewTermQuery("course_id", timelineQuery.CourseID),
+	).Filter(eventFilterQueries(timelineQuery.eventFilter())...)
+
+	search := es.client.
+		Search().
+		Index(indexNames...).
+		Query(query).
+		Sort("event_time", true).
+		Sort("_index", true).
+		Sort("_id", true).
+		Size(timelineQuery.Size)
+	if timelineQuery.Cursor != "" {
+		searchAfter, err := decodeSearchAfterCursor(timelineQuery.Cursor)
+		if err != nil {
+			return nil, "", err
 		}
+		search = search.SearchAfter(searchAfter...)
+	}
+	res, err := search.Do(ctx)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return result, nil
+	result := make([]UserCourseEvent, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		var event UserCourseEvent
+		if err := json.Unmarshal(hit.Source, &event); err != nil {
+			log.Println("WARN: error while converting search results")
+			continue
+		}
+		event.Index = logicalIndexName(hit.Index)
+		event.Source = hit.Source
+		result = append(result, event)
+	}
+
+	nextCursor := ""
+	if len(res.Hits.Hits) == timelineQuery.Size && timelineQuery.Size > 0 {
+		nextCursor, err = encodeSearchAfterCursor(res.Hits.Hits[len(res.Hits.Hits)-1].Sort)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return result, nextCursor, nil
 }
 
-// GetSortedVideoEventsForVideo gets video events where video_id is videoID and
-// sorts them by ascending video time.
-func (es *ElasticService) GetSortedVideoEventsForVideo(videoID string) ([]models.VideoEventDescription, error) {
-	if es.client == nil {
-		return nil, errors.New("You need to connect to ElasticSearch first")
+func encodeSearchAfterCursor(sortValues []interface{}) (string, error) {
+	b, err := json.Marshal(sortValues)
+	if err != nil {
+		return "", err
 	}
-	searchResult, err := es.client.
-		Search().
-		Index(VideoEventDescriptionIndexName).
-		Query(elastic.NewTermQuery("video_id", videoID)).
-		Sort("video_time", true).
-		Size(1e4).
-		Do(context.Background())
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeSearchAfterCursor(cursor string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var sortValues []interface{}
+	if err = decoder.Decode(&sortValues); err != nil {
+		return nil, ErrInvalidCursor
 	}
+	return sortValues, nil
+}
 
-	if searchResult.Hits.TotalHits.Relation == "gte" {
-		log.Println("WARN: Query doesnt get all the documents at the moment. It's time to add iterating over pages.")
+// ScanCourseEvents calls handleEvent for every event matching query page by page.
+// Events are sorted by course ID and ascending event time.
+func (es *ElasticService) ScanCourseEvents(ctx context.Context, query CourseEventsQuery, handleEvent func(event CourseEvent) error) error {
+	if _, ok := EventDocumentTypes[query.IndexName]; !ok {
+		return errors.New("Unknown event index " + query.IndexName)
 	}
-	result := make([]models.VideoEventDescription, 0)
-	var videoEventObject models.VideoEventDescription
-	for _, searchRes := range searchResult.Each(reflect.TypeOf(videoEventObject)) {
-		if videoEvent, ok := searchRes.(models.VideoEventDescription); ok {
-			result = append(result, videoEvent)
-		} else {
-			return nil, errors.New("Couldn't parse video event description index")
+
+	filters := elastic.NewBoolQuery().Filter(eventFilterQueries(query.EventFilter)...)
+	if query.CourseID != "" {
+		filters = filters.Filter(elastic.NewTermQuery("course_id", query.CourseID))
+	}
+
+	search := DocumentsSearch{
+		IndexNames: []string{query.IndexName},
+		Query:      filters,
+		Sorters:    []elastic.Sorter{elastic.NewFieldSort("course_id"), elastic.NewFieldSort("event_time")},
+	}
+	return es.ScrollHits(ctx, search, func(hit *elastic.SearchHit) error {
+		event, err := newCourseEvent(query.IndexName, hit.Source)
+		if err != nil {
+			return err
 		}
+		return handleEvent(event)
+	})
+}
+
+// eventFilterQueries returns filter queries of the event filter. Events without platform
+// were saved before platforms were recorded, they are web events.
+func eventFilterQueries(filter EventFilter) []elastic.Query {
+	queries := make([]elastic.Query, 0)
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		timeRange := elastic.NewRangeQuery("event_time")
+		if !filter.From.IsZero() {
+			timeRange = timeRange.Gte(filter.From)
+		}
+		if !filter.To.IsZero() {
+			timeRange = timeRange.Lt(filter.To)
+		}
+		queries = append(queries, timeRange)
+	}
+	if filter.Usernames != nil {
+		queries = append(queries, elastic.NewTermsQuery("username", toInterfaces(filter.Usernames)...))
+	}
+	if len(filter.Platforms) > 0 {
+		platformQuery := elastic.NewBoolQuery().Should(elastic.NewTermsQuery("platform", toInterfaces(filter.Platforms)...))
+		for _, platform := range filter.Platforms {
+			if platform == models.WebPlatform {
+				platformQuery = platformQuery.Should(elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery("platform")))
+			}
+		}
+		queries = append(queries, platformQuery.MinimumNumberShouldMatch(1))
 	}
+	return queries
+}
 
-	return result, nil
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+// CountDocuments returns number of searchable documents in index indexName, 0 if there is no such index.
+// Documents written since the last refresh of the index aren't counted.
+func (es *ElasticService) CountDocuments(ctx context.Context, indexName string) (int64, error) {
+	if es.client == nil {
+		return 0, errors.New("You need to connect to ElasticSearch first")
+	}
+	count, err := es.client.Count(indexName).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return 0, nil
+	}
+	return count, err
+}
+
+// GetFirstEventTime returns time of the earliest event of index indexName, zero if it has no events
+func (es *ElasticService) GetFirstEventTime(ctx context.Context, indexName string) (time.Time, error) {
+	if es.client == nil {
+		return time.Time{}, errors.New("You need to connect to ElasticSearch first")
+	}
+	res, err := es.client.
+		Search(indexName).
+		Size(0).
+		Aggregation("first_event_time", elastic.NewMinAggregation().Field("event_time")).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	firstEventTime, ok := res.Aggregations.Min("first_event_time")
+	if !ok || firstEventTime.Value == nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, int64(*firstEventTime.Value)*int64(time.Millisecond)).UTC(), nil
+}
+
+// Refresh makes all documents written into index indexName searchable
+func (es *ElasticService) Refresh(ctx context.Context, indexName string) error {
+	if es.client == nil {
+		return errors.New("You need to connect to ElasticSearch first")
+	}
+	_, err := es.client.Refresh(indexName).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,163 @@
+package database_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kafka-log-processor/pkg/analysers"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"net/http"
+	"strings"
+	"testing"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+// elasticEventsStore reads events of a learner from ElasticSearch and everything else from memory
+type elasticEventsStore struct {
+	*database.MemoryStore
+	elastic *database.ElasticService
+}
+
+func (store elasticEventsStore) GetUserCourseEventsSortedByTime(ctx context.Context, username string, courseID string, filter database.EventFilter) ([]database.UserCourseEvent, error) {
+	return store.elastic.GetUserCourseEventsSortedByTime(ctx, username, courseID, filter)
+}
+
+func (store elasticEventsStore) GetUserTimeline(ctx context.Context, timelineQuery database.TimelineQuery) ([]database.UserCourseEvent, string, error) {
+	return store.elastic.GetUserTimeline(ctx, timelineQuery)
+}
+
+// searchHit is a document of the fake ElasticSearch
+type searchHit struct {
+	Index  string      `json:"_index"`
+	ID     string      `json:"_id"`
+	Source interface{} `json:"_source"`
+}
+
+// newVersionedIndicesStore returns store with events of a learner, ElasticSearch has them in
+// versioned and partitioned physical indices
+func newVersionedIndicesStore(t *testing.T) elasticEventsStore {
+	t.Helper()
+	ctx := context.Background()
+	memoryStore := database.NewMemoryStore()
+	structure := edxstruct.Course{CourseCode: "C1", CourseRun: "2020", Chapters: []edxstruct.Chapter{{
+		URLName: "chapter1",
+		Sequentials: []edxstruct.Sequential{{
+			URLName: "sequential1",
+			Verticals: []edxstruct.Vertical{
+				{URLName: "vertical1", Videos: []edxstruct.Video{{URLName: "video1"}}},
+				{URLName: "vertical2", Problems: []edxstruct.Problem{{URLName: "problem1"}}},
+			},
+		}},
+	}}}
+	if err := memoryStore.AddCourseStructure(ctx, structure); err != nil {
+		t.Fatalf("can't add course structure: %v", err)
+	}
+
+	video := func(eventTime string) models.VideoEventDescription {
+		return models.VideoEventDescription{EventTime: eventTime, Username: "alice", VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID}
+	}
+	problem := func(eventTime string) models.ProblemEventDescription {
+		return models.ProblemEventDescription{EventTime: eventTime, Username: "alice", ProblemID: "problem1", EventType: models.ProblemSubmittedEventType, CourseID: testCourseID}
+	}
+	sequential := models.SequentialMoveEventDescription{EventTime: "2020-03-01T10:01:00Z", Username: "alice", Old: 1, New: 2, EventType: "seq_next", CourseID: testCourseID,
+		SequentialID: "sequential1", OldVerticalID: "vertical1", NewVerticalID: "vertical2"}
+	bookmark := models.BookmarksEventDescription{EventTime: "2020-03-01T10:03:00Z", Username: "alice", EventType: "edx.bookmark.added", IsAdded: true, CourseID: testCourseID,
+		ID: "block-v1:org+C1+2020+type@vertical+block@vertical2", BlockID: "vertical2"}
+
+	hits := []searchHit{
+		{"video_event_description_v3-2020.03", "1", video("2020-03-01T10:00:00Z")},
+		{"sequential_event_description_v0", "2", sequential},
+		{"problem_event_description_v2", "3", problem("2020-03-01T10:02:00Z")},
+		{"bookmarks_event_description_v1-2020.03", "4", bookmark},
+		{"video_event_description_v3-2020.03", "5", video("2020-03-01T10:05:00Z")},
+		{"problem_event_description_v2", "6", problem("2020-03-01T10:08:00Z")},
+	}
+	for _, err := range []error{
+		memoryStore.AddVideoEventDescription(ctx, hits[0].Source.(models.VideoEventDescription)),
+		memoryStore.AddSequentialMoveEventDescription(ctx, sequential),
+		memoryStore.AddProblemEventDescription(ctx, hits[2].Source.(models.ProblemEventDescription)),
+		memoryStore.AddBooksmarkEventDescription(ctx, bookmark),
+		memoryStore.AddVideoEventDescription(ctx, hits[4].Source.(models.VideoEventDescription)),
+		memoryStore.AddProblemEventDescription(ctx, hits[5].Source.(models.ProblemEventDescription)),
+	} {
+		if err != nil {
+			t.Fatalf("can't add event: %v", err)
+		}
+	}
+
+	// every search and the first page of a scroll return all the hits
+	elasticService := database.NewTestElasticService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodDelete:
+			fmt.Fprint(w, `{"succeeded":true}`)
+		case r.URL.Path == "/_search/scroll":
+			fmt.Fprint(w, `{"_scroll_id":"scroll","hits":{"hits":[]}}`)
+		case strings.HasSuffix(r.URL.Path, "/_search"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"_scroll_id": "scroll", "hits": map[string]interface{}{"hits": hits}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return elasticEventsStore{MemoryStore: memoryStore, elastic: elasticService}
+}
+
+func TestAnalysersWithVersionedIndices(t *testing.T) {
+	analyser := analysers.New(newVersionedIndicesStore(t))
+	ctx := context.Background()
+
+	t.Run("route", func(t *testing.T) {
+		routes, err := analyser.GetCourseUsersRoute(ctx, testCourseID, models.Filter{})
+		if err != nil {
+			t.Fatalf("GetCourseUsersRoute() error = %v", err)
+		}
+		if len(routes) != 1 {
+			t.Fatalf("GetCourseUsersRoute() returned %v routes, want 1", len(routes))
+		}
+		want := []string{
+			"video1", database.VideoEventDescriptionIndexName,
+			"vertical2", database.SequentialEventDescriptionIndexName,
+			"problem1", database.ProblemEventDescriptionIndexName,
+			"vertical2", database.BookmarsEventDescriptionIndexName,
+			"video1", database.VideoEventDescriptionIndexName,
+			"problem1", database.ProblemEventDescriptionIndexName,
+		}
+		steps := make([]string, 0)
+		for _, step := range routes[0].Steps {
+			steps = append(steps, step.BlockID, step.Index)
+		}
+		if strings.Join(steps, " ") != strings.Join(want, " ") {
+			t.Errorf("steps = %v, want %v", steps, want)
+		}
+	})
+
+	t.Run("timeline", func(t *testing.T) {
+		timeline, err := analyser.GetUserTimeline(ctx, database.TimelineQuery{Username: "alice", StoredUsernames: []string{"alice"}, CourseID: testCourseID})
+		if err != nil {
+			t.Fatalf("GetUserTimeline() error = %v", err)
+		}
+		want := []string{"video video1", "sequential vertical2", "problem problem1", "bookmarks vertical2", "video video1", "problem problem1"}
+		events := make([]string, 0)
+		for _, event := range timeline.Events {
+			events = append(events, event.Family+" "+event.BlockID)
+		}
+		if strings.Join(events, ",") != strings.Join(want, ",") {
+			t.Errorf("events = %v, want %v", events, want)
+		}
+	})
+
+	t.Run("bookmarks", func(t *testing.T) {
+		report, err := analyser.GetCourseBookmarksReport(ctx, testCourseID, models.Filter{})
+		if err != nil {
+			t.Fatalf("GetCourseBookmarksReport() error = %v", err)
+		}
+		// the learner leaves the bookmarked unit at 10:05 and comes back at 10:08
+		if report.ReturnRate != 1 || report.MedianReturnDelaySeconds != 300 {
+			t.Errorf("ReturnRate = %v, MedianReturnDelaySeconds = %v, want 1 and 300", report.ReturnRate, report.MedianReturnDelaySeconds)
+		}
+	})
+}
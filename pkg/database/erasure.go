@@ -0,0 +1,126 @@
+package database
+
+// Erasure of all the data of learners on their deletion requests.
+// Every erasure is recorded in an append-only audit log of JSON lines.
+// Audit records keep HMAC-SHA256 hashes of usernames made with a secret audit key
+// instead of the usernames, so the log itself doesn't keep personal data and can't
+// be reversed by hashing known usernames, but still can be checked against a request
+// by the holder of the key.
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UsernameHashAlgorithm is the algorithm of username hashes of audit records
+const UsernameHashAlgorithm = "hmac-sha256"
+
+// ErasureResult is a number of documents of an index found, deleted and found after deletion
+type ErasureResult struct {
+	Matched   int64 `json:"matched"`
+	Deleted   int64 `json:"deleted"`
+	Remaining int64 `json:"remaining"`
+}
+
+// ErasureRecord is an audit record of the erasure
+type ErasureRecord struct {
+	StartedAt      time.Time                `json:"started_at"`
+	FinishedAt     time.Time                `json:"finished_at"`
+	Reason         string                   `json:"reason"`
+	DryRun         bool                     `json:"dry_run"`
+	HashAlgorithm  string                   `json:"hash_algorithm"`
+	UsernameHashes []string                 `json:"username_hashes"`
+	Indices        map[string]ErasureResult `json:"indices"`
+	Verified       bool                     `json:"verified"`
+	Error          string                   `json:"error,omitempty"`
+}
+
+// EraseLearners deletes events of learners with usernames from every event index of store
+// and verifies that nothing remains. Usernames are hashed in the record with auditKey.
+// Returned record is filled even if erasure fails.
+func EraseLearners(ctx context.Context, store EventStore, usernames []string, auditKey []byte, reason string, dryRun bool) (ErasureRecord, error) {
+	record := ErasureRecord{
+		StartedAt:      time.Now().UTC(),
+		Reason:         reason,
+		DryRun:         dryRun,
+		HashAlgorithm:  UsernameHashAlgorithm,
+		UsernameHashes: make([]string, 0, len(usernames)),
+		Indices:        map[string]ErasureResult{},
+	}
+	for _, username := range usernames {
+		record.UsernameHashes = append(record.UsernameHashes, HashUsername(auditKey, username))
+	}
+
+	record.Verified = !dryRun
+	for _, indexName := range EventDescriptionIndexNames {
+		result, err := store.EraseUserEvents(ctx, indexName, usernames, dryRun)
+		record.Indices[indexName] = result
+		if err != nil {
+			record.Verified = false
+			record.Error = err.Error()
+			record.FinishedAt = time.Now().UTC()
+			return record, err
+		}
+		if result.Remaining > 0 {
+			record.Verified = false
+		}
+	}
+	record.FinishedAt = time.Now().UTC()
+	return record, nil
+}
+
+// HashUsername returns hex encoded HMAC-SHA256 of username with auditKey used in audit records
+func HashUsername(auditKey []byte, username string) string {
+	mac := hmac.New(sha256.New, auditKey)
+	mac.Write([]byte(username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReadAuditKey reads base64 encoded audit key from file fileName. The key must be at least 32 bytes long.
+func ReadAuditKey(fileName string) ([]byte, error) {
+	if fileName == "" {
+		return nil, errors.New("Audit key file is not configured")
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, errors.New("Audit key is not base64 encoded")
+	}
+	if len(key) < sha256.Size {
+		return nil, errors.New("Audit key is shorter than 32 bytes")
+	}
+	return key, nil
+}
+
+// WriteErasureAudit appends record to the audit log in file fileName
+func WriteErasureAudit(fileName string, record ErasureRecord) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err = file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
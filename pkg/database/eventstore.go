@@ -0,0 +1,288 @@
+package database
+
+// EventStore interface describes all the storage operations used in this project.
+// ElasticService stores data in ElasticSearch, SQLiteStore keeps it in an embedded
+// SQLite file for small deployments and MemoryStore keeps it in memory
+// for single-process local mode and tests.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/models"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+// Storage backends
+const (
+	ElasticBackend = "elastic"
+	SQLiteBackend  = "sqlite"
+	MemoryBackend  = "memory"
+)
+
+// EventStore stores course structures and parsed events and runs searches on them
+type EventStore interface {
+	CreateVideoIndexIfNotExists(ctx context.Context) error
+	CreateBookmarksIndexIfNotExists(ctx context.Context) error
+	CreateLinksIndexIfNotExists(ctx context.Context) error
+	CreateProblemIndexIfNotExists(ctx context.Context) error
+	CreateSequentialIndexIfNotExists(ctx context.Context) error
+	CreateStructureIndexIfNotExists(ctx context.Context) error
+	CreateEnrollmentIndexIfNotExists(ctx context.Context) error
+	CreateRollupIndexIfNotExists(ctx context.Context) error
+
+	AddCourseStructure(ctx context.Context, course edxstruct.Course) error
+	AddVideoEventDescription(ctx context.Context, videoEventDescription models.VideoEventDescription) error
+	AddBooksmarkEventDescription(ctx context.Context, booksmarkEventDescription models.BookmarksEventDescription) error
+	AddLinkEventDescription(ctx context.Context, linkEventDescription models.LinkEventDescription) error
+	AddProblemEventDescription(ctx context.Context, problemEventDescription models.ProblemEventDescription) error
+	AddSequentialMoveEventDescription(ctx context.Context, sequentialMoveEventDescription models.SequentialMoveEventDescription) error
+	AddEnrollmentEventDescription(ctx context.Context, enrollmentEventDescription models.EnrollmentEventDescription) error
+	AddEventDescriptions(ctx context.Context, indexName string, eventDescriptions []interface{}) error
+
+	GetCourseStructure(ctx context.Context, courseCode string) (edxstruct.Course, error)
+	GetUserVideoEvents(ctx context.Context, username string, videoID string) ([]models.VideoEventDescription, error)
+	GetUserVideoAndProblemEventsTimes(ctx context.Context, username string, courseID string) ([]UserProblemAndVideoEventsIDsAndTime, error)
+	GetUserCourseEventsSortedByTime(ctx context.Context, username string, courseID string, filter EventFilter) ([]UserCourseEvent, error)
+	GetAllCourseCodesWithStructure(ctx context.Context) ([]string, error)
+	ScanCourseStructures(ctx context.Context, handleStructure func(course edxstruct.Course) error) error
+	GetAllCourseIDsWithStructureAndLogs(ctx context.Context) ([]string, error)
+	GetSortedVideoEventsForVideo(ctx context.Context, videoID string, filter EventFilter) ([]models.VideoEventDescription, error)
+	GetCourseBookmarkEventsSortedByTime(ctx context.Context, courseID string, filter EventFilter) ([]models.BookmarksEventDescription, error)
+	GetUserTimeline(ctx context.Context, timelineQuery TimelineQuery) ([]UserCourseEvent, string, error)
+	CountDocuments(ctx context.Context, indexName string) (int64, error)
+	GetIndexMapping(ctx context.Context, indexName string) (json.RawMessage, error)
+	GetFirstEventTime(ctx context.Context, indexName string) (time.Time, error)
+	Refresh(ctx context.Context, indexName string) error
+	ScanCourseEvents(ctx context.Context, query CourseEventsQuery, handleEvent func(event CourseEvent) error) error
+	CountUserEvents(ctx context.Context, indexName string, courseID string, filter EventFilter) (map[string]int64, error)
+	EraseUserEvents(ctx context.Context, indexName string, usernames []string, dryRun bool) (ErasureResult, error)
+	RenameUsers(ctx context.Context, indexName string, renames map[string]string) (int64, error)
+
+	AddDailyRollups(ctx context.Context, rollups []models.BlockActivity) error
+	ReplaceDailyRollups(ctx context.Context, from time.Time, to time.Time, rollups []models.BlockActivity) error
+	GetDailyRollups(ctx context.Context, courseID string, from time.Time, to time.Time) ([]models.BlockActivity, error)
+	GetRollupWatermark(ctx context.Context) (time.Time, error)
+	SetRollupWatermark(ctx context.Context, watermark time.Time) error
+
+	GetUniqueStringFieldValuesInIndex(ctx context.Context, indexName string, fieldName string) ([]string, error)
+	GetUniqueStringFieldValuesInIndexWithFilter(ctx context.Context, indexName string, fieldName string, filteredFieldName string, filteredFieldValue interface{}) ([]string, error)
+	GetStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) ([]FieldValueCount, error)
+	GetNestedStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, groupFieldName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) (map[string][]FieldValueCount, error)
+}
+
+// ErrInvalidCursor is returned for timeline cursors that weren't made by the store
+var ErrInvalidCursor = errors.New("Cursor has incorrect format")
+
+// ErrNotFound is matched (with errors.Is) by errors of searches that found nothing
+var ErrNotFound = errors.New("Not found")
+
+type notFoundError struct {
+	message string
+}
+
+func (err *notFoundError) Error() string { return err.message }
+
+func (err *notFoundError) Is(target error) bool { return target == ErrNotFound }
+
+func notFoundf(format string, args ...interface{}) error {
+	return &notFoundError{message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	_ EventStore = &ElasticService{}
+	_ EventStore = &SQLiteStore{}
+	_ EventStore = &MemoryStore{}
+)
+
+// EventFilter limits events of searches, zero values don't filter. From and To limit
+// event time, Usernames and Platforms list the allowed values. Nil Usernames allow every
+// learner, empty non-nil Usernames allow none. Events saved before platforms were
+// recorded are web events.
+type EventFilter struct {
+	From      time.Time
+	To        time.Time
+	Usernames []string
+	Platforms []string
+}
+
+// CourseEventsQuery describes events of one event description index to scan.
+// All courses are scanned if CourseID is empty.
+type CourseEventsQuery struct {
+	IndexName string
+	CourseID  string
+	EventFilter
+}
+
+// CourseEvent is an event found by ScanCourseEvents. Document has
+// the type of EventDocumentTypes value of the scanned index.
+type CourseEvent struct {
+	CourseID string
+	Username string
+	Time     time.Time
+	Document interface{}
+}
+
+// NewEventStore returns EventStore of the backend chosen in config.
+// ElasticSearch is used by default.
+func NewEventStore(config configs.ParserConfig) (EventStore, error) {
+	switch config.Storage.Backend {
+	case "", ElasticBackend:
+		es := &ElasticService{}
+		if err := es.Connect(config.Elastic.Host, config.Elastic.Port); err != nil {
+			return nil, err
+		}
+		return es, nil
+	case SQLiteBackend:
+		return NewSQLiteStore(config.Storage.SQLitePath)
+	case MemoryBackend:
+		return NewMemoryStore(), nil
+	}
+	return nil, errors.New("Unknown storage backend " + config.Storage.Backend)
+}
+
+// DataWatermark returns a value that changes when data read by analyses changes: numbers of
+// searchable course structures and documents of every event index and the rollup watermark
+func DataWatermark(ctx context.Context, store EventStore) (string, error) {
+	indexNames := append([]string{CourseStructureIndexName}, EventDescriptionIndexNames...)
+	parts := make([]string, 0, len(indexNames)+1)
+	for _, indexName := range indexNames {
+		count, err := store.CountDocuments(ctx, indexName)
+		if err != nil {
+			return "", fmt.Errorf("can't count documents of %v: %w", indexName, err)
+		}
+		parts = append(parts, fmt.Sprintf("%v=%v", indexName, count))
+	}
+	rollupWatermark, err := store.GetRollupWatermark(ctx)
+	if err != nil {
+		return "", fmt.Errorf("can't get rollup watermark: %w", err)
+	}
+	parts = append(parts, "rollups="+rollupWatermark.UTC().Format(time.RFC3339))
+	return strings.Join(parts, ","), nil
+}
+
+// DataWatermarks caches DataWatermark of a store for a few seconds,
+// so frequent requests don't count documents of every index each time
+type DataWatermarks struct {
+	store   EventStore
+	ttl     time.Duration
+	mutex   sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// NewDataWatermarks returns DataWatermarks of store, that are computed again after ttl
+func NewDataWatermarks(store EventStore, ttl time.Duration) *DataWatermarks {
+	return &DataWatermarks{store: store, ttl: ttl}
+}
+
+// Get returns the cached DataWatermark of the store or computes it when it is expired
+func (watermarks *DataWatermarks) Get(ctx context.Context) (string, error) {
+	watermarks.mutex.Lock()
+	defer watermarks.mutex.Unlock()
+	if time.Now().Before(watermarks.expires) {
+		return watermarks.value, nil
+	}
+	value, err := DataWatermark(ctx, watermarks.store)
+	if err != nil {
+		return "", err
+	}
+	watermarks.value, watermarks.expires = value, time.Now().Add(watermarks.ttl)
+	return value, nil
+}
+
+// getAllCourseIDsWithStructureAndLogs gets all course ids met in video and problem logs
+// and returns those of them that have course structure in store
+func getAllCourseIDsWithStructureAndLogs(ctx context.Context, store EventStore) ([]string, error) {
+	courseStructureCourses, err := store.GetAllCourseCodesWithStructure(ctx)
+	if err != nil {
+		return nil, err
+	}
+	videoEventsCourses, err := store.GetUniqueStringFieldValuesInIndex(ctx, VideoEventDescriptionIndexName, "course_id")
+	if err != nil {
+		return nil, err
+	}
+	problemEventsCourses, err := store.GetUniqueStringFieldValuesInIndex(ctx, ProblemEventDescriptionIndexName, "course_id")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println(courseStructureCourses)
+	log.Println(videoEventsCourses)
+
+	result := make([]string, 0)
+
+	for _, videoEventsCourse := range videoEventsCourses {
+		for _, coursecourseStructureCourse := range courseStructureCourses {
+			videoEventsCourseCode, err := models.GetCourseCodeFromCourseID(videoEventsCourse)
+			if err != nil {
+				log.Println("Skipping video event because it had invalid course_id. Please check the data!")
+				continue
+			}
+			if coursecourseStructureCourse == videoEventsCourseCode {
+				result = append(result, videoEventsCourse)
+			}
+		}
+	}
+
+	for _, problemEventsCourse := range problemEventsCourses {
+		for _, coursecourseStructureCourse := range courseStructureCourses {
+			problemEventsCourseCode, err := models.GetCourseCodeFromCourseID(problemEventsCourse)
+			if err != nil {
+				log.Println("Skipping problem event because it had invalid course_id. Please check the data!")
+				continue
+			}
+			if coursecourseStructureCourse == problemEventsCourseCode {
+				result = append(result, problemEventsCourse)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// definitionMapping returns mappings of the current version of index indexName,
+// documents of stores without mappings follow them too
+func definitionMapping(indexName string) (json.RawMessage, error) {
+	for _, definition := range IndexDefinitions {
+		if definition.Name != indexName {
+			continue
+		}
+		var body struct {
+			Mappings json.RawMessage `json:"mappings"`
+		}
+		err := json.Unmarshal([]byte(definition.Body), &body)
+		return body.Mappings, err
+	}
+	return nil, errors.New("Unknown index " + indexName)
+}
+
+// newCourseEvent unmarshals event document source of index indexName
+func newCourseEvent(indexName string, source []byte) (CourseEvent, error) {
+	documentType, ok := EventDocumentTypes[indexName]
+	if !ok {
+		return CourseEvent{}, errors.New("Unknown event index " + indexName)
+	}
+	document := reflect.New(reflect.TypeOf(documentType))
+	if err := json.Unmarshal(source, document.Interface()); err != nil {
+		return CourseEvent{}, err
+	}
+	var fields struct {
+		CourseID  string `json:"course_id"`
+		Username  string `json:"username"`
+		EventTime string `json:"event_time"`
+	}
+	if err := json.Unmarshal(source, &fields); err != nil {
+		return CourseEvent{}, err
+	}
+	eventTime, _ := models.ParseEventTime(fields.EventTime)
+	return CourseEvent{CourseID: fields.CourseID, Username: fields.Username, Time: eventTime, Document: document.Elem().Interface()}, nil
+}
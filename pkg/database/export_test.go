@@ -0,0 +1,24 @@
+package database
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/olivere/elastic"
+)
+
+// newTestElasticService returns ElasticService of a fake ElasticSearch answering with handler
+func newTestElasticService(t *testing.T, handler http.HandlerFunc) *ElasticService {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("can't create ElasticSearch client: %v", err)
+	}
+	return &ElasticService{client: client, state: newServiceState()}
+}
+
+// NewTestElasticService is newTestElasticService for the tests of package database_test
+var NewTestElasticService = newTestElasticService
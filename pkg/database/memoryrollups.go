@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"kafka-log-processor/pkg/models"
+	"sort"
+	"time"
+)
+
+// AddDailyRollups saves rollups, rollups of the same day and block are replaced
+func (ms *MemoryStore) AddDailyRollups(ctx context.Context, rollups []models.BlockActivity) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.addRollups(rollups)
+	return nil
+}
+
+// ReplaceDailyRollups replaces rollups of days from from to to with rollups at once
+func (ms *MemoryStore) ReplaceDailyRollups(ctx context.Context, from time.Time, to time.Time, rollups []models.BlockActivity) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	keptRollups := ms.rollups[:0]
+	for _, rollup := range ms.rollups {
+		if !rollupInRange(rollup, "", from, to) {
+			keptRollups = append(keptRollups, rollup)
+		}
+	}
+	ms.rollups = keptRollups
+	ms.addRollups(rollups)
+	return nil
+}
+
+// addRollups saves rollups replacing the ones of the same day and block, mutex must be locked
+func (ms *MemoryStore) addRollups(rollups []models.BlockActivity) {
+	for _, rollup := range rollups {
+		replaced := false
+		for i, savedRollup := range ms.rollups {
+			if savedRollup.Date.Equal(rollup.Date) && savedRollup.CourseID == rollup.CourseID && savedRollup.BlockID == rollup.BlockID {
+				ms.rollups[i] = rollup
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			ms.rollups = append(ms.rollups, rollup)
+		}
+	}
+	sort.SliceStable(ms.rollups, func(i, j int) bool {
+		if !ms.rollups[i].Date.Equal(ms.rollups[j].Date) {
+			return ms.rollups[i].Date.Before(ms.rollups[j].Date)
+		}
+		if ms.rollups[i].CourseID != ms.rollups[j].CourseID {
+			return ms.rollups[i].CourseID < ms.rollups[j].CourseID
+		}
+		return ms.rollups[i].BlockID < ms.rollups[j].BlockID
+	})
+}
+
+// GetDailyRollups returns rollups of course courseID (of all courses if it is empty) of days
+// from from to to sorted by date, course and block. Zero from and to aren't limits.
+func (ms *MemoryStore) GetDailyRollups(ctx context.Context, courseID string, from time.Time, to time.Time) ([]models.BlockActivity, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	rollups := make([]models.BlockActivity, 0)
+	for _, rollup := range ms.rollups {
+		if rollupInRange(rollup, courseID, from, to) {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups, nil
+}
+
+func rollupInRange(rollup models.BlockActivity, courseID string, from time.Time, to time.Time) bool {
+	return (courseID == "" || rollup.CourseID == courseID) &&
+		(from.IsZero() || !rollup.Date.Before(from)) &&
+		(to.IsZero() || rollup.Date.Before(to))
+}
+
+// GetRollupWatermark returns the time all the rollups are computed before, zero if there are no rollups
+func (ms *MemoryStore) GetRollupWatermark(ctx context.Context) (time.Time, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	return ms.rollupWatermark, nil
+}
+
+// SetRollupWatermark saves the time all the rollups are computed before
+func (ms *MemoryStore) SetRollupWatermark(ctx context.Context, watermark time.Time) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.rollupWatermark = watermark
+	return nil
+}
@@ -0,0 +1,682 @@
+package database
+
+// In-memory EventStore implementation. Documents are kept as JSON,
+// the same way ElasticSearch keeps them, so searches use the same field names.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"sort"
+	"sync"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+// MemoryStore keeps all the data in memory
+type MemoryStore struct {
+	mutex      sync.RWMutex
+	structures []edxstruct.Course
+	documents  map[string][]memoryDocument
+	lastID     int
+
+	rollups         []models.BlockActivity
+	rollupWatermark time.Time
+}
+
+type memoryDocument struct {
+	id        string
+	index     string
+	source    json.RawMessage
+	fields    map[string]interface{}
+	eventTime time.Time
+}
+
+// NewMemoryStore constructs empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{documents: map[string][]memoryDocument{}}
+}
+
+// CreateVideoIndexIfNotExists does nothing, indices are created on first insertion
+func (ms *MemoryStore) CreateVideoIndexIfNotExists(ctx context.Context) error { return nil }
+
+// CreateBookmarksIndexIfNotExists does nothing, indices are created on first insertion
+func (ms *MemoryStore) CreateBookmarksIndexIfNotExists(ctx context.Context) error { return nil }
+
+// CreateLinksIndexIfNotExists does nothing, indices are created on first insertion
+func (ms *MemoryStore) CreateLinksIndexIfNotExists(ctx context.Context) error { return nil }
+
+// CreateProblemIndexIfNotExists does nothing, indices are created on first insertion
+func (ms *MemoryStore) CreateProblemIndexIfNotExists(ctx context.Context) error { return nil }
+
+// CreateSequentialIndexIfNotExists does nothing, indices are created on first insertion
+func (ms *MemoryStore) CreateSequentialIndexIfNotExists(ctx context.Context) error { return nil }
+
+// CreateEnrollmentIndexIfNotExists does nothing, indices are created on first insertion
+func (ms *MemoryStore) CreateEnrollmentIndexIfNotExists(ctx context.Context) error { return nil }
+
+// CreateStructureIndexIfNotExists does nothing, indices are created on first insertion
+func (ms *MemoryStore) CreateStructureIndexIfNotExists(ctx context.Context) error { return nil }
+
+// CreateRollupIndexIfNotExists does nothing, rollups are kept in a slice
+func (ms *MemoryStore) CreateRollupIndexIfNotExists(ctx context.Context) error { return nil }
+
+// AddCourseStructure adds information of course structure
+func (ms *MemoryStore) AddCourseStructure(ctx context.Context, course edxstruct.Course) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.structures = append(ms.structures, course)
+	return nil
+}
+
+// AddVideoEventDescription adds information of a parsed log
+func (ms *MemoryStore) AddVideoEventDescription(ctx context.Context, videoEventDescription models.VideoEventDescription) error {
+	return ms.addDocument(VideoEventDescriptionIndexName, videoEventDescription)
+}
+
+// AddBooksmarkEventDescription adds information of a parsed log
+func (ms *MemoryStore) AddBooksmarkEventDescription(ctx context.Context, booksmarkEventDescription models.BookmarksEventDescription) error {
+	return ms.addDocument(BookmarsEventDescriptionIndexName, booksmarkEventDescription)
+}
+
+// AddLinkEventDescription adds information of a parsed log
+func (ms *MemoryStore) AddLinkEventDescription(ctx context.Context, linkEventDescription models.LinkEventDescription) error {
+	return ms.addDocument(LinkEventDescriptionIndexName, linkEventDescription)
+}
+
+// AddProblemEventDescription adds information of a parsed log
+func (ms *MemoryStore) AddProblemEventDescription(ctx context.Context, problemEventDescription models.ProblemEventDescription) error {
+	return ms.addDocument(ProblemEventDescriptionIndexName, problemEventDescription)
+}
+
+// AddSequentialMoveEventDescription adds information of a parsed log
+func (ms *MemoryStore) AddSequentialMoveEventDescription(ctx context.Context, sequentialMoveEventDescription models.SequentialMoveEventDescription) error {
+	return ms.addDocument(SequentialEventDescriptionIndexName, sequentialMoveEventDescription)
+}
+
+// AddEnrollmentEventDescription adds information of a parsed log
+func (ms *MemoryStore) AddEnrollmentEventDescription(ctx context.Context, enrollmentEventDescription models.EnrollmentEventDescription) error {
+	return ms.addDocument(EnrollmentEventDescriptionIndexName, enrollmentEventDescription)
+}
+
+// AddEventDescriptions adds events of index indexName
+func (ms *MemoryStore) AddEventDescriptions(ctx context.Context, indexName string, eventDescriptions []interface{}) error {
+	if _, ok := EventDocumentTypes[indexName]; !ok {
+		return errors.New("Unknown event index " + indexName)
+	}
+	for _, eventDescription := range eventDescriptions {
+		if err := ms.addDocument(indexName, eventDescription); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refresh does nothing, documents of MemoryStore are searchable right after writing
+func (ms *MemoryStore) Refresh(ctx context.Context, indexName string) error {
+	return nil
+}
+
+// CountDocuments returns number of documents in index indexName
+func (ms *MemoryStore) CountDocuments(ctx context.Context, indexName string) (int64, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	if indexName == CourseStructureIndexName {
+		return int64(len(ms.structures)), nil
+	}
+	if indexName == DailyRollupIndexName {
+		return int64(len(ms.rollups)), nil
+	}
+	return int64(len(ms.documents[indexName])), nil
+}
+
+// GetFirstEventTime returns time of the earliest event of index indexName, zero if it has no events
+func (ms *MemoryStore) GetFirstEventTime(ctx context.Context, indexName string) (time.Time, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	var firstEventTime time.Time
+	for _, document := range ms.documents[indexName] {
+		if !document.eventTime.IsZero() && (firstEventTime.IsZero() || document.eventTime.Before(firstEventTime)) {
+			firstEventTime = document.eventTime
+		}
+	}
+	return firstEventTime, nil
+}
+
+// GetIndexMapping returns mappings of the current version of index indexName, memory documents follow them
+func (ms *MemoryStore) GetIndexMapping(ctx context.Context, indexName string) (json.RawMessage, error) {
+	return definitionMapping(indexName)
+}
+
+func (ms *MemoryStore) addDocument(indexName string, document interface{}) error {
+	source, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(source, &fields); err != nil {
+		return err
+	}
+	var eventTime time.Time
+	if eventTimeField, ok := fields["event_time"].(string); ok {
+		eventTime, _ = models.ParseEventTime(eventTimeField)
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.lastID++
+	ms.documents[indexName] = append(ms.documents[indexName], memoryDocument{
+		id:        fmt.Sprintf("%020d", ms.lastID),
+		index:     indexName,
+		source:    source,
+		fields:    fields,
+		eventTime: eventTime,
+	})
+	return nil
+}
+
+// findDocuments returns documents of indices indexNames that have all the filters field values
+func (ms *MemoryStore) findDocuments(indexNames []string, filters map[string]interface{}) []memoryDocument {
+	return ms.findFilteredDocuments(indexNames, filters, EventFilter{})
+}
+
+// findFilteredDocuments returns documents of indices indexNames that have all the filters field values
+// and match eventFilter
+func (ms *MemoryStore) findFilteredDocuments(indexNames []string, filters map[string]interface{}, eventFilter EventFilter) []memoryDocument {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	result := make([]memoryDocument, 0)
+	for _, indexName := range indexNames {
+		for _, document := range ms.documents[indexName] {
+			if document.matches(filters) && document.matchesEventFilter(eventFilter) {
+				result = append(result, document)
+			}
+		}
+	}
+	return result
+}
+
+func (document memoryDocument) matches(filters map[string]interface{}) bool {
+	for fieldName, fieldValue := range filters {
+		if fmt.Sprint(document.fields[fieldName]) != fmt.Sprint(fieldValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesEventFilter tells if document matches filter. Documents without platform are web events.
+func (document memoryDocument) matchesEventFilter(filter EventFilter) bool {
+	if !filter.From.IsZero() && document.eventTime.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !document.eventTime.Before(filter.To) {
+		return false
+	}
+	if filter.Usernames != nil && !containsString(filter.Usernames, fmt.Sprint(document.fields["username"])) {
+		return false
+	}
+	if len(filter.Platforms) > 0 {
+		platform, _ := document.fields["platform"].(string)
+		if platform == "" {
+			platform = models.WebPlatform
+		}
+		if !containsString(filter.Platforms, platform) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortDocumentsByEventTime(documents []memoryDocument) {
+	sort.SliceStable(documents, func(i, j int) bool {
+		if !documents[i].eventTime.Equal(documents[j].eventTime) {
+			return documents[i].eventTime.Before(documents[j].eventTime)
+		}
+		if documents[i].index != documents[j].index {
+			return documents[i].index < documents[j].index
+		}
+		return documents[i].id < documents[j].id
+	})
+}
+
+func documentsToUserCourseEvents(documents []memoryDocument) ([]UserCourseEvent, error) {
+	result := make([]UserCourseEvent, 0, len(documents))
+	for _, document := range documents {
+		var event UserCourseEvent
+		if err := json.Unmarshal(document.source, &event); err != nil {
+			return nil, err
+		}
+		event.Index = document.index
+		event.Source = document.source
+		result = append(result, event)
+	}
+	return result, nil
+}
+
+func documentsToVideoEvents(documents []memoryDocument) ([]models.VideoEventDescription, error) {
+	result := make([]models.VideoEventDescription, 0, len(documents))
+	for _, document := range documents {
+		var videoEvent models.VideoEventDescription
+		if err := json.Unmarshal(document.source, &videoEvent); err != nil {
+			return nil, err
+		}
+		result = append(result, videoEvent)
+	}
+	return result, nil
+}
+
+// GetCourseStructure gets structure for course with course code = courseCode
+func (ms *MemoryStore) GetCourseStructure(ctx context.Context, courseCode string) (edxstruct.Course, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	for _, course := range ms.structures {
+		if course.CourseCode == courseCode {
+			return course, nil
+		}
+	}
+	return edxstruct.Course{}, notFoundf("No structures for course %v was found", courseCode)
+}
+
+// GetUserVideoEvents returns all video events for specific user and a video
+func (ms *MemoryStore) GetUserVideoEvents(ctx context.Context, username string, videoID string) ([]models.VideoEventDescription, error) {
+	return documentsToVideoEvents(ms.findDocuments(
+		[]string{VideoEventDescriptionIndexName},
+		map[string]interface{}{"username": username, "video_id": videoID},
+	))
+}
+
+// GetUserVideoAndProblemEventsTimes gets all video events and problem events logs for user with username and gets
+// their IDs and timestamps
+func (ms *MemoryStore) GetUserVideoAndProblemEventsTimes(ctx context.Context, username string, courseID string) ([]UserProblemAndVideoEventsIDsAndTime, error) {
+	documents := ms.findDocuments(
+		[]string{VideoEventDescriptionIndexName, ProblemEventDescriptionIndexName},
+		map[string]interface{}{"username": username, "course_id": courseID},
+	)
+	result := make([]UserProblemAndVideoEventsIDsAndTime, 0, len(documents))
+	for _, document := range documents {
+		var eventIDsAndTime UserProblemAndVideoEventsIDsAndTime
+		if err := json.Unmarshal(document.source, &eventIDsAndTime); err != nil {
+			return nil, err
+		}
+		result = append(result, eventIDsAndTime)
+	}
+	return result, nil
+}
+
+// GetUserCourseEventsSortedByTime gets events of user with username in course courseID
+// matching filter from every activity index and sorts them by ascending event time.
+func (ms *MemoryStore) GetUserCourseEventsSortedByTime(ctx context.Context, username string, courseID string, filter EventFilter) ([]UserCourseEvent, error) {
+	documents := ms.findFilteredDocuments(ActivityIndexNames, map[string]interface{}{"username": username, "course_id": courseID}, filter)
+	sortDocumentsByEventTime(documents)
+	return documentsToUserCourseEvents(documents)
+}
+
+// GetAllCourseCodesWithStructure returns all course codes of stored course structures
+func (ms *MemoryStore) GetAllCourseCodesWithStructure(ctx context.Context) ([]string, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	result := make([]string, 0, len(ms.structures))
+	for _, course := range ms.structures {
+		result = append(result, course.CourseCode)
+	}
+	return result, nil
+}
+
+// ScanCourseStructures passes every stored course structure to handleStructure in the order they were added
+func (ms *MemoryStore) ScanCourseStructures(ctx context.Context, handleStructure func(course edxstruct.Course) error) error {
+	ms.mutex.RLock()
+	structures := append([]edxstruct.Course{}, ms.structures...)
+	ms.mutex.RUnlock()
+	for _, course := range structures {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := handleStructure(course); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllCourseIDsWithStructureAndLogs gets all course ids met in logs that have course structure.
+// The returned type is in "course-v1:org+CourseCode+CourseRun" notation.
+func (ms *MemoryStore) GetAllCourseIDsWithStructureAndLogs(ctx context.Context) ([]string, error) {
+	return getAllCourseIDsWithStructureAndLogs(ctx, ms)
+}
+
+// GetSortedVideoEventsForVideo gets video events matching filter where video_id is videoID and
+// sorts them by ascending video time.
+func (ms *MemoryStore) GetSortedVideoEventsForVideo(ctx context.Context, videoID string, filter EventFilter) ([]models.VideoEventDescription, error) {
+	videoEvents, err := documentsToVideoEvents(ms.findFilteredDocuments(
+		[]string{VideoEventDescriptionIndexName},
+		map[string]interface{}{"video_id": videoID},
+		filter,
+	))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(videoEvents, func(i, j int) bool {
+		return videoEvents[i].VideoTime < videoEvents[j].VideoTime
+	})
+	return videoEvents, nil
+}
+
+// GetCourseBookmarkEventsSortedByTime gets bookmark events of course courseID matching filter and
+// sorts them by ascending event time.
+func (ms *MemoryStore) GetCourseBookmarkEventsSortedByTime(ctx context.Context, courseID string, filter EventFilter) ([]models.BookmarksEventDescription, error) {
+	documents := ms.findFilteredDocuments([]string{BookmarsEventDescriptionIndexName}, map[string]interface{}{"course_id": courseID}, filter)
+	sortDocumentsByEventTime(documents)
+	result := make([]models.BookmarksEventDescription, 0, len(documents))
+	for _, document := range documents {
+		var bookmarksEvent models.BookmarksEventDescription
+		if err := json.Unmarshal(document.source, &bookmarksEvent); err != nil {
+			return nil, err
+		}
+		result = append(result, bookmarksEvent)
+	}
+	return result, nil
+}
+
+// GetUserTimeline gets a page of events of the user in the course sorted by ascending
+// event time. The second returned value is the cursor of the next page, it is empty
+// if there are no more events.
+func (ms *MemoryStore) GetUserTimeline(ctx context.Context, timelineQuery TimelineQuery) ([]UserCourseEvent, string, error) {
+	indexNames := EventDescriptionIndexNames
+	if len(timelineQuery.Families) > 0 {
+		indexNames = make([]string, 0, len(timelineQuery.Families))
+		for _, family := range timelineQuery.Families {
+			indexName, ok := EventFamilyIndexNames[family]
+			if !ok {
+				return nil, "", fmt.Errorf("Unknown event family %v", family)
+			}
+			indexNames = append(indexNames, indexName)
+		}
+	}
+
+	eventFilter := timelineQuery.eventFilter()
+	eventFilter.Usernames = timelineQuery.storedUsernames()
+	documents := ms.findFilteredDocuments(indexNames, map[string]interface{}{
+		"course_id": timelineQuery.CourseID,
+	}, eventFilter)
+	sortDocumentsByEventTime(documents)
+
+	var after *memoryDocument
+	if timelineQuery.Cursor != "" {
+		searchAfter, err := decodeSearchAfterCursor(timelineQuery.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after, err = memoryDocumentFromSearchAfter(searchAfter)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	page := make([]memoryDocument, 0, timelineQuery.Size)
+	for _, document := range documents {
+		if after != nil && !documentIsAfter(document, *after) {
+			continue
+		}
+		if len(page) == timelineQuery.Size {
+			break
+		}
+		page = append(page, document)
+	}
+
+	events, err := documentsToUserCourseEvents(page)
+	if err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(page) == timelineQuery.Size && timelineQuery.Size > 0 {
+		last := page[len(page)-1]
+		nextCursor, err = encodeSearchAfterCursor([]interface{}{last.eventTime.UnixNano(), last.index, last.id})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return events, nextCursor, nil
+}
+
+// ScanCourseEvents calls handleEvent for every event matching query.
+// Events are sorted by course ID and ascending event time.
+func (ms *MemoryStore) ScanCourseEvents(ctx context.Context, query CourseEventsQuery, handleEvent func(event CourseEvent) error) error {
+	if _, ok := EventDocumentTypes[query.IndexName]; !ok {
+		return errors.New("Unknown event index " + query.IndexName)
+	}
+	filters := map[string]interface{}{}
+	if query.CourseID != "" {
+		filters["course_id"] = query.CourseID
+	}
+	documents := ms.findFilteredDocuments([]string{query.IndexName}, filters, query.EventFilter)
+	sortDocumentsByEventTime(documents)
+	sort.SliceStable(documents, func(i, j int) bool {
+		return fmt.Sprint(documents[i].fields["course_id"]) < fmt.Sprint(documents[j].fields["course_id"])
+	})
+
+	for _, document := range documents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		event, err := newCourseEvent(query.IndexName, document.source)
+		if err != nil {
+			return err
+		}
+		if err = handleEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountUserEvents returns numbers of events of every learner in course courseID of index indexName
+// matching filter
+func (ms *MemoryStore) CountUserEvents(ctx context.Context, indexName string, courseID string, filter EventFilter) (map[string]int64, error) {
+	if _, ok := EventDocumentTypes[indexName]; !ok {
+		return nil, errors.New("Unknown event index " + indexName)
+	}
+	result := map[string]int64{}
+	for _, document := range ms.findFilteredDocuments([]string{indexName}, map[string]interface{}{"course_id": courseID}, filter) {
+		result[fmt.Sprint(document.fields["username"])]++
+	}
+	return result, nil
+}
+
+// EraseUserEvents deletes all the events of users with usernames from index indexName.
+// Events are only counted if dryRun is true.
+func (ms *MemoryStore) EraseUserEvents(ctx context.Context, indexName string, usernames []string, dryRun bool) (ErasureResult, error) {
+	if _, ok := EventDocumentTypes[indexName]; !ok {
+		return ErasureResult{}, errors.New("Unknown event index " + indexName)
+	}
+	erasedUsernames := map[string]bool{}
+	for _, username := range usernames {
+		erasedUsernames[username] = true
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var result ErasureResult
+	keptDocuments := make([]memoryDocument, 0, len(ms.documents[indexName]))
+	for _, document := range ms.documents[indexName] {
+		if !erasedUsernames[fmt.Sprint(document.fields["username"])] {
+			keptDocuments = append(keptDocuments, document)
+			continue
+		}
+		result.Matched++
+		if dryRun {
+			keptDocuments = append(keptDocuments, document)
+			result.Remaining++
+		} else {
+			result.Deleted++
+		}
+	}
+	ms.documents[indexName] = keptDocuments
+	return result, nil
+}
+
+// RenameUsers replaces usernames of events in index indexName, renames map old usernames
+// to new ones. Number of updated events is returned.
+func (ms *MemoryStore) RenameUsers(ctx context.Context, indexName string, renames map[string]string) (int64, error) {
+	if _, ok := EventDocumentTypes[indexName]; !ok {
+		return 0, errors.New("Unknown event index " + indexName)
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var updated int64
+	for i, document := range ms.documents[indexName] {
+		newUsername, ok := renames[fmt.Sprint(document.fields["username"])]
+		if !ok {
+			continue
+		}
+		var source map[string]interface{}
+		if err := json.Unmarshal(document.source, &source); err != nil {
+			return updated, err
+		}
+		source["username"] = newUsername
+		updatedSource, err := json.Marshal(source)
+		if err != nil {
+			return updated, err
+		}
+		document.fields["username"] = newUsername
+		document.source = updatedSource
+		ms.documents[indexName][i] = document
+		updated++
+	}
+	return updated, nil
+}
+
+// memoryDocumentFromSearchAfter returns document of the cursor position. Cursors of MemoryStore
+// have event time in nanoseconds, as precise as documents are sorted.
+func memoryDocumentFromSearchAfter(searchAfter []interface{}) (*memoryDocument, error) {
+	if len(searchAfter) != 3 {
+		return nil, ErrInvalidCursor
+	}
+	eventTimeNumber, ok := searchAfter[0].(json.Number)
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	eventTimeNanos, err := eventTimeNumber.Int64()
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	index, indexOk := searchAfter[1].(string)
+	id, idOk := searchAfter[2].(string)
+	if !indexOk || !idOk {
+		return nil, ErrInvalidCursor
+	}
+	return &memoryDocument{eventTime: time.Unix(0, eventTimeNanos), index: index, id: id}, nil
+}
+
+// documentIsAfter tells if document is after the cursor position in the order of sortDocumentsByEventTime
+func documentIsAfter(document memoryDocument, after memoryDocument) bool {
+	if !document.eventTime.Equal(after.eventTime) {
+		return document.eventTime.After(after.eventTime)
+	}
+	if document.index != after.index {
+		return document.index > after.index
+	}
+	return document.id > after.id
+}
+
+// GetUniqueStringFieldValuesInIndex returns all possible values of field fieldName in index indexName
+func (ms *MemoryStore) GetUniqueStringFieldValuesInIndex(ctx context.Context, indexName string, fieldName string) ([]string, error) {
+	return ms.GetUniqueStringFieldValuesInIndexWithFilter(ctx, indexName, fieldName, "", nil)
+}
+
+// GetUniqueStringFieldValuesInIndexWithFilter is a GetUniqueStringFieldValuesInIndex but with ability to filter the field filteredFieldName
+func (ms *MemoryStore) GetUniqueStringFieldValuesInIndexWithFilter(ctx context.Context, indexName string, fieldName string, filteredFieldName string, filteredFieldValue interface{}) ([]string, error) {
+	filters := map[string]interface{}{}
+	if filteredFieldName != "" {
+		filters[filteredFieldName] = filteredFieldValue
+	}
+	counts, err := countStringFieldValues(ms.findDocuments([]string{indexName}, filters), fieldName, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, count.Value)
+	}
+	return result, nil
+}
+
+// GetStringFieldValuesCountsWithFilters returns size most frequent values of field fieldName in index indexName
+// and numbers of documents with them. Only documents that have all the filters field values and match
+// eventFilter are counted.
+func (ms *MemoryStore) GetStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) ([]FieldValueCount, error) {
+	return countStringFieldValues(ms.findFilteredDocuments([]string{indexName}, filters, eventFilter), fieldName, size)
+}
+
+// GetNestedStringFieldValuesCountsWithFilters groups documents of index indexName by field groupFieldName and
+// returns size most frequent values of field fieldName within every group. Only documents that have all the
+// filters field values and match eventFilter are counted.
+func (ms *MemoryStore) GetNestedStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, groupFieldName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) (map[string][]FieldValueCount, error) {
+	groups := map[string][]memoryDocument{}
+	for _, document := range ms.findFilteredDocuments([]string{indexName}, filters, eventFilter) {
+		fieldValue, ok := document.fields[groupFieldName]
+		if !ok || fieldValue == nil {
+			continue
+		}
+		groupValue, ok := fieldValue.(string)
+		if !ok {
+			return nil, fmt.Errorf("Field %v should be a keyword", groupFieldName)
+		}
+		groups[groupValue] = append(groups[groupValue], document)
+	}
+
+	result := map[string][]FieldValueCount{}
+	for groupValue, documents := range groups {
+		counts, err := countStringFieldValues(documents, fieldName, size)
+		if err != nil {
+			return nil, err
+		}
+		result[groupValue] = counts
+	}
+	return result, nil
+}
+
+// countStringFieldValues works as terms aggregation: it returns size (all if size is 0) most frequent
+// values of the field. Empty strings are counted as ElasticSearch keywords do, missing values aren't.
+func countStringFieldValues(documents []memoryDocument, fieldName string, size int) ([]FieldValueCount, error) {
+	counts := map[string]int64{}
+	for _, document := range documents {
+		fieldValue, ok := document.fields[fieldName]
+		if !ok || fieldValue == nil {
+			continue
+		}
+		stringValue, ok := fieldValue.(string)
+		if !ok {
+			return nil, fmt.Errorf("Field %v should be a keyword", fieldName)
+		}
+		counts[stringValue]++
+	}
+
+	result := make([]FieldValueCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, FieldValueCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	if size > 0 && len(result) > size {
+		result = result[:size]
+	}
+	return result, nil
+}
@@ -2,7 +2,10 @@ package database
 
 // Search results for searches in elasticsearches.go
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // UserProblemAndVideoEventsIDsAndTime is a model for search
 // result parsing
@@ -11,3 +14,31 @@ type UserProblemAndVideoEventsIDsAndTime struct {
 	VideoID   string    `json:"video_id"`
 	Time      time.Time `json:"event_time"`
 }
+
+// UserCourseEvent is a model for search result parsing of any
+// event description index. Index is the name of the index the event
+// was found in, Source is the whole found document.
+type UserCourseEvent struct {
+	Index         string          `json:"-"`
+	Source        json.RawMessage `json:"-"`
+	EventType     string          `json:"event_type"`
+	Time          time.Time       `json:"event_time"`
+	ProblemID     string          `json:"problem_id"`
+	VideoID       string          `json:"video_id"`
+	BookmarkID    string          `json:"id"`
+	BlockID       string          `json:"block_id"`
+	Old           int             `json:"old"`
+	New           int             `json:"new"`
+	SequentialID  string          `json:"sequential_id"`
+	NewVerticalID string          `json:"new_vertical_id"`
+	CurrentURL    string          `json:"current_url"`
+	TargetURL     string          `json:"target_url"`
+	TargetBlockID string          `json:"target_block_id"`
+}
+
+// FieldValueCount is a model for terms aggregation results:
+// field value and number of documents with it
+type FieldValueCount struct {
+	Value string
+	Count int64
+}
@@ -0,0 +1,140 @@
+package database
+
+// Daily rollups in SQLite. Rollups are rows of "daily_rollups" table with the
+// whole document in "source" column, the watermark is a row of "rollup_state".
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"strings"
+	"time"
+)
+
+const rollupWatermarkName = "watermark"
+
+// CreateRollupIndexIfNotExists creates tables for daily rollups and their watermark
+func (ss *SQLiteStore) CreateRollupIndexIfNotExists(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS daily_rollups (
+	date_ms INTEGER,
+	course_id TEXT,
+	block_id TEXT,
+	source TEXT,
+	PRIMARY KEY (date_ms, course_id, block_id)
+);
+CREATE INDEX IF NOT EXISTS daily_rollups_course_id ON daily_rollups (course_id, date_ms);
+CREATE TABLE IF NOT EXISTS rollup_state (
+	name TEXT PRIMARY KEY,
+	value TEXT
+);
+`)
+	return err
+}
+
+// AddDailyRollups saves rollups in a single transaction, rollups of the same day and block are replaced
+func (ss *SQLiteStore) AddDailyRollups(ctx context.Context, rollups []models.BlockActivity) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = insertRollups(ctx, tx, rollups); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceDailyRollups replaces rollups of days from from to to with rollups in a single transaction
+func (ss *SQLiteStore) ReplaceDailyRollups(ctx context.Context, from time.Time, to time.Time, rollups []models.BlockActivity) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	where, args := rollupsWhereClause("", from, to)
+	if _, err = tx.ExecContext(ctx, "DELETE FROM daily_rollups"+where, args...); err != nil {
+		return err
+	}
+	if err = insertRollups(ctx, tx, rollups); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertRollups(ctx context.Context, execer sqlExecer, rollups []models.BlockActivity) error {
+	for _, rollup := range rollups {
+		source, err := json.Marshal(rollup)
+		if err != nil {
+			return err
+		}
+		_, err = execer.ExecContext(
+			ctx,
+			"INSERT OR REPLACE INTO daily_rollups (date_ms, course_id, block_id, source) VALUES (?, ?, ?, ?)",
+			toMillis(rollup.Date), rollup.CourseID, rollup.BlockID, string(source),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDailyRollups returns rollups of course courseID (of all courses if it is empty) of days
+// from from to to sorted by date, course and block. Zero from and to aren't limits.
+func (ss *SQLiteStore) GetDailyRollups(ctx context.Context, courseID string, from time.Time, to time.Time) ([]models.BlockActivity, error) {
+	where, args := rollupsWhereClause(courseID, from, to)
+	rollups := make([]models.BlockActivity, 0)
+	err := ss.querySources(ctx, "SELECT source FROM daily_rollups"+where+" ORDER BY date_ms, course_id, block_id", args, func(source []byte) error {
+		var rollup models.BlockActivity
+		if err := json.Unmarshal(source, &rollup); err != nil {
+			return err
+		}
+		rollups = append(rollups, rollup)
+		return nil
+	})
+	return rollups, err
+}
+
+func rollupsWhereClause(courseID string, from time.Time, to time.Time) (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	args := make([]interface{}, 0)
+	if courseID != "" {
+		conditions = append(conditions, "course_id = ?")
+		args = append(args, courseID)
+	}
+	if !from.IsZero() {
+		conditions = append(conditions, "date_ms >= ?")
+		args = append(args, toMillis(from))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "date_ms < ?")
+		args = append(args, toMillis(to))
+	}
+	return fmt.Sprintf(" WHERE %v", strings.Join(conditions, " AND ")), args
+}
+
+// GetRollupWatermark returns the time all the rollups are computed before, zero if there are no rollups
+func (ss *SQLiteStore) GetRollupWatermark(ctx context.Context) (time.Time, error) {
+	var value string
+	err := ss.db.QueryRowContext(ctx, "SELECT value FROM rollup_state WHERE name = ?", rollupWatermarkName).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// SetRollupWatermark saves the time all the rollups are computed before
+func (ss *SQLiteStore) SetRollupWatermark(ctx context.Context, watermark time.Time) error {
+	_, err := ss.db.ExecContext(
+		ctx,
+		"INSERT OR REPLACE INTO rollup_state (name, value) VALUES (?, ?)",
+		rollupWatermarkName, watermark.UTC().Format(time.RFC3339),
+	)
+	return err
+}
@@ -0,0 +1,944 @@
+package database
+
+// EventStore implementation on an embedded SQLite file for small deployments
+// without ElasticSearch. Every event index is a table with a column for every
+// event description field, the whole document in "source" column and insertion
+// order in "row_id" column.
+// Terms aggregations are GROUP BY queries.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+	_ "modernc.org/sqlite" // sqlite is a cgo-free SQLite driver
+)
+
+// SQLiteStore keeps all the data in a SQLite file
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+type sqliteTable struct {
+	name    string
+	columns map[string]string
+	indexes [][]string
+}
+
+// Tables of the event indices. Columns are named after JSON fields of the event descriptions.
+var sqliteTables = map[string]sqliteTable{
+	VideoEventDescriptionIndexName: {
+		name: "video_events",
+		columns: map[string]string{
+			"event_time": "TEXT", "video_time": "REAL", "username": "TEXT", "video_id": "TEXT",
+			"event_type": "TEXT", "course_id": "TEXT", "platform": "TEXT",
+		},
+		indexes: [][]string{{"course_id"}, {"username", "course_id"}, {"video_id", "video_time"}, {"event_time_ms"}},
+	},
+	ProblemEventDescriptionIndexName: {
+		name: "problem_events",
+		columns: map[string]string{
+			"event_time": "TEXT", "username": "TEXT", "problem_id": "TEXT", "event_type": "TEXT",
+			"weighted_earned": "REAL", "weighted_possible": "REAL", "course_id": "TEXT", "platform": "TEXT",
+		},
+		indexes: [][]string{{"course_id"}, {"username", "course_id"}, {"problem_id"}, {"event_time_ms"}},
+	},
+	SequentialEventDescriptionIndexName: {
+		name: "sequential_events",
+		columns: map[string]string{
+			"event_time": "TEXT", "username": "TEXT", "old": "INTEGER", "event_type": "TEXT", "new": "INTEGER",
+			"course_id": "TEXT", "sequential_id": "TEXT", "old_vertical_id": "TEXT", "old_vertical_name": "TEXT",
+			"new_vertical_id": "TEXT", "new_vertical_name": "TEXT", "platform": "TEXT",
+		},
+		indexes: [][]string{{"course_id"}, {"username", "course_id"}, {"event_time_ms"}},
+	},
+	BookmarsEventDescriptionIndexName: {
+		name: "bookmarks_events",
+		columns: map[string]string{
+			"event_time": "TEXT", "username": "TEXT", "id": "TEXT", "event_type": "TEXT", "is_added": "INTEGER",
+			"course_id": "TEXT", "block_id": "TEXT", "block_name": "TEXT", "platform": "TEXT",
+		},
+		indexes: [][]string{{"course_id"}, {"username", "course_id"}, {"event_time_ms"}},
+	},
+	LinkEventDescriptionIndexName: {
+		name: "link_events",
+		columns: map[string]string{
+			"event_time": "TEXT", "username": "TEXT", "event_type": "TEXT", "current_url": "TEXT", "target_url": "TEXT",
+			"course_id": "TEXT", "link_type": "TEXT", "target_section": "TEXT", "target_domain": "TEXT",
+			"target_path": "TEXT", "target_resource": "TEXT", "target_block_id": "TEXT", "target_block_name": "TEXT",
+			"current_block_id": "TEXT", "current_block_name": "TEXT", "platform": "TEXT",
+		},
+		indexes: [][]string{{"course_id", "link_type"}, {"username", "course_id"}, {"event_time_ms"}},
+	},
+	EnrollmentEventDescriptionIndexName: {
+		name: "enrollment_events",
+		columns: map[string]string{
+			"event_time": "TEXT", "username": "TEXT", "user_id": "INTEGER", "event_type": "TEXT", "mode": "TEXT",
+			"is_active": "INTEGER", "course_id": "TEXT", "platform": "TEXT",
+		},
+		indexes: [][]string{{"course_id"}, {"username", "course_id"}, {"event_time_ms"}},
+	},
+}
+
+// NewSQLiteStore opens (or creates) SQLite database in file fileName and creates all the tables
+func NewSQLiteStore(fileName string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", fileName+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=secure_delete(on)")
+	if err != nil {
+		return nil, err
+	}
+	store := &SQLiteStore{db: db}
+	ctx := context.Background()
+	if err = store.CreateStructureIndexIfNotExists(ctx); err != nil {
+		return nil, err
+	}
+	if err = store.CreateRollupIndexIfNotExists(ctx); err != nil {
+		return nil, err
+	}
+	for indexName := range sqliteTables {
+		if err = store.createTableIfNotExists(ctx, indexName); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// CreateVideoIndexIfNotExists creates table for video events
+func (ss *SQLiteStore) CreateVideoIndexIfNotExists(ctx context.Context) error {
+	return ss.createTableIfNotExists(ctx, VideoEventDescriptionIndexName)
+}
+
+// CreateBookmarksIndexIfNotExists creates table for bookmarks events
+func (ss *SQLiteStore) CreateBookmarksIndexIfNotExists(ctx context.Context) error {
+	return ss.createTableIfNotExists(ctx, BookmarsEventDescriptionIndexName)
+}
+
+// CreateLinksIndexIfNotExists creates table for link events
+func (ss *SQLiteStore) CreateLinksIndexIfNotExists(ctx context.Context) error {
+	return ss.createTableIfNotExists(ctx, LinkEventDescriptionIndexName)
+}
+
+// CreateProblemIndexIfNotExists creates table for problem events
+func (ss *SQLiteStore) CreateProblemIndexIfNotExists(ctx context.Context) error {
+	return ss.createTableIfNotExists(ctx, ProblemEventDescriptionIndexName)
+}
+
+// CreateSequentialIndexIfNotExists creates table for sequential events
+func (ss *SQLiteStore) CreateSequentialIndexIfNotExists(ctx context.Context) error {
+	return ss.createTableIfNotExists(ctx, SequentialEventDescriptionIndexName)
+}
+
+// CreateEnrollmentIndexIfNotExists creates table for enrollment events
+func (ss *SQLiteStore) CreateEnrollmentIndexIfNotExists(ctx context.Context) error {
+	return ss.createTableIfNotExists(ctx, EnrollmentEventDescriptionIndexName)
+}
+
+// CreateStructureIndexIfNotExists creates table for course structures
+func (ss *SQLiteStore) CreateStructureIndexIfNotExists(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS course_structures (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	course_code TEXT,
+	source TEXT
+);
+CREATE INDEX IF NOT EXISTS course_structures_course_code ON course_structures (course_code);
+`)
+	return err
+}
+
+// createTableIfNotExists creates table of index indexName with its indexes.
+// Columns added to an existing table later are added to it, they are NULL in old rows.
+func (ss *SQLiteStore) createTableIfNotExists(ctx context.Context, indexName string) error {
+	table := sqliteTables[indexName]
+	columnDefinitions := []string{"row_id INTEGER PRIMARY KEY AUTOINCREMENT", "event_time_ms INTEGER", "source TEXT"}
+	for column, columnType := range table.columns {
+		columnDefinitions = append(columnDefinitions, quoteIdentifier(column)+" "+columnType)
+	}
+	statements := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (%v)", table.name, strings.Join(columnDefinitions, ", "))}
+	existingColumns, err := ss.tableColumns(ctx, table.name)
+	if err != nil {
+		return err
+	}
+	if len(existingColumns) > 0 {
+		for column, columnType := range table.columns {
+			if !existingColumns[column] {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v %v", table.name, quoteIdentifier(column), columnType))
+			}
+		}
+	}
+	for _, indexColumns := range table.indexes {
+		quotedColumns := make([]string, 0, len(indexColumns))
+		for _, column := range indexColumns {
+			quotedColumns = append(quotedColumns, quoteIdentifier(column))
+		}
+		statements = append(statements, fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS %v_%v ON %v (%v)",
+			table.name, strings.Join(indexColumns, "_"), table.name, strings.Join(quotedColumns, ", "),
+		))
+	}
+	for _, statement := range statements {
+		if _, err := ss.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableColumns returns names of the columns of table tableName, none if there is no such table
+func (ss *SQLiteStore) tableColumns(ctx context.Context, tableName string) (map[string]bool, error) {
+	rows, err := ss.db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := map[string]bool{}
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns[column] = true
+	}
+	return columns, rows.Err()
+}
+
+func quoteIdentifier(identifier string) string {
+	return `"` + strings.Replace(identifier, `"`, `""`, -1) + `"`
+}
+
+// AddCourseStructure adds information of course structure
+func (ss *SQLiteStore) AddCourseStructure(ctx context.Context, course edxstruct.Course) error {
+	source, err := json.Marshal(course)
+	if err != nil {
+		return err
+	}
+	_, err = ss.db.ExecContext(ctx, "INSERT INTO course_structures (course_code, source) VALUES (?, ?)", course.CourseCode, string(source))
+	return err
+}
+
+// AddVideoEventDescription adds information of a parsed log
+func (ss *SQLiteStore) AddVideoEventDescription(ctx context.Context, videoEventDescription models.VideoEventDescription) error {
+	return ss.addEvent(ctx, VideoEventDescriptionIndexName, videoEventDescription)
+}
+
+// AddBooksmarkEventDescription adds information of a parsed log
+func (ss *SQLiteStore) AddBooksmarkEventDescription(ctx context.Context, booksmarkEventDescription models.BookmarksEventDescription) error {
+	return ss.addEvent(ctx, BookmarsEventDescriptionIndexName, booksmarkEventDescription)
+}
+
+// AddLinkEventDescription adds information of a parsed log
+func (ss *SQLiteStore) AddLinkEventDescription(ctx context.Context, linkEventDescription models.LinkEventDescription) error {
+	return ss.addEvent(ctx, LinkEventDescriptionIndexName, linkEventDescription)
+}
+
+// AddProblemEventDescription adds information of a parsed log
+func (ss *SQLiteStore) AddProblemEventDescription(ctx context.Context, problemEventDescription models.ProblemEventDescription) error {
+	return ss.addEvent(ctx, ProblemEventDescriptionIndexName, problemEventDescription)
+}
+
+// AddSequentialMoveEventDescription adds information of a parsed log
+func (ss *SQLiteStore) AddSequentialMoveEventDescription(ctx context.Context, sequentialMoveEventDescription models.SequentialMoveEventDescription) error {
+	return ss.addEvent(ctx, SequentialEventDescriptionIndexName, sequentialMoveEventDescription)
+}
+
+// AddEnrollmentEventDescription adds information of a parsed log
+func (ss *SQLiteStore) AddEnrollmentEventDescription(ctx context.Context, enrollmentEventDescription models.EnrollmentEventDescription) error {
+	return ss.addEvent(ctx, EnrollmentEventDescriptionIndexName, enrollmentEventDescription)
+}
+
+// AddEventDescriptions adds events of index indexName in a single transaction
+func (ss *SQLiteStore) AddEventDescriptions(ctx context.Context, indexName string, eventDescriptions []interface{}) error {
+	if _, err := getTable(indexName); err != nil {
+		return err
+	}
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, eventDescription := range eventDescriptions {
+		if err = insertEvent(ctx, tx, indexName, eventDescription); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Refresh does nothing, documents of SQLiteStore are searchable right after commit
+func (ss *SQLiteStore) Refresh(ctx context.Context, indexName string) error {
+	return nil
+}
+
+// CountDocuments returns number of documents in index indexName
+func (ss *SQLiteStore) CountDocuments(ctx context.Context, indexName string) (int64, error) {
+	tableName := "course_structures"
+	if indexName == DailyRollupIndexName {
+		tableName = "daily_rollups"
+	} else if indexName != CourseStructureIndexName {
+		table, err := getTable(indexName)
+		if err != nil {
+			return 0, err
+		}
+		tableName = table.name
+	}
+	var count int64
+	err := ss.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+tableName).Scan(&count)
+	return count, err
+}
+
+// GetFirstEventTime returns time of the earliest event of index indexName, zero if it has no events
+func (ss *SQLiteStore) GetFirstEventTime(ctx context.Context, indexName string) (time.Time, error) {
+	table, err := getTable(indexName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var firstEventTime sql.NullInt64
+	if err = ss.db.QueryRowContext(ctx, "SELECT MIN(event_time_ms) FROM "+table.name).Scan(&firstEventTime); err != nil {
+		return time.Time{}, err
+	}
+	if !firstEventTime.Valid {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, firstEventTime.Int64*int64(time.Millisecond)).UTC(), nil
+}
+
+// GetIndexMapping returns mappings of the current version of index indexName, rows of the tables follow them
+func (ss *SQLiteStore) GetIndexMapping(ctx context.Context, indexName string) (json.RawMessage, error) {
+	return definitionMapping(indexName)
+}
+
+func (ss *SQLiteStore) addEvent(ctx context.Context, indexName string, eventDescription interface{}) error {
+	return insertEvent(ctx, ss.db, indexName, eventDescription)
+}
+
+// sqlExecer is *sql.DB or *sql.Tx
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertEvent(ctx context.Context, execer sqlExecer, indexName string, eventDescription interface{}) error {
+	source, err := json.Marshal(eventDescription)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(source, &fields); err != nil {
+		return err
+	}
+
+	table := sqliteTables[indexName]
+	columns := []string{"event_time_ms", "source"}
+	values := []interface{}{nil, string(source)}
+	if eventTime, ok := fields["event_time"].(string); ok {
+		if parsedEventTime, err := models.ParseEventTime(eventTime); err == nil {
+			values[0] = toMillis(parsedEventTime)
+		}
+	}
+	for column := range table.columns {
+		columns = append(columns, quoteIdentifier(column))
+		values = append(values, fields[column])
+	}
+	_, err = execer.ExecContext(ctx, fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", table.name, strings.Join(columns, ", "), placeholders(len(columns))), values...)
+	return err
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// whereClause builds WHERE clause from field filters, fields must be table columns
+func whereClause(table sqliteTable, filters map[string]interface{}) (string, []interface{}, error) {
+	conditions := make([]string, 0, len(filters))
+	args := make([]interface{}, 0, len(filters))
+	for fieldName, fieldValue := range filters {
+		if _, ok := table.columns[fieldName]; !ok {
+			return "", nil, fmt.Errorf("Field %v doesn't exist in %v", fieldName, table.name)
+		}
+		conditions = append(conditions, quoteIdentifier(fieldName)+" = ?")
+		args = append(args, sqliteValue(fieldValue))
+	}
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// eventFilterConditions returns WHERE conditions of the event filter and their arguments.
+// Rows without platform were saved before platforms were recorded, they are web events.
+func eventFilterConditions(filter EventFilter) ([]string, []interface{}) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "event_time_ms >= ?")
+		args = append(args, toMillis(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "event_time_ms < ?")
+		args = append(args, toMillis(filter.To))
+	}
+	if filter.Usernames != nil {
+		if len(filter.Usernames) == 0 {
+			conditions = append(conditions, "0 = 1")
+		} else {
+			conditions = append(conditions, "username IN ("+placeholders(len(filter.Usernames))+")")
+			for _, username := range filter.Usernames {
+				args = append(args, username)
+			}
+		}
+	}
+	if len(filter.Platforms) > 0 {
+		conditions = append(conditions, "COALESCE(NULLIF(platform, ''), ?) IN ("+placeholders(len(filter.Platforms))+")")
+		args = append(args, models.WebPlatform)
+		for _, platform := range filter.Platforms {
+			args = append(args, platform)
+		}
+	}
+	return conditions, args
+}
+
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
+
+// sqliteValue converts filter values to the types stored in tables
+func sqliteValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case models.LinkType:
+		return string(v)
+	case models.EventType:
+		return string(v)
+	}
+	return value
+}
+
+func getTable(indexName string) (sqliteTable, error) {
+	table, ok := sqliteTables[indexName]
+	if !ok {
+		return sqliteTable{}, errors.New("Unknown index " + indexName)
+	}
+	return table, nil
+}
+
+// querySources runs query that selects "source" column and unmarshals every row with handleSource
+func (ss *SQLiteStore) querySources(ctx context.Context, query string, args []interface{}, handleSource func(source []byte) error) error {
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var source string
+		if err = rows.Scan(&source); err != nil {
+			return err
+		}
+		if err = handleSource([]byte(source)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (ss *SQLiteStore) queryVideoEvents(ctx context.Context, query string, args ...interface{}) ([]models.VideoEventDescription, error) {
+	result := make([]models.VideoEventDescription, 0)
+	err := ss.querySources(ctx, query, args, func(source []byte) error {
+		var videoEvent models.VideoEventDescription
+		if err := json.Unmarshal(source, &videoEvent); err != nil {
+			return err
+		}
+		result = append(result, videoEvent)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetCourseStructure gets structure for course with course code = courseCode
+func (ss *SQLiteStore) GetCourseStructure(ctx context.Context, courseCode string) (edxstruct.Course, error) {
+	var source string
+	err := ss.db.QueryRowContext(ctx, "SELECT source FROM course_structures WHERE course_code = ? ORDER BY id LIMIT 1", courseCode).Scan(&source)
+	if err == sql.ErrNoRows {
+		return edxstruct.Course{}, notFoundf("No structures for course %v was found", courseCode)
+	}
+	if err != nil {
+		return edxstruct.Course{}, err
+	}
+	var course edxstruct.Course
+	err = json.Unmarshal([]byte(source), &course)
+	return course, err
+}
+
+// GetUserVideoEvents returns all video events for specific user and a video
+func (ss *SQLiteStore) GetUserVideoEvents(ctx context.Context, username string, videoID string) ([]models.VideoEventDescription, error) {
+	return ss.queryVideoEvents(ctx, "SELECT source FROM video_events WHERE username = ? AND video_id = ? ORDER BY row_id", username, videoID)
+}
+
+// GetUserVideoAndProblemEventsTimes gets all video events and problem events logs for user with username and gets
+// their IDs and timestamps
+func (ss *SQLiteStore) GetUserVideoAndProblemEventsTimes(ctx context.Context, username string, courseID string) ([]UserProblemAndVideoEventsIDsAndTime, error) {
+	result := make([]UserProblemAndVideoEventsIDsAndTime, 0)
+	err := ss.querySources(
+		ctx,
+		`SELECT source FROM video_events WHERE username = ? AND course_id = ?
+		UNION ALL SELECT source FROM problem_events WHERE username = ? AND course_id = ?`,
+		[]interface{}{username, courseID, username, courseID},
+		func(source []byte) error {
+			var eventIDsAndTime UserProblemAndVideoEventsIDsAndTime
+			if err := json.Unmarshal(source, &eventIDsAndTime); err != nil {
+				return err
+			}
+			result = append(result, eventIDsAndTime)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// queryUserCourseEvents selects events of user in course from tables of indexNames
+// sorted by event time, index name and id. extraConditions are added to WHERE clause of every table.
+// If after is not nil only events following (event time, index name, id) in it are selected.
+func (ss *SQLiteStore) queryUserCourseEvents(ctx context.Context, indexNames []string, usernames []string, courseID string, extraConditions string, extraArgs []interface{}, after []interface{}, limit int) ([]UserCourseEvent, []int64, error) {
+	selects := make([]string, 0, len(indexNames))
+	args := make([]interface{}, 0)
+	for _, indexName := range indexNames {
+		table, err := getTable(indexName)
+		if err != nil {
+			return nil, nil, err
+		}
+		selects = append(selects, fmt.Sprintf(
+			"SELECT '%v' AS index_name, row_id, event_time_ms, source FROM %v WHERE username IN (%v) AND course_id = ?%v",
+			indexName, table.name, placeholders(len(usernames)), extraConditions,
+		))
+		for _, username := range usernames {
+			args = append(args, username)
+		}
+		args = append(append(args, courseID), extraArgs...)
+	}
+	query := "SELECT index_name, row_id, source FROM (" + strings.Join(selects, " UNION ALL ") + ")"
+	if after != nil {
+		query += " WHERE (event_time_ms, index_name, row_id) > (?, ?, ?)"
+		args = append(args, after...)
+	}
+	query += " ORDER BY event_time_ms, index_name, row_id"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	events := make([]UserCourseEvent, 0)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var indexName, source string
+		var id int64
+		if err = rows.Scan(&indexName, &id, &source); err != nil {
+			return nil, nil, err
+		}
+		var event UserCourseEvent
+		if err = json.Unmarshal([]byte(source), &event); err != nil {
+			return nil, nil, err
+		}
+		event.Index = indexName
+		event.Source = json.RawMessage(source)
+		events = append(events, event)
+		ids = append(ids, id)
+	}
+	return events, ids, rows.Err()
+}
+
+// GetUserCourseEventsSortedByTime gets events of user with username in course courseID
+// matching filter from every activity table and sorts them by ascending event time.
+func (ss *SQLiteStore) GetUserCourseEventsSortedByTime(ctx context.Context, username string, courseID string, filter EventFilter) ([]UserCourseEvent, error) {
+	conditions, args := eventFilterConditions(filter)
+	events, _, err := ss.queryUserCourseEvents(ctx, ActivityIndexNames, []string{username}, courseID, extraConditions(conditions), args, nil, 0)
+	return events, err
+}
+
+// extraConditions joins conditions to be added to WHERE clause with other conditions
+func extraConditions(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(conditions, " AND ")
+}
+
+// GetAllCourseCodesWithStructure returns all course codes of stored course structures
+func (ss *SQLiteStore) GetAllCourseCodesWithStructure(ctx context.Context) ([]string, error) {
+	rows, err := ss.db.QueryContext(ctx, "SELECT course_code FROM course_structures ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]string, 0)
+	for rows.Next() {
+		var courseCode string
+		if err = rows.Scan(&courseCode); err != nil {
+			return nil, err
+		}
+		result = append(result, courseCode)
+	}
+	return result, rows.Err()
+}
+
+// ScanCourseStructures passes every stored course structure to handleStructure in the order they were added
+func (ss *SQLiteStore) ScanCourseStructures(ctx context.Context, handleStructure func(course edxstruct.Course) error) error {
+	return ss.querySources(ctx, "SELECT source FROM course_structures ORDER BY id", nil, func(source []byte) error {
+		var course edxstruct.Course
+		if err := json.Unmarshal(source, &course); err != nil {
+			return err
+		}
+		return handleStructure(course)
+	})
+}
+
+// GetAllCourseIDsWithStructureAndLogs gets all course ids met in logs that have course structure.
+// The returned type is in "course-v1:org+CourseCode+CourseRun" notation.
+func (ss *SQLiteStore) GetAllCourseIDsWithStructureAndLogs(ctx context.Context) ([]string, error) {
+	return getAllCourseIDsWithStructureAndLogs(ctx, ss)
+}
+
+// GetSortedVideoEventsForVideo gets video events matching filter where video_id is videoID and
+// sorts them by ascending video time.
+func (ss *SQLiteStore) GetSortedVideoEventsForVideo(ctx context.Context, videoID string, filter EventFilter) ([]models.VideoEventDescription, error) {
+	conditions, args := eventFilterConditions(filter)
+	return ss.queryVideoEvents(
+		ctx,
+		"SELECT source FROM video_events WHERE video_id = ?"+extraConditions(conditions)+" ORDER BY video_time, row_id",
+		append([]interface{}{videoID}, args...)...,
+	)
+}
+
+// GetCourseBookmarkEventsSortedByTime gets bookmark events of course courseID matching filter and
+// sorts them by ascending event time.
+func (ss *SQLiteStore) GetCourseBookmarkEventsSortedByTime(ctx context.Context, courseID string, filter EventFilter) ([]models.BookmarksEventDescription, error) {
+	conditions, args := eventFilterConditions(filter)
+	result := make([]models.BookmarksEventDescription, 0)
+	err := ss.querySources(
+		ctx,
+		"SELECT source FROM bookmarks_events WHERE course_id = ?"+extraConditions(conditions)+" ORDER BY event_time_ms, row_id",
+		append([]interface{}{courseID}, args...),
+		func(source []byte) error {
+			var bookmarksEvent models.BookmarksEventDescription
+			if err := json.Unmarshal(source, &bookmarksEvent); err != nil {
+				return err
+			}
+			result = append(result, bookmarksEvent)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetUserTimeline gets a page of events of the user in the course sorted by ascending
+// event time. The second returned value is the cursor of the next page, it is empty
+// if there are no more events.
+func (ss *SQLiteStore) GetUserTimeline(ctx context.Context, timelineQuery TimelineQuery) ([]UserCourseEvent, string, error) {
+	indexNames := EventDescriptionIndexNames
+	if len(timelineQuery.Families) > 0 {
+		indexNames = make([]string, 0, len(timelineQuery.Families))
+		for _, family := range timelineQuery.Families {
+			indexName, ok := EventFamilyIndexNames[family]
+			if !ok {
+				return nil, "", fmt.Errorf("Unknown event family %v", family)
+			}
+			indexNames = append(indexNames, indexName)
+		}
+	}
+
+	conditions, args := eventFilterConditions(timelineQuery.eventFilter())
+	var after []interface{}
+	if timelineQuery.Cursor != "" {
+		searchAfter, err := decodeSearchAfterCursor(timelineQuery.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		eventTimeMillis, indexName, id, err := parseSQLiteCursor(searchAfter)
+		if err != nil {
+			return nil, "", err
+		}
+		after = []interface{}{eventTimeMillis, indexName, id}
+	}
+
+	events, ids, err := ss.queryUserCourseEvents(ctx, indexNames, timelineQuery.storedUsernames(), timelineQuery.CourseID, extraConditions(conditions), args, after, timelineQuery.Size)
+	if err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if timelineQuery.Size > 0 && len(events) == timelineQuery.Size {
+		last := len(events) - 1
+		nextCursor, err = encodeSearchAfterCursor([]interface{}{toMillis(events[last].Time), events[last].Index, ids[last]})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return events, nextCursor, nil
+}
+
+// ScanCourseEvents calls handleEvent for every event matching query.
+// Events are sorted by course ID and ascending event time.
+func (ss *SQLiteStore) ScanCourseEvents(ctx context.Context, query CourseEventsQuery, handleEvent func(event CourseEvent) error) error {
+	table, err := getTable(query.IndexName)
+	if err != nil {
+		return err
+	}
+	conditions, args := eventFilterConditions(query.EventFilter)
+	conditions = append([]string{"1 = 1"}, conditions...)
+	if query.CourseID != "" {
+		conditions = append(conditions, "course_id = ?")
+		args = append(args, query.CourseID)
+	}
+
+	rows, err := ss.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT source FROM %v WHERE %v ORDER BY course_id, event_time_ms, row_id",
+		table.name, strings.Join(conditions, " AND "),
+	), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var source string
+		if err = rows.Scan(&source); err != nil {
+			return err
+		}
+		event, err := newCourseEvent(query.IndexName, []byte(source))
+		if err != nil {
+			return err
+		}
+		if err = handleEvent(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountUserEvents returns numbers of events of every learner in course courseID of index indexName
+// matching filter
+func (ss *SQLiteStore) CountUserEvents(ctx context.Context, indexName string, courseID string, filter EventFilter) (map[string]int64, error) {
+	table, err := getTable(indexName)
+	if err != nil {
+		return nil, err
+	}
+	conditions, args := eventFilterConditions(filter)
+	rows, err := ss.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT username, COUNT(*) FROM %v WHERE course_id = ? AND username IS NOT NULL%v GROUP BY username",
+		table.name, extraConditions(conditions),
+	), append([]interface{}{courseID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := map[string]int64{}
+	for rows.Next() {
+		var username string
+		var count int64
+		if err = rows.Scan(&username, &count); err != nil {
+			return nil, err
+		}
+		result[username] = count
+	}
+	return result, rows.Err()
+}
+
+// EraseUserEvents deletes all the events of users with usernames from index indexName.
+// Events are only counted if dryRun is true.
+func (ss *SQLiteStore) EraseUserEvents(ctx context.Context, indexName string, usernames []string, dryRun bool) (ErasureResult, error) {
+	table, err := getTable(indexName)
+	if err != nil {
+		return ErasureResult{}, err
+	}
+	if len(usernames) == 0 {
+		return ErasureResult{}, nil
+	}
+	args := make([]interface{}, 0, len(usernames))
+	for _, username := range usernames {
+		args = append(args, username)
+	}
+	where := fmt.Sprintf(" FROM %v WHERE username IN (%v)", table.name, placeholders(len(args)))
+
+	var result ErasureResult
+	if err = ss.db.QueryRowContext(ctx, "SELECT COUNT(*)"+where, args...).Scan(&result.Matched); err != nil {
+		return result, err
+	}
+	if !dryRun && result.Matched > 0 {
+		res, err := ss.db.ExecContext(ctx, "DELETE"+where, args...)
+		if err != nil {
+			return result, err
+		}
+		if result.Deleted, err = res.RowsAffected(); err != nil {
+			return result, err
+		}
+	}
+	err = ss.db.QueryRowContext(ctx, "SELECT COUNT(*)"+where, args...).Scan(&result.Remaining)
+	return result, err
+}
+
+// RenameUsers replaces usernames of events in index indexName, renames map old usernames
+// to new ones. Number of updated events is returned.
+func (ss *SQLiteStore) RenameUsers(ctx context.Context, indexName string, renames map[string]string) (int64, error) {
+	table, err := getTable(indexName)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var updated int64
+	for oldUsername, newUsername := range renames {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"UPDATE %v SET username = ?, source = json_set(source, '$.username', ?) WHERE username = ?", table.name,
+		), newUsername, newUsername, oldUsername)
+		if err != nil {
+			return 0, err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		updated += rows
+	}
+	return updated, tx.Commit()
+}
+
+func parseSQLiteCursor(searchAfter []interface{}) (int64, string, int64, error) {
+	if len(searchAfter) != 3 {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	eventTimeNumber, timeOk := searchAfter[0].(json.Number)
+	indexName, indexOk := searchAfter[1].(string)
+	idNumber, idOk := searchAfter[2].(json.Number)
+	if !timeOk || !indexOk || !idOk {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	eventTimeMillis, err := eventTimeNumber.Int64()
+	if err != nil {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	id, err := idNumber.Int64()
+	if err != nil {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	return eventTimeMillis, indexName, id, nil
+}
+
+// GetUniqueStringFieldValuesInIndex returns all possible values of field fieldName in index indexName
+func (ss *SQLiteStore) GetUniqueStringFieldValuesInIndex(ctx context.Context, indexName string, fieldName string) ([]string, error) {
+	return ss.GetUniqueStringFieldValuesInIndexWithFilter(ctx, indexName, fieldName, "", nil)
+}
+
+// GetUniqueStringFieldValuesInIndexWithFilter is a GetUniqueStringFieldValuesInIndex but with ability to filter the field filteredFieldName
+func (ss *SQLiteStore) GetUniqueStringFieldValuesInIndexWithFilter(ctx context.Context, indexName string, fieldName string, filteredFieldName string, filteredFieldValue interface{}) ([]string, error) {
+	filters := map[string]interface{}{}
+	if filteredFieldName != "" {
+		filters[filteredFieldName] = filteredFieldValue
+	}
+	counts, err := ss.GetStringFieldValuesCountsWithFilters(ctx, indexName, fieldName, filters, EventFilter{}, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, count.Value)
+	}
+	return result, nil
+}
+
+// GetStringFieldValuesCountsWithFilters returns size (all if size is 0) most frequent values of field fieldName
+// in index indexName and numbers of documents with them. Only documents that have all the filters field values
+// and match eventFilter are counted.
+func (ss *SQLiteStore) GetStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) ([]FieldValueCount, error) {
+	groups, err := ss.countGroupedFieldValues(ctx, indexName, "", fieldName, filters, eventFilter, size)
+	if err != nil {
+		return nil, err
+	}
+	return groups[""], nil
+}
+
+// GetNestedStringFieldValuesCountsWithFilters groups documents of index indexName by field groupFieldName and
+// returns size most frequent values of field fieldName within every group. Only documents that have all the
+// filters field values and match eventFilter are counted.
+func (ss *SQLiteStore) GetNestedStringFieldValuesCountsWithFilters(ctx context.Context, indexName string, groupFieldName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) (map[string][]FieldValueCount, error) {
+	if groupFieldName == "" {
+		return nil, errors.New("Group field name is required")
+	}
+	return ss.countGroupedFieldValues(ctx, indexName, groupFieldName, fieldName, filters, eventFilter, size)
+}
+
+// countGroupedFieldValues is a terms aggregation with optional terms sub aggregation on groupFieldName
+func (ss *SQLiteStore) countGroupedFieldValues(ctx context.Context, indexName string, groupFieldName string, fieldName string, filters map[string]interface{}, eventFilter EventFilter, size int) (map[string][]FieldValueCount, error) {
+	table, err := getTable(indexName)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := table.columns[fieldName]; !ok {
+		return nil, fmt.Errorf("Field %v doesn't exist in %v", fieldName, table.name)
+	}
+	groupExpression := "''"
+	if groupFieldName != "" {
+		if _, ok := table.columns[groupFieldName]; !ok {
+			return nil, fmt.Errorf("Field %v doesn't exist in %v", groupFieldName, table.name)
+		}
+		groupExpression = quoteIdentifier(groupFieldName)
+	}
+	where, args, err := whereClause(table, filters)
+	if err != nil {
+		return nil, err
+	}
+	if where == "" {
+		where = " WHERE 1 = 1"
+	}
+	eventConditions, eventArgs := eventFilterConditions(eventFilter)
+	where += extraConditions(eventConditions)
+	args = append(args, eventArgs...)
+	query := fmt.Sprintf(
+		"SELECT %[1]v, %[2]v, COUNT(*) AS documents FROM %[3]v%[4]v AND %[1]v IS NOT NULL AND %[2]v IS NOT NULL GROUP BY %[1]v, %[2]v ORDER BY %[1]v, documents DESC, %[2]v",
+		groupExpression, quoteIdentifier(fieldName), table.name, where,
+	)
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string][]FieldValueCount{}
+	for rows.Next() {
+		var group string
+		var count FieldValueCount
+		if err = rows.Scan(&group, &count.Value, &count.Count); err != nil {
+			return nil, fmt.Errorf("Field %v should be a keyword: %v", fieldName, err)
+		}
+		if size > 0 && len(result[group]) >= size {
+			continue
+		}
+		result[group] = append(result[group], count)
+	}
+	return result, rows.Err()
+}
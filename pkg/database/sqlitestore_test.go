@@ -0,0 +1,220 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+// fillTestStore adds structures, events of every family and rollups to store
+func fillTestStore(t *testing.T, store EventStore) {
+	t.Helper()
+	ctx := context.Background()
+	otherCourseID := "course-v1:org+C2+2020"
+	for _, err := range []error{
+		store.AddCourseStructure(ctx, edxstruct.Course{DisplayName: "Course", CourseCode: "C1", CourseRun: "2020"}),
+		store.AddCourseStructure(ctx, edxstruct.Course{DisplayName: "Other course", CourseCode: "C2", CourseRun: "2020"}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:00:00Z", Username: "alice", VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID, Platform: models.WebPlatform}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:01:00.5Z", VideoTime: 60, Username: "alice", VideoID: "video1", EventType: models.PAUSE, CourseID: testCourseID, Platform: models.WebPlatform}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-02T10:00:00Z", Username: "bob", VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID, Platform: models.MobilePlatform}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-02T11:00:00Z", Username: "bob", VideoID: "video2", EventType: models.PLAY, CourseID: otherCourseID}),
+		store.AddProblemEventDescription(ctx, models.ProblemEventDescription{EventTime: "2020-03-01T10:02:00Z", Username: "alice", ProblemID: "problem1", EventType: models.ProblemSubmittedEventType,
+			WeightedEarned: 1, WeightedPossible: 2, CourseID: testCourseID}),
+		store.AddSequentialMoveEventDescription(ctx, models.SequentialMoveEventDescription{EventTime: "2020-03-01T10:03:00Z", Username: "alice", Old: 1, New: 2, EventType: "seq_next", CourseID: testCourseID,
+			SequentialID: "sequential1", OldVerticalID: "vertical1", NewVerticalID: "vertical2"}),
+		store.AddBooksmarkEventDescription(ctx, models.BookmarksEventDescription{EventTime: "2020-03-01T10:04:00Z", Username: "alice", EventType: "edx.bookmark.added", IsAdded: true, CourseID: testCourseID, BlockID: "vertical2"}),
+		store.AddLinkEventDescription(ctx, models.LinkEventDescription{EventTime: "2020-03-01T10:05:00Z", Username: "bob", EventType: "edx.ui.lms.link_clicked", CourseID: testCourseID, TargetURL: "https://example.com"}),
+		store.AddEventDescriptions(ctx, EnrollmentEventDescriptionIndexName, []interface{}{
+			models.EnrollmentEventDescription{EventTime: "2020-02-28T09:00:00Z", Username: "alice", UserID: 1, EventType: "edx.course.enrollment.activated", Mode: "audit", IsActive: true, CourseID: testCourseID},
+			models.EnrollmentEventDescription{EventTime: "2020-02-29T09:00:00Z", Username: "bob", UserID: 2, EventType: "edx.course.enrollment.activated", Mode: "verified", IsActive: true, CourseID: testCourseID},
+		}),
+		store.AddDailyRollups(ctx, []models.BlockActivity{
+			{CourseID: testCourseID, BlockID: "video1", Date: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC), ActiveLearners: 1, VideoPlays: 1},
+			{CourseID: testCourseID, BlockID: "video1", Date: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), ActiveLearners: 1, VideoPlays: 1},
+		}),
+		store.SetRollupWatermark(ctx, time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC)),
+	} {
+		if err != nil {
+			t.Fatalf("can't fill the store: %v", err)
+		}
+	}
+}
+
+// readAllTimeline reads every page of the timeline of query
+func readAllTimeline(ctx context.Context, store EventStore, query TimelineQuery) ([]UserCourseEvent, error) {
+	events := make([]UserCourseEvent, 0)
+	for {
+		page, cursor, err := store.GetUserTimeline(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if cursor == "" {
+			return events, nil
+		}
+		query.Cursor = cursor
+	}
+}
+
+func sortedValues(values []string, err error) (interface{}, error) {
+	sort.Strings(values)
+	return values, err
+}
+
+// storeQueries are searches that must return the same results in every store
+var storeQueries = []struct {
+	name  string
+	query func(ctx context.Context, store EventStore) (interface{}, error)
+}{
+	{"course structure", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetCourseStructure(ctx, "C2")
+	}},
+	{"course structures", func(ctx context.Context, store EventStore) (interface{}, error) {
+		names := make([]string, 0)
+		err := store.ScanCourseStructures(ctx, func(course edxstruct.Course) error {
+			names = append(names, course.DisplayName)
+			return nil
+		})
+		return names, err
+	}},
+	{"course codes", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetAllCourseCodesWithStructure(ctx)
+	}},
+	{"courses with logs", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return sortedValues(store.GetAllCourseIDsWithStructureAndLogs(ctx))
+	}},
+	{"video events of user", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetUserVideoEvents(ctx, "alice", "video1")
+	}},
+	{"video and problem event times", func(ctx context.Context, store EventStore) (interface{}, error) {
+		times, err := store.GetUserVideoAndProblemEventsTimes(ctx, "alice", testCourseID)
+		sort.Slice(times, func(i, j int) bool { return times[i].Time.Before(times[j].Time) })
+		return times, err
+	}},
+	{"events of user", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetUserCourseEventsSortedByTime(ctx, "alice", testCourseID, EventFilter{To: time.Date(2020, 3, 1, 10, 4, 0, 0, time.UTC)})
+	}},
+	{"video events by platform", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetSortedVideoEventsForVideo(ctx, "video1", EventFilter{Platforms: []string{models.WebPlatform}})
+	}},
+	{"bookmark events", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetCourseBookmarkEventsSortedByTime(ctx, testCourseID, EventFilter{})
+	}},
+	{"timeline pages", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return readAllTimeline(ctx, store, TimelineQuery{Username: "alice", StoredUsernames: []string{"alice"}, CourseID: testCourseID, Size: 2})
+	}},
+	{"timeline families", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return readAllTimeline(ctx, store, TimelineQuery{Username: "alice", StoredUsernames: []string{"alice"}, CourseID: testCourseID, Families: []string{"video", "bookmarks"}, Size: 10})
+	}},
+	{"scanned events", func(ctx context.Context, store EventStore) (interface{}, error) {
+		events := make([]string, 0)
+		err := store.ScanCourseEvents(ctx, CourseEventsQuery{IndexName: VideoEventDescriptionIndexName}, func(event CourseEvent) error {
+			events = append(events, fmt.Sprintf("%v %v %v %+v", event.CourseID, event.Username, event.Time.UTC(), event.Document))
+			return nil
+		})
+		return events, err
+	}},
+	{"user event counts", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.CountUserEvents(ctx, VideoEventDescriptionIndexName, testCourseID, EventFilter{})
+	}},
+	{"document counts", func(ctx context.Context, store EventStore) (interface{}, error) {
+		counts := map[string]int64{}
+		for _, definition := range IndexDefinitions {
+			count, err := store.CountDocuments(ctx, definition.Name)
+			if err != nil {
+				return nil, err
+			}
+			counts[definition.Name] = count
+		}
+		return counts, nil
+	}},
+	{"first event time", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetFirstEventTime(ctx, VideoEventDescriptionIndexName)
+	}},
+	{"unique values", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return sortedValues(store.GetUniqueStringFieldValuesInIndexWithFilter(ctx, VideoEventDescriptionIndexName, "video_id", "course_id", testCourseID))
+	}},
+	{"value counts", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetStringFieldValuesCountsWithFilters(ctx, EnrollmentEventDescriptionIndexName, "mode", map[string]interface{}{"course_id": testCourseID}, EventFilter{}, 10)
+	}},
+	{"rollups", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetDailyRollups(ctx, testCourseID, time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), time.Time{})
+	}},
+	{"rollup watermark", func(ctx context.Context, store EventStore) (interface{}, error) {
+		return store.GetRollupWatermark(ctx)
+	}},
+}
+
+func TestSQLiteStoreMatchesMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore()
+	fillTestStore(t, memoryStore)
+	fileName := filepath.Join(t.TempDir(), "events.db")
+	sqliteStore, err := NewSQLiteStore(fileName)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	fillTestStore(t, sqliteStore)
+	// the data is read back from the file
+	reopenedStore, err := NewSQLiteStore(fileName)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() of existing file error = %v", err)
+	}
+
+	for _, query := range storeQueries {
+		t.Run(query.name, func(t *testing.T) {
+			want, err := query.query(ctx, memoryStore)
+			if err != nil {
+				t.Fatalf("MemoryStore error = %v", err)
+			}
+			got, err := query.query(ctx, reopenedStore)
+			if err != nil {
+				t.Fatalf("SQLiteStore error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SQLiteStore returned %+v, MemoryStore %+v", got, want)
+			}
+		})
+	}
+
+	t.Run("rename and erasure", func(t *testing.T) {
+		results := make([]string, 0, 2)
+		for _, store := range []EventStore{memoryStore, reopenedStore} {
+			renamed, err := store.RenameUsers(ctx, VideoEventDescriptionIndexName, map[string]string{"alice": "carol"})
+			if err != nil {
+				t.Fatalf("RenameUsers() error = %v", err)
+			}
+			erased, err := store.EraseUserEvents(ctx, VideoEventDescriptionIndexName, []string{"bob"}, false)
+			if err != nil {
+				t.Fatalf("EraseUserEvents() error = %v", err)
+			}
+			events, err := store.GetUserVideoEvents(ctx, "carol", "video1")
+			if err != nil {
+				t.Fatalf("GetUserVideoEvents() error = %v", err)
+			}
+			count, _ := store.CountDocuments(ctx, VideoEventDescriptionIndexName)
+			results = append(results, fmt.Sprintf("%v %+v %+v %v", renamed, erased, events, count))
+		}
+		if results[0] != results[1] {
+			t.Errorf("SQLiteStore returned %v, MemoryStore %v", results[1], results[0])
+		}
+	})
+
+	t.Run("missing course structure", func(t *testing.T) {
+		for _, store := range []EventStore{memoryStore, reopenedStore} {
+			if _, err := store.GetCourseStructure(ctx, "C3"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetCourseStructure() error = %v, want %v", err, ErrNotFound)
+			}
+		}
+	})
+}
@@ -0,0 +1,333 @@
+package dataset
+
+// Snapshots of the analytics dataset in local files. Every index of
+// database.IndexDefinitions is dumped to "<index>.ndjson.gz" with a JSON document
+// per line, "manifest.json" keeps mappings the indices had in the store, document
+// counts and SHA-256 sums of the files. Counts are checked against the store after
+// the dump and after the restore. Snapshots can be restored into any empty EventStore.
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+const (
+	manifestFileName = "manifest.json"
+	restoreBatchSize = 1000
+)
+
+// IndexManifest describes dumped index
+type IndexManifest struct {
+	Name      string          `json:"name"`
+	Version   int             `json:"version"`
+	Mapping   json.RawMessage `json:"mapping"`
+	Documents int64           `json:"documents"`
+	File      string          `json:"file"`
+	SHA256    string          `json:"sha256"`
+}
+
+// Manifest describes the whole snapshot
+type Manifest struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Indices   []IndexManifest `json:"indices"`
+}
+
+// indexCodec reads all the documents of an index from the store and writes them back
+type indexCodec struct {
+	dump    func(ctx context.Context, store database.EventStore, indexName string, writeDocument func(document interface{}) error) error
+	restore func(ctx context.Context, store database.EventStore, indexName string, sources []json.RawMessage) error
+}
+
+func codecOf(indexName string) (indexCodec, bool) {
+	if indexName == database.CourseStructureIndexName {
+		return indexCodec{dump: dumpStructures, restore: restoreStructures}, true
+	}
+	if indexName == database.DailyRollupIndexName {
+		return indexCodec{dump: dumpRollups, restore: restoreRollups}, true
+	}
+	if _, ok := database.EventDocumentTypes[indexName]; ok {
+		return indexCodec{dump: dumpEvents, restore: restoreEvents}, true
+	}
+	return indexCodec{}, false
+}
+
+// Dump writes all the indices of store into directory dir
+func Dump(ctx context.Context, store database.EventStore, dir string) (Manifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Manifest{}, err
+	}
+	manifest := Manifest{CreatedAt: time.Now().UTC(), Indices: make([]IndexManifest, 0, len(database.IndexDefinitions))}
+	for _, definition := range database.IndexDefinitions {
+		codec, ok := codecOf(definition.Name)
+		if !ok {
+			return manifest, errors.New("Don't know how to dump index " + definition.Name)
+		}
+		mapping, err := store.GetIndexMapping(ctx, definition.Name)
+		if err != nil {
+			return manifest, fmt.Errorf("can't get mapping of %v: %v", definition.Name, err)
+		}
+		indexManifest := IndexManifest{
+			Name:    definition.Name,
+			Version: definition.Version,
+			Mapping: mapping,
+			File:    definition.Name + ".ndjson.gz",
+		}
+		indexManifest.Documents, indexManifest.SHA256, err = writeIndexFile(filepath.Join(dir, indexManifest.File), func(writeDocument func(document interface{}) error) error {
+			return codec.dump(ctx, store, definition.Name, writeDocument)
+		})
+		if err != nil {
+			return manifest, fmt.Errorf("can't dump %v: %v", definition.Name, err)
+		}
+		documents, err := store.CountDocuments(ctx, definition.Name)
+		if err != nil {
+			return manifest, err
+		}
+		if documents != indexManifest.Documents {
+			return manifest, fmt.Errorf("%v documents of %v were dumped instead of %v", indexManifest.Documents, definition.Name, documents)
+		}
+		manifest.Indices = append(manifest.Indices, indexManifest)
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, os.WriteFile(filepath.Join(dir, manifestFileName), b, 0644)
+}
+
+// writeIndexFile writes documents passed to writeDocument by dump into gzipped NDJSON file
+// fileName and returns their number and SHA-256 sum of the file
+func writeIndexFile(fileName string, dump func(writeDocument func(document interface{}) error) error) (int64, string, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	compressor := gzip.NewWriter(io.MultiWriter(file, hash))
+	encoder := json.NewEncoder(compressor)
+
+	var documents int64
+	err = dump(func(document interface{}) error {
+		documents++
+		return encoder.Encode(document)
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	if err = compressor.Close(); err != nil {
+		return 0, "", err
+	}
+	return documents, hex.EncodeToString(hash.Sum(nil)), file.Close()
+}
+
+// ReadManifest reads manifest of snapshot in directory dir
+func ReadManifest(dir string) (Manifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return Manifest{}, err
+	}
+	var manifest Manifest
+	err = json.Unmarshal(b, &manifest)
+	return manifest, err
+}
+
+// Restore writes snapshot in directory dir into store. All the indices of store must be empty.
+// Checksums of the files are checked before the restore and document counts after it.
+func Restore(ctx context.Context, store database.EventStore, dir string) (Manifest, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return manifest, err
+	}
+	for _, indexManifest := range manifest.Indices {
+		if _, ok := codecOf(indexManifest.Name); !ok {
+			return manifest, errors.New("Don't know how to restore index " + indexManifest.Name)
+		}
+		if err = checkFileSum(filepath.Join(dir, indexManifest.File), indexManifest.SHA256); err != nil {
+			return manifest, err
+		}
+	}
+
+	if err = createIndices(ctx, store); err != nil {
+		return manifest, err
+	}
+	for _, indexManifest := range manifest.Indices {
+		documents, err := store.CountDocuments(ctx, indexManifest.Name)
+		if err != nil {
+			return manifest, err
+		}
+		if documents > 0 {
+			return manifest, fmt.Errorf("Index %v is not empty", indexManifest.Name)
+		}
+	}
+
+	for _, indexManifest := range manifest.Indices {
+		codec, _ := codecOf(indexManifest.Name)
+		err = readIndexFile(filepath.Join(dir, indexManifest.File), func(sources []json.RawMessage) error {
+			return codec.restore(ctx, store, indexManifest.Name, sources)
+		})
+		if err != nil {
+			return manifest, fmt.Errorf("can't restore %v: %v", indexManifest.Name, err)
+		}
+		if err = store.Refresh(ctx, indexManifest.Name); err != nil {
+			return manifest, err
+		}
+		documents, err := store.CountDocuments(ctx, indexManifest.Name)
+		if err != nil {
+			return manifest, err
+		}
+		if documents != indexManifest.Documents {
+			return manifest, fmt.Errorf("%v documents of %v were restored instead of %v", documents, indexManifest.Name, indexManifest.Documents)
+		}
+	}
+	return manifest, nil
+}
+
+func checkFileSum(fileName string, expectedSum string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != expectedSum {
+		return errors.New("Checksum of " + fileName + " doesn't match the manifest")
+	}
+	return nil
+}
+
+// readIndexFile reads gzipped NDJSON file and passes its documents to restore in batches
+func readIndexFile(fileName string, restore func(sources []json.RawMessage) error) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decompressor, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+
+	scanner := bufio.NewScanner(decompressor)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	batch := make([]json.RawMessage, 0, restoreBatchSize)
+	for scanner.Scan() {
+		batch = append(batch, append(json.RawMessage(nil), scanner.Bytes()...))
+		if len(batch) == restoreBatchSize {
+			if err = restore(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return restore(batch)
+	}
+	return nil
+}
+
+func createIndices(ctx context.Context, store database.EventStore) error {
+	creators := []func(ctx context.Context) error{
+		store.CreateStructureIndexIfNotExists,
+		store.CreateVideoIndexIfNotExists,
+		store.CreateProblemIndexIfNotExists,
+		store.CreateSequentialIndexIfNotExists,
+		store.CreateBookmarksIndexIfNotExists,
+		store.CreateLinksIndexIfNotExists,
+		store.CreateEnrollmentIndexIfNotExists,
+		store.CreateRollupIndexIfNotExists,
+	}
+	for _, create := range creators {
+		if err := create(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpStructures(ctx context.Context, store database.EventStore, indexName string, writeDocument func(document interface{}) error) error {
+	return store.ScanCourseStructures(ctx, func(course edxstruct.Course) error {
+		return writeDocument(course)
+	})
+}
+
+func restoreStructures(ctx context.Context, store database.EventStore, indexName string, sources []json.RawMessage) error {
+	for _, source := range sources {
+		var course edxstruct.Course
+		if err := json.Unmarshal(source, &course); err != nil {
+			return err
+		}
+		if err := store.AddCourseStructure(ctx, course); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpEvents(ctx context.Context, store database.EventStore, indexName string, writeDocument func(document interface{}) error) error {
+	return store.ScanCourseEvents(ctx, database.CourseEventsQuery{IndexName: indexName}, func(event database.CourseEvent) error {
+		return writeDocument(event.Document)
+	})
+}
+
+func restoreEvents(ctx context.Context, store database.EventStore, indexName string, sources []json.RawMessage) error {
+	documentType := reflect.TypeOf(database.EventDocumentTypes[indexName])
+	eventDescriptions := make([]interface{}, 0, len(sources))
+	for _, source := range sources {
+		eventDescription := reflect.New(documentType)
+		if err := json.Unmarshal(source, eventDescription.Interface()); err != nil {
+			return err
+		}
+		eventDescriptions = append(eventDescriptions, eventDescription.Elem().Interface())
+	}
+	return store.AddEventDescriptions(ctx, indexName, eventDescriptions)
+}
+
+// dumpRollups writes rollups without their watermark, so rollups of the restored
+// snapshot are recomputed by the rollup job
+func dumpRollups(ctx context.Context, store database.EventStore, indexName string, writeDocument func(document interface{}) error) error {
+	rollups, err := store.GetDailyRollups(ctx, "", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, rollup := range rollups {
+		if err = writeDocument(rollup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreRollups(ctx context.Context, store database.EventStore, indexName string, sources []json.RawMessage) error {
+	rollups := make([]models.BlockActivity, 0, len(sources))
+	for _, source := range sources {
+		var rollup models.BlockActivity
+		if err := json.Unmarshal(source, &rollup); err != nil {
+			return err
+		}
+		rollups = append(rollups, rollup)
+	}
+	return store.AddDailyRollups(ctx, rollups)
+}
@@ -0,0 +1,137 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+// newTestStore returns memory store with two revisions of a course structure, another run
+// of the course, events of every family and rollups
+func newTestStore(t *testing.T) *database.MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	for _, err := range []error{
+		store.AddCourseStructure(ctx, edxstruct.Course{DisplayName: "Revision 1", CourseCode: "C1", CourseRun: "2020"}),
+		store.AddCourseStructure(ctx, edxstruct.Course{DisplayName: "Revision 2", CourseCode: "C1", CourseRun: "2020"}),
+		store.AddCourseStructure(ctx, edxstruct.Course{DisplayName: "Next run", CourseCode: "C1", CourseRun: "2021"}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:00:00Z", Username: "alice", VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:01:00Z", Username: "alice", VideoID: "video1", EventType: models.PAUSE, CourseID: testCourseID}),
+		store.AddProblemEventDescription(ctx, models.ProblemEventDescription{EventTime: "2020-03-01T10:02:00Z", Username: "alice", ProblemID: "problem1", EventType: models.ProblemSubmittedEventType, CourseID: testCourseID}),
+		store.AddSequentialMoveEventDescription(ctx, models.SequentialMoveEventDescription{EventTime: "2020-03-01T10:03:00Z", Username: "bob", Old: 1, New: 2, EventType: "seq_next", CourseID: testCourseID}),
+		store.AddBooksmarkEventDescription(ctx, models.BookmarksEventDescription{EventTime: "2020-03-01T10:04:00Z", Username: "bob", EventType: "edx.bookmark.added", IsAdded: true, CourseID: testCourseID}),
+		store.AddLinkEventDescription(ctx, models.LinkEventDescription{EventTime: "2020-03-01T10:05:00Z", Username: "bob", EventType: "edx.ui.lms.link_clicked", CourseID: testCourseID, TargetURL: "https://example.com"}),
+		store.AddEnrollmentEventDescription(ctx, models.EnrollmentEventDescription{EventTime: "2020-03-01T09:00:00Z", Username: "bob", EventType: "edx.course.enrollment.activated", IsActive: true, CourseID: testCourseID}),
+		store.AddDailyRollups(ctx, []models.BlockActivity{{CourseID: testCourseID, BlockID: "video1", Date: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)}}),
+	} {
+		if err != nil {
+			t.Fatalf("can't fill the store: %v", err)
+		}
+	}
+	return store
+}
+
+func TestDumpRestore(t *testing.T) {
+	ctx := context.Background()
+	source := newTestStore(t)
+	dir := t.TempDir()
+	manifest, err := Dump(ctx, source, dir)
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	if len(manifest.Indices) != len(database.IndexDefinitions) {
+		t.Fatalf("manifest has %v indices, want %v", len(manifest.Indices), len(database.IndexDefinitions))
+	}
+	for _, indexManifest := range manifest.Indices {
+		want, err := source.CountDocuments(ctx, indexManifest.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexManifest.Documents != want || want == 0 {
+			t.Errorf("manifest has %v documents of %v, want %v", indexManifest.Documents, indexManifest.Name, want)
+		}
+		if len(indexManifest.Mapping) == 0 || !json.Valid(indexManifest.Mapping) {
+			t.Errorf("manifest has no mapping of %v", indexManifest.Name)
+		}
+	}
+
+	sqliteStore, err := database.NewSQLiteStore(filepath.Join(t.TempDir(), "restored.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	destinations := []struct {
+		name  string
+		store database.EventStore
+	}{
+		{"memory", database.NewMemoryStore()},
+		{"sqlite", sqliteStore},
+	}
+	for _, destination := range destinations {
+		t.Run(destination.name, func(t *testing.T) {
+			if _, err := Restore(ctx, destination.store, dir); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			for _, indexManifest := range manifest.Indices {
+				documents, err := destination.store.CountDocuments(ctx, indexManifest.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if documents != indexManifest.Documents {
+					t.Errorf("%v documents of %v were restored, want %v", documents, indexManifest.Name, indexManifest.Documents)
+				}
+			}
+			names := make([]string, 0)
+			err := destination.store.ScanCourseStructures(ctx, func(course edxstruct.Course) error {
+				names = append(names, course.DisplayName)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ScanCourseStructures() error = %v", err)
+			}
+			if strings.Join(names, ",") != "Revision 1,Revision 2,Next run" {
+				t.Errorf("restored structures %v, want every revision and run", names)
+			}
+
+			if _, err = Restore(ctx, destination.store, dir); err == nil {
+				t.Errorf("Restore() into the filled store error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestRestoreChecksSums(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest, err := Dump(ctx, newTestStore(t), dir)
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	videoFile := filepath.Join(dir, manifest.Indices[0].File)
+	for _, indexManifest := range manifest.Indices {
+		if indexManifest.Name == database.VideoEventDescriptionIndexName {
+			videoFile = filepath.Join(dir, indexManifest.File)
+		}
+	}
+	if err = os.WriteFile(videoFile, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := database.NewMemoryStore()
+	if _, err = Restore(ctx, store, dir); err == nil || !strings.Contains(err.Error(), "Checksum") {
+		t.Fatalf("Restore() error = %v, want checksum error", err)
+	}
+	if documents, _ := store.CountDocuments(ctx, database.CourseStructureIndexName); documents != 0 {
+		t.Errorf("%v structures were restored from the changed snapshot", documents)
+	}
+}
@@ -0,0 +1,210 @@
+package export
+
+// Export of event description indices to Parquet files for researchers.
+// Files are partitioned the way pandas (pyarrow) and R (arrow) read datasets:
+// "<family>/course_id=<course>/month=<yyyy-mm>/part-0.parquet".
+// Columns are parquet names of pkg/models event description fields, event_time is
+// TIMESTAMP(MICROS) adjusted to UTC, it is null for events with unknown time.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"kafka-log-processor/pkg/database"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Rows are flushed into a new row group after every exportRowGroupSize rows,
+// so memory used by a writer stays bounded
+const exportRowGroupSize = 50000
+
+// Query describes events to export. Families are keys of database.EventFamilyIndexNames
+// (all families if empty), all courses are exported if CourseID is empty. From and To
+// limit event time if not zero.
+type Query struct {
+	Families []string
+	CourseID string
+	From     time.Time
+	To       time.Time
+}
+
+// FileCreator creates file with slash separated path relative to export root
+type FileCreator func(filePath string) (io.WriteCloser, error)
+
+// DirectoryFileCreator creates files in directory dir
+func DirectoryFileCreator(dir string) FileCreator {
+	return func(filePath string) (io.WriteCloser, error) {
+		fullPath := filepath.Join(dir, filepath.FromSlash(filePath))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return nil, err
+		}
+		return os.Create(fullPath)
+	}
+}
+
+// ExportParquet exports events matching query to Parquet files created by createFile,
+// one file per family, course and month. Events are read page by page and only one
+// file is written at a time. Paths of the created files are returned.
+func ExportParquet(ctx context.Context, store database.EventStore, query Query, createFile FileCreator) ([]string, error) {
+	families := query.Families
+	if len(families) == 0 {
+		for family := range database.EventFamilyIndexNames {
+			families = append(families, family)
+		}
+		sort.Strings(families)
+	}
+
+	filePaths := make([]string, 0)
+	for _, family := range families {
+		indexName, ok := database.EventFamilyIndexNames[family]
+		if !ok {
+			return filePaths, fmt.Errorf("Unknown event family %v", family)
+		}
+
+		rowType, eventTimeField := exportRowType(reflect.TypeOf(database.EventDocumentTypes[indexName]))
+		partition := &partitionWriter{
+			family:         family,
+			schema:         parquet.SchemaOf(reflect.New(rowType).Elem().Interface()),
+			rowType:        rowType,
+			eventTimeField: eventTimeField,
+			createFile:     createFile,
+		}
+		err := store.ScanCourseEvents(ctx, database.CourseEventsQuery{
+			IndexName:   indexName,
+			CourseID:    query.CourseID,
+			EventFilter: database.EventFilter{From: query.From, To: query.To},
+		}, partition.write)
+		if closeErr := partition.close(); err == nil {
+			err = closeErr
+		}
+		filePaths = append(filePaths, partition.filePaths...)
+		if err != nil {
+			return filePaths, err
+		}
+	}
+	return filePaths, nil
+}
+
+// exportRowType returns type of the exported rows of documentType, that has the same fields
+// but event_time of time type, and the number of event_time field
+func exportRowType(documentType reflect.Type) (reflect.Type, int) {
+	eventTimeField := -1
+	fields := make([]reflect.StructField, 0, documentType.NumField())
+	for i := 0; i < documentType.NumField(); i++ {
+		field := documentType.Field(i)
+		if field.Tag.Get("parquet") == "event_time" {
+			field.Type = reflect.TypeOf(&time.Time{})
+			field.Tag = `parquet:"event_time,timestamp(microsecond)"`
+			eventTimeField = i
+		}
+		fields = append(fields, field)
+	}
+	return reflect.StructOf(fields), eventTimeField
+}
+
+// partitionWriter writes events sorted by course and time, a new file is started
+// when course or month of the event changes
+type partitionWriter struct {
+	family         string
+	schema         *parquet.Schema
+	rowType        reflect.Type
+	eventTimeField int
+	createFile     FileCreator
+
+	filePath  string
+	file      io.WriteCloser
+	writer    *parquet.Writer
+	rows      int
+	filePaths []string
+}
+
+func (pw *partitionWriter) write(event database.CourseEvent) error {
+	filePath := PartitionPath(pw.family, event.CourseID, event.Time)
+	if filePath != pw.filePath {
+		if err := pw.close(); err != nil {
+			return err
+		}
+		file, err := pw.createFile(filePath)
+		if err != nil {
+			return err
+		}
+		pw.filePath = filePath
+		pw.file = file
+		pw.writer = parquet.NewWriter(file, pw.schema)
+		pw.filePaths = append(pw.filePaths, filePath)
+	}
+
+	if err := pw.writer.Write(pw.row(event)); err != nil {
+		return err
+	}
+	pw.rows++
+	if pw.rows%exportRowGroupSize == 0 {
+		return pw.writer.Flush()
+	}
+	return nil
+}
+
+// row returns exported row of event
+func (pw *partitionWriter) row(event database.CourseEvent) interface{} {
+	document := reflect.ValueOf(event.Document)
+	row := reflect.New(pw.rowType).Elem()
+	for i := 0; i < document.NumField(); i++ {
+		if i != pw.eventTimeField {
+			row.Field(i).Set(document.Field(i))
+		} else if !event.Time.IsZero() {
+			eventTime := event.Time.UTC()
+			row.Field(i).Set(reflect.ValueOf(&eventTime))
+		}
+	}
+	return row.Interface()
+}
+
+func (pw *partitionWriter) close() error {
+	if pw.file == nil {
+		return nil
+	}
+	err := pw.writer.Close()
+	if closeErr := pw.file.Close(); err == nil {
+		err = closeErr
+	}
+	pw.file = nil
+	pw.writer = nil
+	pw.rows = 0
+	return err
+}
+
+// PartitionPath returns path of the file with events of family in course courseID
+// that happened in month of eventTime. Events with unknown time go to "month=unknown".
+func PartitionPath(family string, courseID string, eventTime time.Time) string {
+	month := "unknown"
+	if !eventTime.IsZero() {
+		month = eventTime.UTC().Format("2006-01")
+	}
+	return path.Join(family, "course_id="+escapePartitionValue(courseID), "month="+month, "part-0.parquet")
+}
+
+// escapePartitionValue percent-encodes all the characters except letters, digits, "-", "_" and ".",
+// so course IDs like "course-v1:org+Code+Run" are valid file names on every platform.
+// pyarrow and arrow decode them back when reading partitioned datasets.
+func escapePartitionValue(value string) string {
+	if value == "" {
+		return "__HIVE_DEFAULT_PARTITION__"
+	}
+	escaped := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' {
+			escaped = append(escaped, c)
+			continue
+		}
+		escaped = append(escaped, fmt.Sprintf("%%%02X", c)...)
+	}
+	return string(escaped)
+}
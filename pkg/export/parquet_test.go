@@ -0,0 +1,167 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// videoRow is a row of exported video events as researchers read it
+type videoRow struct {
+	EventTime *time.Time `parquet:"event_time,timestamp(microsecond)"`
+	VideoTime float64    `parquet:"video_time"`
+	Username  string     `parquet:"username"`
+	VideoID   string     `parquet:"video_id"`
+	EventType string     `parquet:"event_type"`
+	CourseID  string     `parquet:"course_id"`
+	Platform  string     `parquet:"platform"`
+}
+
+// memoryFile is a file kept in memory by memoryFileCreator
+type memoryFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (file *memoryFile) Close() error {
+	file.closed = true
+	return nil
+}
+
+// memoryFileCreator returns FileCreator keeping files in files
+func memoryFileCreator(files map[string]*memoryFile) FileCreator {
+	return func(filePath string) (io.WriteCloser, error) {
+		file := &memoryFile{}
+		files[filePath] = file
+		return file, nil
+	}
+}
+
+func readVideoRows(t *testing.T, file *memoryFile) []videoRow {
+	t.Helper()
+	rows, err := parquet.Read[videoRow](bytes.NewReader(file.Bytes()), int64(file.Len()))
+	if err != nil {
+		t.Fatalf("can't read exported file: %v", err)
+	}
+	return rows
+}
+
+func TestExportParquet(t *testing.T) {
+	ctx := context.Background()
+	courseID := "course-v1:org+C1+2020"
+	otherCourseID := "course-v1:org+C2+2020"
+	store := database.NewMemoryStore()
+	for _, event := range []models.VideoEventDescription{
+		{EventTime: "2020-03-31T23:59:59.123456Z", Username: "alice", VideoID: "video1", EventType: models.PLAY, CourseID: courseID, Platform: models.WebPlatform},
+		{EventTime: "2020-03-01T10:00:00Z", VideoTime: 12.5, Username: "bob", VideoID: "video1", EventType: models.PAUSE, CourseID: courseID},
+		{EventTime: "2020-04-01T00:00:00+03:00", Username: "alice", VideoID: "video2", EventType: models.PLAY, CourseID: courseID},
+		{EventTime: "2020-04-02T10:00:00Z", Username: "carol", VideoID: "video3", EventType: models.PLAY, CourseID: otherCourseID},
+	} {
+		if err := store.AddVideoEventDescription(ctx, event); err != nil {
+			t.Fatalf("can't add event: %v", err)
+		}
+	}
+	err := store.AddProblemEventDescription(ctx, models.ProblemEventDescription{EventTime: "2020-03-01T10:00:00Z", Username: "alice", ProblemID: "problem1",
+		EventType: models.ProblemSubmittedEventType, CourseID: courseID})
+	if err != nil {
+		t.Fatalf("can't add event: %v", err)
+	}
+
+	at := func(month time.Month, day int, hour int, minute int, second int, nanosecond int) *time.Time {
+		eventTime := time.Date(2020, month, day, hour, minute, second, nanosecond, time.UTC)
+		return &eventTime
+	}
+	tests := []struct {
+		name      string
+		query     Query
+		wantFiles map[string][]videoRow
+	}{
+		{"partitions of course and month", Query{Families: []string{"video"}}, map[string][]videoRow{
+			"video/course_id=course-v1%3Aorg%2BC1%2B2020/month=2020-03/part-0.parquet": {
+				{EventTime: at(3, 1, 10, 0, 0, 0), VideoTime: 12.5, Username: "bob", VideoID: "video1", EventType: "pause", CourseID: courseID},
+				{EventTime: at(3, 31, 21, 0, 0, 0), Username: "alice", VideoID: "video2", EventType: "play", CourseID: courseID},
+				{EventTime: at(3, 31, 23, 59, 59, 123456000), Username: "alice", VideoID: "video1", EventType: "play", CourseID: courseID, Platform: models.WebPlatform},
+			},
+			"video/course_id=course-v1%3Aorg%2BC2%2B2020/month=2020-04/part-0.parquet": {
+				{EventTime: at(4, 2, 10, 0, 0, 0), Username: "carol", VideoID: "video3", EventType: "play", CourseID: otherCourseID},
+			},
+		}},
+		{"course and time range", Query{Families: []string{"video"}, CourseID: courseID, From: *at(3, 31, 0, 0, 0, 0)}, map[string][]videoRow{
+			"video/course_id=course-v1%3Aorg%2BC1%2B2020/month=2020-03/part-0.parquet": {
+				{EventTime: at(3, 31, 21, 0, 0, 0), Username: "alice", VideoID: "video2", EventType: "play", CourseID: courseID},
+				{EventTime: at(3, 31, 23, 59, 59, 123456000), Username: "alice", VideoID: "video1", EventType: "play", CourseID: courseID, Platform: models.WebPlatform},
+			},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string]*memoryFile{}
+			filePaths, err := ExportParquet(ctx, store, test.query, memoryFileCreator(files))
+			if err != nil {
+				t.Fatalf("ExportParquet() error = %v", err)
+			}
+			if len(filePaths) != len(test.wantFiles) || len(files) != len(test.wantFiles) {
+				t.Fatalf("ExportParquet() = %v, want %v files", filePaths, len(test.wantFiles))
+			}
+			for _, filePath := range filePaths {
+				file, ok := files[filePath]
+				if !ok || !file.closed {
+					t.Fatalf("file %v isn't created or closed", filePath)
+				}
+				want, ok := test.wantFiles[filePath]
+				if !ok {
+					t.Fatalf("unexpected file %v", filePath)
+				}
+				if got := readVideoRows(t, file); !reflect.DeepEqual(got, want) {
+					t.Errorf("rows of %v = %+v, want %+v", filePath, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("all families", func(t *testing.T) {
+		files := map[string]*memoryFile{}
+		filePaths, err := ExportParquet(ctx, store, Query{CourseID: courseID}, memoryFileCreator(files))
+		if err != nil {
+			t.Fatalf("ExportParquet() error = %v", err)
+		}
+		want := []string{
+			"problem/course_id=course-v1%3Aorg%2BC1%2B2020/month=2020-03/part-0.parquet",
+			"video/course_id=course-v1%3Aorg%2BC1%2B2020/month=2020-03/part-0.parquet",
+		}
+		if !reflect.DeepEqual(filePaths, want) {
+			t.Errorf("ExportParquet() = %v, want %v", filePaths, want)
+		}
+	})
+
+	t.Run("unknown family", func(t *testing.T) {
+		if _, err := ExportParquet(ctx, store, Query{Families: []string{"unknown"}}, memoryFileCreator(map[string]*memoryFile{})); err == nil {
+			t.Errorf("ExportParquet() error = nil, want error")
+		}
+	})
+}
+
+func TestPartitionPath(t *testing.T) {
+	tests := []struct {
+		courseID  string
+		eventTime time.Time
+		want      string
+	}{
+		{"course-v1:org+C1+2020", time.Date(2020, 3, 31, 23, 0, 0, 0, time.FixedZone("", -3*3600)), "video/course_id=course-v1%3Aorg%2BC1%2B2020/month=2020-04/part-0.parquet"},
+		{"", time.Time{}, "video/course_id=__HIVE_DEFAULT_PARTITION__/month=unknown/part-0.parquet"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := PartitionPath("video", test.courseID, test.eventTime); got != test.want {
+				t.Errorf("PartitionPath() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
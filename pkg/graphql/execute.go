@@ -0,0 +1,352 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// execution is the state of execution of an operation. Fields are resolved level by level:
+// every field of the level is resolved for all its parent objects at once.
+type execution struct {
+	schema    *Schema
+	doc       *document
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+// nullByError is the value of fields nulled by an already reported error,
+// it nulls the parent of non-null fields
+type nullByError struct{}
+
+// object is an object of the response, it keeps the order of fields of the query
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		keyJSON, _ := json.Marshal(key)
+		b.Write(keyJSON)
+		b.WriteByte(':')
+		valueJSON, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(valueJSON)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// fieldGroup is the fields of a selection set with the same response key
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+func (exec *execution) execute(ctx context.Context, op *operation) interface{} {
+	data := exec.executeObjects(ctx, exec.schema.query, []interface{}{nil}, op.selections, [][]interface{}{{}})[0]
+	if _, ok := data.(nullByError); ok {
+		return nil
+	}
+	return data
+}
+
+// executeObjects resolves selections of objects of type t from their sources at paths
+func (exec *execution) executeObjects(ctx context.Context, t *Type, sources []interface{}, selections []selection, paths [][]interface{}) []interface{} {
+	objects := make([]interface{}, len(sources))
+	for i := range objects {
+		objects[i] = &object{}
+	}
+	for _, group := range exec.collectFields(selections, map[string]bool{}, nil) {
+		f := group.fields[0]
+		fieldPaths := make([][]interface{}, len(paths))
+		for i, path := range paths {
+			fieldPaths[i] = append(append(make([]interface{}, 0, len(path)+1), path...), group.key)
+		}
+
+		var values []interface{}
+		var fieldType *Type
+		if f.name == "__typename" {
+			fieldType = NonNull(String)
+			values = make([]interface{}, len(sources))
+			for i := range values {
+				values[i] = t.Name
+			}
+		} else {
+			definition := exec.schema.fieldOf(t, f.name)
+			fieldType = definition.Type
+			values = exec.resolve(ctx, definition, sources, f, fieldPaths)
+		}
+
+		var subSelections []selection
+		for _, groupField := range group.fields {
+			subSelections = append(subSelections, groupField.selections...)
+		}
+		completed := exec.complete(ctx, fieldType, values, subSelections, fieldPaths, f)
+		for i, value := range completed {
+			o, ok := objects[i].(*object)
+			if !ok {
+				continue
+			}
+			if _, ok := value.(nullByError); ok {
+				objects[i] = nullByError{}
+				continue
+			}
+			o.keys = append(o.keys, group.key)
+			o.values = append(o.values, value)
+		}
+	}
+	return objects
+}
+
+// resolve calls the resolver of field f for all sources, errors become nullByError values
+func (exec *execution) resolve(ctx context.Context, definition *Field, sources []interface{}, f *field, paths [][]interface{}) []interface{} {
+	values := make([]interface{}, len(sources))
+	nullAll := func(err error) []interface{} {
+		exec.fieldError(ctx, err, f, paths[0])
+		for i := range values {
+			values[i] = nullByError{}
+		}
+		return values
+	}
+	args, err := coerceArguments(definition.Args, f.arguments, exec.variables)
+	if err != nil {
+		return nullAll(err)
+	}
+	resolved, err := definition.Resolve(ctx, sources, args)
+	if err != nil {
+		return nullAll(err)
+	}
+	if len(resolved) != len(sources) {
+		return nullAll(fmt.Errorf("graphql: resolver of %v returned %v values for %v objects", f.name, len(resolved), len(sources)))
+	}
+	for i, value := range resolved {
+		if err, ok := value.(error); ok {
+			exec.fieldError(ctx, err, f, paths[i])
+			value = nullByError{}
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// complete converts resolved values of type t to response values. Values of nullable
+// types nulled by errors become null, nulls of non-null types are errors.
+func (exec *execution) complete(ctx context.Context, t *Type, values []interface{}, selections []selection, paths [][]interface{}, f *field) []interface{} {
+	if t.Kind == NonNullKind {
+		completed := exec.completeNullable(ctx, t.OfType, values, selections, paths, f)
+		for i, value := range completed {
+			if value == nil {
+				exec.errors = append(exec.errors, &Error{
+					Message:   fmt.Sprintf("Cannot return null for non-nullable field %q", f.name),
+					Locations: []Location{f.location},
+					Path:      paths[i],
+				})
+				completed[i] = nullByError{}
+			}
+		}
+		return completed
+	}
+	completed := exec.completeNullable(ctx, t, values, selections, paths, f)
+	for i, value := range completed {
+		if _, ok := value.(nullByError); ok {
+			completed[i] = nil
+		}
+	}
+	return completed
+}
+
+func (exec *execution) completeNullable(ctx context.Context, t *Type, values []interface{}, selections []selection, paths [][]interface{}, f *field) []interface{} {
+	completed := make([]interface{}, len(values))
+	switch t.Kind {
+	case ListKind:
+		// items of all the lists are completed at once
+		var items []interface{}
+		var itemPaths [][]interface{}
+		lengths := make([]int, len(values))
+		for i, value := range values {
+			if isNull(value) {
+				completed[i] = nullOf(value)
+				continue
+			}
+			list := reflect.ValueOf(value)
+			if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+				exec.fieldError(ctx, fmt.Errorf("graphql: expected list for %v, got %T", f.name, value), f, paths[i])
+				completed[i] = nullByError{}
+				continue
+			}
+			lengths[i] = list.Len()
+			for j := 0; j < list.Len(); j++ {
+				items = append(items, list.Index(j).Interface())
+				itemPaths = append(itemPaths, append(append(make([]interface{}, 0, len(paths[i])+1), paths[i]...), j))
+			}
+		}
+		completedItems := exec.complete(ctx, t.OfType, items, selections, itemPaths, f)
+		offset := 0
+		for i := range values {
+			if completed[i] != nil {
+				continue
+			}
+			if isNull(values[i]) {
+				continue
+			}
+			list := completedItems[offset : offset+lengths[i]]
+			offset += lengths[i]
+			completed[i] = list
+			for _, item := range list {
+				if _, ok := item.(nullByError); ok {
+					completed[i] = nullByError{}
+				}
+			}
+		}
+	case ObjectKind:
+		var sources []interface{}
+		var sourcePaths [][]interface{}
+		var indices []int
+		for i, value := range values {
+			if isNull(value) {
+				completed[i] = nullOf(value)
+				continue
+			}
+			sources = append(sources, value)
+			sourcePaths = append(sourcePaths, paths[i])
+			indices = append(indices, i)
+		}
+		if len(sources) > 0 {
+			for j, o := range exec.executeObjects(ctx, t, sources, selections, sourcePaths) {
+				completed[indices[j]] = o
+			}
+		}
+	case EnumKind:
+		for i, value := range values {
+			if isNull(value) {
+				completed[i] = nullOf(value)
+				continue
+			}
+			name := reflect.ValueOf(value)
+			if name.Kind() != reflect.String || !t.hasEnumValue(name.String()) {
+				exec.fieldError(ctx, fmt.Errorf("Enum %v cannot represent value %v", t.Name, value), f, paths[i])
+				completed[i] = nullByError{}
+				continue
+			}
+			completed[i] = name.String()
+		}
+	case ScalarKind:
+		for i, value := range values {
+			if isNull(value) {
+				completed[i] = nullOf(value)
+				continue
+			}
+			serialized, err := t.serialize(value)
+			if err != nil {
+				exec.fieldError(ctx, err, f, paths[i])
+				completed[i] = nullByError{}
+				continue
+			}
+			completed[i] = serialized
+		}
+	}
+	return completed
+}
+
+// isNull tells if value is null or nulled by an error
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if _, ok := value.(nullByError); ok {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// nullOf returns null value of null or nulled value
+func nullOf(value interface{}) interface{} {
+	if _, ok := value.(nullByError); ok {
+		return value
+	}
+	return nil
+}
+
+// fieldError reports error of field f at path
+func (exec *execution) fieldError(ctx context.Context, err error, f *field, path []interface{}) {
+	var fieldErr *Error
+	if graphqlErr, ok := err.(*Error); ok {
+		copied := *graphqlErr
+		fieldErr = &copied
+	} else if exec.schema.PresentError != nil {
+		fieldErr = exec.schema.PresentError(ctx, err)
+	} else {
+		fieldErr = &Error{Message: err.Error()}
+	}
+	if len(fieldErr.Locations) == 0 {
+		fieldErr.Locations = []Location{f.location}
+	}
+	fieldErr.Path = path
+	exec.errors = append(exec.errors, fieldErr)
+}
+
+// collectFields groups fields of selections by response keys in the order of the query,
+// fields and fragments skipped by directives are left out
+func (exec *execution) collectFields(selections []selection, visited map[string]bool, groups []*fieldGroup) []*fieldGroup {
+	for _, s := range selections {
+		switch s := s.(type) {
+		case *field:
+			if !exec.included(s.directives) {
+				continue
+			}
+			key := s.responseKey()
+			found := false
+			for _, group := range groups {
+				if group.key == key {
+					group.fields = append(group.fields, s)
+					found = true
+				}
+			}
+			if !found {
+				groups = append(groups, &fieldGroup{key: key, fields: []*field{s}})
+			}
+		case *inlineFragment:
+			if exec.included(s.directives) {
+				groups = exec.collectFields(s.selections, visited, groups)
+			}
+		case *fragmentSpread:
+			if visited[s.name] || !exec.included(s.directives) {
+				continue
+			}
+			visited[s.name] = true
+			groups = exec.collectFields(exec.doc.fragments[s.name].selections, visited, groups)
+		}
+	}
+	return groups
+}
+
+// included evaluates @skip and @include directives
+func (exec *execution) included(directives []*directive) bool {
+	for _, d := range directives {
+		args, err := coerceArguments(exec.schema.directive(d.name).args, d.arguments, exec.variables)
+		if err != nil {
+			continue
+		}
+		condition, _ := args["if"].(bool)
+		if (d.name == "skip" && condition) || (d.name == "include" && !condition) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+// Package graphql executes GraphQL queries against schemas built in Go. Only query
+// operations are supported: object, scalar, enum, list, non-null and input object types,
+// fragments, variables, @skip/@include directives and introspection.
+//
+// Fields are resolved breadth-first: the resolver of a field is called once with the
+// parent objects of every occurrence of the field on a level of the response, lists
+// included, so resolvers can load data of all the parents with a single search.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Request is a GraphQL request as it is sent over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is a result of a request. Data is missing if the request couldn't be executed,
+// it is null if an error of a non-null field nulled the whole result.
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []*Error        `json:"errors,omitempty"`
+}
+
+// Location is a position in the query, lines and columns start from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is an error of the request or of a field. Path is the path of the field in
+// the response: response keys and list indices.
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (err *Error) Error() string {
+	if len(err.Locations) == 0 {
+		return err.Message
+	}
+	locations := make([]string, 0, len(err.Locations))
+	for _, location := range err.Locations {
+		locations = append(locations, fmt.Sprintf("%v:%v", location.Line, location.Column))
+	}
+	return err.Message + " (" + strings.Join(locations, ", ") + ")"
+}
+
+// Execute runs query operation of request. Errors of the request itself are returned
+// without data, errors of resolvers are returned along with the data of other fields.
+func (schema *Schema) Execute(ctx context.Context, request Request) *Response {
+	doc, err := parse(request.Query)
+	if err != nil {
+		return requestErrorResponse(err)
+	}
+	if errs := schema.validate(doc); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+	op, err := selectOperation(doc, request.OperationName)
+	if err != nil {
+		return requestErrorResponse(err)
+	}
+	variables, errs := schema.coerceVariables(op, request.Variables)
+	if len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	exec := &execution{schema: schema, doc: doc, variables: variables}
+	data := exec.execute(ctx, op)
+	response := &Response{Errors: exec.errors}
+	if response.Data, err = json.Marshal(data); err != nil {
+		return requestErrorResponse(err)
+	}
+	return response
+}
+
+func requestErrorResponse(err error) *Response {
+	if graphqlErr, ok := err.(*Error); ok {
+		return &Response{Errors: []*Error{graphqlErr}}
+	}
+	return &Response{Errors: []*Error{{Message: err.Error()}}}
+}
+
+// selectOperation returns the operation named name, the only operation of the document
+// if name is empty
+func selectOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations"}
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q", name)}
+}
@@ -0,0 +1,449 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCourse struct {
+	ID      string
+	Title   string
+	Level   string
+	Started time.Time
+}
+
+type testBlock struct {
+	ID       string
+	CourseID string
+	Kind     string
+}
+
+var testCourses = []testCourse{
+	{ID: "c1", Title: "Algebra", Level: "BASIC", Started: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{ID: "c2", Title: "Calculus", Level: "ADVANCED", Started: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+var testBlocks = []testBlock{
+	{ID: "b1", CourseID: "c1", Kind: "video"},
+	{ID: "b2", CourseID: "c1", Kind: "problem"},
+	{ID: "b3", CourseID: "c2", Kind: "video"},
+}
+
+// testSchema is a schema of courses and their blocks. blockResolves counts calls
+// of the blocks resolver to check that fields are resolved in batches.
+type testSchema struct {
+	*Schema
+	blockResolves int
+}
+
+func newTestSchema(t *testing.T) *testSchema {
+	t.Helper()
+	ts := &testSchema{}
+	level := NewEnum("Level", "Level of a course.", "BASIC", "ADVANCED")
+	block := NewObject("Block", "Block of a course.",
+		&Field{Name: "id", Type: NonNull(ID), Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(testBlock).ID, nil
+		})},
+		&Field{Name: "kind", Type: NonNull(String), Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(testBlock).Kind, nil
+		})},
+	)
+	course := NewObject("Course", "Course with blocks.",
+		&Field{Name: "id", Type: NonNull(ID), Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(testCourse).ID, nil
+		})},
+		&Field{Name: "title", Type: NonNull(String), Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(testCourse).Title, nil
+		})},
+		&Field{Name: "level", Type: level, Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(testCourse).Level, nil
+		})},
+		&Field{Name: "started", Type: DateTime, Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(testCourse).Started, nil
+		})},
+		&Field{Name: "note", Type: String, Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("note of " + source.(testCourse).ID + " is unavailable")
+		})},
+		&Field{Name: "code", Type: NonNull(String), Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			if source.(testCourse).ID == "c2" {
+				return nil, errors.New("code of c2 is unavailable")
+			}
+			return "ALG", nil
+		})},
+		&Field{Name: "missing", Type: NonNull(String), Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return nil, nil
+		})},
+		&Field{
+			Name: "blocks",
+			Type: NonNull(List(NonNull(block))),
+			Args: []*InputValue{{Name: "kind", Type: String}},
+			Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				ts.blockResolves++
+				values := make([]interface{}, len(sources))
+				for i, source := range sources {
+					blocks := make([]testBlock, 0)
+					for _, b := range testBlocks {
+						if kind, ok := args["kind"].(string); b.CourseID == source.(testCourse).ID && (!ok || b.Kind == kind) {
+							blocks = append(blocks, b)
+						}
+					}
+					values[i] = blocks
+				}
+				return values, nil
+			},
+		},
+	)
+	filter := NewInputObject("CourseFilter", "Filter of courses.",
+		&InputValue{Name: "level", Type: level},
+		&InputValue{Name: "startedAfter", Type: DateTime},
+		&InputValue{Name: "ids", Type: List(NonNull(ID))},
+	)
+	query := NewObject("Query", "Root of queries.",
+		&Field{
+			Name: "course",
+			Type: course,
+			Args: []*InputValue{{Name: "id", Type: NonNull(ID)}},
+			Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				for _, c := range testCourses {
+					if c.ID == args["id"] {
+						return c, nil
+					}
+				}
+				return nil, nil
+			}),
+		},
+		&Field{
+			Name: "courses",
+			Type: NonNull(List(NonNull(course))),
+			Args: []*InputValue{{Name: "filter", Type: filter}, {Name: "first", Type: Int, DefaultValue: 10}},
+			Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				fields, _ := args["filter"].(map[string]interface{})
+				result := make([]testCourse, 0)
+				for _, c := range testCourses {
+					if level, ok := fields["level"].(string); ok && c.Level != level {
+						continue
+					}
+					if after, ok := fields["startedAfter"].(time.Time); ok && !c.Started.After(after) {
+						continue
+					}
+					if ids, ok := fields["ids"].([]interface{}); ok && !containsValue(ids, c.ID) {
+						continue
+					}
+					if len(result) < args["first"].(int) {
+						result = append(result, c)
+					}
+				}
+				return result, nil
+			}),
+		},
+		&Field{
+			Name: "echo",
+			Type: String,
+			Args: []*InputValue{{Name: "text", Type: NonNull(String)}, {Name: "times", Type: Int, DefaultValue: 1}},
+			Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return strings.Repeat(args["text"].(string), args["times"].(int)), nil
+			}),
+		},
+	)
+	schema, err := NewSchema(query)
+	if err != nil {
+		t.Fatalf("NewSchema() error = %v", err)
+	}
+	ts.Schema = schema
+	return ts
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// execute runs query and returns compacted JSON of the data and the errors
+func execute(t *testing.T, schema *testSchema, query string, variables map[string]interface{}) (string, []*Error) {
+	t.Helper()
+	response := schema.Execute(context.Background(), Request{Query: query, Variables: variables})
+	if response.Data == nil {
+		return "", response.Errors
+	}
+	var data bytes.Buffer
+	if err := json.Compact(&data, response.Data); err != nil {
+		t.Fatalf("response data is not JSON: %v", err)
+	}
+	return data.String(), response.Errors
+}
+
+// errorMessages returns messages of errs
+func errorMessages(errs []*Error) []string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Message)
+	}
+	return messages
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		data      string
+	}{
+		{
+			name:  "nested lists",
+			query: `{ courses { id blocks { id } } }`,
+			data:  `{"courses":[{"id":"c1","blocks":[{"id":"b1"},{"id":"b2"}]},{"id":"c2","blocks":[{"id":"b3"}]}]}`,
+		},
+		{
+			name:  "aliases and arguments",
+			query: `{ first: course(id: "c1") { title } second: course(id: 2) { title } none: course(id: "c3") { title } }`,
+			data:  `{"first":{"title":"Algebra"},"second":null,"none":null}`,
+		},
+		{
+			name: "named and inline fragments",
+			query: `query { course(id: "c1") { ...CourseFields ... on Course { videos: blocks(kind: "video") { ...BlockFields } } } }
+				fragment CourseFields on Course { id level started }
+				fragment BlockFields on Block { id kind }`,
+			data: `{"course":{"id":"c1","level":"BASIC","started":"2020-01-01T00:00:00Z","videos":[{"id":"b1","kind":"video"}]}}`,
+		},
+		{
+			name:  "fields merged from fragments",
+			query: `{ course(id: "c1") { id ... on Course { id title } } }`,
+			data:  `{"course":{"id":"c1","title":"Algebra"}}`,
+		},
+		{
+			name:      "skip and include",
+			query:     `query($withTitle: Boolean!) { course(id: "c1") { id title @include(if: $withTitle) level @skip(if: true) } }`,
+			variables: map[string]interface{}{"withTitle": false},
+			data:      `{"course":{"id":"c1"}}`,
+		},
+		{
+			name:      "variables with defaults",
+			query:     `query($text: String!, $times: Int = 3) { echo(text: $text, times: $times) }`,
+			variables: map[string]interface{}{"text": "ab"},
+			data:      `{"echo":"ababab"}`,
+		},
+		{
+			name:      "input object variable",
+			query:     `query($filter: CourseFilter) { courses(filter: $filter) { id } }`,
+			variables: map[string]interface{}{"filter": map[string]interface{}{"level": "ADVANCED", "startedAfter": "2020-06-01T00:00:00Z"}},
+			data:      `{"courses":[{"id":"c2"}]}`,
+		},
+		{
+			name:      "variables inside input object literal",
+			query:     `query($level: Level, $id: ID!) { courses(filter: {level: $level, ids: [$id]}, first: 5) { id } }`,
+			variables: map[string]interface{}{"level": "BASIC", "id": "c1"},
+			data:      `{"courses":[{"id":"c1"}]}`,
+		},
+		{
+			name:      "single value coerced to list",
+			query:     `query($ids: [ID!]) { courses(filter: {ids: $ids}) { id } }`,
+			variables: map[string]interface{}{"ids": "c2"},
+			data:      `{"courses":[{"id":"c2"}]}`,
+		},
+		{
+			name:  "typename",
+			query: `{ __typename course(id: "c1") { __typename } }`,
+			data:  `{"__typename":"Query","course":{"__typename":"Course"}}`,
+		},
+		{
+			name:  "operation name",
+			query: `query A { echo(text: "a") } query B { echo(text: "b") }`,
+			data:  `{"echo":"a"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := newTestSchema(t)
+			request := Request{Query: test.query, Variables: test.variables}
+			if test.name == "operation name" {
+				request.OperationName = "A"
+			}
+			response := schema.Execute(context.Background(), request)
+			if len(response.Errors) > 0 {
+				t.Fatalf("Execute() errors = %v", errorMessages(response.Errors))
+			}
+			var data bytes.Buffer
+			if err := json.Compact(&data, response.Data); err != nil {
+				t.Fatalf("response data is not JSON: %v", err)
+			}
+			if data.String() != test.data {
+				t.Errorf("data = %v, want %v", data.String(), test.data)
+			}
+		})
+	}
+}
+
+func TestExecuteResolvesFieldsInBatches(t *testing.T) {
+	schema := newTestSchema(t)
+	data, errs := execute(t, schema, `{ courses { blocks { id } } c1: course(id: "c1") { blocks { id } } }`, nil)
+	if len(errs) > 0 {
+		t.Fatalf("errors = %v", errorMessages(errs))
+	}
+	if schema.blockResolves != 2 {
+		t.Errorf("blocks resolved %v times, want once per occurrence of the field: 2", schema.blockResolves)
+	}
+	if want := `{"courses":[{"blocks":[{"id":"b1"},{"id":"b2"}]},{"blocks":[{"id":"b3"}]}],"c1":{"blocks":[{"id":"b1"},{"id":"b2"}]}}`; data != want {
+		t.Errorf("data = %v, want %v", data, want)
+	}
+}
+
+func TestExecuteFieldErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		data  string
+		// messages and paths of the expected errors
+		messages []string
+		paths    []string
+	}{
+		{
+			name:     "nullable field is nulled",
+			query:    `{ course(id: "c1") { id note } }`,
+			data:     `{"course":{"id":"c1","note":null}}`,
+			messages: []string{"note of c1 is unavailable"},
+			paths:    []string{`["course","note"]`},
+		},
+		{
+			name:     "error of non-null field nulls the parent",
+			query:    `{ c1: course(id: "c1") { code } c2: course(id: "c2") { code } }`,
+			data:     `{"c1":{"code":"ALG"},"c2":null}`,
+			messages: []string{"code of c2 is unavailable"},
+			paths:    []string{`["c2","code"]`},
+		},
+		{
+			name:     "null of non-null field nulls the parent",
+			query:    `{ course(id: "c1") { id missing } }`,
+			data:     `{"course":null}`,
+			messages: []string{`Cannot return null for non-nullable field "missing"`},
+			paths:    []string{`["course","missing"]`},
+		},
+		{
+			name:     "null propagates through non-null lists up to data",
+			query:    `{ courses { id code } echo(text: "x") }`,
+			data:     `null`,
+			messages: []string{"code of c2 is unavailable"},
+			paths:    []string{`["courses",1,"code"]`},
+		},
+		{
+			name:     "errors of every list item are reported",
+			query:    `{ courses { note } }`,
+			data:     `{"courses":[{"note":null},{"note":null}]}`,
+			messages: []string{"note of c1 is unavailable", "note of c2 is unavailable"},
+			paths:    []string{`["courses",0,"note"]`, `["courses",1,"note"]`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, errs := execute(t, newTestSchema(t), test.query, nil)
+			if data != test.data {
+				t.Errorf("data = %v, want %v", data, test.data)
+			}
+			if len(errs) != len(test.messages) {
+				t.Fatalf("errors = %v, want %v", errorMessages(errs), test.messages)
+			}
+			for i, err := range errs {
+				path, _ := json.Marshal(err.Path)
+				if err.Message != test.messages[i] || string(path) != test.paths[i] {
+					t.Errorf("error %v at %s, want %v at %v", err.Message, path, test.messages[i], test.paths[i])
+				}
+				if len(err.Locations) != 1 {
+					t.Errorf("error %v has locations %v, want the location of the field", err.Message, err.Locations)
+				}
+			}
+		})
+	}
+}
+
+func TestExecutePresentError(t *testing.T) {
+	schema := newTestSchema(t)
+	schema.PresentError = func(ctx context.Context, err error) *Error {
+		return &Error{Message: "Internal error", Extensions: map[string]interface{}{"code": "internal"}}
+	}
+	_, errs := execute(t, schema, `{ course(id: "c1") { note } }`, nil)
+	if len(errs) != 1 || errs[0].Message != "Internal error" || errs[0].Extensions["code"] != "internal" {
+		t.Errorf("errors = %v, want error presented by PresentError", errorMessages(errs))
+	}
+}
+
+func TestExecuteVariableCoercionErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		message   string
+	}{
+		{
+			name:    "missing required variable",
+			query:   `query($text: String!) { echo(text: $text) }`,
+			message: `Variable "$text" of required type String! was not provided`,
+		},
+		{
+			name:      "null required variable",
+			query:     `query($text: String!) { echo(text: $text) }`,
+			variables: map[string]interface{}{"text": nil},
+			message:   `Variable "$text" got invalid value: Expected non-nullable type String! not to be null`,
+		},
+		{
+			name:      "wrong scalar type",
+			query:     `query($text: String!, $times: Int) { echo(text: $text, times: $times) }`,
+			variables: map[string]interface{}{"text": "a", "times": "3"},
+			message:   `Variable "$times" got invalid value: Int cannot represent value 3`,
+		},
+		{
+			name:      "int out of range",
+			query:     `query($text: String!, $times: Int) { echo(text: $text, times: $times) }`,
+			variables: map[string]interface{}{"text": "a", "times": json.Number("3000000000")},
+			message:   `Variable "$times" got invalid value: Int cannot represent non 32-bit signed integer value 3000000000`,
+		},
+		{
+			name:      "unknown enum value",
+			query:     `query($filter: CourseFilter) { courses(filter: $filter) { id } }`,
+			variables: map[string]interface{}{"filter": map[string]interface{}{"level": "EXPERT"}},
+			message:   `Variable "$filter" got invalid value: At field level: Value EXPERT does not exist in Level enum`,
+		},
+		{
+			name:      "unknown input field",
+			query:     `query($filter: CourseFilter) { courses(filter: $filter) { id } }`,
+			variables: map[string]interface{}{"filter": map[string]interface{}{"title": "Algebra"}},
+			message:   `Variable "$filter" got invalid value: Field "title" is not defined by type CourseFilter`,
+		},
+		{
+			name:      "invalid list item",
+			query:     `query($filter: CourseFilter) { courses(filter: $filter) { id } }`,
+			variables: map[string]interface{}{"filter": map[string]interface{}{"ids": []interface{}{"c1", nil}}},
+			message:   `Variable "$filter" got invalid value: At field ids: At index 1: Expected non-nullable type ID! not to be null`,
+		},
+		{
+			name:      "invalid date",
+			query:     `query($filter: CourseFilter) { courses(filter: $filter) { id } }`,
+			variables: map[string]interface{}{"filter": map[string]interface{}{"startedAfter": "2020-01-01"}},
+			message:   `Variable "$filter" got invalid value: At field startedAfter: DateTime cannot represent value 2020-01-01, it should be in RFC 3339 format`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, errs := execute(t, newTestSchema(t), test.query, test.variables)
+			if data != "" {
+				t.Errorf("data = %v, want no data", data)
+			}
+			if len(errs) != 1 || errs[0].Message != test.message {
+				t.Fatalf("errors = %q, want %q", errorMessages(errs), test.message)
+			}
+			variable := strings.TrimPrefix(strings.Fields(test.message)[1], `"`)
+			variable = strings.TrimSuffix(variable, `"`)
+			definition := Location{Line: 1, Column: strings.Index(test.query, variable) + 1}
+			if len(errs[0].Locations) != 1 || errs[0].Locations[0] != definition {
+				t.Errorf("locations = %v, want the location of the variable definition %v", errs[0].Locations, definition)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package graphql
+
+import "context"
+
+// Introspection types and the __schema and __type fields of the query type
+
+var (
+	typeKindEnum = NewEnum("__TypeKind", "An enum describing what kind of type a given `__Type` is.",
+		"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL")
+	directiveLocationEnum = NewEnum("__DirectiveLocation", "A Directive can be adjacent to many parts of the GraphQL language, a __DirectiveLocation describes one such possible adjacencies.",
+		"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT", "VARIABLE_DEFINITION",
+		"SCHEMA", "SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INTERFACE", "UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION")
+
+	introspectionSchemaType     = NewObject("__Schema", "A GraphQL Schema defines the capabilities of a GraphQL server. It exposes all available types and directives on the server, as well as the entry points for query, mutation, and subscription operations.")
+	introspectionTypeType       = NewObject("__Type", "The fundamental unit of any GraphQL Schema is the type. There are many kinds of types in GraphQL as represented by the `__TypeKind` enum.")
+	introspectionFieldType      = NewObject("__Field", "Object and Interface types are described by a list of Fields, each of which has a name, potentially a list of arguments, and a return type.")
+	introspectionInputValueType = NewObject("__InputValue", "Arguments provided to Fields or Directives and the input fields of an InputObject are represented as Input Values which describe their type and optionally a default value.")
+	introspectionEnumValueType  = NewObject("__EnumValue", "One possible value for a given Enum. Enum values are unique values, not a placeholder for a string or numeric value.")
+	introspectionDirectiveType  = NewObject("__Directive", "A Directive provides a way to describe alternate runtime execution and type validation behavior in a GraphQL document.")
+)
+
+// includeDeprecatedArg is accepted for compatibility, nothing is deprecated
+var includeDeprecatedArg = &InputValue{Name: "includeDeprecated", Type: Boolean, DefaultValue: false}
+
+func init() {
+	introspectionSchemaType.AddFields(
+		metaField("description", String, func(source interface{}) interface{} { return nil }),
+		metaField("types", NonNull(List(NonNull(introspectionTypeType))), func(source interface{}) interface{} {
+			return source.(*Schema).sortedTypes()
+		}),
+		metaField("queryType", NonNull(introspectionTypeType), func(source interface{}) interface{} { return source.(*Schema).query }),
+		metaField("mutationType", introspectionTypeType, func(source interface{}) interface{} { return nil }),
+		metaField("subscriptionType", introspectionTypeType, func(source interface{}) interface{} { return nil }),
+		metaField("directives", NonNull(List(NonNull(introspectionDirectiveType))), func(source interface{}) interface{} {
+			return source.(*Schema).directives
+		}),
+	)
+
+	introspectionTypeType.AddFields(
+		metaField("kind", NonNull(typeKindEnum), func(source interface{}) interface{} { return string(source.(*Type).Kind) }),
+		metaField("name", String, func(source interface{}) interface{} { return nullableString(source.(*Type).Name) }),
+		metaField("description", String, func(source interface{}) interface{} { return nullableString(source.(*Type).Description) }),
+		metaField("specifiedByURL", String, func(source interface{}) interface{} { return nil }),
+		withDeprecatedArg(metaField("fields", List(NonNull(introspectionFieldType)), func(source interface{}) interface{} {
+			if t := source.(*Type); t.Kind == ObjectKind {
+				return t.Fields
+			}
+			return nil
+		})),
+		metaField("interfaces", List(NonNull(introspectionTypeType)), func(source interface{}) interface{} {
+			if source.(*Type).Kind == ObjectKind {
+				return []*Type{}
+			}
+			return nil
+		}),
+		metaField("possibleTypes", List(NonNull(introspectionTypeType)), func(source interface{}) interface{} { return nil }),
+		withDeprecatedArg(metaField("enumValues", List(NonNull(introspectionEnumValueType)), func(source interface{}) interface{} {
+			if t := source.(*Type); t.Kind == EnumKind {
+				return t.EnumValues
+			}
+			return nil
+		})),
+		withDeprecatedArg(metaField("inputFields", List(NonNull(introspectionInputValueType)), func(source interface{}) interface{} {
+			if t := source.(*Type); t.Kind == InputObjectKind {
+				return t.InputFields
+			}
+			return nil
+		})),
+		metaField("ofType", introspectionTypeType, func(source interface{}) interface{} { return source.(*Type).OfType }),
+		metaField("isOneOf", Boolean, func(source interface{}) interface{} {
+			if source.(*Type).Kind == InputObjectKind {
+				return false
+			}
+			return nil
+		}),
+	)
+
+	introspectionFieldType.AddFields(
+		metaField("name", NonNull(String), func(source interface{}) interface{} { return source.(*Field).Name }),
+		metaField("description", String, func(source interface{}) interface{} { return nullableString(source.(*Field).Description) }),
+		withDeprecatedArg(metaField("args", NonNull(List(NonNull(introspectionInputValueType))), func(source interface{}) interface{} {
+			return append([]*InputValue{}, source.(*Field).Args...)
+		})),
+		metaField("type", NonNull(introspectionTypeType), func(source interface{}) interface{} { return source.(*Field).Type }),
+		metaField("isDeprecated", NonNull(Boolean), func(source interface{}) interface{} { return false }),
+		metaField("deprecationReason", String, func(source interface{}) interface{} { return nil }),
+	)
+
+	introspectionInputValueType.AddFields(
+		metaField("name", NonNull(String), func(source interface{}) interface{} { return source.(*InputValue).Name }),
+		metaField("description", String, func(source interface{}) interface{} { return nullableString(source.(*InputValue).Description) }),
+		metaField("type", NonNull(introspectionTypeType), func(source interface{}) interface{} { return source.(*InputValue).Type }),
+		metaField("defaultValue", String, func(source interface{}) interface{} {
+			if input := source.(*InputValue); input.DefaultValue != nil {
+				return printValue(input.DefaultValue, input.Type)
+			}
+			return nil
+		}),
+		metaField("isDeprecated", NonNull(Boolean), func(source interface{}) interface{} { return false }),
+		metaField("deprecationReason", String, func(source interface{}) interface{} { return nil }),
+	)
+
+	introspectionEnumValueType.AddFields(
+		metaField("name", NonNull(String), func(source interface{}) interface{} { return source.(*EnumValue).Name }),
+		metaField("description", String, func(source interface{}) interface{} { return nullableString(source.(*EnumValue).Description) }),
+		metaField("isDeprecated", NonNull(Boolean), func(source interface{}) interface{} { return false }),
+		metaField("deprecationReason", String, func(source interface{}) interface{} { return nil }),
+	)
+
+	introspectionDirectiveType.AddFields(
+		metaField("name", NonNull(String), func(source interface{}) interface{} { return source.(*directiveDefinition).name }),
+		metaField("description", String, func(source interface{}) interface{} {
+			return nullableString(source.(*directiveDefinition).description)
+		}),
+		metaField("locations", NonNull(List(NonNull(directiveLocationEnum))), func(source interface{}) interface{} {
+			return source.(*directiveDefinition).locations
+		}),
+		withDeprecatedArg(metaField("args", NonNull(List(NonNull(introspectionInputValueType))), func(source interface{}) interface{} {
+			return source.(*directiveDefinition).args
+		})),
+		metaField("isRepeatable", NonNull(Boolean), func(source interface{}) interface{} { return false }),
+	)
+}
+
+// metaField returns field of introspection type resolved by resolve
+func metaField(name string, t *Type, resolve func(source interface{}) interface{}) *Field {
+	return &Field{
+		Name: name,
+		Type: t,
+		Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return resolve(source), nil
+		}),
+	}
+}
+
+func withDeprecatedArg(field *Field) *Field {
+	field.Args = []*InputValue{includeDeprecatedArg}
+	return field
+}
+
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// fieldOf returns the field name of object type t, __schema and __type are fields of the query type
+func (schema *Schema) fieldOf(t *Type, name string) *Field {
+	if t == schema.query {
+		switch name {
+		case "__schema":
+			return &Field{
+				Name: "__schema",
+				Type: NonNull(introspectionSchemaType),
+				Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+					return schema, nil
+				}),
+			}
+		case "__type":
+			return &Field{
+				Name: "__type",
+				Type: introspectionTypeType,
+				Args: []*InputValue{{Name: "name", Type: NonNull(String)}},
+				Resolve: Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+					if t, ok := schema.types[args["name"].(string)]; ok {
+						return t, nil
+					}
+					return nil, nil
+				}),
+			}
+		}
+	}
+	return t.Field(name)
+}
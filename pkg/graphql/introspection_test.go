@@ -0,0 +1,106 @@
+package graphql
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIntrospection(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		data  string
+	}{
+		{
+			name:  "root types",
+			query: `{ __schema { queryType { name } mutationType { name } subscriptionType { name } } }`,
+			data:  `{"__schema":{"queryType":{"name":"Query"},"mutationType":null,"subscriptionType":null}}`,
+		},
+		{
+			name:  "object fields with wrapped types and arguments",
+			query: `{ __type(name: "Query") { kind fields { name args { name defaultValue type { kind name ofType { kind name } } } } } }`,
+			data: `{"__type":{"kind":"OBJECT","fields":[` +
+				`{"name":"course","args":[{"name":"id","defaultValue":null,"type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"ID"}}}]},` +
+				`{"name":"courses","args":[{"name":"filter","defaultValue":null,"type":{"kind":"INPUT_OBJECT","name":"CourseFilter","ofType":null}},` +
+				`{"name":"first","defaultValue":"10","type":{"kind":"SCALAR","name":"Int","ofType":null}}]},` +
+				`{"name":"echo","args":[{"name":"text","defaultValue":null,"type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"String"}}},` +
+				`{"name":"times","defaultValue":"1","type":{"kind":"SCALAR","name":"Int","ofType":null}}]}]}}`,
+		},
+		{
+			name:  "enum values",
+			query: `{ __type(name: "Level") { kind enumValues { name isDeprecated } fields { name } } }`,
+			data:  `{"__type":{"kind":"ENUM","enumValues":[{"name":"BASIC","isDeprecated":false},{"name":"ADVANCED","isDeprecated":false}],"fields":null}}`,
+		},
+		{
+			name:  "input fields",
+			query: `{ __type(name: "CourseFilter") { kind inputFields { name type { kind ofType { kind ofType { name } } } } } }`,
+			data: `{"__type":{"kind":"INPUT_OBJECT","inputFields":[` +
+				`{"name":"level","type":{"kind":"ENUM","ofType":null}},` +
+				`{"name":"startedAfter","type":{"kind":"SCALAR","ofType":null}},` +
+				`{"name":"ids","type":{"kind":"LIST","ofType":{"kind":"NON_NULL","ofType":{"name":"ID"}}}}]}}`,
+		},
+		{
+			name:  "unknown type",
+			query: `{ __type(name: "Missing") { name } }`,
+			data:  `{"__type":null}`,
+		},
+		{
+			name:  "directives",
+			query: `{ __schema { directives { name locations args { name } } } }`,
+			data: `{"__schema":{"directives":[` +
+				`{"name":"include","locations":["FIELD","FRAGMENT_SPREAD","INLINE_FRAGMENT"],"args":[{"name":"if"}]},` +
+				`{"name":"skip","locations":["FIELD","FRAGMENT_SPREAD","INLINE_FRAGMENT"],"args":[{"name":"if"}]}]}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, errs := execute(t, newTestSchema(t), test.query, nil)
+			if len(errs) > 0 {
+				t.Fatalf("errors = %v", errorMessages(errs))
+			}
+			if data != test.data {
+				t.Errorf("data = %v, want %v", data, test.data)
+			}
+		})
+	}
+}
+
+func TestIntrospectionTypes(t *testing.T) {
+	data, errs := execute(t, newTestSchema(t), `{ __schema { types { name kind } } }`, nil)
+	if len(errs) > 0 {
+		t.Fatalf("errors = %v", errorMessages(errs))
+	}
+	var result struct {
+		Schema struct {
+			Types []struct {
+				Name string
+				Kind string
+			}
+		} `json:"__schema"`
+	}
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]string{}
+	previous := ""
+	for _, typ := range result.Schema.Types {
+		if typ.Name < previous {
+			t.Errorf("type %v is after %v, types should be sorted by names", typ.Name, previous)
+		}
+		previous = typ.Name
+		kinds[typ.Name] = typ.Kind
+	}
+	want := map[string]string{
+		"Query": "OBJECT", "Course": "OBJECT", "Block": "OBJECT", "Level": "ENUM", "CourseFilter": "INPUT_OBJECT",
+		"ID": "SCALAR", "String": "SCALAR", "Int": "SCALAR", "Boolean": "SCALAR", "DateTime": "SCALAR",
+		"__Schema": "OBJECT", "__Type": "OBJECT", "__TypeKind": "ENUM", "__Field": "OBJECT",
+	}
+	for name, kind := range want {
+		if kinds[name] != kind {
+			t.Errorf("type %v has kind %q, want %q", name, kinds[name], kind)
+		}
+	}
+	if _, ok := kinds["Float"]; ok {
+		t.Errorf("unused Float type is in the schema")
+	}
+}
@@ -0,0 +1,245 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	punctuatorToken
+	nameToken
+	intToken
+	floatToken
+	stringToken
+)
+
+type token struct {
+	kind     tokenKind
+	value    string
+	location Location
+}
+
+// lexer splits GraphQL document into tokens, commas and comments are ignored
+type lexer struct {
+	source string
+	offset int
+	line   int
+	column int
+}
+
+func newLexer(source string) *lexer {
+	return &lexer{source: strings.TrimPrefix(source, "\uFEFF"), line: 1, column: 1}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	location := Location{Line: l.line, Column: l.column}
+	if l.offset >= len(l.source) {
+		return token{kind: eofToken, location: location}, nil
+	}
+	c := l.source[l.offset]
+	switch {
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		l.advance(1)
+		return token{kind: punctuatorToken, value: string(c), location: location}, nil
+	case c == '.':
+		if !strings.HasPrefix(l.source[l.offset:], "...") {
+			return token{}, syntaxError(location, "Unexpected \".\"")
+		}
+		l.advance(3)
+		return token{kind: punctuatorToken, value: "...", location: location}, nil
+	case c == '_' || isLetter(c):
+		start := l.offset
+		for l.offset < len(l.source) && (l.source[l.offset] == '_' || isLetter(l.source[l.offset]) || isDigit(l.source[l.offset])) {
+			l.advance(1)
+		}
+		return token{kind: nameToken, value: l.source[start:l.offset], location: location}, nil
+	case c == '-' || isDigit(c):
+		return l.number(location)
+	case c == '"':
+		if strings.HasPrefix(l.source[l.offset:], `"""`) {
+			return l.blockString(location)
+		}
+		return l.string(location)
+	}
+	r, _ := utf8.DecodeRuneInString(l.source[l.offset:])
+	return token{}, syntaxError(location, fmt.Sprintf("Unexpected character %q", r))
+}
+
+func (l *lexer) skipIgnored() {
+	for l.offset < len(l.source) {
+		switch c := l.source[l.offset]; c {
+		case ' ', '\t', ',', '\r':
+			l.advance(1)
+		case '\n':
+			l.offset++
+			l.line, l.column = l.line+1, 1
+		case '#':
+			for l.offset < len(l.source) && l.source[l.offset] != '\n' {
+				l.advance(1)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) advance(n int) {
+	l.offset += n
+	l.column += n
+}
+
+func (l *lexer) number(location Location) (token, error) {
+	start := l.offset
+	kind := intToken
+	if l.source[l.offset] == '-' {
+		l.advance(1)
+	}
+	integerStart := l.offset
+	if !l.digits() || (l.source[integerStart] == '0' && l.offset-integerStart > 1) {
+		return token{}, syntaxError(location, "Invalid number")
+	}
+	if l.offset < len(l.source) && l.source[l.offset] == '.' {
+		kind = floatToken
+		l.advance(1)
+		if !l.digits() {
+			return token{}, syntaxError(location, "Invalid number")
+		}
+	}
+	if l.offset < len(l.source) && (l.source[l.offset] == 'e' || l.source[l.offset] == 'E') {
+		kind = floatToken
+		l.advance(1)
+		if l.offset < len(l.source) && (l.source[l.offset] == '+' || l.source[l.offset] == '-') {
+			l.advance(1)
+		}
+		if !l.digits() {
+			return token{}, syntaxError(location, "Invalid number")
+		}
+	}
+	if l.offset < len(l.source) && (l.source[l.offset] == '_' || l.source[l.offset] == '.' || isLetter(l.source[l.offset])) {
+		return token{}, syntaxError(location, "Invalid number")
+	}
+	return token{kind: kind, value: l.source[start:l.offset], location: location}, nil
+}
+
+func (l *lexer) digits() bool {
+	start := l.offset
+	for l.offset < len(l.source) && isDigit(l.source[l.offset]) {
+		l.advance(1)
+	}
+	return l.offset > start
+}
+
+func (l *lexer) string(location Location) (token, error) {
+	l.advance(1)
+	var value strings.Builder
+	for l.offset < len(l.source) {
+		c := l.source[l.offset]
+		switch {
+		case c == '"':
+			l.advance(1)
+			return token{kind: stringToken, value: value.String(), location: location}, nil
+		case c == '\n' || c == '\r':
+			return token{}, syntaxError(location, "Unterminated string")
+		case c == '\\':
+			if l.offset+1 >= len(l.source) {
+				return token{}, syntaxError(location, "Unterminated string")
+			}
+			escaped := l.source[l.offset+1]
+			if escaped == 'u' {
+				if l.offset+6 > len(l.source) {
+					return token{}, syntaxError(location, "Invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(l.source[l.offset+2:l.offset+6], 16, 32)
+				if err != nil {
+					return token{}, syntaxError(location, "Invalid unicode escape")
+				}
+				value.WriteRune(rune(code))
+				l.advance(6)
+				continue
+			}
+			replacement, ok := map[byte]string{'"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}[escaped]
+			if !ok {
+				return token{}, syntaxError(location, fmt.Sprintf("Invalid escape \\%c", escaped))
+			}
+			value.WriteString(replacement)
+			l.advance(2)
+		default:
+			_, size := utf8.DecodeRuneInString(l.source[l.offset:])
+			value.WriteString(l.source[l.offset : l.offset+size])
+			l.advance(size)
+		}
+	}
+	return token{}, syntaxError(location, "Unterminated string")
+}
+
+// blockString reads """block string""" and removes its common indentation
+func (l *lexer) blockString(location Location) (token, error) {
+	l.advance(3)
+	var raw strings.Builder
+	for l.offset < len(l.source) {
+		switch {
+		case strings.HasPrefix(l.source[l.offset:], `"""`):
+			l.advance(3)
+			return token{kind: stringToken, value: blockStringValue(raw.String()), location: location}, nil
+		case strings.HasPrefix(l.source[l.offset:], `\"""`):
+			raw.WriteString(`"""`)
+			l.advance(4)
+		case l.source[l.offset] == '\n':
+			raw.WriteByte('\n')
+			l.offset++
+			l.line, l.column = l.line+1, 1
+		default:
+			raw.WriteByte(l.source[l.offset])
+			l.advance(1)
+		}
+	}
+	return token{}, syntaxError(location, "Unterminated string")
+}
+
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func syntaxError(location Location, message string) *Error {
+	return &Error{Message: "Syntax error: " + message, Locations: []Location{location}}
+}
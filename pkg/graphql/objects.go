@@ -0,0 +1,164 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Objects builds object types of Go structs by reflection, the way encoding/json marshals them:
+// JSON names of struct fields become camel case fields ("video_id" -> "videoId") resolved from
+// the struct, fields of embedded structs are added inline. Slices are non-null lists of non-null
+// items, pointers are nullable. Maps, interfaces and raw JSON aren't exposed.
+// Types are named after Go types, a type used by several structs is built once.
+type Objects struct {
+	types map[reflect.Type]*Type
+}
+
+// NewObjects returns empty Objects
+func NewObjects() *Objects {
+	return &Objects{types: map[reflect.Type]*Type{}}
+}
+
+// Object returns object type of struct value or of a pointer to it. Fields can be added
+// and replaced in the returned type before the schema is made.
+func (objects *Objects) Object(value interface{}, description string) *Type {
+	structType := reflect.TypeOf(value)
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("graphql: %v isn't a struct", structType))
+	}
+	object := objects.object(structType)
+	if description != "" {
+		object.Description = description
+	}
+	return object
+}
+
+func (objects *Objects) object(structType reflect.Type) *Type {
+	if object, ok := objects.types[structType]; ok {
+		return object
+	}
+	object := &Type{Kind: ObjectKind, Name: structType.Name()}
+	objects.types[structType] = object
+	objects.addFields(object, structType, structType, nil)
+	return object
+}
+
+// addFields adds fields of struct fieldsType found at index of sourceType to object
+func (objects *Objects) addFields(object *Type, sourceType reflect.Type, fieldsType reflect.Type, index []int) {
+	for i := 0; i < fieldsType.NumField(); i++ {
+		structField := fieldsType.Field(i)
+		tag := structField.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		fieldIndex := append(append([]int{}, index...), i)
+		if structField.Anonymous && name == "" && structField.Type.Kind() == reflect.Struct {
+			objects.addFields(object, sourceType, structField.Type, fieldIndex)
+			continue
+		}
+		if structField.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = structField.Name
+		}
+		fieldType := objects.typeOf(structField.Type)
+		if fieldType == nil {
+			continue
+		}
+		object.AddFields(&Field{
+			Name:    camelCase(name),
+			Type:    fieldType,
+			Resolve: structFieldResolver(sourceType, fieldIndex),
+		})
+	}
+}
+
+// typeOf returns GraphQL type of values of Go type valueType, nil if it can't be exposed
+func (objects *Objects) typeOf(valueType reflect.Type) *Type {
+	if valueType == timeType {
+		return NonNull(DateTime)
+	}
+	switch valueType.Kind() {
+	case reflect.Ptr:
+		if t := objects.typeOf(valueType.Elem()); t != nil && t.Kind == NonNullKind {
+			return t.OfType
+		}
+		return nil
+	case reflect.Bool:
+		return NonNull(Boolean)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint8, reflect.Uint16:
+		return NonNull(Int)
+	case reflect.Float32, reflect.Float64:
+		return NonNull(Float)
+	case reflect.String:
+		return NonNull(String)
+	case reflect.Slice, reflect.Array:
+		if valueType.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		if item := objects.typeOf(valueType.Elem()); item != nil {
+			return NonNull(List(item))
+		}
+	case reflect.Struct:
+		return NonNull(objects.object(valueType))
+	}
+	return nil
+}
+
+// structFieldResolver resolves the field at index of sources of type sourceType.
+// Nil slices are resolved as empty lists.
+func structFieldResolver(sourceType reflect.Type, index []int) BatchResolveFunc {
+	return Resolve(func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+		value := reflect.ValueOf(source)
+		for value.Kind() == reflect.Ptr && !value.IsNil() {
+			value = value.Elem()
+		}
+		if value.Type() != sourceType {
+			return nil, fmt.Errorf("graphql: %v can't be resolved as %v", value.Type(), sourceType)
+		}
+		field := value.FieldByIndex(index)
+		if field.Kind() == reflect.Slice && field.IsNil() {
+			return reflect.MakeSlice(field.Type(), 0, 0).Interface(), nil
+		}
+		return field.Interface(), nil
+	})
+}
+
+// camelCase converts snake case JSON name or Go name to camel case
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	result := lowerInitial(parts[0])
+	for _, part := range parts[1:] {
+		if part != "" {
+			result += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return result
+}
+
+// lowerInitial lowers the leading upper case word: "URLName" -> "urlName", "ID" -> "id"
+func lowerInitial(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
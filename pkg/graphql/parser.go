@@ -0,0 +1,534 @@
+package graphql
+
+import "fmt"
+
+// Executable documents: operations and fragments with their selections
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string
+	name       string
+	variables  []*variableDefinition
+	directives []*directive
+	selections []selection
+	location   Location
+}
+
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue *value
+	location     Location
+}
+
+// typeRef is a type of variable definition: a named type, a list of ofType or non-null ofType
+type typeRef struct {
+	name    string
+	list    bool
+	nonNull bool
+	ofType  *typeRef
+}
+
+func (ref *typeRef) String() string {
+	switch {
+	case ref.nonNull:
+		return ref.ofType.String() + "!"
+	case ref.list:
+		return "[" + ref.ofType.String() + "]"
+	}
+	return ref.name
+}
+
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []*argument
+	directives []*directive
+	selections []selection
+	location   Location
+}
+
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	location   Location
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+	location      Location
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+	location      Location
+}
+
+type argument struct {
+	name     string
+	value    *value
+	location Location
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+	location  Location
+}
+
+type valueKind int
+
+const (
+	variableValue valueKind = iota
+	intValue
+	floatValue
+	stringValue
+	booleanValue
+	nullValue
+	enumValue
+	listValue
+	objectValue
+)
+
+// value is a literal of the document, raw is the name of variables and enums
+// and the text of scalars
+type value struct {
+	kind     valueKind
+	raw      string
+	list     []*value
+	fields   []*argument
+	location Location
+}
+
+type parser struct {
+	lexer *lexer
+	token token
+}
+
+// parse parses executable GraphQL document
+func parse(source string) (*document, error) {
+	p := &parser{lexer: newLexer(source)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.token.kind != eofToken {
+		switch {
+		case p.peek("{"):
+			location := p.token.location
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: selections, location: location})
+		case p.peekName("query", "mutation", "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peekName("fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[frag.name]; ok {
+				return nil, &Error{Message: fmt.Sprintf("There can be only one fragment named %q", frag.name), Locations: []Location{frag.location}}
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &Error{Message: "Document has no operations"}
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	next, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = next
+	return nil
+}
+
+func (p *parser) peek(punctuator string) bool {
+	return p.token.kind == punctuatorToken && p.token.value == punctuator
+}
+
+func (p *parser) peekName(names ...string) bool {
+	if p.token.kind != nameToken {
+		return false
+	}
+	for _, name := range names {
+		if p.token.value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// skip advances past punctuator if it is the current token
+func (p *parser) skip(punctuator string) (bool, error) {
+	if !p.peek(punctuator) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(punctuator string) error {
+	if !p.peek(punctuator) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != nameToken {
+		return "", p.unexpected()
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *parser) unexpected() error {
+	if p.token.kind == eofToken {
+		return syntaxError(p.token.location, "Unexpected end of document")
+	}
+	return syntaxError(p.token.location, fmt.Sprintf("Unexpected %q", p.token.value))
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.token.value, location: p.token.location}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.token.kind == nameToken {
+		if op.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if op.variables, err = p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if op.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() ([]*variableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var definitions []*variableDefinition
+	for !p.peek(")") {
+		definition := &variableDefinition{location: p.token.location}
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		var err error
+		if definition.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if definition.typ, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skip("="); err != nil {
+			return nil, err
+		} else if ok {
+			if definition.defaultValue, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err = p.directives(); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, p.advance()
+}
+
+func (p *parser) typeRef() (*typeRef, error) {
+	var ref *typeRef
+	if ok, err := p.skip("["); err != nil {
+		return nil, err
+	} else if ok {
+		ofType, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+		ref = &typeRef{list: true, ofType: ofType}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		ref = &typeRef{name: name}
+	}
+	if ok, err := p.skip("!"); err != nil {
+		return nil, err
+	} else if ok {
+		ref = &typeRef{nonNull: true, ofType: ref}
+	}
+	return ref, nil
+}
+
+func (p *parser) directives() ([]*directive, error) {
+	var directives []*directive
+	for p.peek("@") {
+		d := &directive{location: p.token.location}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if d.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if d.arguments, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	// selection sets can't be empty
+	var selections []selection
+	for len(selections) == 0 || !p.peek("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (selection, error) {
+	location := p.token.location
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		return p.fragmentSelection(location)
+	}
+
+	f := &field{location: location}
+	var err error
+	if f.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		f.alias = f.name
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if f.arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// fragmentSelection parses fragment spread or inline fragment after "..."
+func (p *parser) fragmentSelection(location Location) (selection, error) {
+	if p.token.kind == nameToken && p.token.value != "on" {
+		spread := &fragmentSpread{name: p.token.value, location: location}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		spread.directives, err = p.directives()
+		return spread, err
+	}
+	inline := &inlineFragment{location: location}
+	var err error
+	if p.peekName("on") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		if inline.typeCondition, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if inline.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if inline.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return inline, nil
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	frag := &fragment{location: p.token.location}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	if frag.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	if err = p.advance(); err != nil {
+		return nil, err
+	}
+	if frag.typeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if frag.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if frag.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+func (p *parser) arguments(constant bool) ([]*argument, error) {
+	if ok, err := p.skip("("); err != nil || !ok {
+		return nil, err
+	}
+	var arguments []*argument
+	for !p.peek(")") {
+		arg := &argument{location: p.token.location}
+		var err error
+		if arg.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if arg.value, err = p.value(constant); err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, arg)
+	}
+	return arguments, p.advance()
+}
+
+// value parses a literal, constant literals can't have variables
+func (p *parser) value(constant bool) (*value, error) {
+	v := &value{raw: p.token.value, location: p.token.location}
+	switch p.token.kind {
+	case intToken:
+		v.kind = intValue
+	case floatToken:
+		v.kind = floatValue
+	case stringToken:
+		v.kind = stringValue
+	case nameToken:
+		switch p.token.value {
+		case "true", "false":
+			v.kind = booleanValue
+		case "null":
+			v.kind = nullValue
+		default:
+			v.kind = enumValue
+		}
+	case punctuatorToken:
+		switch p.token.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected()
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v.kind = variableValue
+			var err error
+			v.raw, err = p.name()
+			return v, err
+		case "[":
+			v.kind = listValue
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			for !p.peek("]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.list = append(v.list, item)
+			}
+			return v, p.advance()
+		case "{":
+			v.kind = objectValue
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			for !p.peek("}") {
+				objectField := &argument{location: p.token.location}
+				var err error
+				if objectField.name, err = p.name(); err != nil {
+					return nil, err
+				}
+				if err = p.expect(":"); err != nil {
+					return nil, err
+				}
+				if objectField.value, err = p.value(constant); err != nil {
+					return nil, err
+				}
+				v.fields = append(v.fields, objectField)
+			}
+			return v, p.advance()
+		default:
+			return nil, p.unexpected()
+		}
+	default:
+		return nil, p.unexpected()
+	}
+	return v, p.advance()
+}
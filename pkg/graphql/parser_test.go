@@ -0,0 +1,140 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		# comments and commas are ignored
+		query Course($id: ID!, $kinds: [String!] = ["video", "problem"]) @skip(if: false) {
+			course(id: $id) {
+				title: displayName,
+				...Blocks @include(if: true)
+				... on Course { id }
+			}
+		}
+
+		fragment Blocks on Course {
+			blocks(filter: {kind: VIDEO, minScore: -1.5e2, tags: [], note: null, text: "a\"bé", block: """
+				indented
+				  "quoted"
+			"""})
+		}
+	`)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	if len(doc.operations) != 1 || len(doc.fragments) != 1 {
+		t.Fatalf("parsed %v operations and %v fragments, want 1 and 1", len(doc.operations), len(doc.fragments))
+	}
+	op := doc.operations[0]
+	if op.kind != "query" || op.name != "Course" || len(op.directives) != 1 {
+		t.Errorf("operation = %v %v with %v directives", op.kind, op.name, len(op.directives))
+	}
+	if len(op.variables) != 2 || op.variables[0].typ.String() != "ID!" || op.variables[1].typ.String() != "[String!]" {
+		t.Fatalf("variables = %+v", op.variables)
+	}
+	if op.variables[1].defaultValue == nil || len(op.variables[1].defaultValue.list) != 2 {
+		t.Errorf("default value of $kinds = %v, want list of 2 values", op.variables[1].defaultValue)
+	}
+	if op.location != (Location{Line: 3, Column: 3}) {
+		t.Errorf("operation location = %v, want 3:3", op.location)
+	}
+
+	course := op.selections[0].(*field)
+	if course.name != "course" || len(course.arguments) != 1 || course.arguments[0].value.kind != variableValue {
+		t.Fatalf("course field = %+v", course)
+	}
+	if len(course.selections) != 3 {
+		t.Fatalf("course has %v selections, want 3", len(course.selections))
+	}
+	if title := course.selections[0].(*field); title.alias != "title" || title.name != "displayName" || title.responseKey() != "title" {
+		t.Errorf("aliased field = %+v", title)
+	}
+	if spread := course.selections[1].(*fragmentSpread); spread.name != "Blocks" || len(spread.directives) != 1 {
+		t.Errorf("fragment spread = %+v", spread)
+	}
+	if inline := course.selections[2].(*inlineFragment); inline.typeCondition != "Course" || len(inline.selections) != 1 {
+		t.Errorf("inline fragment = %+v", inline)
+	}
+
+	blocks := doc.fragments["Blocks"].selections[0].(*field)
+	fields := map[string]*value{}
+	for _, objectField := range blocks.arguments[0].value.fields {
+		fields[objectField.name] = objectField.value
+	}
+	want := map[string]struct {
+		kind valueKind
+		raw  string
+	}{
+		"kind":     {enumValue, "VIDEO"},
+		"minScore": {floatValue, "-1.5e2"},
+		"tags":     {listValue, ""},
+		"note":     {nullValue, ""},
+		"text":     {stringValue, "a\"bé"},
+		"block":    {stringValue, "indented\n  \"quoted\""},
+	}
+	for name, expected := range want {
+		v, ok := fields[name]
+		if !ok {
+			t.Errorf("field %v of the object value is missing", name)
+			continue
+		}
+		if v.kind != expected.kind || (expected.raw != "" && v.raw != expected.raw) {
+			t.Errorf("field %v = %v %q, want %v %q", name, v.kind, v.raw, expected.kind, expected.raw)
+		}
+	}
+}
+
+func TestParseShorthandQuery(t *testing.T) {
+	doc, err := parse(`{ a { b } }`)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if op := doc.operations[0]; op.kind != "query" || op.name != "" || len(op.selections) != 1 {
+		t.Errorf("operation = %+v, want anonymous query", op)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source   string
+		message  string
+		location Location
+	}{
+		{`{ a(b: "x) }`, `Syntax error: Unterminated string`, Location{1, 8}},
+		{`{ a(b: "\x") }`, `Syntax error: Invalid escape \x`, Location{1, 8}},
+		{`{ a(b: "\u00zz") }`, `Syntax error: Invalid unicode escape`, Location{1, 8}},
+		{`{ a(b: 01) }`, `Syntax error: Invalid number`, Location{1, 8}},
+		{`{ a(b: 1.) }`, `Syntax error: Invalid number`, Location{1, 8}},
+		{`{ a ..b }`, `Syntax error: Unexpected "."`, Location{1, 5}},
+		{"{ a \n  % }", `Syntax error: Unexpected character '%'`, Location{2, 3}},
+		{`{ a }}`, `Syntax error: Unexpected "}"`, Location{1, 6}},
+		{`query { a `, `Syntax error: Unexpected end of document`, Location{1, 11}},
+		{`{ a(b) }`, `Syntax error: Unexpected ")"`, Location{1, 6}},
+		{`{ }`, `Syntax error: Unexpected "}"`, Location{1, 3}},
+		{`fragment F on Course { a } fragment F on Course { b }`, `There can be only one fragment named "F"`, Location{1, 28}},
+		{`fragment F on Course { a }`, `Document has no operations`, Location{}},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			_, err := parse(test.source)
+			graphqlErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("parse() error = %v, want *Error", err)
+			}
+			if graphqlErr.Message != test.message {
+				t.Errorf("message = %q, want %q", graphqlErr.Message, test.message)
+			}
+			if test.location == (Location{}) {
+				if len(graphqlErr.Locations) != 0 {
+					t.Errorf("locations = %v, want none", graphqlErr.Locations)
+				}
+			} else if len(graphqlErr.Locations) != 1 || graphqlErr.Locations[0] != test.location {
+				t.Errorf("locations = %v, want %v", graphqlErr.Locations, test.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Kind is a kind of GraphQL type
+type Kind string
+
+// Kinds of types, interfaces and unions aren't supported
+const (
+	ScalarKind      Kind = "SCALAR"
+	ObjectKind      Kind = "OBJECT"
+	EnumKind        Kind = "ENUM"
+	InputObjectKind Kind = "INPUT_OBJECT"
+	ListKind        Kind = "LIST"
+	NonNullKind     Kind = "NON_NULL"
+)
+
+// Type is a GraphQL type. Named types have Name, lists and non-null types wrap OfType.
+// Objects have Fields, input objects have InputFields and enums have EnumValues.
+type Type struct {
+	Kind        Kind
+	Name        string
+	Description string
+	OfType      *Type
+	Fields      []*Field
+	InputFields []*InputValue
+	EnumValues  []*EnumValue
+
+	// serialize converts resolved values of scalars to JSON values
+	serialize func(value interface{}) (interface{}, error)
+	// parse converts input values of scalars: Go values of literals (int64, float64,
+	// string, bool) or JSON values of variables
+	parse func(value interface{}) (interface{}, error)
+}
+
+// Field is a field of an object type. Arguments are passed to Resolve coerced to Args types
+// with their defaults, input objects are maps.
+type Field struct {
+	Name        string
+	Description string
+	Type        *Type
+	Args        []*InputValue
+	Resolve     BatchResolveFunc
+}
+
+// BatchResolveFunc resolves the field of every source object at once, it returns a value
+// for every source. A value that is an error is the error of the field of that source only.
+type BatchResolveFunc func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error)
+
+// ResolveFunc resolves the field of a single source object
+type ResolveFunc func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error)
+
+// Resolve makes BatchResolveFunc calling resolve for every source, for cheap fields
+func Resolve(resolve ResolveFunc) BatchResolveFunc {
+	return func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		values := make([]interface{}, len(sources))
+		for i, source := range sources {
+			value, err := resolve(ctx, source, args)
+			if err != nil {
+				values[i] = err
+				continue
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+}
+
+// InputValue is an argument of a field or a field of an input object.
+// DefaultValue is used if the value is missing, nil means no default.
+type InputValue struct {
+	Name         string
+	Description  string
+	Type         *Type
+	DefaultValue interface{}
+}
+
+// EnumValue is a value of an enum type
+type EnumValue struct {
+	Name        string
+	Description string
+}
+
+// NonNull returns non-null type of ofType
+func NonNull(ofType *Type) *Type {
+	return &Type{Kind: NonNullKind, OfType: ofType}
+}
+
+// List returns type of lists of ofType
+func List(ofType *Type) *Type {
+	return &Type{Kind: ListKind, OfType: ofType}
+}
+
+// NewObject returns object type with fields
+func NewObject(name string, description string, fields ...*Field) *Type {
+	return &Type{Kind: ObjectKind, Name: name, Description: description, Fields: fields}
+}
+
+// NewEnum returns enum type of values
+func NewEnum(name string, description string, values ...string) *Type {
+	enum := &Type{Kind: EnumKind, Name: name, Description: description}
+	for _, value := range values {
+		enum.EnumValues = append(enum.EnumValues, &EnumValue{Name: value})
+	}
+	return enum
+}
+
+// NewInputObject returns input object type with fields
+func NewInputObject(name string, description string, fields ...*InputValue) *Type {
+	return &Type{Kind: InputObjectKind, Name: name, Description: description, InputFields: fields}
+}
+
+// NewScalar returns scalar type. serialize converts resolved values to JSON values, parse
+// converts input values: Go values of literals (int64, float64, string, bool) or JSON values
+// of variables (float64 or json.Number numbers).
+func NewScalar(name string, description string, serialize func(value interface{}) (interface{}, error), parse func(value interface{}) (interface{}, error)) *Type {
+	return &Type{Kind: ScalarKind, Name: name, Description: description, serialize: serialize, parse: parse}
+}
+
+// Field returns the field named name, nil if there is no such field
+func (t *Type) Field(name string) *Field {
+	for _, field := range t.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// AddFields adds fields to object type t, fields with the same names are replaced
+func (t *Type) AddFields(fields ...*Field) *Type {
+	for _, field := range fields {
+		replaced := false
+		for i, existing := range t.Fields {
+			if existing.Name == field.Name {
+				t.Fields[i], replaced = field, true
+			}
+		}
+		if !replaced {
+			t.Fields = append(t.Fields, field)
+		}
+	}
+	return t
+}
+
+// RemoveFields removes fields named names from object type t
+func (t *Type) RemoveFields(names ...string) *Type {
+	fields := t.Fields[:0]
+	for _, field := range t.Fields {
+		removed := false
+		for _, name := range names {
+			removed = removed || field.Name == name
+		}
+		if !removed {
+			fields = append(fields, field)
+		}
+	}
+	t.Fields = fields
+	return t
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case NonNullKind:
+		return t.OfType.String() + "!"
+	case ListKind:
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.Name
+}
+
+// named returns the named type wrapped by lists and non-null types
+func (t *Type) named() *Type {
+	for t.OfType != nil {
+		t = t.OfType
+	}
+	return t
+}
+
+func (t *Type) isLeaf() bool {
+	kind := t.named().Kind
+	return kind == ScalarKind || kind == EnumKind
+}
+
+func (t *Type) isInput() bool {
+	kind := t.named().Kind
+	return kind == ScalarKind || kind == EnumKind || kind == InputObjectKind
+}
+
+func (t *Type) hasEnumValue(name string) bool {
+	for _, value := range t.EnumValues {
+		if value.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Type) inputField(name string) *InputValue {
+	for _, field := range t.InputFields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// Schema is a GraphQL schema with a query type
+type Schema struct {
+	query      *Type
+	types      map[string]*Type
+	directives []*directiveDefinition
+
+	// MaxDepth limits nesting of fields in queries
+	MaxDepth int
+	// MaxFields limits the number of fields in queries with fragments expanded
+	MaxFields int
+	// PresentError converts errors of resolvers to field errors, by default
+	// the message of the error is sent
+	PresentError func(ctx context.Context, err error) *Error
+}
+
+// directiveDefinition is a directive the schema supports
+type directiveDefinition struct {
+	name        string
+	description string
+	locations   []string
+	args        []*InputValue
+}
+
+// NewSchema returns schema of query type, types used by the fields are collected from it.
+// Different types can't have the same name.
+func NewSchema(query *Type) (*Schema, error) {
+	schema := &Schema{
+		query:     query,
+		types:     map[string]*Type{},
+		MaxDepth:  20,
+		MaxFields: 1000,
+		directives: []*directiveDefinition{
+			{
+				name:        "include",
+				description: "Directs the executor to include this field or fragment only when the `if` argument is true.",
+				locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+				args:        []*InputValue{{Name: "if", Description: "Included when true.", Type: NonNull(Boolean)}},
+			},
+			{
+				name:        "skip",
+				description: "Directs the executor to skip this field or fragment when the `if` argument is true.",
+				locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+				args:        []*InputValue{{Name: "if", Description: "Skipped when true.", Type: NonNull(Boolean)}},
+			},
+		},
+	}
+	if query == nil || query.Kind != ObjectKind {
+		return nil, errors.New("Query type must be an object type")
+	}
+	roots := []*Type{query, String, Boolean, introspectionSchemaType}
+	for _, root := range roots {
+		if err := schema.collect(root); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// collect adds t and the types of its fields, arguments and input fields to schema types
+func (schema *Schema) collect(t *Type) error {
+	t = t.named()
+	if t.Name == "" {
+		return errors.New("Named types must have names")
+	}
+	if existing, ok := schema.types[t.Name]; ok {
+		if existing != t {
+			return fmt.Errorf("Schema has different types named %v", t.Name)
+		}
+		return nil
+	}
+	schema.types[t.Name] = t
+	for _, field := range t.Fields {
+		if field.Resolve == nil {
+			return fmt.Errorf("Field %v.%v has no resolver", t.Name, field.Name)
+		}
+		if err := schema.collect(field.Type); err != nil {
+			return err
+		}
+		for _, arg := range field.Args {
+			if !arg.Type.isInput() {
+				return fmt.Errorf("Argument %v of field %v.%v must have input type", arg.Name, t.Name, field.Name)
+			}
+			if err := schema.collect(arg.Type); err != nil {
+				return err
+			}
+		}
+	}
+	for _, field := range t.InputFields {
+		if !field.Type.isInput() {
+			return fmt.Errorf("Field %v.%v must have input type", t.Name, field.Name)
+		}
+		if err := schema.collect(field.Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedTypes returns the types of schema sorted by names
+func (schema *Schema) sortedTypes() []*Type {
+	types := make([]*Type, 0, len(schema.types))
+	for _, t := range schema.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+func (schema *Schema) directive(name string) *directiveDefinition {
+	for _, directive := range schema.directives {
+		if directive.name == name {
+			return directive
+		}
+	}
+	return nil
+}
+
+// Built-in scalars
+var (
+	Int = NewScalar("Int", "The `Int` scalar type represents non-fractional signed whole numeric values from -2^31 to 2^31-1.",
+		serializeInt, parseInt)
+	Float = NewScalar("Float", "The `Float` scalar type represents signed double-precision fractional values as specified by IEEE 754.",
+		serializeFloat, parseFloat)
+	String = NewScalar("String", "The `String` scalar type represents textual data as UTF-8 character sequences.",
+		serializeString, parseString)
+	Boolean = NewScalar("Boolean", "The `Boolean` scalar type represents `true` or `false`.",
+		serializeBoolean, parseBoolean)
+	ID = NewScalar("ID", "The `ID` scalar type represents a unique identifier serialized as a string.",
+		serializeString, parseID)
+	// DateTime is time.Time sent and received in RFC 3339 format
+	DateTime = NewScalar("DateTime", "Date and time in RFC 3339 format.", serializeDateTime, parseDateTime)
+)
+
+func serializeInt(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == math.Trunc(f) {
+			return int64(f), nil
+		}
+	}
+	return nil, fmt.Errorf("Int cannot represent value %v", value)
+}
+
+func parseInt(value interface{}) (interface{}, error) {
+	var number float64
+	switch v := value.(type) {
+	case int:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case float64:
+		number = v
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("Int cannot represent value %v", value)
+		}
+		number = parsed
+	default:
+		return nil, fmt.Errorf("Int cannot represent value %v", value)
+	}
+	if number != math.Trunc(number) || number < math.MinInt32 || number > math.MaxInt32 {
+		return nil, fmt.Errorf("Int cannot represent non 32-bit signed integer value %v", value)
+	}
+	return int(number), nil
+}
+
+func serializeFloat(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("Float cannot represent value %v", value)
+}
+
+func parseFloat(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case json.Number:
+		if number, err := v.Float64(); err == nil {
+			return number, nil
+		}
+	}
+	return nil, fmt.Errorf("Float cannot represent value %v", value)
+}
+
+func serializeString(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	}
+	if stringer, ok := value.(fmt.Stringer); ok {
+		return stringer.String(), nil
+	}
+	return nil, fmt.Errorf("String cannot represent value %v", value)
+}
+
+func parseString(value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("String cannot represent value %v", value)
+}
+
+func parseID(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return v.String(), nil
+		}
+	case float64:
+		if v == math.Trunc(v) {
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+	}
+	return nil, fmt.Errorf("ID cannot represent value %v", value)
+}
+
+func serializeBoolean(value interface{}) (interface{}, error) {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Bool {
+		return v.Bool(), nil
+	}
+	return nil, fmt.Errorf("Boolean cannot represent value %v", value)
+}
+
+func parseBoolean(value interface{}) (interface{}, error) {
+	if b, ok := value.(bool); ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("Boolean cannot represent value %v", value)
+}
+
+func serializeDateTime(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case *time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	}
+	return nil, fmt.Errorf("DateTime cannot represent value %v", value)
+}
+
+func parseDateTime(value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("DateTime cannot represent value %v, it should be in RFC 3339 format", value)
+}
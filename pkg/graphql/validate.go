@@ -0,0 +1,440 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+)
+
+// validator checks the document against the schema before execution
+type validator struct {
+	schema        *Schema
+	doc           *document
+	errs          []*Error
+	usedFragments map[string]bool
+}
+
+// operationScope is the state of validation of an operation
+type operationScope struct {
+	op        *operation
+	variables map[string]*variableDefinition
+	types     map[string]*Type
+	used      map[string]bool
+	visited   map[string]bool
+}
+
+// variablePlaceholder stands for values of variables during validation
+type variablePlaceholder struct{}
+
+func (schema *Schema) validate(doc *document) []*Error {
+	v := &validator{schema: schema, doc: doc, usedFragments: map[string]bool{}}
+	v.checkOperationNames()
+	v.checkFragmentDefinitions()
+	if v.checkFragmentCycles(); len(v.errs) > 0 {
+		return v.errs
+	}
+	for _, op := range doc.operations {
+		v.checkOperation(op)
+	}
+	for _, name := range sortedFragmentNames(doc) {
+		if !v.usedFragments[name] {
+			v.errorf(doc.fragments[name].location, "Fragment %q is never used", name)
+		}
+	}
+	return v.errs
+}
+
+func (v *validator) errorf(location Location, format string, args ...interface{}) {
+	v.errs = append(v.errs, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{location}})
+}
+
+func (v *validator) checkOperationNames() {
+	names := map[string]bool{}
+	for _, op := range v.doc.operations {
+		if op.name == "" && len(v.doc.operations) > 1 {
+			v.errorf(op.location, "This anonymous operation must be the only defined operation")
+		}
+		if op.name != "" && names[op.name] {
+			v.errorf(op.location, "There can be only one operation named %q", op.name)
+		}
+		names[op.name] = true
+		if op.kind != "query" {
+			v.errorf(op.location, "Schema is not configured for %vs", op.kind)
+		}
+	}
+}
+
+func (v *validator) checkFragmentDefinitions() {
+	for _, name := range sortedFragmentNames(v.doc) {
+		frag := v.doc.fragments[name]
+		v.checkDirectives(frag.directives, "FRAGMENT_DEFINITION", nil)
+		t, ok := v.schema.types[frag.typeCondition]
+		if !ok {
+			v.errorf(frag.location, "Unknown type %q", frag.typeCondition)
+		} else if t.Kind != ObjectKind {
+			v.errorf(frag.location, "Fragment %q cannot condition on non composite type %q", name, t.Name)
+		}
+	}
+}
+
+// checkFragmentCycles reports fragments spreading themselves directly or through other fragments
+func (v *validator) checkFragmentCycles() {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	states := map[string]int{}
+	var visit func(name string, location Location)
+	visit = func(name string, location Location) {
+		frag, ok := v.doc.fragments[name]
+		if !ok || states[name] == done {
+			return
+		}
+		if states[name] == visiting {
+			v.errorf(location, "Cannot spread fragment %q within itself", name)
+			return
+		}
+		states[name] = visiting
+		for _, spread := range fragmentSpreads(frag.selections) {
+			visit(spread.name, spread.location)
+		}
+		states[name] = done
+	}
+	for _, name := range sortedFragmentNames(v.doc) {
+		visit(name, v.doc.fragments[name].location)
+	}
+}
+
+// fragmentSpreads returns fragment spreads of selections and of their nested selections
+func fragmentSpreads(selections []selection) []*fragmentSpread {
+	var spreads []*fragmentSpread
+	for _, s := range selections {
+		switch s := s.(type) {
+		case *field:
+			spreads = append(spreads, fragmentSpreads(s.selections)...)
+		case *inlineFragment:
+			spreads = append(spreads, fragmentSpreads(s.selections)...)
+		case *fragmentSpread:
+			spreads = append(spreads, s)
+		}
+	}
+	return spreads
+}
+
+func (v *validator) checkOperation(op *operation) {
+	scope := &operationScope{
+		op:        op,
+		variables: map[string]*variableDefinition{},
+		types:     map[string]*Type{},
+		used:      map[string]bool{},
+		visited:   map[string]bool{},
+	}
+	v.checkDirectives(op.directives, "QUERY", nil)
+	for _, definition := range op.variables {
+		if _, ok := scope.variables[definition.name]; ok {
+			v.errorf(definition.location, "There can be only one variable named \"$%v\"", definition.name)
+			continue
+		}
+		scope.variables[definition.name] = definition
+		t := v.schema.typeOfRef(definition.typ)
+		if t == nil {
+			v.errorf(definition.location, "Unknown type %q", definition.typ.String())
+			continue
+		}
+		if !t.isInput() {
+			v.errorf(definition.location, "Variable \"$%v\" cannot be non-input type %q", definition.name, t)
+			continue
+		}
+		scope.types[definition.name] = t
+		if definition.defaultValue != nil {
+			if _, _, err := coerceLiteral(definition.defaultValue, t, nil); err != nil {
+				v.errs = append(v.errs, err.(*Error))
+			}
+		}
+	}
+
+	v.checkSelections(op.selections, v.schema.query, scope)
+
+	for _, definition := range op.variables {
+		if !scope.used[definition.name] {
+			v.errorf(definition.location, "Variable \"$%v\" is never used%v", definition.name, operationSuffix(op))
+		}
+	}
+	depth, fields := v.measure(op.selections, map[string][2]int{})
+	if depth > v.schema.MaxDepth {
+		v.errorf(op.location, "Query is too deep: %v levels of fields, at most %v are allowed", depth, v.schema.MaxDepth)
+	}
+	if fields > v.schema.MaxFields {
+		v.errorf(op.location, "Query has too many fields: more than %v with fragments expanded", v.schema.MaxFields)
+	}
+}
+
+func operationSuffix(op *operation) string {
+	if op.name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" in operation %q", op.name)
+}
+
+func (v *validator) checkSelections(selections []selection, parent *Type, scope *operationScope) {
+	v.checkResponseKeys(selections, scope.variables)
+	for _, s := range selections {
+		switch s := s.(type) {
+		case *field:
+			v.checkField(s, parent, scope)
+		case *inlineFragment:
+			v.checkDirectives(s.directives, "INLINE_FRAGMENT", scope)
+			if s.typeCondition != "" && s.typeCondition != parent.Name {
+				if _, ok := v.schema.types[s.typeCondition]; !ok {
+					v.errorf(s.location, "Unknown type %q", s.typeCondition)
+				} else {
+					v.errorf(s.location, "Fragment cannot be spread here as objects of type %q can never be of type %q", parent.Name, s.typeCondition)
+				}
+				continue
+			}
+			v.checkSelections(s.selections, parent, scope)
+		case *fragmentSpread:
+			v.checkDirectives(s.directives, "FRAGMENT_SPREAD", scope)
+			frag, ok := v.doc.fragments[s.name]
+			if !ok {
+				v.errorf(s.location, "Unknown fragment %q", s.name)
+				continue
+			}
+			v.usedFragments[s.name] = true
+			if frag.typeCondition != parent.Name {
+				if _, ok := v.schema.types[frag.typeCondition]; ok {
+					v.errorf(s.location, "Fragment %q cannot be spread here as objects of type %q can never be of type %q", s.name, parent.Name, frag.typeCondition)
+				}
+				continue
+			}
+			if !scope.visited[s.name] {
+				scope.visited[s.name] = true
+				v.checkSelections(frag.selections, parent, scope)
+			}
+		}
+	}
+}
+
+func (v *validator) checkField(f *field, parent *Type, scope *operationScope) {
+	v.checkDirectives(f.directives, "FIELD", scope)
+	if f.name == "__typename" {
+		v.checkArguments(f.arguments, nil, f.location, fmt.Sprintf("field %q", f.name), scope)
+		if len(f.selections) > 0 {
+			v.errorf(f.location, "Field %q must not have a selection since type \"String!\" has no subfields", f.name)
+		}
+		return
+	}
+	definition := v.schema.fieldOf(parent, f.name)
+	if definition == nil {
+		v.errorf(f.location, "Cannot query field %q on type %q", f.name, parent.Name)
+		return
+	}
+	v.checkArguments(f.arguments, definition.Args, f.location, fmt.Sprintf("field \"%v.%v\"", parent.Name, f.name), scope)
+	switch {
+	case definition.Type.isLeaf() && len(f.selections) > 0:
+		v.errorf(f.location, "Field %q must not have a selection since type %q has no subfields", f.name, definition.Type)
+	case !definition.Type.isLeaf() && len(f.selections) == 0:
+		v.errorf(f.location, "Field %q of type %q must have a selection of subfields", f.name, definition.Type)
+	case len(f.selections) > 0:
+		v.checkSelections(f.selections, definition.Type.named(), scope)
+	}
+}
+
+// checkArguments checks arguments args of owner against definitions
+func (v *validator) checkArguments(args []*argument, definitions []*InputValue, location Location, owner string, scope *operationScope) {
+	given := map[string]bool{}
+	for _, arg := range args {
+		if given[arg.name] {
+			v.errorf(arg.location, "There can be only one argument named %q", arg.name)
+			continue
+		}
+		given[arg.name] = true
+		var definition *InputValue
+		for _, d := range definitions {
+			if d.Name == arg.name {
+				definition = d
+			}
+		}
+		if definition == nil {
+			v.errorf(arg.location, "Unknown argument %q on %v", arg.name, owner)
+			continue
+		}
+		if _, _, err := coerceLiteral(arg.value, definition.Type, v.variableUsage(scope, definition.DefaultValue != nil)); err != nil {
+			if graphqlErr, ok := err.(*Error); ok {
+				v.errs = append(v.errs, graphqlErr)
+			} else {
+				v.errorf(arg.location, "%v", err)
+			}
+		}
+	}
+	for _, definition := range definitions {
+		if !given[definition.Name] && definition.Type.Kind == NonNullKind && definition.DefaultValue == nil {
+			v.errorf(location, "Argument %q of required type %q on %v was not provided", definition.Name, definition.Type, owner)
+		}
+	}
+}
+
+// variableUsage checks variables used in a position with or without default value
+func (v *validator) variableUsage(scope *operationScope, positionHasDefault bool) variableLookup {
+	return func(name string, expected *Type, location Location) (interface{}, bool, error) {
+		if scope == nil {
+			return nil, false, &Error{Message: fmt.Sprintf("Variable \"$%v\" can't be used here", name), Locations: []Location{location}}
+		}
+		scope.used[name] = true
+		definition, ok := scope.variables[name]
+		if !ok {
+			return nil, false, &Error{Message: fmt.Sprintf("Variable \"$%v\" is not defined%v", name, operationSuffix(scope.op)), Locations: []Location{location}}
+		}
+		t, ok := scope.types[name]
+		if !ok {
+			// the definition is already reported
+			return variablePlaceholder{}, true, nil
+		}
+		if !variableAllowed(t, definition.defaultValue != nil || positionHasDefault, expected) {
+			return nil, false, &Error{
+				Message:   fmt.Sprintf("Variable \"$%v\" of type %q used in position expecting type %q", name, t, expected),
+				Locations: []Location{location},
+			}
+		}
+		return variablePlaceholder{}, true, nil
+	}
+}
+
+// variableAllowed tells if variable of type t can be used where expected type is expected.
+// Nullable variables can be used in non-null positions if there is a default value.
+func variableAllowed(t *Type, hasDefault bool, expected *Type) bool {
+	if expected.Kind == NonNullKind && t.Kind != NonNullKind {
+		if !hasDefault {
+			return false
+		}
+		expected = expected.OfType
+	}
+	return isSubType(t, expected)
+}
+
+func isSubType(t *Type, super *Type) bool {
+	switch {
+	case super.Kind == NonNullKind:
+		return t.Kind == NonNullKind && isSubType(t.OfType, super.OfType)
+	case t.Kind == NonNullKind:
+		return isSubType(t.OfType, super)
+	case super.Kind == ListKind:
+		return t.Kind == ListKind && isSubType(t.OfType, super.OfType)
+	case t.Kind == ListKind:
+		return false
+	}
+	return t == super
+}
+
+func (v *validator) checkDirectives(directives []*directive, location string, scope *operationScope) {
+	seen := map[string]bool{}
+	for _, d := range directives {
+		definition := v.schema.directive(d.name)
+		if definition == nil {
+			v.errorf(d.location, "Unknown directive \"@%v\"", d.name)
+			continue
+		}
+		if seen[d.name] {
+			v.errorf(d.location, "The directive \"@%v\" can only be used once at this location", d.name)
+		}
+		seen[d.name] = true
+		allowed := false
+		for _, l := range definition.locations {
+			allowed = allowed || l == location
+		}
+		if !allowed {
+			v.errorf(d.location, "Directive \"@%v\" may not be used on %v", d.name, location)
+			continue
+		}
+		v.checkArguments(d.arguments, definition.args, d.location, "directive \"@"+d.name+"\"", scope)
+	}
+}
+
+// checkResponseKeys reports fields of a selection set with the same response key
+// that are different fields or have different arguments
+func (v *validator) checkResponseKeys(selections []selection, variables map[string]*variableDefinition) {
+	fields := map[string]*field{}
+	visited := map[string]bool{}
+	var check func(selections []selection)
+	check = func(selections []selection) {
+		for _, s := range selections {
+			switch s := s.(type) {
+			case *field:
+				key := s.responseKey()
+				other, ok := fields[key]
+				if !ok {
+					fields[key] = s
+					continue
+				}
+				if other.name != s.name {
+					v.errorf(s.location, "Fields %q conflict because %q and %q are different fields, use different aliases on the fields", key, other.name, s.name)
+				} else if argumentsString(other.arguments) != argumentsString(s.arguments) {
+					v.errorf(s.location, "Fields %q conflict because they have differing arguments, use different aliases on the fields", key)
+				}
+			case *inlineFragment:
+				check(s.selections)
+			case *fragmentSpread:
+				if frag, ok := v.doc.fragments[s.name]; ok && !visited[s.name] {
+					visited[s.name] = true
+					check(frag.selections)
+				}
+			}
+		}
+	}
+	check(selections)
+}
+
+func argumentsString(args []*argument) string {
+	printed := make([]string, 0, len(args))
+	for _, arg := range args {
+		printed = append(printed, arg.name+":"+arg.value.String())
+	}
+	sort.Strings(printed)
+	return fmt.Sprint(printed)
+}
+
+// measure returns nesting depth and number of fields of selections with fragments expanded,
+// memo keeps the measures of fragments. Fragments must not have cycles.
+func (v *validator) measure(selections []selection, memo map[string][2]int) (int, int) {
+	depth, fields := 0, 0
+	add := func(d int, f int) {
+		if d > depth {
+			depth = d
+		}
+		fields += f
+		if fields > v.schema.MaxFields {
+			fields = v.schema.MaxFields + 1
+		}
+	}
+	for _, s := range selections {
+		switch s := s.(type) {
+		case *field:
+			d, f := v.measure(s.selections, memo)
+			add(d+1, f+1)
+		case *inlineFragment:
+			add(v.measure(s.selections, memo))
+		case *fragmentSpread:
+			frag, ok := v.doc.fragments[s.name]
+			if !ok {
+				continue
+			}
+			measures, ok := memo[s.name]
+			if !ok {
+				d, f := v.measure(frag.selections, memo)
+				measures = [2]int{d, f}
+				memo[s.name] = measures
+			}
+			add(measures[0], measures[1])
+		}
+	}
+	return depth, fields
+}
+
+func sortedFragmentNames(doc *document) []string {
+	names := make([]string, 0, len(doc.fragments))
+	for name := range doc.fragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,178 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		messages []string
+	}{
+		{
+			name:     "unknown field",
+			query:    `{ course(id: "c1") { name } }`,
+			messages: []string{`Cannot query field "name" on type "Course"`},
+		},
+		{
+			name:     "unknown argument",
+			query:    `{ course(id: "c1", name: "a") { id } }`,
+			messages: []string{`Unknown argument "name" on field "Query.course"`},
+		},
+		{
+			name:     "missing required argument",
+			query:    `{ course { id } }`,
+			messages: []string{`Argument "id" of required type "ID!" on field "Query.course" was not provided`},
+		},
+		{
+			name:     "invalid argument literal",
+			query:    `{ courses(first: "2") { id } }`,
+			messages: []string{`Expected value of type Int, found "2"; Int cannot represent value 2`},
+		},
+		{
+			name:     "leaf field with selection",
+			query:    `{ course(id: "c1") { id { value } } }`,
+			messages: []string{`Field "id" must not have a selection since type "ID!" has no subfields`},
+		},
+		{
+			name:     "object field without selection",
+			query:    `{ course(id: "c1") }`,
+			messages: []string{`Field "course" of type "Course" must have a selection of subfields`},
+		},
+		{
+			name:     "undefined variable",
+			query:    `query { echo(text: $text) }`,
+			messages: []string{`Variable "$text" is not defined`},
+		},
+		{
+			name:     "unused variable",
+			query:    `query Echo($text: String!, $times: Int) { echo(text: $text) }`,
+			messages: []string{`Variable "$times" is never used in operation "Echo"`},
+		},
+		{
+			name:     "variable of wrong type",
+			query:    `query($text: String) { echo(text: $text) }`,
+			messages: []string{`Variable "$text" of type "String" used in position expecting type "String!"`},
+		},
+		{
+			name:     "variable of output type",
+			query:    `query($course: Course) { echo(text: "a") }`,
+			messages: []string{`Variable "$course" cannot be non-input type "Course"`, `Variable "$course" is never used`},
+		},
+		{
+			name:     "unknown fragment",
+			query:    `{ course(id: "c1") { ...Missing } }`,
+			messages: []string{`Unknown fragment "Missing"`},
+		},
+		{
+			name:     "unused fragment",
+			query:    `{ echo(text: "a") } fragment Unused on Course { id }`,
+			messages: []string{`Fragment "Unused" is never used`},
+		},
+		{
+			name:     "fragment cycle",
+			query:    `{ course(id: "c1") { ...A } } fragment A on Course { ...B } fragment B on Course { ...A }`,
+			messages: []string{`Cannot spread fragment "A" within itself`},
+		},
+		{
+			name:     "fragment on wrong type",
+			query:    `{ course(id: "c1") { ...BlockFields } } fragment BlockFields on Block { kind }`,
+			messages: []string{`Fragment "BlockFields" cannot be spread here as objects of type "Course" can never be of type "Block"`},
+		},
+		{
+			name:     "fragment on scalar",
+			query:    `{ echo(text: "a") ...F } fragment F on String { length }`,
+			messages: []string{`Fragment "F" cannot condition on non composite type "String"`},
+		},
+		{
+			name:     "unknown directive",
+			query:    `{ echo(text: "a") @cached }`,
+			messages: []string{`Unknown directive "@cached"`},
+		},
+		{
+			name:     "repeated directive",
+			query:    `{ echo(text: "a") @skip(if: false) @skip(if: true) }`,
+			messages: []string{`The directive "@skip" can only be used once at this location`},
+		},
+		{
+			name:     "conflicting fields",
+			query:    `{ course(id: "c1") { id: title id } }`,
+			messages: []string{`Fields "id" conflict because "title" and "id" are different fields, use different aliases on the fields`},
+		},
+		{
+			name:     "conflicting arguments",
+			query:    `{ echo(text: "a") echo(text: "b") }`,
+			messages: []string{`Fields "echo" conflict because they have differing arguments, use different aliases on the fields`},
+		},
+		{
+			name:     "anonymous operation with others",
+			query:    `{ echo(text: "a") } query B { echo(text: "b") }`,
+			messages: []string{`This anonymous operation must be the only defined operation`},
+		},
+		{
+			name:     "mutation",
+			query:    `mutation { echo(text: "a") }`,
+			messages: []string{`Schema is not configured for mutations`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, errs := execute(t, newTestSchema(t), test.query, nil)
+			if data != "" {
+				t.Errorf("data = %v, want no data", data)
+			}
+			messages := errorMessages(errs)
+			if strings.Join(messages, "\n") != strings.Join(test.messages, "\n") {
+				t.Fatalf("errors = %q, want %q", messages, test.messages)
+			}
+			for _, err := range errs {
+				if len(err.Locations) == 0 {
+					t.Errorf("error %q has no location", err.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDepthLimit(t *testing.T) {
+	schema := newTestSchema(t)
+	schema.MaxDepth = 3
+
+	if _, errs := execute(t, schema, `{ course(id: "c1") { blocks { id } } }`, nil); len(errs) > 0 {
+		t.Fatalf("errors of query at the depth limit = %v", errorMessages(errs))
+	}
+
+	// fragments and inline fragments count the levels of their fields
+	query := `{ course(id: "c1") { ...Blocks } } fragment Blocks on Course { ... on Course { blocks { id } title } }`
+	if _, errs := execute(t, schema, query, nil); len(errs) > 0 {
+		t.Fatalf("errors of query with fragments at the depth limit = %v", errorMessages(errs))
+	}
+
+	schema.MaxDepth = 2
+	data, errs := execute(t, schema, query, nil)
+	want := "Query is too deep: 3 levels of fields, at most 2 are allowed"
+	if data != "" || len(errs) != 1 || errs[0].Message != want {
+		t.Errorf("data = %v, errors = %q, want no data and %q", data, errorMessages(errs), want)
+	}
+}
+
+func TestValidateFieldLimit(t *testing.T) {
+	schema := newTestSchema(t)
+	schema.MaxFields = 10
+
+	// every spread of the fragment counts its fields
+	query := `{ a: course(id: "c1") { ...F } b: course(id: "c1") { ...F } c: course(id: "c1") { ...F } }
+		fragment F on Course { id title level }`
+	data, errs := execute(t, schema, query, nil)
+	want := "Query has too many fields: more than 10 with fragments expanded"
+	if data != "" || len(errs) != 1 || errs[0].Message != want {
+		t.Errorf("data = %v, errors = %q, want no data and %q", data, errorMessages(errs), want)
+	}
+
+	schema.MaxFields = 12
+	if _, errs = execute(t, schema, query, nil); len(errs) > 0 {
+		t.Errorf("errors of query at the field limit = %v", errorMessages(errs))
+	}
+}
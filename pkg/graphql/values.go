@@ -0,0 +1,354 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// variableLookup returns the value of variable name used at a position of type t,
+// present is false if the variable has no value
+type variableLookup func(name string, t *Type, location Location) (value interface{}, present bool, err error)
+
+// coerceLiteral converts literal v to a value of input type t, input objects become maps.
+// present is false if v is a variable without value.
+func coerceLiteral(v *value, t *Type, lookup variableLookup) (interface{}, bool, error) {
+	if v.kind == variableValue {
+		return lookup(v.raw, t, v.location)
+	}
+	if t.Kind == NonNullKind {
+		if v.kind == nullValue {
+			return nil, false, literalError(v, "Expected value of type %v, found null", t)
+		}
+		result, present, err := coerceLiteral(v, t.OfType, lookup)
+		if err == nil && present && result == nil {
+			err = literalError(v, "Expected value of type %v, found null", t)
+		}
+		return result, present, err
+	}
+	if v.kind == nullValue {
+		return nil, true, nil
+	}
+
+	switch t.Kind {
+	case ListKind:
+		if v.kind != listValue {
+			item, err := coerceListItem(v, t.OfType, lookup)
+			if err != nil {
+				return nil, false, err
+			}
+			return []interface{}{item}, true, nil
+		}
+		items := make([]interface{}, 0, len(v.list))
+		for _, itemValue := range v.list {
+			item, err := coerceListItem(itemValue, t.OfType, lookup)
+			if err != nil {
+				return nil, false, err
+			}
+			items = append(items, item)
+		}
+		return items, true, nil
+	case InputObjectKind:
+		if v.kind != objectValue {
+			return nil, false, literalError(v, "Expected value of type %v, found %v", t, v)
+		}
+		fields := map[string]*value{}
+		for _, objectField := range v.fields {
+			if t.inputField(objectField.name) == nil {
+				return nil, false, literalError(objectField.value, "Field %q is not defined by type %v", objectField.name, t)
+			}
+			if _, ok := fields[objectField.name]; ok {
+				return nil, false, literalError(objectField.value, "There can be only one input field named %q", objectField.name)
+			}
+			fields[objectField.name] = objectField.value
+		}
+		result := map[string]interface{}{}
+		for _, field := range t.InputFields {
+			if fieldValue, ok := fields[field.Name]; ok {
+				coerced, present, err := coerceLiteral(fieldValue, field.Type, lookup)
+				if err != nil {
+					return nil, false, err
+				}
+				if present {
+					result[field.Name] = coerced
+					continue
+				}
+			}
+			if field.DefaultValue != nil {
+				result[field.Name] = field.DefaultValue
+			} else if field.Type.Kind == NonNullKind {
+				return nil, false, literalError(v, "Field %v.%v of required type %v was not provided", t, field.Name, field.Type)
+			}
+		}
+		return result, true, nil
+	case EnumKind:
+		if v.kind != enumValue || !t.hasEnumValue(v.raw) {
+			return nil, false, literalError(v, "Value %v does not exist in %v enum", v, t)
+		}
+		return v.raw, true, nil
+	case ScalarKind:
+		var literal interface{}
+		switch v.kind {
+		case intValue:
+			if number, err := strconv.ParseInt(v.raw, 10, 64); err == nil {
+				literal = number
+			} else {
+				literal, _ = strconv.ParseFloat(v.raw, 64)
+			}
+		case floatValue:
+			literal, _ = strconv.ParseFloat(v.raw, 64)
+		case stringValue:
+			literal = v.raw
+		case booleanValue:
+			literal = v.raw == "true"
+		default:
+			return nil, false, literalError(v, "Expected value of type %v, found %v", t, v)
+		}
+		result, err := t.parse(literal)
+		if err != nil {
+			return nil, false, literalError(v, "Expected value of type %v, found %v; %v", t, v, err)
+		}
+		return result, true, nil
+	}
+	return nil, false, literalError(v, "Type %v is not an input type", t)
+}
+
+// coerceListItem coerces item of a list, items that are variables without value are null
+func coerceListItem(v *value, t *Type, lookup variableLookup) (interface{}, error) {
+	item, present, err := coerceLiteral(v, t, lookup)
+	if err != nil {
+		return nil, err
+	}
+	if !present && t.Kind == NonNullKind {
+		return nil, literalError(v, "Expected value of type %v, found null", t)
+	}
+	return item, nil
+}
+
+func literalError(v *value, format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{v.location}}
+}
+
+// coerceInput converts JSON value of a variable to a value of input type t
+func coerceInput(input interface{}, t *Type) (interface{}, error) {
+	if t.Kind == NonNullKind {
+		if input == nil {
+			return nil, fmt.Errorf("Expected non-nullable type %v not to be null", t)
+		}
+		return coerceInput(input, t.OfType)
+	}
+	if input == nil {
+		return nil, nil
+	}
+
+	switch t.Kind {
+	case ListKind:
+		items, ok := input.([]interface{})
+		if !ok {
+			item, err := coerceInput(input, t.OfType)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		result := make([]interface{}, 0, len(items))
+		for i, item := range items {
+			coerced, err := coerceInput(item, t.OfType)
+			if err != nil {
+				return nil, fmt.Errorf("At index %v: %w", i, err)
+			}
+			result = append(result, coerced)
+		}
+		return result, nil
+	case InputObjectKind:
+		fields, ok := input.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Expected type %v to be an object", t)
+		}
+		for name := range fields {
+			if t.inputField(name) == nil {
+				return nil, fmt.Errorf("Field %q is not defined by type %v", name, t)
+			}
+		}
+		result := map[string]interface{}{}
+		for _, field := range t.InputFields {
+			fieldInput, ok := fields[field.Name]
+			if !ok {
+				if field.DefaultValue != nil {
+					result[field.Name] = field.DefaultValue
+				} else if field.Type.Kind == NonNullKind {
+					return nil, fmt.Errorf("Field %v of required type %v was not provided", field.Name, field.Type)
+				}
+				continue
+			}
+			coerced, err := coerceInput(fieldInput, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("At field %v: %w", field.Name, err)
+			}
+			result[field.Name] = coerced
+		}
+		return result, nil
+	case EnumKind:
+		name, ok := input.(string)
+		if !ok || !t.hasEnumValue(name) {
+			return nil, fmt.Errorf("Value %v does not exist in %v enum", input, t)
+		}
+		return name, nil
+	case ScalarKind:
+		return t.parse(input)
+	}
+	return nil, fmt.Errorf("Type %v is not an input type", t)
+}
+
+// coerceVariables returns values of the variables of op from inputs with defaults of their definitions
+func (schema *Schema) coerceVariables(op *operation, inputs map[string]interface{}) (map[string]interface{}, []*Error) {
+	variables := map[string]interface{}{}
+	var errs []*Error
+	for _, definition := range op.variables {
+		t := schema.typeOfRef(definition.typ)
+		input, ok := inputs[definition.name]
+		if !ok {
+			if definition.defaultValue != nil {
+				value, _, err := coerceLiteral(definition.defaultValue, t, nil)
+				if err != nil {
+					errs = append(errs, err.(*Error))
+					continue
+				}
+				variables[definition.name] = value
+			} else if t.Kind == NonNullKind {
+				errs = append(errs, &Error{
+					Message:   fmt.Sprintf("Variable \"$%v\" of required type %v was not provided", definition.name, t),
+					Locations: []Location{definition.location},
+				})
+			}
+			continue
+		}
+		value, err := coerceInput(input, t)
+		if err != nil {
+			errs = append(errs, &Error{
+				Message:   fmt.Sprintf("Variable \"$%v\" got invalid value: %v", definition.name, err),
+				Locations: []Location{definition.location},
+			})
+			continue
+		}
+		variables[definition.name] = value
+	}
+	return variables, errs
+}
+
+// coerceArguments returns arguments of definitions given by literals args with their defaults
+func coerceArguments(definitions []*InputValue, args []*argument, variables map[string]interface{}) (map[string]interface{}, error) {
+	lookup := func(name string, t *Type, location Location) (interface{}, bool, error) {
+		value, ok := variables[name]
+		if ok && value == nil && t.Kind == NonNullKind {
+			return nil, false, &Error{Message: fmt.Sprintf("Variable \"$%v\" of non-null type %v must not be null", name, t), Locations: []Location{location}}
+		}
+		return value, ok, nil
+	}
+	result := map[string]interface{}{}
+	for _, definition := range definitions {
+		for _, arg := range args {
+			if arg.name != definition.Name {
+				continue
+			}
+			value, present, err := coerceLiteral(arg.value, definition.Type, lookup)
+			if err != nil {
+				return nil, err
+			}
+			if present {
+				result[definition.Name] = value
+			}
+		}
+		if _, ok := result[definition.Name]; ok {
+			continue
+		}
+		if definition.DefaultValue != nil {
+			result[definition.Name] = definition.DefaultValue
+		} else if definition.Type.Kind == NonNullKind {
+			return nil, fmt.Errorf("Argument %q of required type %v was not provided", definition.Name, definition.Type)
+		}
+	}
+	return result, nil
+}
+
+// typeOfRef returns the type of variable definition, nil if its named type isn't in the schema
+func (schema *Schema) typeOfRef(ref *typeRef) *Type {
+	switch {
+	case ref.nonNull:
+		if ofType := schema.typeOfRef(ref.ofType); ofType != nil {
+			return NonNull(ofType)
+		}
+		return nil
+	case ref.list:
+		if ofType := schema.typeOfRef(ref.ofType); ofType != nil {
+			return List(ofType)
+		}
+		return nil
+	}
+	return schema.types[ref.name]
+}
+
+// String prints v as GraphQL literal
+func (v *value) String() string {
+	switch v.kind {
+	case variableValue:
+		return "$" + v.raw
+	case stringValue:
+		b, _ := json.Marshal(v.raw)
+		return string(b)
+	case listValue:
+		items := make([]string, 0, len(v.list))
+		for _, item := range v.list {
+			items = append(items, item.String())
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case objectValue:
+		fields := make([]string, 0, len(v.fields))
+		for _, field := range v.fields {
+			fields = append(fields, field.name+": "+field.value.String())
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return v.raw
+}
+
+// printValue prints input value of type t as GraphQL literal, for default values of introspection
+func printValue(input interface{}, t *Type) string {
+	if t.Kind == NonNullKind {
+		return printValue(input, t.OfType)
+	}
+	if input == nil {
+		return "null"
+	}
+	switch t.Kind {
+	case ListKind:
+		items := reflect.ValueOf(input)
+		if items.Kind() != reflect.Slice {
+			return printValue(input, t.OfType)
+		}
+		printed := make([]string, 0, items.Len())
+		for i := 0; i < items.Len(); i++ {
+			printed = append(printed, printValue(items.Index(i).Interface(), t.OfType))
+		}
+		return "[" + strings.Join(printed, ", ") + "]"
+	case InputObjectKind:
+		fields, _ := input.(map[string]interface{})
+		printed := make([]string, 0, len(fields))
+		for _, field := range t.InputFields {
+			if fieldValue, ok := fields[field.Name]; ok {
+				printed = append(printed, field.Name+": "+printValue(fieldValue, field.Type))
+			}
+		}
+		return "{" + strings.Join(printed, ", ") + "}"
+	case EnumKind:
+		return fmt.Sprint(input)
+	}
+	serialized, err := t.serialize(input)
+	if err != nil {
+		return "null"
+	}
+	b, _ := json.Marshal(serialized)
+	return string(b)
+}
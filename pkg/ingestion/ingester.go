@@ -0,0 +1,212 @@
+package ingestion
+
+// Ingester parses raw edX logs and course structures and saves them into
+// EventStore in a single process. It routes events by event_type the same way
+// filebeat routes them to kafka topics for parser services.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/parsers"
+	"kafka-log-processor/pkg/pseudonymization"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+// Event families by edX event_type
+var eventTypeFamilies = map[string]string{
+	"seek_video":                         "video",
+	"pause_video":                        "video",
+	"stop_video":                         "video",
+	"play_video":                         "video",
+	"edx.grades.problem.submitted":       "problem",
+	"problem_show":                       "problem",
+	"showanswer":                         "problem",
+	"seq_goto":                           "sequential",
+	"seq_next":                           "sequential",
+	"seq_prev":                           "sequential",
+	"edx.bookmark.removed":               "bookmarks",
+	"edx.bookmark.added":                 "bookmarks",
+	"edx.ui.lms.link_clicked":            "link",
+	"edx.course.enrollment.activated":    "enrollment",
+	"edx.course.enrollment.deactivated":  "enrollment",
+	"edx.course.enrollment.mode_changed": "enrollment",
+}
+
+// Ingester saves parsed logs and structures into the event store
+type Ingester struct {
+	eventStore       database.EventStore
+	structureIndices *parsers.CourseStructureIndexCache
+	pseudonymizer    *pseudonymization.Pseudonymizer
+}
+
+// New constructs Ingester that saves data into eventStore.
+// Usernames are replaced with pseudonyms if pseudonymizer is not nil.
+func New(eventStore database.EventStore, pseudonymizer *pseudonymization.Pseudonymizer) *Ingester {
+	return &Ingester{
+		eventStore:       eventStore,
+		structureIndices: parsers.NewCourseStructureIndexCache(eventStore.GetCourseStructure),
+		pseudonymizer:    pseudonymizer,
+	}
+}
+
+// IngestStructuresDir parses every "*.tar.gz" course structure in directory dirName
+func (ingester *Ingester) IngestStructuresDir(ctx context.Context, dirName string) error {
+	fileNames, err := filepath.Glob(filepath.Join(dirName, "*.tar.gz"))
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		course, err := edxstruct.ParseCourse(fileName)
+		if err != nil {
+			log.Printf("can't parse course structure %v: %v\n", fileName, err)
+			continue
+		}
+		if err = ingester.eventStore.AddCourseStructure(ctx, course); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IngestLogsDir parses every "*.log" file in directory dirName
+func (ingester *Ingester) IngestLogsDir(ctx context.Context, dirName string) error {
+	fileNames, err := filepath.Glob(filepath.Join(dirName, "*.log"))
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		if err = ingester.IngestLogFile(ctx, fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IngestLogFile parses edX log file with one JSON log per line
+func (ingester *Ingester) IngestLogFile(ctx context.Context, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if err := ingester.IngestEvent(ctx, scanner.Bytes()); err != nil {
+			log.Printf("can't ingest log line from %v: %v\n", fileName, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// IngestEvent parses single edX log and saves it. Logs with event types that
+// are not analysed in this project are skipped.
+func (ingester *Ingester) IngestEvent(ctx context.Context, eventLog []byte) error {
+	eventLog, eventType, err := decodeEventField(eventLog)
+	if err != nil {
+		return err
+	}
+
+	switch eventTypeFamilies[eventType] {
+	case "video":
+		videoEvent, err := parsers.ParseVideoEvent(eventLog)
+		if err != nil {
+			return err
+		}
+		if videoEvent.Username, err = ingester.pseudonymizer.Pseudonymize(videoEvent.Username); err != nil {
+			return err
+		}
+		return ingester.eventStore.AddVideoEventDescription(ctx, videoEvent)
+	case "problem":
+		problemEvent, err := parsers.ParseProblemEvent(eventLog)
+		if err != nil {
+			return err
+		}
+		if problemEvent.Username, err = ingester.pseudonymizer.Pseudonymize(problemEvent.Username); err != nil {
+			return err
+		}
+		return ingester.eventStore.AddProblemEventDescription(ctx, problemEvent)
+	case "sequential":
+		sequentialEvent, err := parsers.ParseSequentialEvent(eventLog)
+		if err != nil {
+			return err
+		}
+		if sequentialEvent.Username, err = ingester.pseudonymizer.Pseudonymize(sequentialEvent.Username); err != nil {
+			return err
+		}
+		if structureIndex, err := ingester.structureIndices.Get(ctx, sequentialEvent.CourseID); err == nil {
+			parsers.ResolveSequentialEventVerticals(&sequentialEvent, structureIndex)
+		}
+		return ingester.eventStore.AddSequentialMoveEventDescription(ctx, sequentialEvent)
+	case "bookmarks":
+		bookmarksEvent, err := parsers.ParseBookmarksEvent(eventLog)
+		if err != nil {
+			return err
+		}
+		if bookmarksEvent.Username, err = ingester.pseudonymizer.Pseudonymize(bookmarksEvent.Username); err != nil {
+			return err
+		}
+		if structureIndex, err := ingester.structureIndices.Get(ctx, bookmarksEvent.CourseID); err == nil {
+			bookmarksEvent.BlockName, _ = structureIndex.DisplayName(bookmarksEvent.BlockID)
+		}
+		return ingester.eventStore.AddBooksmarkEventDescription(ctx, bookmarksEvent)
+	case "link":
+		linkEvent, err := parsers.ParseLinkEvent(eventLog)
+		if err != nil {
+			return err
+		}
+		if linkEvent.Username, err = ingester.pseudonymizer.Pseudonymize(linkEvent.Username); err != nil {
+			return err
+		}
+		if structureIndex, err := ingester.structureIndices.Get(ctx, linkEvent.CourseID); err == nil {
+			parsers.ResolveLinkEventBlocks(&linkEvent, structureIndex)
+		}
+		return ingester.eventStore.AddLinkEventDescription(ctx, linkEvent)
+	case "enrollment":
+		enrollmentEvent, err := parsers.ParseEnrollmentEvent(eventLog)
+		if err != nil {
+			return err
+		}
+		if enrollmentEvent.Username, err = ingester.pseudonymizer.Pseudonymize(enrollmentEvent.Username); err != nil {
+			return err
+		}
+		return ingester.eventStore.AddEnrollmentEventDescription(ctx, enrollmentEvent)
+	}
+	return nil
+}
+
+// decodeEventField returns event_type of the log and the log with "event" field decoded
+// from JSON string into object, as filebeat does before sending logs to kafka.
+func decodeEventField(eventLog []byte) ([]byte, string, error) {
+	var logFields map[string]json.RawMessage
+	if err := json.Unmarshal(eventLog, &logFields); err != nil {
+		return nil, "", err
+	}
+	var eventType string
+	if err := json.Unmarshal(logFields["event_type"], &eventType); err != nil {
+		return nil, "", fmt.Errorf("log has incorrect event_type: %v", err)
+	}
+
+	var encodedEvent string
+	if err := json.Unmarshal(logFields["event"], &encodedEvent); err != nil || !strings.HasPrefix(strings.TrimSpace(encodedEvent), "{") {
+		return eventLog, eventType, nil
+	}
+	if !json.Valid([]byte(encodedEvent)) {
+		return eventLog, eventType, nil
+	}
+	logFields["event"] = json.RawMessage(encodedEvent)
+	decodedLog, err := json.Marshal(logFields)
+	if err != nil {
+		return nil, "", err
+	}
+	return decodedLog, eventType, nil
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import "container/list"
+
+// resultCache keeps size recently used results by their keys. It isn't safe for
+// concurrent use, Manager guards it with its mutex.
+type resultCache struct {
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key    string
+	result *Result
+}
+
+func newResultCache(size int) *resultCache {
+	return &resultCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (cache *resultCache) get(key string) (*Result, bool) {
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).result, true
+}
+
+// add saves result of key, the least recently used result is removed if the cache is full
+func (cache *resultCache) add(key string, result *Result) {
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*cacheEntry).result = result
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&cacheEntry{key: key, result: result})
+	if cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,250 @@
+package jobs
+
+// Asynchronous jobs of the analysis server. Submitted jobs wait in a queue for one of
+// the workers, report their progress while running and are kept for a while after they
+// finish. Successful results are cached by job key, so a job submitted with the key of
+// a cached result finishes at once.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Statuses of jobs
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	Canceled  = "canceled"
+)
+
+// ErrQueueFull is returned by Submit when every place in the queue is taken
+var ErrQueueFull = errors.New("Job queue is full")
+
+// Result is the output of a job, Header has headers of the response
+type Result struct {
+	Header http.Header
+	Body   []byte
+}
+
+// RunFunc computes result of a job. It should stop when ctx is done and
+// tell progress how many of total steps are done.
+type RunFunc func(ctx context.Context, progress func(done int, total int)) (Result, error)
+
+// Job is a state of a job. Result is set for succeeded jobs, Err for failed ones.
+type Job struct {
+	ID         string
+	Owner      string
+	Analysis   string
+	Params     url.Values
+	Status     string
+	Done       int
+	Total      int
+	Cached     bool
+	Result     *Result
+	Err        error
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Finished tells if the job won't change anymore
+func (job Job) Finished() bool {
+	return job.Status == Succeeded || job.Status == Failed || job.Status == Canceled
+}
+
+// Config of Manager, zero values are replaced by defaults
+type Config struct {
+	// Workers is the number of jobs running at once, 2 by default
+	Workers int
+	// QueueSize is the number of jobs waiting for workers, 100 by default
+	QueueSize int
+	// CacheSize is the number of cached results, 100 by default
+	CacheSize int
+	// Timeout cancels jobs running longer, 1 hour by default
+	Timeout time.Duration
+	// ResultTTL is how long finished jobs are kept, 1 hour by default
+	ResultTTL time.Duration
+}
+
+// Manager runs jobs on a pool of workers
+type Manager struct {
+	config Config
+	queue  chan *job
+	mutex  sync.Mutex
+	jobs   map[string]*job
+	cache  *resultCache
+}
+
+type job struct {
+	Job
+	key      string
+	run      RunFunc
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// NewManager constructs Manager and starts its workers
+func NewManager(config Config) *Manager {
+	if config.Workers <= 0 {
+		config.Workers = 2
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = 100
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Hour
+	}
+	if config.ResultTTL <= 0 {
+		config.ResultTTL = time.Hour
+	}
+	manager := &Manager{
+		config: config,
+		queue:  make(chan *job, config.QueueSize),
+		jobs:   map[string]*job{},
+		cache:  newResultCache(config.CacheSize),
+	}
+	for i := 0; i < config.Workers; i++ {
+		go manager.work()
+	}
+	return manager
+}
+
+// Submit queues job of owner that runs analysis with params. If there is a cached
+// result of key, the returned job is already succeeded.
+func (manager *Manager) Submit(owner string, analysis string, params url.Values, key string, run RunFunc) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now()
+	newJob := &job{
+		Job: Job{ID: id, Owner: owner, Analysis: analysis, Params: params, Status: Queued, CreatedAt: now},
+		key: key,
+		run: run,
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.removeExpired(now)
+	if result, ok := manager.cache.get(key); ok {
+		newJob.Status, newJob.Cached, newJob.Result = Succeeded, true, result
+		newJob.StartedAt, newJob.FinishedAt = now, now
+		manager.jobs[id] = newJob
+		return newJob.Job, nil
+	}
+	select {
+	case manager.queue <- newJob:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	manager.jobs[id] = newJob
+	return newJob.Job, nil
+}
+
+// Get returns job id of owner, jobs of other owners aren't found
+func (manager *Manager) Get(owner string, id string) (Job, bool) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.removeExpired(time.Now())
+	found, ok := manager.jobs[id]
+	if !ok || found.Owner != owner {
+		return Job{}, false
+	}
+	return found.Job, true
+}
+
+// Cancel cancels job id of owner. Queued jobs are canceled at once, running
+// jobs are canceled when they stop. Finished jobs are left as they are.
+func (manager *Manager) Cancel(owner string, id string) (Job, bool) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	found, ok := manager.jobs[id]
+	if !ok || found.Owner != owner {
+		return Job{}, false
+	}
+	switch found.Status {
+	case Queued:
+		found.Status, found.FinishedAt = Canceled, time.Now()
+	case Running:
+		found.canceled = true
+		found.cancel()
+	}
+	return found.Job, true
+}
+
+// removeExpired forgets jobs finished more than ResultTTL before now
+func (manager *Manager) removeExpired(now time.Time) {
+	for id, found := range manager.jobs {
+		if found.Finished() && now.Sub(found.FinishedAt) > manager.config.ResultTTL {
+			delete(manager.jobs, id)
+		}
+	}
+}
+
+func (manager *Manager) work() {
+	for queued := range manager.queue {
+		manager.runJob(queued)
+	}
+}
+
+func (manager *Manager) runJob(queued *job) {
+	manager.mutex.Lock()
+	if queued.Status != Queued {
+		manager.mutex.Unlock()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manager.config.Timeout)
+	defer cancel()
+	queued.Status, queued.StartedAt, queued.cancel = Running, time.Now(), cancel
+	manager.mutex.Unlock()
+
+	result, err := runSafely(ctx, queued.run, func(done int, total int) {
+		manager.mutex.Lock()
+		queued.Done, queued.Total = done, total
+		manager.mutex.Unlock()
+	})
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	queued.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		queued.Status, queued.Result = Succeeded, &result
+		queued.Done = queued.Total
+		manager.cache.add(queued.key, &result)
+	case queued.canceled:
+		queued.Status = Canceled
+	default:
+		queued.Status, queued.Err = Failed, err
+	}
+}
+
+// runSafely calls run and turns its panic into error
+func runSafely(ctx context.Context, run RunFunc, progress func(done int, total int)) (result Result, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return run(ctx, progress)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
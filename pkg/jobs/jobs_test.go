@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingRun returns RunFunc that reports its start on started and
+// succeeds with body when release is closed
+func blockingRun(started chan<- string, release <-chan struct{}, body string) RunFunc {
+	return func(ctx context.Context, progress func(done int, total int)) (Result, error) {
+		progress(1, 2)
+		started <- body
+		select {
+		case <-release:
+			return Result{Body: []byte(body)}, nil
+		case <-ctx.Done():
+			return Result{}, ctx.Err()
+		}
+	}
+}
+
+// waitForStatus waits until job id of owner gets status
+func waitForStatus(t *testing.T, manager *Manager, owner string, id string, status string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		found, ok := manager.Get(owner, id)
+		if !ok {
+			t.Fatalf("job %v is not found", id)
+		}
+		if found.Status == status {
+			return found
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %v has status %v, want %v", id, found.Status, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	manager := NewManager(Config{Workers: 2})
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	ids := make([]string, 0)
+	for _, key := range []string{"a", "b", "c"} {
+		submitted, err := manager.Submit("alice", "analysis", nil, key, blockingRun(started, release, key))
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		ids = append(ids, submitted.ID)
+	}
+
+	<-started
+	<-started
+	running := 0
+	for _, id := range ids {
+		if found, _ := manager.Get("alice", id); found.Status == Running {
+			running++
+			if found.Done != 1 || found.Total != 2 {
+				t.Errorf("progress of running job = %v of %v, want 1 of 2", found.Done, found.Total)
+			}
+		}
+	}
+	if running != 2 {
+		t.Errorf("%v jobs are running, want one per worker", running)
+	}
+
+	close(release)
+	for i, id := range ids {
+		finished := waitForStatus(t, manager, "alice", id, Succeeded)
+		if finished.Result == nil || string(finished.Result.Body) != []string{"a", "b", "c"}[i] {
+			t.Errorf("Result of job %v = %+v", i, finished.Result)
+		}
+		if finished.Done != 2 || finished.Cached {
+			t.Errorf("finished job has Done = %v, Cached = %v, want 2 and false", finished.Done, finished.Cached)
+		}
+	}
+
+	cached, err := manager.Submit("bob", "analysis", nil, "b", func(ctx context.Context, progress func(done int, total int)) (Result, error) {
+		t.Error("job with cached result is run")
+		return Result{}, nil
+	})
+	if err != nil || cached.Status != Succeeded || !cached.Cached || string(cached.Result.Body) != "b" {
+		t.Errorf("Submit() of cached key = %+v, %v, want cached result", cached, err)
+	}
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+	manager := NewManager(Config{Workers: 1, QueueSize: 1})
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	first, err := manager.Submit("alice", "analysis", nil, "first", blockingRun(started, release, "first"))
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-started
+	waitForStatus(t, manager, "alice", first.ID, Running)
+	if _, err = manager.Submit("alice", "analysis", nil, "second", blockingRun(started, release, "second")); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err = manager.Submit("alice", "analysis", nil, "third", blockingRun(started, release, "third")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() into the full queue error = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	manager := NewManager(Config{Workers: 1})
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	running, _ := manager.Submit("alice", "analysis", nil, "running", blockingRun(started, release, "running"))
+	<-started
+	waitForStatus(t, manager, "alice", running.ID, Running)
+	queued, _ := manager.Submit("alice", "analysis", nil, "queued", func(ctx context.Context, progress func(done int, total int)) (Result, error) {
+		t.Error("job canceled while queued is run")
+		return Result{}, nil
+	})
+
+	if canceled, ok := manager.Cancel("alice", queued.ID); !ok || canceled.Status != Canceled {
+		t.Errorf("Cancel() of queued job = %+v, %v, want canceled", canceled, ok)
+	}
+	if _, ok := manager.Cancel("alice", running.ID); !ok {
+		t.Fatalf("Cancel() of running job didn't find it")
+	}
+	if canceled := waitForStatus(t, manager, "alice", running.ID, Canceled); canceled.Err != nil || canceled.Result != nil {
+		t.Errorf("canceled job has Err = %v, Result = %v", canceled.Err, canceled.Result)
+	}
+
+	// the worker takes the canceled job from the queue and skips it
+	next, _ := manager.Submit("alice", "analysis", nil, "next", blockingRun(started, release, "next"))
+	<-started
+	waitForStatus(t, manager, "alice", next.ID, Running)
+	if found, _ := manager.Get("alice", queued.ID); found.Status != Canceled || !found.StartedAt.IsZero() {
+		t.Errorf("job canceled while queued = %+v, want canceled and never started", found)
+	}
+}
+
+func TestFailedJobs(t *testing.T) {
+	manager := NewManager(Config{Workers: 1})
+	runErr := errors.New("analysis failed")
+	failing, _ := manager.Submit("alice", "analysis", nil, "failing", func(ctx context.Context, progress func(done int, total int)) (Result, error) {
+		return Result{}, runErr
+	})
+	panicking, _ := manager.Submit("alice", "analysis", nil, "panicking", func(ctx context.Context, progress func(done int, total int)) (Result, error) {
+		panic("broken analysis")
+	})
+
+	if failed := waitForStatus(t, manager, "alice", failing.ID, Failed); failed.Err != runErr {
+		t.Errorf("Err = %v, want %v", failed.Err, runErr)
+	}
+	if failed := waitForStatus(t, manager, "alice", panicking.ID, Failed); failed.Err == nil {
+		t.Errorf("Err of panicked job = nil, want error")
+	}
+	// results of failed jobs aren't cached
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	close(release)
+	again, _ := manager.Submit("alice", "analysis", nil, "failing", blockingRun(started, release, "again"))
+	if again.Cached {
+		t.Errorf("failed result is cached")
+	}
+	waitForStatus(t, manager, "alice", again.ID, Succeeded)
+}
+
+func TestTimeout(t *testing.T) {
+	manager := NewManager(Config{Workers: 1, Timeout: 10 * time.Millisecond})
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	defer close(release)
+	submitted, _ := manager.Submit("alice", "analysis", nil, "slow", blockingRun(started, release, "slow"))
+	if timedOut := waitForStatus(t, manager, "alice", submitted.ID, Failed); !errors.Is(timedOut.Err, context.DeadlineExceeded) {
+		t.Errorf("Err = %v, want %v", timedOut.Err, context.DeadlineExceeded)
+	}
+}
+
+func TestResultTTL(t *testing.T) {
+	manager := NewManager(Config{Workers: 1, ResultTTL: 20 * time.Millisecond})
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	close(release)
+	submitted, _ := manager.Submit("alice", "analysis", nil, "key", blockingRun(started, release, "key"))
+	waitForStatus(t, manager, "alice", submitted.ID, Succeeded)
+
+	time.Sleep(40 * time.Millisecond)
+	if found, ok := manager.Get("alice", submitted.ID); ok {
+		t.Errorf("Get() of expired job = %+v, want not found", found)
+	}
+	// the result stays cached after the job expires
+	if cached, err := manager.Submit("alice", "analysis", nil, "key", nil); err != nil || !cached.Cached {
+		t.Errorf("Submit() after expiry = %+v, %v, want cached result", cached, err)
+	}
+}
+
+func TestOwners(t *testing.T) {
+	manager := NewManager(Config{Workers: 1})
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	defer close(release)
+	submitted, _ := manager.Submit("alice", "analysis", nil, "key", blockingRun(started, release, "key"))
+	<-started
+
+	if found, ok := manager.Get("bob", submitted.ID); ok {
+		t.Errorf("Get() by another owner = %+v, want not found", found)
+	}
+	if _, ok := manager.Cancel("bob", submitted.ID); ok {
+		t.Errorf("Cancel() by another owner found the job")
+	}
+	if found, _ := manager.Get("alice", submitted.ID); found.Status != Running {
+		t.Errorf("job canceled by another owner has status %v", found.Status)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	cache := newResultCache(2)
+	a, b, c := &Result{Body: []byte("a")}, &Result{Body: []byte("b")}, &Result{Body: []byte("c")}
+	cache.add("a", a)
+	cache.add("b", b)
+	cache.get("a")
+	cache.add("c", c)
+
+	tests := []struct {
+		key    string
+		want   *Result
+		wantOk bool
+	}{
+		{"a", a, true},
+		{"b", nil, false},
+		{"c", c, true},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			got, ok := cache.get(test.key)
+			if got != test.want || ok != test.wantOk {
+				t.Errorf("get(%q) = %v, %v, want %v, %v", test.key, got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+
+	cache.add("a", c)
+	if got, _ := cache.get("a"); got != c || cache.order.Len() != 2 {
+		t.Errorf("add() of cached key = %v with %v entries, want replaced result", got, cache.order.Len())
+	}
+}
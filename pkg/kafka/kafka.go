@@ -26,6 +26,31 @@ func (s Service) NextMessage() ([]byte, error) {
 	return m.Value, nil
 }
 
+// ReadMessage returns next message value, it waits for the message until ctx is done
+func (s Service) ReadMessage(ctx context.Context) ([]byte, error) {
+	m, err := s.reader.ReadMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.Value, nil
+}
+
+// Close closes connection of the service
+func (s Service) Close() error {
+	return s.reader.Close()
+}
+
+// NewLatestMessagesKafka returns kafka.Service connected to topic that reads only
+// the messages written after the connection, for consumers that don't need the history
+func NewLatestMessagesKafka(host string, port int, topic string) (Service, error) {
+	service := newConnection(host, port, topic)
+	if err := service.reader.SetOffset(kafka.LastOffset); err != nil {
+		service.reader.Close()
+		return Service{}, err
+	}
+	return service, nil
+}
+
 func newConnection(host string, port int, topic string) Service {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:   []string{host + ":" + strconv.Itoa(port)},
@@ -1,31 +1,47 @@
 package kafka
 
+// Kafka topics of learner events routed by filebeat
+const (
+	VideoTopic      = "VideoEvents"
+	ProblemTopic    = "TestEvents"
+	SequentialTopic = "SequentialEvents"
+	BookmarksTopic  = "BookmarksEvents"
+	LinksTopic      = "LinksEvents"
+	EnrollmentTopic = "EnrollmentEvents"
+)
+
 // NewVideoTopicKafka returns kafka.Service connected to
 // VideoEvents kafka topic
 func NewVideoTopicKafka(host string, port int) Service {
-	return newConnection(host, port, "VideoEvents")
+	return newConnection(host, port, VideoTopic)
 }
 
 // NewProblemTopicKafka returns kafka.Service connected to
 // TestEvents kafka topic
 func NewProblemTopicKafka(host string, port int) Service {
-	return newConnection(host, port, "TestEvents")
+	return newConnection(host, port, ProblemTopic)
 }
 
 // NewSequentialTopicKafka returns kafka.Service connected to
 // SequentialEvents kafka topic
 func NewSequentialTopicKafka(host string, port int) Service {
-	return newConnection(host, port, "SequentialEvents")
+	return newConnection(host, port, SequentialTopic)
 }
 
 // NewBookmarksTopicKafka returns kafka.Service connected to
 // BookmarksEvents kafka topic
 func NewBookmarksTopicKafka(host string, port int) Service {
-	return newConnection(host, port, "BookmarksEvents")
+	return newConnection(host, port, BookmarksTopic)
 }
 
 // NewLinksTopicKafka returns kafka.Service connected to
 // LinksEvents kafka topic
 func NewLinksTopicKafka(host string, port int) Service {
-	return newConnection(host, port, "LinksEvents")
+	return newConnection(host, port, LinksTopic)
+}
+
+// NewEnrollmentTopicKafka returns kafka.Service connected to
+// EnrollmentEvents kafka topic
+func NewEnrollmentTopicKafka(host string, port int) Service {
+	return newConnection(host, port, EnrollmentTopic)
 }
@@ -0,0 +1,58 @@
+package live
+
+import (
+	"fmt"
+	"kafka-log-processor/pkg/models"
+	"time"
+)
+
+// Event is a learner event of the live stream. Events without BlockID are counted
+// only in course-wide activity.
+type Event struct {
+	Time       time.Time
+	CourseID   string
+	BlockID    string
+	Username   string
+	Platform   string
+	Play       bool
+	Submission bool
+}
+
+// EventOf returns event of parsed event description, blocks are found the way
+// rollups find them. Enrollment events and other documents aren't learner activity.
+func EventOf(document interface{}) (Event, bool, error) {
+	var event Event
+	var eventTime string
+	switch document := document.(type) {
+	case models.VideoEventDescription:
+		eventTime, event.CourseID, event.Username, event.Platform = document.EventTime, document.CourseID, document.Username, document.Platform
+		event.BlockID = document.VideoID
+		event.Play = document.EventType == models.PLAY
+	case models.ProblemEventDescription:
+		eventTime, event.CourseID, event.Username, event.Platform = document.EventTime, document.CourseID, document.Username, document.Platform
+		event.BlockID = document.ProblemID
+		event.Submission = document.EventType == models.ProblemSubmittedEventType
+	case models.SequentialMoveEventDescription:
+		eventTime, event.CourseID, event.Username, event.Platform = document.EventTime, document.CourseID, document.Username, document.Platform
+		event.BlockID = document.NewVerticalID
+	case models.BookmarksEventDescription:
+		eventTime, event.CourseID, event.Username, event.Platform = document.EventTime, document.CourseID, document.Username, document.Platform
+		event.BlockID = document.BlockID
+		if event.BlockID == "" {
+			event.BlockID = models.GetBlockIDFromUsageKey(document.ID)
+		}
+	case models.LinkEventDescription:
+		eventTime, event.CourseID, event.Username, event.Platform = document.EventTime, document.CourseID, document.Username, document.Platform
+		event.BlockID = document.CurrentBlockID
+	default:
+		return Event{}, false, nil
+	}
+	if event.CourseID == "" {
+		return Event{}, false, nil
+	}
+	var err error
+	if event.Time, err = models.ParseEventTime(eventTime); err != nil {
+		return Event{}, false, fmt.Errorf("event has incorrect event_time: %w", err)
+	}
+	return event, true, nil
+}
@@ -0,0 +1,330 @@
+package live
+
+// Live activity of courses. Learner events are kept by courses and minutes for
+// the replay window. Every update interval subscribers of a course get the
+// activity of the minutes that got new events, counted over the blocks and
+// platforms they selected. Minutes without selected events aren't sent.
+// The updates run until the hub is closed.
+
+import (
+	"kafka-log-processor/pkg/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config of Hub, zero values are replaced by defaults
+type Config struct {
+	// Window is how long events are kept for replay, 1 hour by default
+	Window time.Duration
+	// Interval is the period of updates, 5 seconds by default
+	Interval time.Duration
+	// Buffer is the number of updates a subscriber can leave unread, slower
+	// subscribers are dropped. 100 by default.
+	Buffer int
+}
+
+// Query selects live activity of a course. Empty Blocks and Platforms don't filter.
+// Minutes from Since are replayed on subscription, zero Since replays nothing.
+type Query struct {
+	CourseID  string
+	Blocks    []string
+	Platforms []string
+	Since     time.Time
+}
+
+// Hub counts live activity of courses for their subscribers
+type Hub struct {
+	config  Config
+	mutex   sync.Mutex
+	courses map[string]*courseEvents
+	// now is the clock of added events and replays
+	now       func() time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type courseEvents struct {
+	minutes       map[time.Time][]Event
+	changed       map[time.Time]bool
+	subscriptions map[*Subscription]bool
+}
+
+// Subscription receives live activity of its query
+type Subscription struct {
+	hub       *Hub
+	courseID  string
+	blocks    map[string]bool
+	platforms map[string]bool
+	updates   chan models.LiveActivity
+}
+
+// NewHub constructs Hub and starts its updates, they are stopped by Close
+func NewHub(config Config) *Hub {
+	if config.Window <= 0 {
+		config.Window = time.Hour
+	}
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Second
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = 100
+	}
+	hub := &Hub{config: config, courses: map[string]*courseEvents{}, now: time.Now, done: make(chan struct{})}
+	go hub.update()
+	return hub
+}
+
+// Window returns how long events are kept for replay
+func (hub *Hub) Window() time.Duration {
+	return hub.config.Window
+}
+
+// Add counts event. Events older than the window or more than a minute ahead of the clock are skipped.
+func (hub *Hub) Add(event Event) {
+	now := hub.now()
+	minute := event.Time.UTC().Truncate(time.Minute)
+	if minute.Before(hub.oldestMinute(now)) || event.Time.After(now.Add(time.Minute)) {
+		return
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	course := hub.course(event.CourseID)
+	course.minutes[minute] = append(course.minutes[minute], event)
+	course.changed[minute] = true
+}
+
+// Subscribe returns subscription of query and the activity of the minutes from query.Since
+// within the window. Later activity comes from Subscription.Updates, updates of
+// a closed hub are closed at once.
+func (hub *Hub) Subscribe(query Query) (*Subscription, []models.LiveActivity) {
+	subscription := &Subscription{
+		hub:       hub,
+		courseID:  query.CourseID,
+		blocks:    set(query.Blocks),
+		platforms: set(query.Platforms),
+		updates:   make(chan models.LiveActivity, hub.config.Buffer),
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	select {
+	case <-hub.done:
+		close(subscription.updates)
+		return subscription, nil
+	default:
+	}
+	course := hub.course(query.CourseID)
+	course.subscriptions[subscription] = true
+
+	var replay []models.LiveActivity
+	if query.Since.IsZero() {
+		return subscription, replay
+	}
+	since := query.Since.UTC().Truncate(time.Minute)
+	if oldest := hub.oldestMinute(hub.now()); since.Before(oldest) {
+		since = oldest
+	}
+	for _, minute := range sortedMinutes(course.minutes) {
+		if minute.Before(since) {
+			continue
+		}
+		if activity, ok := subscription.activity(minute, course.minutes[minute]); ok {
+			replay = append(replay, activity)
+		}
+	}
+	return subscription, replay
+}
+
+// Updates returns activity of the minutes that got new events. The channel is closed
+// when the subscription is closed or dropped for being too slow.
+func (subscription *Subscription) Updates() <-chan models.LiveActivity {
+	return subscription.updates
+}
+
+// Close stops updates of the subscription
+func (subscription *Subscription) Close() {
+	subscription.hub.mutex.Lock()
+	defer subscription.hub.mutex.Unlock()
+	subscription.hub.unsubscribe(subscription)
+}
+
+// Close stops updates of the hub and closes its subscriptions
+func (hub *Hub) Close() {
+	hub.closeOnce.Do(func() { close(hub.done) })
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, course := range hub.courses {
+		for subscription := range course.subscriptions {
+			hub.unsubscribe(subscription)
+		}
+	}
+}
+
+func (hub *Hub) update() {
+	ticker := time.NewTicker(hub.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hub.done:
+			return
+		case now := <-ticker.C:
+			hub.publish(now)
+		}
+	}
+}
+
+// publish sends activity of changed minutes to subscribers and forgets minutes older than the window
+func (hub *Hub) publish(now time.Time) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	oldest := hub.oldestMinute(now)
+	for courseID, course := range hub.courses {
+		changed := make([]time.Time, 0, len(course.changed))
+		for minute := range course.changed {
+			changed = append(changed, minute)
+		}
+		sort.Slice(changed, func(i, j int) bool { return changed[i].Before(changed[j]) })
+		course.changed = map[time.Time]bool{}
+		for subscription := range course.subscriptions {
+			hub.send(subscription, changed, course.minutes)
+		}
+		for minute := range course.minutes {
+			if minute.Before(oldest) {
+				delete(course.minutes, minute)
+			}
+		}
+		if len(course.minutes) == 0 && len(course.subscriptions) == 0 {
+			delete(hub.courses, courseID)
+		}
+	}
+}
+
+// send sends activity of minutes to subscription, it is dropped if its buffer is full
+func (hub *Hub) send(subscription *Subscription, minutes []time.Time, events map[time.Time][]Event) {
+	for _, minute := range minutes {
+		activity, ok := subscription.activity(minute, events[minute])
+		if !ok {
+			continue
+		}
+		select {
+		case subscription.updates <- activity:
+		default:
+			hub.unsubscribe(subscription)
+			return
+		}
+	}
+}
+
+func (hub *Hub) unsubscribe(subscription *Subscription) {
+	course, ok := hub.courses[subscription.courseID]
+	if !ok || !course.subscriptions[subscription] {
+		return
+	}
+	delete(course.subscriptions, subscription)
+	close(subscription.updates)
+}
+
+func (hub *Hub) course(courseID string) *courseEvents {
+	course, ok := hub.courses[courseID]
+	if !ok {
+		course = &courseEvents{
+			minutes:       map[time.Time][]Event{},
+			changed:       map[time.Time]bool{},
+			subscriptions: map[*Subscription]bool{},
+		}
+		hub.courses[courseID] = course
+	}
+	return course
+}
+
+func (hub *Hub) oldestMinute(now time.Time) time.Time {
+	return now.UTC().Add(-hub.config.Window).Truncate(time.Minute)
+}
+
+// activity counts events of minute selected by the subscription, false if none are selected
+func (subscription *Subscription) activity(minute time.Time, events []Event) (models.LiveActivity, bool) {
+	course := newCounter()
+	blocks := map[string]*counter{}
+	for _, event := range events {
+		if len(subscription.platforms) > 0 && !subscription.platforms[event.Platform] {
+			continue
+		}
+		if len(subscription.blocks) > 0 && !subscription.blocks[event.BlockID] {
+			continue
+		}
+		course.add(event)
+		if event.BlockID == "" {
+			continue
+		}
+		block, ok := blocks[event.BlockID]
+		if !ok {
+			block = newCounter()
+			blocks[event.BlockID] = block
+		}
+		block.add(event)
+	}
+	if course.events == 0 {
+		return models.LiveActivity{}, false
+	}
+
+	activity := models.LiveActivity{
+		CourseID:       subscription.courseID,
+		Minute:         minute,
+		ActiveLearners: int64(len(course.learners)),
+		Plays:          course.plays,
+		Submissions:    course.submissions,
+		Blocks:         make([]models.LiveBlockActivity, 0, len(blocks)),
+	}
+	for blockID, block := range blocks {
+		activity.Blocks = append(activity.Blocks, models.LiveBlockActivity{
+			BlockID:        blockID,
+			ActiveLearners: int64(len(block.learners)),
+			Plays:          block.plays,
+			Submissions:    block.submissions,
+		})
+	}
+	sort.Slice(activity.Blocks, func(i, j int) bool { return activity.Blocks[i].BlockID < activity.Blocks[j].BlockID })
+	return activity, true
+}
+
+type counter struct {
+	events      int
+	learners    map[string]bool
+	plays       int64
+	submissions int64
+}
+
+func newCounter() *counter {
+	return &counter{learners: map[string]bool{}}
+}
+
+func (c *counter) add(event Event) {
+	c.events++
+	if event.Username != "" {
+		c.learners[event.Username] = true
+	}
+	if event.Play {
+		c.plays++
+	}
+	if event.Submission {
+		c.submissions++
+	}
+}
+
+// sortedMinutes returns minutes of course events sorted by time
+func sortedMinutes(events map[time.Time][]Event) []time.Time {
+	minutes := make([]time.Time, 0, len(events))
+	for minute := range events {
+		minutes = append(minutes, minute)
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i].Before(minutes[j]) })
+	return minutes
+}
+
+func set(values []string) map[string]bool {
+	valueSet := make(map[string]bool, len(values))
+	for _, value := range values {
+		valueSet[value] = true
+	}
+	return valueSet
+}
@@ -0,0 +1,211 @@
+package live
+
+import (
+	"kafka-log-processor/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+func at(hour int, minute int, second int) time.Time {
+	return time.Date(2020, 3, 1, hour, minute, second, 0, time.UTC)
+}
+
+// newTestHub returns hub with the clock at *clock, updates are published by the tests
+func newTestHub(t *testing.T, config Config, clock *time.Time) *Hub {
+	t.Helper()
+	config.Interval = time.Hour
+	hub := NewHub(config)
+	t.Cleanup(hub.Close)
+	hub.now = func() time.Time { return *clock }
+	return hub
+}
+
+// received returns updates of subscription sent so far and if they are still open
+func received(subscription *Subscription) ([]models.LiveActivity, bool) {
+	var activities []models.LiveActivity
+	for {
+		select {
+		case activity, ok := <-subscription.Updates():
+			if !ok {
+				return activities, false
+			}
+			activities = append(activities, activity)
+		default:
+			return activities, true
+		}
+	}
+}
+
+func minutesOf(activities []models.LiveActivity) []time.Time {
+	var minutes []time.Time
+	for _, activity := range activities {
+		minutes = append(minutes, activity.Minute)
+	}
+	return minutes
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	clock := at(12, 30, 30)
+	hub := newTestHub(t, Config{Window: 10 * time.Minute}, &clock)
+	for _, event := range []Event{
+		{Time: at(12, 19, 59), Username: "late"},
+		{Time: at(12, 21, 10), Username: "alice"},
+		{Time: at(12, 29, 0), Username: "bob"},
+		{Time: at(12, 31, 31), Username: "ahead"},
+	} {
+		event.CourseID = testCourseID
+		hub.Add(event)
+	}
+	// the window moves past 12:21 before the minute is forgotten by publish
+	clock = at(12, 35, 30)
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  []time.Time
+	}{
+		{"no replay", time.Time{}, nil},
+		{"clamped to the window", at(12, 0, 0), []time.Time{at(12, 29, 0)}},
+		{"since the middle of a minute", at(12, 29, 40), []time.Time{at(12, 29, 0)}},
+		{"since later minute", at(12, 30, 0), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subscription, replay := hub.Subscribe(Query{CourseID: testCourseID, Since: test.since})
+			defer subscription.Close()
+			if got := minutesOf(replay); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("replayed minutes %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPublishFilters(t *testing.T) {
+	clock := at(12, 30, 0)
+	hub := newTestHub(t, Config{}, &clock)
+	for _, event := range []Event{
+		{Time: at(12, 28, 10), BlockID: "problem1", Username: "carol", Platform: "web", Submission: true},
+		{Time: at(12, 29, 10), BlockID: "video1", Username: "alice", Platform: "web", Play: true},
+		{Time: at(12, 29, 20), BlockID: "video1", Username: "bob", Platform: "mobile", Play: true},
+		{Time: at(12, 29, 30), BlockID: "problem1", Username: "alice", Platform: "web", Submission: true},
+		{Time: at(12, 29, 40), Username: "dave", Platform: "web"},
+	} {
+		event.CourseID = testCourseID
+		hub.Add(event)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []models.LiveActivity
+	}{
+		{"every event", Query{}, []models.LiveActivity{
+			{Minute: at(12, 28, 0), ActiveLearners: 1, Submissions: 1, Blocks: []models.LiveBlockActivity{{BlockID: "problem1", ActiveLearners: 1, Submissions: 1}}},
+			{Minute: at(12, 29, 0), ActiveLearners: 3, Plays: 2, Submissions: 1, Blocks: []models.LiveBlockActivity{
+				{BlockID: "problem1", ActiveLearners: 1, Submissions: 1},
+				{BlockID: "video1", ActiveLearners: 2, Plays: 2},
+			}},
+		}},
+		{"block and platform", Query{Blocks: []string{"video1"}, Platforms: []string{"web"}}, []models.LiveActivity{
+			{Minute: at(12, 29, 0), ActiveLearners: 1, Plays: 1, Blocks: []models.LiveBlockActivity{{BlockID: "video1", ActiveLearners: 1, Plays: 1}}},
+		}},
+		{"platform", Query{Platforms: []string{"mobile"}}, []models.LiveActivity{
+			{Minute: at(12, 29, 0), ActiveLearners: 1, Plays: 1, Blocks: []models.LiveBlockActivity{{BlockID: "video1", ActiveLearners: 1, Plays: 1}}},
+		}},
+		{"block without events", Query{Blocks: []string{"video2"}}, nil},
+	}
+	subscriptions := make([]*Subscription, len(tests))
+	for i, test := range tests {
+		test.query.CourseID = testCourseID
+		subscriptions[i], _ = hub.Subscribe(test.query)
+	}
+	hub.publish(clock)
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for j := range test.want {
+				test.want[j].CourseID = testCourseID
+			}
+			got, open := received(subscriptions[i])
+			if !reflect.DeepEqual(got, test.want) || !open {
+				t.Errorf("updates = %+v, open %v, want %+v", got, open, test.want)
+			}
+		})
+	}
+
+	// published minutes are sent again only when they get new events
+	hub.publish(clock)
+	if got, _ := received(subscriptions[0]); len(got) != 0 {
+		t.Errorf("unchanged minutes were sent again: %+v", got)
+	}
+	hub.Add(Event{Time: at(12, 29, 50), CourseID: testCourseID, Username: "erin"})
+	hub.publish(clock)
+	if got, _ := received(subscriptions[0]); len(got) != 1 || got[0].ActiveLearners != 4 {
+		t.Errorf("updates after new event = %+v, want the changed minute with 4 learners", got)
+	}
+}
+
+func TestPublishDropsSlowSubscribers(t *testing.T) {
+	clock := at(12, 30, 0)
+	hub := newTestHub(t, Config{Buffer: 1}, &clock)
+	hub.Add(Event{Time: at(12, 28, 0), CourseID: testCourseID, BlockID: "video1", Username: "alice"})
+	hub.Add(Event{Time: at(12, 29, 0), CourseID: testCourseID, BlockID: "video2", Username: "alice"})
+	slow, _ := hub.Subscribe(Query{CourseID: testCourseID})
+	selective, _ := hub.Subscribe(Query{CourseID: testCourseID, Blocks: []string{"video2"}})
+
+	hub.publish(clock)
+	if got, open := received(slow); len(got) != 1 || open {
+		t.Errorf("slow subscriber got %v updates, open %v, want the first update and closed channel", len(got), open)
+	}
+	if got, open := received(selective); len(got) != 1 || !open {
+		t.Errorf("subscriber with free buffer got %v updates, open %v, want 1 and open channel", len(got), open)
+	}
+	slow.Close()
+
+	hub.Add(Event{Time: at(12, 30, 0), CourseID: testCourseID, BlockID: "video2", Username: "bob"})
+	hub.publish(clock)
+	if got, open := received(selective); len(got) != 1 || !open {
+		t.Errorf("subscriber got %v updates, open %v, want 1 and open channel", len(got), open)
+	}
+}
+
+func TestPublishForgetsOldMinutes(t *testing.T) {
+	clock := at(12, 30, 0)
+	hub := newTestHub(t, Config{Window: 10 * time.Minute}, &clock)
+	hub.Add(Event{Time: at(12, 21, 0), CourseID: testCourseID, Username: "alice"})
+	hub.Add(Event{Time: at(12, 29, 0), CourseID: testCourseID, Username: "bob"})
+
+	hub.publish(at(12, 35, 0))
+	subscription, replay := hub.Subscribe(Query{CourseID: testCourseID, Since: at(12, 0, 0)})
+	if got := minutesOf(replay); !reflect.DeepEqual(got, []time.Time{at(12, 29, 0)}) {
+		t.Errorf("replayed minutes %v, want only the minute within the window of publish", got)
+	}
+	subscription.Close()
+
+	hub.publish(at(13, 0, 0))
+	if len(hub.courses) != 0 {
+		t.Errorf("hub keeps %v courses without events and subscribers", len(hub.courses))
+	}
+}
+
+func TestClose(t *testing.T) {
+	clock := at(12, 30, 0)
+	hub := newTestHub(t, Config{}, &clock)
+	subscription, _ := hub.Subscribe(Query{CourseID: testCourseID})
+
+	hub.Close()
+	if _, open := received(subscription); open {
+		t.Errorf("updates of closed hub are open")
+	}
+	subscription.Close()
+	hub.Close()
+
+	late, _ := hub.Subscribe(Query{CourseID: testCourseID})
+	if _, open := received(late); open {
+		t.Errorf("subscription to closed hub is open")
+	}
+	late.Close()
+}
@@ -0,0 +1,117 @@
+package live
+
+import (
+	"context"
+	"fmt"
+	"kafka-log-processor/pkg/kafka"
+	"kafka-log-processor/pkg/parsers"
+	"log"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+// topicParser parses message of a kafka topic into event description
+type topicParser func(ctx context.Context, message []byte, structureIndices *parsers.CourseStructureIndexCache) (interface{}, error)
+
+// topicParsers are parsers of the kafka topics with learner activity. Blocks of sequential
+// and link events are resolved with course structures the way parser services do it.
+var topicParsers = map[string]topicParser{
+	kafka.VideoTopic: func(ctx context.Context, message []byte, _ *parsers.CourseStructureIndexCache) (interface{}, error) {
+		return parsers.ParseVideoEvent(message)
+	},
+	kafka.ProblemTopic: func(ctx context.Context, message []byte, _ *parsers.CourseStructureIndexCache) (interface{}, error) {
+		return parsers.ParseProblemEvent(message)
+	},
+	kafka.SequentialTopic: func(ctx context.Context, message []byte, structureIndices *parsers.CourseStructureIndexCache) (interface{}, error) {
+		sequentialEvent, err := parsers.ParseSequentialEvent(message)
+		if err != nil {
+			return nil, err
+		}
+		if structureIndex, err := structureIndices.Get(ctx, sequentialEvent.CourseID); err == nil {
+			parsers.ResolveSequentialEventVerticals(&sequentialEvent, structureIndex)
+		}
+		return sequentialEvent, nil
+	},
+	kafka.BookmarksTopic: func(ctx context.Context, message []byte, _ *parsers.CourseStructureIndexCache) (interface{}, error) {
+		return parsers.ParseBookmarksEvent(message)
+	},
+	kafka.LinksTopic: func(ctx context.Context, message []byte, structureIndices *parsers.CourseStructureIndexCache) (interface{}, error) {
+		linkEvent, err := parsers.ParseLinkEvent(message)
+		if err != nil {
+			return nil, err
+		}
+		if structureIndex, err := structureIndices.Get(ctx, linkEvent.CourseID); err == nil {
+			parsers.ResolveLinkEventBlocks(&linkEvent, structureIndex)
+		}
+		return linkEvent, nil
+	},
+}
+
+// ConsumeKafka reads messages written to kafka topics from now on and adds their events
+// to hub until ctx is done. Course structures are loaded with getCourseStructure.
+// Usernames are only used to count learners and aren't pseudonymized.
+func ConsumeKafka(ctx context.Context, hub *Hub, host string, port int, topics []string, getCourseStructure func(ctx context.Context, courseCode string) (edxstruct.Course, error)) error {
+	services := make([]kafka.Service, 0, len(topics))
+	for _, topic := range topics {
+		if _, ok := topicParsers[topic]; !ok {
+			closeAll(services)
+			return fmt.Errorf("topic %v has no learner activity", topic)
+		}
+		service, err := kafka.NewLatestMessagesKafka(host, port, topic)
+		if err != nil {
+			closeAll(services)
+			return fmt.Errorf("can't connect to kafka topic %v: %w", topic, err)
+		}
+		services = append(services, service)
+	}
+	for i, topic := range topics {
+		// structure caches aren't safe for concurrent use, every topic has its own
+		go consume(ctx, hub, services[i], topic, parsers.NewCourseStructureIndexCache(getCourseStructure))
+	}
+	return nil
+}
+
+func consume(ctx context.Context, hub *Hub, service kafka.Service, topic string, structureIndices *parsers.CourseStructureIndexCache) {
+	defer service.Close()
+	parse := topicParsers[topic]
+	for {
+		message, err := service.ReadMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("WARN: can't read live activity from kafka topic %v: %v\n", topic, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		document, err := parse(ctx, message, structureIndices)
+		if err != nil {
+			log.Printf("WARN: can't parse message of kafka topic %v: %v\n", topic, err)
+			continue
+		}
+		event, ok, err := EventOf(document)
+		if err != nil {
+			log.Printf("WARN: can't count message of kafka topic %v: %v\n", topic, err)
+			continue
+		}
+		if ok {
+			hub.Add(event)
+		}
+	}
+}
+
+func closeAll(services []kafka.Service) {
+	for _, service := range services {
+		service.Close()
+	}
+}
+
+// Topics returns the kafka topics with learner activity
+func Topics() []string {
+	return []string{kafka.VideoTopic, kafka.ProblemTopic, kafka.SequentialTopic, kafka.BookmarksTopic, kafka.LinksTopic}
+}
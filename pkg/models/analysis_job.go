@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// AnalysisJob is a state of an analysis running in background. Status is "queued", "running",
+// "succeeded", "failed" or "canceled". Progress is the done part of the analysis from 0 to 1,
+// analyses that don't report steps jump from 0 to 1. Cached jobs got the result of an earlier
+// job with the same parameters on the same data.
+type AnalysisJob struct {
+	ID         string            `json:"id"`
+	Analysis   string            `json:"analysis"`
+	Params     map[string]string `json:"params"`
+	Status     string            `json:"status"`
+	Progress   float64           `json:"progress"`
+	DoneSteps  int               `json:"done_steps"`
+	TotalSteps int               `json:"total_steps"`
+	Cached     bool              `json:"cached"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// BlockBookmarks describes bookmarks of the course block.
+// ActiveBookmarks is a number of bookmarks that weren't removed,
+// AddedBookmarks is a number of times the block was bookmarked,
+// Returns is a number of bookmarks after which learner came back to the block.
+type BlockBookmarks struct {
+	BlockID                  string  `json:"block_id"`
+	DisplayName              string  `json:"display_name"`
+	ActiveBookmarks          int     `json:"active_bookmarks"`
+	AddedBookmarks           int     `json:"added_bookmarks"`
+	Returns                  int     `json:"returns"`
+	MedianReturnDelaySeconds float64 `json:"median_return_delay_seconds"`
+}
+
+// BookmarksTimeline is a number of active bookmarks of the block at the end of
+// every day it has changed
+type BookmarksTimeline struct {
+	BlockID         string   `json:"block_id"`
+	DisplayName     string   `json:"display_name"`
+	Dates           []string `json:"dates"`
+	ActiveBookmarks []int    `json:"active_bookmarks"`
+}
+
+// BookmarksReport contains bookmark analytics of the course.
+// Blocks are sorted from the most bookmarked ones.
+type BookmarksReport struct {
+	Blocks                   []BlockBookmarks    `json:"blocks"`
+	Timelines                []BookmarksTimeline `json:"timelines"`
+	ReturnRate               float64             `json:"return_rate"`
+	MedianReturnDelaySeconds float64             `json:"median_return_delay_seconds"`
+}
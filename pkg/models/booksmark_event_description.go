@@ -4,11 +4,16 @@ package models
 // IsAdded shows if bookmark is being added or removed
 // (true  => added)
 // (false => removed)
+// ID is a usage key of the bookmarked block, BlockID and BlockName are its
+// url_name and display name.
 type BookmarksEventDescription struct {
-	EventTime string `json:"event_time"`
-	Username  string `json:"username"`
-	ID        string `json:"id"`
-	EventType string `json:"event_type"`
-	IsAdded   bool   `json:"is_added"`
-	CourseID  string `json:"course_id"`
+	EventTime string `json:"event_time" parquet:"event_time"`
+	Username  string `json:"username" parquet:"username"`
+	ID        string `json:"id" parquet:"id"`
+	EventType string `json:"event_type" parquet:"event_type"`
+	IsAdded   bool   `json:"is_added" parquet:"is_added"`
+	CourseID  string `json:"course_id" parquet:"course_id"`
+	BlockID   string `json:"block_id" parquet:"block_id"`
+	BlockName string `json:"block_name" parquet:"block_name"`
+	Platform  string `json:"platform" parquet:"platform"`
 }
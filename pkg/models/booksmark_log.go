@@ -7,6 +7,7 @@ type BookmarksLog struct {
 	Time             string            `json:"time"`
 	Event            BookmarksEventLog `json:"event"`
 	BookmarksContext LogContext        `json:"context"`
+	LogOrigin
 }
 
 // BookmarksEventLog is a definition of an event object within BookmarksLog
@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // GetCourseCodeFromCourseID extracts CourseCode from "course-v1:org+CourseCode+CourseRun" notation
@@ -13,3 +14,15 @@ func GetCourseCodeFromCourseID(courseID string) (string, error) {
 	}
 	return courseIDSplited[1], nil
 }
+
+// GetBlockIDFromUsageKey extracts block ID from "block-v1:org+CourseCode+CourseRun+type@vertical+block@BlockID"
+// notation. If usageKey is already a block ID, it is returned unchanged.
+func GetBlockIDFromUsageKey(usageKey string) string {
+	usageKeySplited := strings.Split(usageKey, "@")
+	return usageKeySplited[len(usageKeySplited)-1]
+}
+
+// ParseEventTime parses event_time field of event descriptions
+func ParseEventTime(eventTime string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, eventTime)
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// BlockActivity is activity on the course block during a day (or an hour).
+// Course-wide activity has empty BlockID. ScoreSum is a sum of submission scores
+// from 0 to 1, MeanScore is ScoreSum divided by Submissions.
+type BlockActivity struct {
+	Date             time.Time `json:"date"`
+	CourseID         string    `json:"course_id"`
+	BlockID          string    `json:"block_id"`
+	ActiveLearners   int64     `json:"active_learners"`
+	VideoPlays       int64     `json:"video_plays"`
+	WatchSeconds     float64   `json:"watch_seconds"`
+	Submissions      int64     `json:"submissions"`
+	ScoreSum         float64   `json:"score_sum"`
+	MeanScore        float64   `json:"mean_score"`
+	BookmarksAdded   int64     `json:"bookmarks_added"`
+	BookmarksRemoved int64     `json:"bookmarks_removed"`
+	LinkClicks       int64     `json:"link_clicks"`
+}
+
+// CourseActivity is activity on the course and its blocks by days or hours.
+// Course contains course-wide activity, Blocks contain activity of every block.
+type CourseActivity struct {
+	CourseID    string          `json:"course_id"`
+	Granularity string          `json:"granularity"`
+	Course      []BlockActivity `json:"course"`
+	Blocks      []BlockActivity `json:"blocks"`
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+// CourseStructureIndex gives quick access to course blocks by their url_name.
+// Blocks are numbered in the order a learner meets them in the courseware:
+// every vertical gets a position and its videos and problems follow it.
+// Chapters and sequentials share the position of their first vertical.
+type CourseStructureIndex struct {
+	positions           map[string]int
+	displayNames        map[string]string
+	sequentialVerticals map[string][]string
+	blockSequentials    map[string]string
+	blockVerticals      map[string]string
+}
+
+// NewCourseStructureIndex builds CourseStructureIndex for the course
+func NewCourseStructureIndex(course edxstruct.Course) CourseStructureIndex {
+	index := CourseStructureIndex{
+		positions:           map[string]int{},
+		displayNames:        map[string]string{},
+		sequentialVerticals: map[string][]string{},
+		blockSequentials:    map[string]string{},
+		blockVerticals:      map[string]string{},
+	}
+
+	currentPosition := 0
+	for _, chapter := range course.Chapters {
+		index.displayNames[chapter.URLName] = chapter.DisplayName
+		for _, sequential := range chapter.Sequentials {
+			index.displayNames[sequential.URLName] = sequential.DisplayName
+			for _, vertical := range sequential.Verticals {
+				if _, ok := index.positions[chapter.URLName]; !ok {
+					index.positions[chapter.URLName] = currentPosition
+				}
+				if _, ok := index.positions[sequential.URLName]; !ok {
+					index.positions[sequential.URLName] = currentPosition
+				}
+				index.sequentialVerticals[sequential.URLName] = append(index.sequentialVerticals[sequential.URLName], vertical.URLName)
+				index.addBlock(vertical.URLName, vertical.DisplayName, sequential.URLName, vertical.URLName, &currentPosition)
+				for _, video := range vertical.Videos {
+					index.addBlock(video.URLName, video.DisplayName, sequential.URLName, vertical.URLName, &currentPosition)
+				}
+				for _, problem := range vertical.Problems {
+					index.addBlock(problem.URLName, problem.DisplayName, sequential.URLName, vertical.URLName, &currentPosition)
+				}
+			}
+		}
+	}
+
+	return index
+}
+
+func (index *CourseStructureIndex) addBlock(urlName string, displayName string, sequential string, vertical string, currentPosition *int) {
+	index.positions[urlName] = *currentPosition
+	index.displayNames[urlName] = displayName
+	index.blockSequentials[urlName] = sequential
+	index.blockVerticals[urlName] = vertical
+	*currentPosition++
+}
+
+// Position returns position of the block with url_name = urlName in the course
+func (index CourseStructureIndex) Position(urlName string) (int, bool) {
+	position, ok := index.positions[urlName]
+	return position, ok
+}
+
+// DisplayName returns display name of the block with url_name = urlName
+func (index CourseStructureIndex) DisplayName(urlName string) (string, bool) {
+	displayName, ok := index.displayNames[urlName]
+	return displayName, ok
+}
+
+// SequentialOf returns url_name of the sequential that contains block urlName
+func (index CourseStructureIndex) SequentialOf(urlName string) (string, bool) {
+	sequential, ok := index.blockSequentials[urlName]
+	return sequential, ok
+}
+
+// VerticalOf returns url_name of the vertical that contains block urlName.
+// For verticals their own url_name is returned.
+func (index CourseStructureIndex) VerticalOf(urlName string) (string, bool) {
+	vertical, ok := index.blockVerticals[urlName]
+	return vertical, ok
+}
+
+// SequentialVertical returns url_name of the vertical shown on tab tabPosition
+// of the sequential. Tab positions start from 1 as in edX logs.
+func (index CourseStructureIndex) SequentialVertical(sequential string, tabPosition int) (string, bool) {
+	verticals := index.sequentialVerticals[sequential]
+	if tabPosition < 1 || tabPosition > len(verticals) {
+		return "", false
+	}
+	return verticals[tabPosition-1], true
+}
+
+// BlockFromCoursewareURL returns url_name of the block that is opened by LMS url
+// rawURL. Both ".../courseware/chapter/sequential/position" and ".../jump_to/usage_key"
+// urls are supported.
+func (index CourseStructureIndex) BlockFromCoursewareURL(rawURL string) (string, bool) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	if activeBlock := parsedURL.Query().Get("activate_block_id"); activeBlock != "" {
+		if _, ok := index.positions[GetBlockIDFromUsageKey(activeBlock)]; ok {
+			return GetBlockIDFromUsageKey(activeBlock), true
+		}
+	}
+
+	pathParts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	for i, part := range pathParts {
+		switch part {
+		case "jump_to":
+			if i+1 < len(pathParts) {
+				blockID := GetBlockIDFromUsageKey(pathParts[i+1])
+				_, ok := index.positions[blockID]
+				return blockID, ok
+			}
+		case "courseware":
+			rest := pathParts[i+1:]
+			if len(rest) >= 3 {
+				if tabPosition, err := strconv.Atoi(rest[2]); err == nil {
+					if vertical, ok := index.SequentialVertical(rest[1], tabPosition); ok {
+						return vertical, true
+					}
+				}
+			}
+			for j := len(rest) - 1; j >= 0; j-- {
+				if _, ok := index.positions[rest[j]]; ok {
+					return rest[j], true
+				}
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
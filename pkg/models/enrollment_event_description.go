@@ -0,0 +1,16 @@
+package models
+
+// EnrollmentEventDescription is a change of learner's enrollment in the course.
+// Mode is the enrollment mode after the change ("audit", "verified", ...),
+// IsActive is false for unenrollments. UserID is the LMS id of the enrolled learner,
+// Username is empty if the enrollment was changed by someone else (e.g. staff).
+type EnrollmentEventDescription struct {
+	EventTime string `json:"event_time" parquet:"event_time"`
+	Username  string `json:"username" parquet:"username"`
+	UserID    int64  `json:"user_id" parquet:"user_id"`
+	EventType string `json:"event_type" parquet:"event_type"`
+	Mode      string `json:"mode" parquet:"mode"`
+	IsActive  bool   `json:"is_active" parquet:"is_active"`
+	CourseID  string `json:"course_id" parquet:"course_id"`
+	Platform  string `json:"platform" parquet:"platform"`
+}
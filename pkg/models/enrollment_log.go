@@ -0,0 +1,27 @@
+package models
+
+// EnrollmentLog is a definition of a log object with event type "edx.course.enrollment.activated",
+// "edx.course.enrollment.deactivated" or "edx.course.enrollment.mode_changed"
+type EnrollmentLog struct {
+	Username          string               `json:"username"`
+	EventType         string               `json:"event_type"`
+	Time              string               `json:"time"`
+	Event             EnrollmentEventLog   `json:"event"`
+	EnrollmentContext EnrollmentLogContext `json:"context"`
+	LogOrigin
+}
+
+// EnrollmentEventLog is a definition of an event object within EnrollmentLog.
+// UserID is the LMS id of the enrolled learner.
+type EnrollmentEventLog struct {
+	CourseID string `json:"course_id"`
+	UserID   int64  `json:"user_id"`
+	Mode     string `json:"mode"`
+}
+
+// EnrollmentLogContext is a definition of context object within EnrollmentLog.
+// UserID is the LMS id of the user who made the change, staff can enroll other learners.
+type EnrollmentLogContext struct {
+	CourseID string `json:"course_id"`
+	UserID   int64  `json:"user_id"`
+}
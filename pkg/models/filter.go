@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Filter selects events and learners of an analysis, zero values don't filter.
+// From and To limit event time, Usernames, EnrollmentModes and Platforms list the allowed
+// values. Learners with fewer than MinEvents events matching the other filters are left out.
+type Filter struct {
+	From            time.Time
+	To              time.Time
+	Usernames       []string
+	EnrollmentModes []string
+	Platforms       []string
+	MinEvents       int
+}
+
+// SelectsLearners tells if filter selects some learners or platforms instead of
+// all the events of the period
+func (filter Filter) SelectsLearners() bool {
+	return len(filter.Usernames) > 0 || len(filter.EnrollmentModes) > 0 || len(filter.Platforms) > 0 || filter.MinEvents > 0
+}
@@ -1,11 +1,40 @@
 package models
 
-// LinkEventDescription has all the data about moving within sequential object
+// LinkType describes where the clicked link leads
+type LinkType string
+
+const (
+	// COURSEWARE links lead to the course blocks within LMS
+	COURSEWARE LinkType = "courseware"
+	// INTERNAL links lead to LMS pages outside the courseware: progress, forum, wiki, etc.
+	INTERNAL LinkType = "internal"
+	// EXTERNAL links lead to resources outside LMS
+	EXTERNAL LinkType = "external"
+	// IN_PAGE links are empty or lead to an anchor of the current page
+	IN_PAGE LinkType = "in_page"
+)
+
+// LinkEventDescription has all the data about clicking links in LMS.
+// TargetSection is set for INTERNAL links (e.g. "progress", "discussion", "wiki",
+// "course" for the course home page and "home" for the LMS root).
+// TargetDomain and TargetPath are normalized parts of EXTERNAL links and
+// TargetResource is their concatenation. Block fields are url_names and display
+// names of the blocks the urls are resolved to using the course structure.
 type LinkEventDescription struct {
-	EventTime  string `json:"event_time"`
-	Username   string `json:"username"`
-	EventType  string `json:"event_type"`
-	CurrentURL string `json:"current_url"`
-	TargetURL  string `json:"target_url"`
-	CourseID   string `json:"course_id"`
+	EventTime        string   `json:"event_time" parquet:"event_time"`
+	Username         string   `json:"username" parquet:"username"`
+	EventType        string   `json:"event_type" parquet:"event_type"`
+	CurrentURL       string   `json:"current_url" parquet:"current_url"`
+	TargetURL        string   `json:"target_url" parquet:"target_url"`
+	CourseID         string   `json:"course_id" parquet:"course_id"`
+	LinkType         LinkType `json:"link_type" parquet:"link_type"`
+	TargetSection    string   `json:"target_section" parquet:"target_section"`
+	TargetDomain     string   `json:"target_domain" parquet:"target_domain"`
+	TargetPath       string   `json:"target_path" parquet:"target_path"`
+	TargetResource   string   `json:"target_resource" parquet:"target_resource"`
+	TargetBlockID    string   `json:"target_block_id" parquet:"target_block_id"`
+	TargetBlockName  string   `json:"target_block_name" parquet:"target_block_name"`
+	CurrentBlockID   string   `json:"current_block_id" parquet:"current_block_id"`
+	CurrentBlockName string   `json:"current_block_name" parquet:"current_block_name"`
+	Platform         string   `json:"platform" parquet:"platform"`
 }
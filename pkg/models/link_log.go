@@ -7,6 +7,7 @@ type LinkLog struct {
 	Time        string       `json:"time"`
 	Event       LinkEventLog `json:"event"`
 	LinkContext LogContext   `json:"context"`
+	LogOrigin
 }
 
 // LinkEventLog is a definition of an event object within ProblemLog
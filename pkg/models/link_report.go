@@ -0,0 +1,21 @@
+package models
+
+// ResourceClicks is a number of clicks on external resource
+type ResourceClicks struct {
+	Resource string `json:"resource"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// UnitResourceClicks are the most clicked external resources of the course unit
+type UnitResourceClicks struct {
+	BlockID     string           `json:"block_id"`
+	DisplayName string           `json:"display_name"`
+	Resources   []ResourceClicks `json:"resources"`
+}
+
+// ExternalResourcesReport are the most clicked external resources of the course
+// in total and for every unit links were clicked in
+type ExternalResourcesReport struct {
+	Course []ResourceClicks     `json:"course"`
+	Units  []UnitResourceClicks `json:"units"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// LiveActivity is activity on the course during a minute of the live stream.
+// Course-wide counts are counts of all the selected blocks, Blocks contain counts
+// of every block with events sorted by BlockID.
+type LiveActivity struct {
+	CourseID       string              `json:"course_id"`
+	Minute         time.Time           `json:"minute"`
+	ActiveLearners int64               `json:"active_learners"`
+	Plays          int64               `json:"plays"`
+	Submissions    int64               `json:"submissions"`
+	Blocks         []LiveBlockActivity `json:"blocks"`
+}
+
+// LiveBlockActivity is activity on the course block during a minute of the live stream.
+// BlockName is the display name of the block, empty if the course structure is unknown.
+type LiveBlockActivity struct {
+	BlockID        string `json:"block_id"`
+	BlockName      string `json:"block_name,omitempty"`
+	ActiveLearners int64  `json:"active_learners"`
+	Plays          int64  `json:"plays"`
+	Submissions    int64  `json:"submissions"`
+}
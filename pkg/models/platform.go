@@ -0,0 +1,27 @@
+package models
+
+import "strings"
+
+// Platforms of events: events of the edX mobile apps are "mobile", all the others are "web"
+const (
+	WebPlatform    = "web"
+	MobilePlatform = "mobile"
+)
+
+// Platforms are all the platforms of events
+var Platforms = []string{WebPlatform, MobilePlatform}
+
+// LogOrigin has fields of every edX log that tell where the event came from
+type LogOrigin struct {
+	EventSource string `json:"event_source"`
+	Agent       string `json:"agent"`
+}
+
+// Platform returns platform of the log. Mobile apps send their events with "mobile" event_source,
+// server events of requests made by the apps have user agent of the app.
+func (origin LogOrigin) Platform() string {
+	if origin.EventSource == "mobile" || strings.Contains(origin.Agent, "org.edx.mobile") {
+		return MobilePlatform
+	}
+	return WebPlatform
+}
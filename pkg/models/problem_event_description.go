@@ -1,13 +1,18 @@
 package models
 
+// ProblemSubmittedEventType is the event type of graded problem submissions
+const ProblemSubmittedEventType = "edx.grades.problem.submitted"
+
 // ProblemEventDescription has all the data about video events for analysis
-// JSON names are also mentioned for umarshaling and sending that json to elastic
+// JSON names are also mentioned for umarshaling and sending that json to elastic,
+// parquet names are column names of exported files
 type ProblemEventDescription struct {
-	EventTime        string  `json:"event_time"`
-	Username         string  `json:"username"`
-	ProblemID        string  `json:"problem_id"`
-	EventType        string  `json:"event_type"`
-	WeightedEarned   float64 `json:"weighted_earned"`
-	WeightedPossible float64 `json:"weighted_possible"`
-	CourseID         string  `json:"course_id"`
+	EventTime        string  `json:"event_time" parquet:"event_time"`
+	Username         string  `json:"username" parquet:"username"`
+	ProblemID        string  `json:"problem_id" parquet:"problem_id"`
+	EventType        string  `json:"event_type" parquet:"event_type"`
+	WeightedEarned   float64 `json:"weighted_earned" parquet:"weighted_earned"`
+	WeightedPossible float64 `json:"weighted_possible" parquet:"weighted_possible"`
+	CourseID         string  `json:"course_id" parquet:"course_id"`
+	Platform         string  `json:"platform" parquet:"platform"`
 }
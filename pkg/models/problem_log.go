@@ -7,6 +7,7 @@ type ProblemLog struct {
 	Time           string          `json:"time"`
 	Event          ProblemEventLog `json:"event"`
 	ProblemContext LogContext      `json:"context"`
+	LogOrigin
 }
 
 // ProblemEventLog is a definition of an event object within ProblemLog
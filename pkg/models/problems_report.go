@@ -0,0 +1,25 @@
+package models
+
+// ProblemStatistics describes graded submissions of the course problem.
+// Learners is a number of learners that submitted the problem, SolvedLearners got
+// the full score with their last submission, FirstAttemptSolvedLearners with the first one.
+// MeanScore is a mean share of the possible score of all the submissions. Position is
+// the position of the problem in the course structure, 0 if the structure doesn't have it.
+type ProblemStatistics struct {
+	ProblemID                  string  `json:"problem_id"`
+	DisplayName                string  `json:"display_name"`
+	Position                   int     `json:"position"`
+	Learners                   int     `json:"learners"`
+	Submissions                int     `json:"submissions"`
+	MeanAttempts               float64 `json:"mean_attempts"`
+	MeanScore                  float64 `json:"mean_score"`
+	SolvedLearners             int     `json:"solved_learners"`
+	FirstAttemptSolvedLearners int     `json:"first_attempt_solved_learners"`
+}
+
+// ProblemsReport contains statistics of the course problems in the course order.
+// Problems missing in the course structure are at the end.
+type ProblemsReport struct {
+	CourseID string              `json:"course_id"`
+	Problems []ProblemStatistics `json:"problems"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// RouteStep is a single learner action on the course route
+type RouteStep struct {
+	Position  int       `json:"position"`
+	BlockID   string    `json:"block_id"`
+	EventType string    `json:"event_type"`
+	Index     string    `json:"index"`
+	Time      time.Time `json:"time"`
+}
+
+// UserRoute is a time-ordered learner path through the course structure
+// with summary metrics:
+// LinearityScore is a share of transitions that go forward in the course,
+// BackwardJumps is a number of transitions that go back,
+// Revisits is a number of steps on the positions already visited before,
+// FarthestPosition is the largest position learner has reached.
+type UserRoute struct {
+	Username         string      `json:"username"`
+	Steps            []RouteStep `json:"steps"`
+	LinearityScore   float64     `json:"linearity_score"`
+	BackwardJumps    int         `json:"backward_jumps"`
+	Revisits         int         `json:"revisits"`
+	FarthestPosition int         `json:"farthest_position"`
+}
+
+// CalculateMetrics fills summary metrics of the route from its steps
+func (route *UserRoute) CalculateMetrics() {
+	route.LinearityScore = 1
+	route.BackwardJumps = 0
+	route.Revisits = 0
+	route.FarthestPosition = 0
+
+	visited := map[int]bool{}
+	forwardTransitions := 0
+	for i, step := range route.Steps {
+		if visited[step.Position] {
+			route.Revisits++
+		}
+		visited[step.Position] = true
+		if step.Position > route.FarthestPosition {
+			route.FarthestPosition = step.Position
+		}
+		if i == 0 {
+			continue
+		}
+		if step.Position > route.Steps[i-1].Position {
+			forwardTransitions++
+		} else if step.Position < route.Steps[i-1].Position {
+			route.BackwardJumps++
+		}
+	}
+
+	if len(route.Steps) > 1 {
+		route.LinearityScore = float64(forwardTransitions) / float64(len(route.Steps)-1)
+	}
+}
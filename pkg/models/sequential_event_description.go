@@ -1,11 +1,20 @@
 package models
 
-// SequentialMoveEventDescription has all the data about moving within sequential object
+// SequentialMoveEventDescription has all the data about moving within sequential object.
+// Old and New are tab positions within the sequential with usage key SequentialID,
+// *VerticalID and *VerticalName fields are the verticals these tabs are resolved to
+// using the course structure (empty if structure is unknown).
 type SequentialMoveEventDescription struct {
-	EventTime string `json:"event_time"`
-	Username  string `json:"username"`
-	Old       int    `json:"old"`
-	EventType string `json:"event_type"`
-	New       int    `json:"new"`
-	CourseID  string `json:"course_id"`
+	EventTime       string `json:"event_time" parquet:"event_time"`
+	Username        string `json:"username" parquet:"username"`
+	Old             int    `json:"old" parquet:"old"`
+	EventType       string `json:"event_type" parquet:"event_type"`
+	New             int    `json:"new" parquet:"new"`
+	CourseID        string `json:"course_id" parquet:"course_id"`
+	SequentialID    string `json:"sequential_id" parquet:"sequential_id"`
+	OldVerticalID   string `json:"old_vertical_id" parquet:"old_vertical_id"`
+	OldVerticalName string `json:"old_vertical_name" parquet:"old_vertical_name"`
+	NewVerticalID   string `json:"new_vertical_id" parquet:"new_vertical_id"`
+	NewVerticalName string `json:"new_vertical_name" parquet:"new_vertical_name"`
+	Platform        string `json:"platform" parquet:"platform"`
 }
@@ -7,10 +7,12 @@ type SequentialLog struct {
 	Time              string             `json:"time"`
 	Event             SequentialEventLog `json:"event"`
 	SequentialContext LogContext         `json:"context"`
+	LogOrigin
 }
 
 // SequentialEventLog is a definition of an event object within SequentialLog
 type SequentialEventLog struct {
-	Old int `json:"old"`
-	New int `json:"new"`
+	Old int    `json:"old"`
+	New int    `json:"new"`
+	ID  string `json:"id"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TimelineEvent is a single learner event on the timeline.
+// BlockID and DisplayName describe the course block the event happened on,
+// Details is the whole stored event description.
+type TimelineEvent struct {
+	Family      string          `json:"family"`
+	EventType   string          `json:"event_type"`
+	Time        time.Time       `json:"time"`
+	BlockID     string          `json:"block_id"`
+	DisplayName string          `json:"display_name"`
+	Details     json.RawMessage `json:"details"`
+}
+
+// Timeline is a page of time-sorted learner events in the course.
+// NextCursor should be passed to get the next page, it is empty on the last page.
+type Timeline struct {
+	Username   string          `json:"username"`
+	CourseID   string          `json:"course_id"`
+	Events     []TimelineEvent `json:"events"`
+	NextCursor string          `json:"next_cursor"`
+}
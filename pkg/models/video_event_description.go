@@ -16,12 +16,14 @@ const (
 )
 
 // VideoEventDescription has all the data about video events for analysis
-// JSON names are also mentioned for umarshaling and sending that json to elastic
+// JSON names are also mentioned for umarshaling and sending that json to elastic,
+// parquet names are column names of exported files
 type VideoEventDescription struct {
-	EventTime string    `json:"event_time"`
-	VideoTime float64   `json:"video_time"`
-	Username  string    `json:"username"`
-	VideoID   string    `json:"video_id"`
-	EventType EventType `json:"event_type"`
-	CourseID  string    `json:"course_id"`
+	EventTime string    `json:"event_time" parquet:"event_time"`
+	VideoTime float64   `json:"video_time" parquet:"video_time"`
+	Username  string    `json:"username" parquet:"username"`
+	VideoID   string    `json:"video_id" parquet:"video_id"`
+	EventType EventType `json:"event_type" parquet:"event_type"`
+	CourseID  string    `json:"course_id" parquet:"course_id"`
+	Platform  string    `json:"platform" parquet:"platform"`
 }
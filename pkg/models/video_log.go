@@ -7,6 +7,7 @@ type VideoLog struct {
 	Time         string        `json:"time"`
 	Event        VideoEventLog `json:"event"`
 	VideoContext LogContext    `json:"context"`
+	LogOrigin
 }
 
 // VideoEventLog is a definition of an event object within VideoLog
@@ -21,5 +21,7 @@ func ParseBookmarksEvent(log []byte) (models.BookmarksEventDescription, error) {
 		ID:        logObject.Event.ComponentUsageID,
 		IsAdded:   isAdded,
 		CourseID:  logObject.BookmarksContext.CourseID,
+		BlockID:   models.GetBlockIDFromUsageKey(logObject.Event.ComponentUsageID),
+		Platform:  logObject.Platform(),
 	}, nil
 }
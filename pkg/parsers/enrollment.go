@@ -0,0 +1,37 @@
+package parsers
+
+import (
+	"encoding/json"
+	"kafka-log-processor/pkg/models"
+)
+
+// ParseEnrollmentEvent gets log object (as string represented in bytes, as it's returned
+// from kafka) and returns object with enrollment-only-related properties.
+// Username of the log belongs to whoever made the change, so it's kept only if
+// that's the enrolled learner, the learner is identified by UserID anyway.
+func ParseEnrollmentEvent(log []byte) (models.EnrollmentEventDescription, error) {
+	var logObject models.EnrollmentLog
+	err := json.Unmarshal(log, &logObject)
+	if err != nil {
+		return models.EnrollmentEventDescription{}, err
+	}
+	courseID := logObject.Event.CourseID
+	if courseID == "" {
+		courseID = logObject.EnrollmentContext.CourseID
+	}
+	username := logObject.Username
+	learnerID := logObject.Event.UserID
+	if learnerID != 0 && logObject.EnrollmentContext.UserID != 0 && learnerID != logObject.EnrollmentContext.UserID {
+		username = ""
+	}
+	return models.EnrollmentEventDescription{
+		EventTime: logObject.Time,
+		Username:  username,
+		UserID:    learnerID,
+		EventType: logObject.EventType,
+		Mode:      logObject.Event.Mode,
+		IsActive:  logObject.EventType != "edx.course.enrollment.deactivated",
+		CourseID:  courseID,
+		Platform:  logObject.Platform(),
+	}, nil
+}
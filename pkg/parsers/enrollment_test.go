@@ -0,0 +1,56 @@
+package parsers
+
+import (
+	"kafka-log-processor/pkg/models"
+	"testing"
+)
+
+func TestParseEnrollmentEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want models.EnrollmentEventDescription
+	}{
+		{
+			name: "learner enrolled themselves",
+			log: `{"username": "learner", "event_type": "edx.course.enrollment.activated", "time": "2020-03-01T10:00:00Z",
+				"event": {"course_id": "course-v1:org+C1+2020", "user_id": 7, "mode": "audit"},
+				"context": {"course_id": "course-v1:org+C1+2020", "user_id": 7}}`,
+			want: models.EnrollmentEventDescription{
+				EventTime: "2020-03-01T10:00:00Z", Username: "learner", UserID: 7, EventType: "edx.course.enrollment.activated",
+				Mode: "audit", IsActive: true, CourseID: "course-v1:org+C1+2020",
+			},
+		},
+		{
+			name: "staff changed mode of the learner",
+			log: `{"username": "staff", "event_type": "edx.course.enrollment.mode_changed", "time": "2020-03-02T10:00:00Z",
+				"event": {"course_id": "course-v1:org+C1+2020", "user_id": 7, "mode": "verified"},
+				"context": {"course_id": "course-v1:org+C1+2020", "user_id": 1}}`,
+			want: models.EnrollmentEventDescription{
+				EventTime: "2020-03-02T10:00:00Z", UserID: 7, EventType: "edx.course.enrollment.mode_changed",
+				Mode: "verified", IsActive: true, CourseID: "course-v1:org+C1+2020",
+			},
+		},
+		{
+			name: "log without user ids",
+			log: `{"username": "learner", "event_type": "edx.course.enrollment.deactivated", "time": "2020-03-03T10:00:00Z",
+				"event": {"mode": "audit"}, "context": {"course_id": "course-v1:org+C1+2020"}}`,
+			want: models.EnrollmentEventDescription{
+				EventTime: "2020-03-03T10:00:00Z", Username: "learner", EventType: "edx.course.enrollment.deactivated",
+				Mode: "audit", CourseID: "course-v1:org+C1+2020",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseEnrollmentEvent([]byte(test.log))
+			if err != nil {
+				t.Fatalf("ParseEnrollmentEvent() error = %v", err)
+			}
+			test.want.Platform = got.Platform
+			if got != test.want {
+				t.Errorf("got = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
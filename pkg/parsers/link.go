@@ -3,6 +3,8 @@ package parsers
 import (
 	"encoding/json"
 	"kafka-log-processor/pkg/models"
+	"net/url"
+	"strings"
 )
 
 // ParseLinkEvent gets log object (as string represented in bytes, as it's returned
@@ -13,12 +15,108 @@ func ParseLinkEvent(log []byte) (models.LinkEventDescription, error) {
 	if err != nil {
 		return models.LinkEventDescription{}, err
 	}
-	return models.LinkEventDescription{
+	linkEvent := models.LinkEventDescription{
 		EventTime:  logObject.Time,
 		Username:   logObject.Username,
 		EventType:  logObject.EventType,
 		CurrentURL: logObject.Event.CurrentURL,
 		TargetURL:  logObject.Event.TargetURL,
 		CourseID:   logObject.LinkContext.CourseID,
-	}, nil
+		Platform:   logObject.Platform(),
+	}
+	ClassifyLinkEvent(&linkEvent)
+	return linkEvent, nil
+}
+
+// ClassifyLinkEvent sets link type of the link event. Internal non-courseware links
+// get their LMS section and external links get normalized domain and path. Relative
+// links are resolved against the current url, empty and fragment-only links are in-page.
+func ClassifyLinkEvent(linkEvent *models.LinkEventDescription) {
+	targetURL, err := url.Parse(strings.TrimSpace(linkEvent.TargetURL))
+	if err != nil {
+		linkEvent.LinkType = models.EXTERNAL
+		linkEvent.TargetResource = linkEvent.TargetURL
+		return
+	}
+	if targetURL.Scheme == "" && targetURL.Host == "" && targetURL.Path == "" && targetURL.RawQuery == "" {
+		linkEvent.LinkType = models.IN_PAGE
+		return
+	}
+	targetURL, currentURL := resolveReference(linkEvent.CurrentURL, targetURL)
+
+	if targetURL.Scheme != "" && targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+		linkEvent.LinkType = models.EXTERNAL
+		linkEvent.TargetDomain = targetURL.Scheme
+		linkEvent.TargetPath = targetURL.Opaque
+		linkEvent.TargetResource = targetURL.Scheme + ":" + targetURL.Opaque
+		return
+	}
+	if targetURL.Host != "" && !strings.EqualFold(targetURL.Hostname(), currentURL.Hostname()) {
+		linkEvent.LinkType = models.EXTERNAL
+		linkEvent.TargetDomain = strings.TrimPrefix(strings.ToLower(targetURL.Hostname()), "www.")
+		linkEvent.TargetPath = "/" + strings.Trim(targetURL.Path, "/")
+		linkEvent.TargetResource = linkEvent.TargetDomain + linkEvent.TargetPath
+		return
+	}
+
+	section := "home"
+	pathParts := pathSegments(targetURL.Path)
+	if len(pathParts) >= 2 && pathParts[0] == "courses" {
+		section = "course"
+		pathParts = pathParts[2:]
+	}
+	if len(pathParts) > 0 {
+		section = pathParts[0]
+	}
+	if section == "courseware" || section == "jump_to" {
+		linkEvent.LinkType = models.COURSEWARE
+		return
+	}
+	linkEvent.LinkType = models.INTERNAL
+	linkEvent.TargetSection = section
+}
+
+// resolveReference resolves relative targetURL against currentURL and returns it
+// with parsed currentURL, that is empty if it can't be parsed
+func resolveReference(currentURL string, targetURL *url.URL) (*url.URL, *url.URL) {
+	parsedCurrentURL, err := url.Parse(currentURL)
+	if err != nil {
+		parsedCurrentURL = &url.URL{}
+	}
+	if targetURL.Scheme == "" && targetURL.Host == "" {
+		targetURL = parsedCurrentURL.ResolveReference(targetURL)
+	}
+	return targetURL, parsedCurrentURL
+}
+
+// pathSegments returns non-empty segments of url path
+func pathSegments(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// ResolveLinkEventBlocks fills blocks of current and target urls of the link event
+// using the course structure index. Relative target urls are resolved against the current url.
+func ResolveLinkEventBlocks(linkEvent *models.LinkEventDescription, structureIndex models.CourseStructureIndex) {
+	if currentBlock, ok := structureIndex.BlockFromCoursewareURL(linkEvent.CurrentURL); ok {
+		linkEvent.CurrentBlockID = currentBlock
+		linkEvent.CurrentBlockName, _ = structureIndex.DisplayName(currentBlock)
+	}
+	if linkEvent.LinkType != models.COURSEWARE {
+		return
+	}
+	targetURL, err := url.Parse(strings.TrimSpace(linkEvent.TargetURL))
+	if err != nil {
+		return
+	}
+	targetURL, _ = resolveReference(linkEvent.CurrentURL, targetURL)
+	if targetBlock, ok := structureIndex.BlockFromCoursewareURL(targetURL.String()); ok {
+		linkEvent.TargetBlockID = targetBlock
+		linkEvent.TargetBlockName, _ = structureIndex.DisplayName(targetBlock)
+	}
 }
@@ -0,0 +1,75 @@
+package parsers
+
+import (
+	"kafka-log-processor/pkg/models"
+	"testing"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+func TestClassifyLinkEvent(t *testing.T) {
+	const currentURL = "https://courses.example.com/courses/course-v1:org+C1+2020/courseware/ch1/seq1/1"
+	tests := []struct {
+		targetURL string
+		want      models.LinkEventDescription
+	}{
+		{"", models.LinkEventDescription{LinkType: models.IN_PAGE}},
+		{"#top", models.LinkEventDescription{LinkType: models.IN_PAGE}},
+		{"/courses/course-v1:org+C1+2020", models.LinkEventDescription{LinkType: models.INTERNAL, TargetSection: "course"}},
+		{"/courses/course-v1:org+C1+2020/", models.LinkEventDescription{LinkType: models.INTERNAL, TargetSection: "course"}},
+		{"/courses/course-v1:org+C1+2020//progress", models.LinkEventDescription{LinkType: models.INTERNAL, TargetSection: "progress"}},
+		{"/courses/course-v1:org+C1+2020/courseware/ch1/seq2/", models.LinkEventDescription{LinkType: models.COURSEWARE}},
+		{"/courses/course-v1:org+C1+2020/jump_to/block-v1:org+C1+2020+type@vertical+block@v1", models.LinkEventDescription{LinkType: models.COURSEWARE}},
+		{"https://courses.example.com/dashboard", models.LinkEventDescription{LinkType: models.INTERNAL, TargetSection: "dashboard"}},
+		{"/", models.LinkEventDescription{LinkType: models.INTERNAL, TargetSection: "home"}},
+		{"?activate_block_id=v2", models.LinkEventDescription{LinkType: models.COURSEWARE}},
+		{"../seq2/1", models.LinkEventDescription{LinkType: models.COURSEWARE}},
+		{"https://www.Example.org/docs/page/", models.LinkEventDescription{LinkType: models.EXTERNAL, TargetDomain: "example.org", TargetPath: "/docs/page", TargetResource: "example.org/docs/page"}},
+		{"mailto:staff@example.com", models.LinkEventDescription{LinkType: models.EXTERNAL, TargetDomain: "mailto", TargetPath: "staff@example.com", TargetResource: "mailto:staff@example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.targetURL, func(t *testing.T) {
+			linkEvent := models.LinkEventDescription{CurrentURL: currentURL, TargetURL: test.targetURL}
+			ClassifyLinkEvent(&linkEvent)
+			test.want.CurrentURL = currentURL
+			test.want.TargetURL = test.targetURL
+			if linkEvent != test.want {
+				t.Errorf("got = %+v, want %+v", linkEvent, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveLinkEventBlocks(t *testing.T) {
+	const currentURL = "https://courses.example.com/courses/course-v1:org+C1+2020/courseware/ch1/seq1/1"
+	structureIndex := models.NewCourseStructureIndex(edxstruct.Course{Chapters: []edxstruct.Chapter{{URLName: "ch1", Sequentials: []edxstruct.Sequential{
+		{URLName: "seq1", Verticals: []edxstruct.Vertical{{URLName: "v1", DisplayName: "Unit 1"}, {URLName: "v2", DisplayName: "Unit 2"}}},
+		{URLName: "seq2", Verticals: []edxstruct.Vertical{{URLName: "v3", DisplayName: "Unit 3"}}},
+	}}}})
+	tests := []struct {
+		targetURL       string
+		wantTargetBlock string
+		wantTargetName  string
+	}{
+		{"https://courses.example.com/courses/course-v1:org+C1+2020/courseware/ch1/seq1/2", "v2", "Unit 2"},
+		{"/courses/course-v1:org+C1+2020/jump_to/block-v1:org+C1+2020+type@vertical+block@v3", "v3", "Unit 3"},
+		{"../seq2/1", "v3", "Unit 3"},
+		{"2", "v2", "Unit 2"},
+		{"?activate_block_id=block-v1:org+C1+2020+type@vertical+block@v2", "v2", "Unit 2"},
+		{"/courses/course-v1:org+C1+2020/progress", "", ""},
+		{"https://example.org/courseware/ch1/seq1/2", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.targetURL, func(t *testing.T) {
+			linkEvent := models.LinkEventDescription{CurrentURL: currentURL, TargetURL: test.targetURL}
+			ClassifyLinkEvent(&linkEvent)
+			ResolveLinkEventBlocks(&linkEvent, structureIndex)
+			if linkEvent.CurrentBlockID != "v1" || linkEvent.CurrentBlockName != "Unit 1" {
+				t.Errorf("current block = %v %q, want v1 \"Unit 1\"", linkEvent.CurrentBlockID, linkEvent.CurrentBlockName)
+			}
+			if linkEvent.TargetBlockID != test.wantTargetBlock || linkEvent.TargetBlockName != test.wantTargetName {
+				t.Errorf("target block = %v %q, want %v %q", linkEvent.TargetBlockID, linkEvent.TargetBlockName, test.wantTargetBlock, test.wantTargetName)
+			}
+		})
+	}
+}
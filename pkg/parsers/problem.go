@@ -40,5 +40,6 @@ func ParseProblemEvent(log []byte) (models.ProblemEventDescription, error) {
 		WeightedEarned:   logObject.Event.WeightedEarned,
 		WeightedPossible: logObject.Event.WeightedPossible,
 		CourseID:         logObject.ProblemContext.CourseID,
+		Platform:         logObject.Platform(),
 	}, nil
 }
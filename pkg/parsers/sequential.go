@@ -14,11 +14,30 @@ func ParseSequentialEvent(log []byte) (models.SequentialMoveEventDescription, er
 		return models.SequentialMoveEventDescription{}, err
 	}
 	return models.SequentialMoveEventDescription{
-		EventTime: logObject.Time,
-		Username:  logObject.Username,
-		EventType: logObject.EventType,
-		New:       logObject.Event.New,
-		Old:       logObject.Event.Old,
-		CourseID:  logObject.SequentialContext.CourseID,
+		EventTime:    logObject.Time,
+		Username:     logObject.Username,
+		EventType:    logObject.EventType,
+		New:          logObject.Event.New,
+		Old:          logObject.Event.Old,
+		CourseID:     logObject.SequentialContext.CourseID,
+		SequentialID: logObject.Event.ID,
+		Platform:     logObject.Platform(),
 	}, nil
 }
+
+// ResolveSequentialEventVerticals fills old and new verticals of the sequential event
+// using the course structure index. It returns false if any of tabs couldn't be resolved.
+func ResolveSequentialEventVerticals(sequentialEvent *models.SequentialMoveEventDescription, structureIndex models.CourseStructureIndex) bool {
+	sequential := models.GetBlockIDFromUsageKey(sequentialEvent.SequentialID)
+	oldVertical, oldOk := structureIndex.SequentialVertical(sequential, sequentialEvent.Old)
+	if oldOk {
+		sequentialEvent.OldVerticalID = oldVertical
+		sequentialEvent.OldVerticalName, _ = structureIndex.DisplayName(oldVertical)
+	}
+	newVertical, newOk := structureIndex.SequentialVertical(sequential, sequentialEvent.New)
+	if newOk {
+		sequentialEvent.NewVerticalID = newVertical
+		sequentialEvent.NewVerticalName, _ = structureIndex.DisplayName(newVertical)
+	}
+	return oldOk && newOk
+}
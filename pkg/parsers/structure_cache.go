@@ -0,0 +1,52 @@
+package parsers
+
+import (
+	"context"
+	"kafka-log-processor/pkg/models"
+	"time"
+
+	edxstruct "github.com/veotani/edx-structure-json"
+)
+
+const courseStructureIndexTTL = 10 * time.Minute
+
+// CourseStructureIndexCache keeps structure indices of the courses, so parsers
+// don't request course structure for every event. Indices are requested again
+// after courseStructureIndexTTL to get newly uploaded structures.
+type CourseStructureIndexCache struct {
+	getCourseStructure func(ctx context.Context, courseCode string) (edxstruct.Course, error)
+	indices            map[string]cachedCourseStructureIndex
+}
+
+type cachedCourseStructureIndex struct {
+	index     models.CourseStructureIndex
+	createdAt time.Time
+}
+
+// NewCourseStructureIndexCache constructs cache that loads structures with getCourseStructure
+func NewCourseStructureIndexCache(getCourseStructure func(ctx context.Context, courseCode string) (edxstruct.Course, error)) *CourseStructureIndexCache {
+	return &CourseStructureIndexCache{
+		getCourseStructure: getCourseStructure,
+		indices:            map[string]cachedCourseStructureIndex{},
+	}
+}
+
+// Get returns structure index of the course with courseID in
+// "course-v1:org+CourseCode+CourseRun" notation
+func (c *CourseStructureIndexCache) Get(ctx context.Context, courseID string) (models.CourseStructureIndex, error) {
+	courseCode, err := models.GetCourseCodeFromCourseID(courseID)
+	if err != nil {
+		return models.CourseStructureIndex{}, err
+	}
+	if cached, ok := c.indices[courseCode]; ok && time.Since(cached.createdAt) < courseStructureIndexTTL {
+		return cached.index, nil
+	}
+
+	course, err := c.getCourseStructure(ctx, courseCode)
+	if err != nil {
+		return models.CourseStructureIndex{}, err
+	}
+	index := models.NewCourseStructureIndex(course)
+	c.indices[courseCode] = cachedCourseStructureIndex{index: index, createdAt: time.Now()}
+	return index, nil
+}
@@ -22,6 +22,7 @@ func ParseVideoEvent(log []byte) (models.VideoEventDescription, error) {
 			VideoID:   logObject.Event.ID,
 			VideoTime: logObject.Event.CurrentTime,
 			CourseID:  logObject.VideoContext.CourseID,
+			Platform:  logObject.Platform(),
 		}, nil
 	}
 
@@ -33,6 +34,7 @@ func ParseVideoEvent(log []byte) (models.VideoEventDescription, error) {
 			VideoID:   logObject.Event.ID,
 			VideoTime: logObject.Event.OldTime,
 			CourseID:  logObject.VideoContext.CourseID,
+			Platform:  logObject.Platform(),
 		}, nil
 	}
 
@@ -43,5 +45,6 @@ func ParseVideoEvent(log []byte) (models.VideoEventDescription, error) {
 		VideoID:   logObject.Event.ID,
 		VideoTime: logObject.Event.CurrentTime,
 		CourseID:  logObject.VideoContext.CourseID,
+		Platform:  logObject.Platform(),
 	}, nil
 }
@@ -0,0 +1,49 @@
+package pseudonymization
+
+import (
+	"errors"
+	"kafka-log-processor/configs"
+)
+
+// Identities converts learner usernames between the form they are stored in and the form
+// the analysis server shows them in. Nil Identities keeps usernames as is, that is the case
+// when pseudonymization is disabled or the analysis server shows pseudonyms.
+type Identities struct {
+	pseudonymizer *Pseudonymizer
+}
+
+// IdentitiesFromConfig constructs Identities for "api_usernames" mode of pseudonymization config
+func IdentitiesFromConfig(config configs.ParserConfig, pseudonymizer *Pseudonymizer) (*Identities, error) {
+	if pseudonymizer == nil {
+		return nil, nil
+	}
+	switch config.Pseudonymization.APIUsernames {
+	case "", PseudonymsMode:
+		return nil, nil
+	case RealMode:
+		return &Identities{pseudonymizer: pseudonymizer}, nil
+	}
+	return nil, errors.New("Unknown api usernames mode " + config.Pseudonymization.APIUsernames)
+}
+
+// Stored returns all the forms username from API request is stored in: pseudonyms of every
+// key found in the re-identification table, so learners are found during key rotation too
+func (identities *Identities) Stored(username string) ([]string, error) {
+	if identities == nil {
+		return []string{username}, nil
+	}
+	return identities.pseudonymizer.AllPseudonyms(username)
+}
+
+// Presented returns username to show instead of storedUsername.
+// Pseudonyms missing in the re-identification table are shown as is.
+func (identities *Identities) Presented(storedUsername string) (string, error) {
+	if identities == nil {
+		return storedUsername, nil
+	}
+	username, ok, err := identities.pseudonymizer.table.Username(storedUsername)
+	if err != nil || !ok {
+		return storedUsername, err
+	}
+	return username, nil
+}
@@ -0,0 +1,261 @@
+package pseudonymization
+
+// Pseudonymization of learner identities. Parsers replace usernames with keyed
+// HMAC-SHA256 pseudonyms before events are stored, so the same learner gets the
+// same pseudonym in every service without any coordination. Pseudonyms have the
+// id of the key in them: "p-<key id>-<hmac>". Keys are rotated by adding a new key
+// to the keys file, making it current and running cmd/rotate_pseudonyms, which
+// replaces pseudonyms of the old keys in stored events. Its backfill mode replaces
+// usernames stored before pseudonymization was enabled.
+// Pairs of pseudonyms and usernames are saved in the re-identification table.
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"kafka-log-processor/configs"
+	"kafka-log-processor/pkg/database"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const pseudonymPrefix = "p-"
+
+// Pseudonyms are saved to the re-identification table again after savedPseudonymTTL,
+// so pseudonyms deleted by erasure come back if the learner returns
+const savedPseudonymTTL = 10 * time.Minute
+
+// Modes of usernames returned by the analysis server
+const (
+	PseudonymsMode = "pseudonyms"
+	RealMode       = "real"
+)
+
+// Keys are HMAC keys by their ids, CurrentKey is an id of the key new pseudonyms are made with
+type Keys struct {
+	CurrentKey string            `yaml:"current_key"`
+	Keys       map[string]string `yaml:"keys"`
+}
+
+// Pseudonymizer replaces usernames with pseudonyms
+type Pseudonymizer struct {
+	keyID string
+	key   []byte
+	table *ReidentificationTable
+
+	mutex           sync.Mutex
+	savedPseudonyms map[string]time.Time
+}
+
+// ReadKeys reads keys file. Keys are base64 encoded and must be at least 32 bytes long.
+func ReadKeys(fileName string) (Keys, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Keys{}, err
+	}
+	defer f.Close()
+
+	var keys Keys
+	if err = yaml.NewDecoder(f).Decode(&keys); err != nil {
+		return Keys{}, err
+	}
+	if _, ok := keys.Keys[keys.CurrentKey]; !ok {
+		return Keys{}, errors.New("Current key " + keys.CurrentKey + " is not in keys file")
+	}
+	for keyID := range keys.Keys {
+		if strings.Contains(keyID, "-") || keyID == "" {
+			return Keys{}, errors.New("Key id " + keyID + " should be non empty and have no dashes")
+		}
+		if _, err = keys.Key(keyID); err != nil {
+			return Keys{}, err
+		}
+	}
+	return keys, nil
+}
+
+// Key returns decoded key with id keyID
+func (keys Keys) Key(keyID string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(keys.Keys[keyID])
+	if err != nil {
+		return nil, errors.New("Key " + keyID + " is not base64 encoded")
+	}
+	if len(key) < sha256.Size {
+		return nil, errors.New("Key " + keyID + " is shorter than 32 bytes")
+	}
+	return key, nil
+}
+
+// New constructs Pseudonymizer that makes pseudonyms with key keyID and saves them to table
+func New(keys Keys, keyID string, table *ReidentificationTable) (*Pseudonymizer, error) {
+	key, err := keys.Key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return &Pseudonymizer{keyID: keyID, key: key, table: table, savedPseudonyms: map[string]time.Time{}}, nil
+}
+
+// FromConfig constructs Pseudonymizer with the current key from pseudonymization config.
+// It returns nil if pseudonymization is disabled, nil Pseudonymizer keeps usernames as is.
+func FromConfig(config configs.ParserConfig) (*Pseudonymizer, error) {
+	if !config.Pseudonymization.Enabled {
+		return nil, nil
+	}
+	keys, err := ReadKeys(config.Pseudonymization.KeysFile)
+	if err != nil {
+		return nil, err
+	}
+	table, err := OpenReidentificationTable(config.Pseudonymization.ReidentificationTable)
+	if err != nil {
+		return nil, err
+	}
+	return New(keys, keys.CurrentKey, table)
+}
+
+// Pseudonym returns pseudonym of username without saving it to the re-identification table
+func (p *Pseudonymizer) Pseudonym(username string) string {
+	if p == nil || username == "" {
+		return username
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(username))
+	return pseudonymPrefix + p.keyID + "-" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Pseudonymize returns pseudonym of username and saves it to the re-identification table
+func (p *Pseudonymizer) Pseudonymize(username string) (string, error) {
+	pseudonym := p.Pseudonym(username)
+	if pseudonym == username {
+		return username, nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if savedAt, ok := p.savedPseudonyms[pseudonym]; !ok || time.Since(savedAt) > savedPseudonymTTL {
+		if err := p.table.Add(pseudonym, p.keyID, username); err != nil {
+			return "", err
+		}
+		p.savedPseudonyms[pseudonym] = time.Now()
+	}
+	return pseudonym, nil
+}
+
+// AllPseudonyms returns pseudonyms of username made with any key that are in the
+// re-identification table and the pseudonym made with the current key
+func (p *Pseudonymizer) AllPseudonyms(username string) ([]string, error) {
+	if p == nil {
+		return nil, nil
+	}
+	pseudonyms, err := p.table.Pseudonyms(username)
+	if err != nil {
+		return nil, err
+	}
+	current := p.Pseudonym(username)
+	for _, pseudonym := range pseudonyms {
+		if pseudonym == current {
+			return pseudonyms, nil
+		}
+	}
+	return append(pseudonyms, current), nil
+}
+
+// Forget deletes all the pseudonyms of username from the re-identification table
+func (p *Pseudonymizer) Forget(username string) error {
+	if p == nil {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.savedPseudonyms = map[string]time.Time{}
+	return p.table.DeleteUsername(username)
+}
+
+// Rotate replaces pseudonyms made with keys other than the current one in the events
+// of store and in the re-identification table. Pseudonyms are replaced in batches
+// of batchSize learners. It returns the number of replaced pseudonyms.
+func (p *Pseudonymizer) Rotate(ctx context.Context, store database.EventStore, batchSize int) (int, error) {
+	aliases, err := p.table.AliasesNotOfKey(p.keyID)
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for start := 0; start < len(aliases); start += batchSize {
+		end := start + batchSize
+		if end > len(aliases) {
+			end = len(aliases)
+		}
+		renames := map[string]string{}
+		for _, alias := range aliases[start:end] {
+			if renames[alias.Pseudonym], err = p.Pseudonymize(alias.Username); err != nil {
+				return rotated, err
+			}
+		}
+		for _, indexName := range database.EventDescriptionIndexNames {
+			if _, err = store.RenameUsers(ctx, indexName, renames); err != nil {
+				return rotated, err
+			}
+		}
+		for _, alias := range aliases[start:end] {
+			if err = p.table.DeletePseudonym(alias.Pseudonym); err != nil {
+				return rotated, err
+			}
+		}
+		rotated += end - start
+	}
+	return rotated, nil
+}
+
+// Backfill replaces usernames stored before pseudonymization was enabled, that is all the
+// usernames without pseudonym prefix, with pseudonyms made with the current key in the
+// events of store. Usernames are replaced in batches of batchSize learners.
+// It returns the number of replaced usernames.
+func (p *Pseudonymizer) Backfill(ctx context.Context, store database.EventStore, batchSize int) (int, error) {
+	plainUsernames := map[string]bool{}
+	for _, indexName := range database.EventDescriptionIndexNames {
+		usernames, err := store.GetUniqueStringFieldValuesInIndex(ctx, indexName, "username")
+		if err != nil {
+			return 0, err
+		}
+		for _, username := range usernames {
+			if username != "" && !strings.HasPrefix(username, pseudonymPrefix) {
+				plainUsernames[username] = true
+			}
+		}
+	}
+	usernames := make([]string, 0, len(plainUsernames))
+	for username := range plainUsernames {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	backfilled := 0
+	for start := 0; start < len(usernames); start += batchSize {
+		end := start + batchSize
+		if end > len(usernames) {
+			end = len(usernames)
+		}
+		renames := map[string]string{}
+		for _, username := range usernames[start:end] {
+			pseudonym, err := p.Pseudonymize(username)
+			if err != nil {
+				return backfilled, err
+			}
+			renames[username] = pseudonym
+		}
+		for _, indexName := range database.EventDescriptionIndexNames {
+			if _, err := store.RenameUsers(ctx, indexName, renames); err != nil {
+				return backfilled, err
+			}
+		}
+		backfilled += end - start
+	}
+	return backfilled, nil
+}
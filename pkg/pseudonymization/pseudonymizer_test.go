@@ -0,0 +1,142 @@
+package pseudonymization
+
+import (
+	"context"
+	"encoding/base64"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+var testKeys = Keys{
+	CurrentKey: "k2",
+	Keys: map[string]string{
+		"k1": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", 32))),
+		"k2": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", 32))),
+	},
+}
+
+func newTestPseudonymizer(t *testing.T, keyID string, table *ReidentificationTable) *Pseudonymizer {
+	t.Helper()
+	pseudonymizer, err := New(testKeys, keyID, table)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return pseudonymizer
+}
+
+// addVideoEvent adds video event of username to store
+func addVideoEvent(t *testing.T, store database.EventStore, username string) {
+	t.Helper()
+	err := store.AddVideoEventDescription(context.Background(), models.VideoEventDescription{EventTime: "2020-03-01T10:00:00Z", Username: username,
+		VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID})
+	if err != nil {
+		t.Fatalf("can't add event: %v", err)
+	}
+}
+
+// storedUsernames returns sorted usernames of video events of store
+func storedUsernames(t *testing.T, store database.EventStore) []string {
+	t.Helper()
+	usernames, err := store.GetUniqueStringFieldValuesInIndex(context.Background(), database.VideoEventDescriptionIndexName, "username")
+	if err != nil {
+		t.Fatalf("GetUniqueStringFieldValuesInIndex() error = %v", err)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	table, err := OpenReidentificationTable(filepath.Join(t.TempDir(), "reidentification.db"))
+	if err != nil {
+		t.Fatalf("OpenReidentificationTable() error = %v", err)
+	}
+	store := database.NewMemoryStore()
+	oldPseudonymizer := newTestPseudonymizer(t, "k1", table)
+	oldPseudonyms := map[string]string{}
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if oldPseudonyms[username], err = oldPseudonymizer.Pseudonymize(username); err != nil {
+			t.Fatalf("Pseudonymize() error = %v", err)
+		}
+		addVideoEvent(t, store, oldPseudonyms[username])
+	}
+
+	pseudonymizer := newTestPseudonymizer(t, "k2", table)
+	identities := &Identities{pseudonymizer: pseudonymizer}
+	// events are found by both pseudonyms while the key is rotated
+	stored, err := identities.Stored("alice")
+	if want := []string{oldPseudonyms["alice"], pseudonymizer.Pseudonym("alice")}; err != nil || !reflect.DeepEqual(stored, want) {
+		t.Errorf("Stored() before rotation = %v, %v, want %v", stored, err, want)
+	}
+
+	rotated, err := pseudonymizer.Rotate(ctx, store, 2)
+	if err != nil || rotated != 3 {
+		t.Fatalf("Rotate() = %v, %v, want 3", rotated, err)
+	}
+	want := []string{pseudonymizer.Pseudonym("alice"), pseudonymizer.Pseudonym("bob"), pseudonymizer.Pseudonym("carol")}
+	sort.Strings(want)
+	if got := storedUsernames(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("usernames after rotation = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name           string
+		storedUsername string
+		want           string
+	}{
+		{"new pseudonym", pseudonymizer.Pseudonym("bob"), "bob"},
+		{"rotated pseudonym", oldPseudonyms["bob"], oldPseudonyms["bob"]},
+		{"unknown pseudonym", "p-k2-unknown", "p-k2-unknown"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := identities.Presented(test.storedUsername); err != nil || got != test.want {
+				t.Errorf("Presented() = %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+	stored, err = identities.Stored("alice")
+	if want := []string{pseudonymizer.Pseudonym("alice")}; err != nil || !reflect.DeepEqual(stored, want) {
+		t.Errorf("Stored() after rotation = %v, %v, want %v", stored, err, want)
+	}
+
+	if rotated, err = pseudonymizer.Rotate(ctx, store, 2); err != nil || rotated != 0 {
+		t.Errorf("second Rotate() = %v, %v, want 0", rotated, err)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	table, err := OpenReidentificationTable(filepath.Join(t.TempDir(), "reidentification.db"))
+	if err != nil {
+		t.Fatalf("OpenReidentificationTable() error = %v", err)
+	}
+	store := database.NewMemoryStore()
+	pseudonymizer := newTestPseudonymizer(t, "k2", table)
+	bobPseudonym, err := pseudonymizer.Pseudonymize("bob")
+	if err != nil {
+		t.Fatalf("Pseudonymize() error = %v", err)
+	}
+	addVideoEvent(t, store, "alice")
+	addVideoEvent(t, store, bobPseudonym)
+
+	backfilled, err := pseudonymizer.Backfill(ctx, store, 10)
+	if err != nil || backfilled != 1 {
+		t.Fatalf("Backfill() = %v, %v, want 1", backfilled, err)
+	}
+	want := []string{pseudonymizer.Pseudonym("alice"), bobPseudonym}
+	sort.Strings(want)
+	if got := storedUsernames(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("usernames after backfill = %v, want %v", got, want)
+	}
+	if username, ok, err := table.Username(pseudonymizer.Pseudonym("alice")); err != nil || !ok || username != "alice" {
+		t.Errorf("Username() of backfilled pseudonym = %v, %v, %v, want alice", username, ok, err)
+	}
+}
@@ -0,0 +1,131 @@
+package pseudonymization
+
+// Re-identification table maps pseudonyms back to usernames. It is kept in its own
+// SQLite file readable only by its owner, apart from the event store, so access to
+// events doesn't give access to identities. Only parsers, erasure, key rotation and
+// the analysis server in "real" usernames mode open it.
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // sqlite is a cgo-free SQLite driver
+)
+
+// ReidentificationTable keeps pairs of pseudonyms and usernames
+type ReidentificationTable struct {
+	db *sql.DB
+}
+
+// Alias is a pseudonym of the username made with key KeyID
+type Alias struct {
+	Pseudonym string
+	KeyID     string
+	Username  string
+}
+
+// OpenReidentificationTable opens (or creates) re-identification table in file fileName
+func OpenReidentificationTable(fileName string) (*ReidentificationTable, error) {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	if err = os.Chmod(fileName, 0600); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", fileName+"?_pragma=busy_timeout(10000)&_pragma=secure_delete(on)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS aliases (
+	pseudonym TEXT PRIMARY KEY,
+	key_id TEXT NOT NULL,
+	username TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS aliases_username ON aliases (username);
+CREATE INDEX IF NOT EXISTS aliases_key_id ON aliases (key_id);
+`)
+	if err != nil {
+		return nil, err
+	}
+	return &ReidentificationTable{db: db}, nil
+}
+
+// Add saves pseudonym of username made with key keyID
+func (rt *ReidentificationTable) Add(pseudonym string, keyID string, username string) error {
+	_, err := rt.db.Exec(
+		"INSERT OR IGNORE INTO aliases (pseudonym, key_id, username, created_at) VALUES (?, ?, ?, ?)",
+		pseudonym, keyID, username, time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// Username returns username of pseudonym, false is returned if pseudonym is unknown
+func (rt *ReidentificationTable) Username(pseudonym string) (string, bool, error) {
+	var username string
+	err := rt.db.QueryRow("SELECT username FROM aliases WHERE pseudonym = ?", pseudonym).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return username, true, nil
+}
+
+// Pseudonyms returns all the pseudonyms of username made with any key
+func (rt *ReidentificationTable) Pseudonyms(username string) ([]string, error) {
+	rows, err := rt.db.Query("SELECT pseudonym FROM aliases WHERE username = ?", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pseudonyms := make([]string, 0)
+	for rows.Next() {
+		var pseudonym string
+		if err = rows.Scan(&pseudonym); err != nil {
+			return nil, err
+		}
+		pseudonyms = append(pseudonyms, pseudonym)
+	}
+	return pseudonyms, rows.Err()
+}
+
+// AliasesNotOfKey returns all the aliases made with keys other than keyID
+func (rt *ReidentificationTable) AliasesNotOfKey(keyID string) ([]Alias, error) {
+	rows, err := rt.db.Query("SELECT pseudonym, key_id, username FROM aliases WHERE key_id != ?", keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aliases := make([]Alias, 0)
+	for rows.Next() {
+		var alias Alias
+		if err = rows.Scan(&alias.Pseudonym, &alias.KeyID, &alias.Username); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// DeletePseudonym deletes pseudonym from the table
+func (rt *ReidentificationTable) DeletePseudonym(pseudonym string) error {
+	_, err := rt.db.Exec("DELETE FROM aliases WHERE pseudonym = ?", pseudonym)
+	return err
+}
+
+// DeleteUsername deletes all the pseudonyms of username from the table
+func (rt *ReidentificationTable) DeleteUsername(username string) error {
+	_, err := rt.db.Exec("DELETE FROM aliases WHERE username = ?", username)
+	return err
+}
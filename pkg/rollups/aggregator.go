@@ -0,0 +1,161 @@
+package rollups
+
+// Aggregation of learner events into activity of course blocks by periods.
+// Events of every course are expected to come sorted by time, the way
+// EventStore.ScanCourseEvents returns them. Watch time is a sum of video
+// intervals between play and the next pause of the same learner and video
+// that happened in the same period.
+
+import (
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"sort"
+	"time"
+)
+
+// Granularities of activity periods
+const (
+	DayGranularity  = "day"
+	HourGranularity = "hour"
+)
+
+type activityKey struct {
+	period   time.Time
+	courseID string
+	blockID  string
+}
+
+type playKey struct {
+	period   time.Time
+	courseID string
+	username string
+	videoID  string
+}
+
+// Aggregator counts activity of course blocks by periods
+type Aggregator struct {
+	truncate   func(t time.Time) time.Time
+	activities map[activityKey]*models.BlockActivity
+	learners   map[activityKey]map[string]bool
+	plays      map[playKey]float64
+}
+
+// NewAggregator constructs Aggregator with periods of granularity
+func NewAggregator(granularity string) *Aggregator {
+	truncate := func(t time.Time) time.Time {
+		return t.UTC().Truncate(24 * time.Hour)
+	}
+	if granularity == HourGranularity {
+		truncate = func(t time.Time) time.Time {
+			return t.UTC().Truncate(time.Hour)
+		}
+	}
+	return &Aggregator{
+		truncate:   truncate,
+		activities: map[activityKey]*models.BlockActivity{},
+		learners:   map[activityKey]map[string]bool{},
+		plays:      map[playKey]float64{},
+	}
+}
+
+// Add counts event found by EventStore.ScanCourseEvents
+func (a *Aggregator) Add(event database.CourseEvent) {
+	period := a.truncate(event.Time)
+	var username, blockID string
+	var count func(activity *models.BlockActivity)
+
+	switch document := event.Document.(type) {
+	case models.VideoEventDescription:
+		username, blockID = document.Username, document.VideoID
+		key := playKey{period: period, courseID: event.CourseID, username: username, videoID: blockID}
+		if document.EventType == models.PLAY {
+			a.plays[key] = document.VideoTime
+			count = func(activity *models.BlockActivity) { activity.VideoPlays++ }
+		} else if playTime, ok := a.plays[key]; ok {
+			delete(a.plays, key)
+			if watched := document.VideoTime - playTime; watched > 0 {
+				count = func(activity *models.BlockActivity) { activity.WatchSeconds += watched }
+			}
+		}
+	case models.ProblemEventDescription:
+		username, blockID = document.Username, document.ProblemID
+		if document.EventType == models.ProblemSubmittedEventType {
+			count = func(activity *models.BlockActivity) {
+				activity.Submissions++
+				if document.WeightedPossible > 0 {
+					activity.ScoreSum += document.WeightedEarned / document.WeightedPossible
+				}
+			}
+		}
+	case models.SequentialMoveEventDescription:
+		username, blockID = document.Username, document.NewVerticalID
+	case models.BookmarksEventDescription:
+		username, blockID = document.Username, document.BlockID
+		if blockID == "" {
+			blockID = models.GetBlockIDFromUsageKey(document.ID)
+		}
+		count = func(activity *models.BlockActivity) {
+			if document.IsAdded {
+				activity.BookmarksAdded++
+			} else {
+				activity.BookmarksRemoved++
+			}
+		}
+	case models.LinkEventDescription:
+		username, blockID = document.Username, document.CurrentBlockID
+		count = func(activity *models.BlockActivity) { activity.LinkClicks++ }
+	default:
+		return
+	}
+
+	keys := []activityKey{{period: period, courseID: event.CourseID}}
+	if blockID != "" {
+		keys = append(keys, activityKey{period: period, courseID: event.CourseID, blockID: blockID})
+	}
+	for _, key := range keys {
+		activity := a.activity(key)
+		if username != "" && !a.learners[key][username] {
+			a.learners[key][username] = true
+			activity.ActiveLearners++
+		}
+		if count != nil {
+			count(activity)
+		}
+	}
+}
+
+func (a *Aggregator) activity(key activityKey) *models.BlockActivity {
+	activity, ok := a.activities[key]
+	if !ok {
+		activity = &models.BlockActivity{Date: key.period, CourseID: key.courseID, BlockID: key.blockID}
+		a.activities[key] = activity
+		a.learners[key] = map[string]bool{}
+	}
+	return activity
+}
+
+// Activities returns counted activities sorted by period, course and block
+func (a *Aggregator) Activities() []models.BlockActivity {
+	activities := make([]models.BlockActivity, 0, len(a.activities))
+	for _, activity := range a.activities {
+		if activity.Submissions > 0 {
+			activity.MeanScore = activity.ScoreSum / float64(activity.Submissions)
+		}
+		activities = append(activities, *activity)
+	}
+	SortActivities(activities)
+	return activities
+}
+
+// SortActivities sorts activities by period, course and block
+func SortActivities(activities []models.BlockActivity) {
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].Date.Equal(activities[j].Date) {
+			return activities[i].Date.Before(activities[j].Date)
+		}
+		if activities[i].CourseID != activities[j].CourseID {
+			return activities[i].CourseID < activities[j].CourseID
+		}
+		return activities[i].BlockID < activities[j].BlockID
+	})
+}
@@ -0,0 +1,89 @@
+package rollups
+
+import (
+	"context"
+	"kafka-log-processor/pkg/database"
+	"time"
+)
+
+// Update recomputes daily rollups of all courses from lookbackDays before the watermark
+// to the beginning of the current day. Days before the watermark are complete, lookback
+// days catch events that were stored late. Without watermark all the events are rolled up
+// starting from the day of the first event. Every day is aggregated and replaced on its own
+// and the watermark is moved past it, so an interrupted update continues from that day.
+// It returns the new watermark.
+func Update(ctx context.Context, store database.EventStore, now time.Time, lookbackDays int) (time.Time, error) {
+	if err := store.CreateRollupIndexIfNotExists(ctx); err != nil {
+		return time.Time{}, err
+	}
+	watermark, err := store.GetRollupWatermark(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	to := now.UTC().Truncate(24 * time.Hour)
+	from := watermark.AddDate(0, 0, -lookbackDays)
+	if watermark.IsZero() {
+		if from, err = firstEventDay(ctx, store); err != nil {
+			return watermark, err
+		}
+		if from.IsZero() {
+			from = to
+		}
+	}
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		nextDay := day.AddDate(0, 0, 1)
+		aggregator := NewAggregator(DayGranularity)
+		if err = Aggregate(ctx, store, "", database.EventFilter{From: day, To: nextDay}, aggregator); err != nil {
+			return watermark, err
+		}
+		if err = store.ReplaceDailyRollups(ctx, day, nextDay, aggregator.Activities()); err != nil {
+			return watermark, err
+		}
+		if nextDay.After(watermark) {
+			if err = store.SetRollupWatermark(ctx, nextDay); err != nil {
+				return watermark, err
+			}
+			watermark = nextDay
+		}
+	}
+	if watermark.Before(to) {
+		if err = store.SetRollupWatermark(ctx, to); err != nil {
+			return watermark, err
+		}
+		watermark = to
+	}
+	return watermark, nil
+}
+
+// firstEventDay returns the beginning of the day of the earliest event of the activity indices,
+// zero if there are no events
+func firstEventDay(ctx context.Context, store database.EventStore) (time.Time, error) {
+	var firstEventTime time.Time
+	for _, indexName := range database.ActivityIndexNames {
+		indexFirstEventTime, err := store.GetFirstEventTime(ctx, indexName)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !indexFirstEventTime.IsZero() && (firstEventTime.IsZero() || indexFirstEventTime.Before(firstEventTime)) {
+			firstEventTime = indexFirstEventTime
+		}
+	}
+	return firstEventTime.UTC().Truncate(24 * time.Hour), nil
+}
+
+// Aggregate adds events of all the activity indices matching filter
+// in course courseID (or in all courses if it is empty) to aggregator
+func Aggregate(ctx context.Context, store database.EventStore, courseID string, filter database.EventFilter, aggregator *Aggregator) error {
+	for _, indexName := range database.ActivityIndexNames {
+		query := database.CourseEventsQuery{IndexName: indexName, CourseID: courseID, EventFilter: filter}
+		err := store.ScanCourseEvents(ctx, query, func(event database.CourseEvent) error {
+			aggregator.Add(event)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package rollups
+
+import (
+	"context"
+	"errors"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testCourseID = "course-v1:org+C1+2020"
+
+// failingStore fails to replace rollups of failingDay
+type failingStore struct {
+	*database.MemoryStore
+	failingDay time.Time
+}
+
+func (store failingStore) ReplaceDailyRollups(ctx context.Context, from time.Time, to time.Time, rollups []models.BlockActivity) error {
+	if from.Equal(store.failingDay) {
+		return errors.New("rollups can't be saved")
+	}
+	return store.MemoryStore.ReplaceDailyRollups(ctx, from, to, rollups)
+}
+
+func date(day int) time.Time {
+	return time.Date(2020, 3, day, 0, 0, 0, 0, time.UTC)
+}
+
+// newTestStore returns memory store with events of March 1, 2 and 4 of 2020
+func newTestStore(t *testing.T) *database.MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	for _, err := range []error{
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:00:00Z", Username: "alice", VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-01T10:01:00Z", VideoTime: 60, Username: "alice", VideoID: "video1", EventType: models.PAUSE, CourseID: testCourseID}),
+		store.AddProblemEventDescription(ctx, models.ProblemEventDescription{EventTime: "2020-03-02T10:00:00Z", Username: "alice", ProblemID: "problem1",
+			EventType: models.ProblemSubmittedEventType, WeightedEarned: 1, WeightedPossible: 2, CourseID: testCourseID}),
+		store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-04T23:59:00Z", Username: "bob", VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID}),
+	} {
+		if err != nil {
+			t.Fatalf("can't add event: %v", err)
+		}
+	}
+	return store
+}
+
+// allDaysRollups returns rollups of all the events of store aggregated at once
+func allDaysRollups(t *testing.T, store database.EventStore) []models.BlockActivity {
+	t.Helper()
+	aggregator := NewAggregator(DayGranularity)
+	if err := Aggregate(context.Background(), store, "", database.EventFilter{}, aggregator); err != nil {
+		t.Fatalf("Aggregate() error = %v", err)
+	}
+	return aggregator.Activities()
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	watermark, err := Update(ctx, store, now, 1)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !watermark.Equal(date(5)) {
+		t.Errorf("Update() = %v, want %v", watermark, date(5))
+	}
+	rollups, _ := store.GetDailyRollups(ctx, "", time.Time{}, time.Time{})
+	if want := allDaysRollups(t, store); !reflect.DeepEqual(rollups, want) {
+		t.Errorf("rollups = %+v, want %+v", rollups, want)
+	}
+
+	// a late event of the lookback day replaces its rollups, the watermark stays
+	err = store.AddVideoEventDescription(ctx, models.VideoEventDescription{EventTime: "2020-03-04T12:00:00Z", Username: "alice", VideoID: "video1", EventType: models.PLAY, CourseID: testCourseID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watermark, err = Update(ctx, store, now, 1); err != nil || !watermark.Equal(date(5)) {
+		t.Fatalf("Update() = %v, %v, want %v", watermark, err, date(5))
+	}
+	rollups, _ = store.GetDailyRollups(ctx, "", date(4), date(5))
+	if len(rollups) == 0 || rollups[0].ActiveLearners != 2 || rollups[0].VideoPlays != 2 {
+		t.Errorf("rollups of the lookback day = %+v, want 2 learners and plays", rollups)
+	}
+}
+
+func TestUpdateInterrupted(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := newTestStore(t)
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	watermark, err := Update(ctx, failingStore{MemoryStore: memoryStore, failingDay: date(2)}, now, 0)
+	if err == nil {
+		t.Fatalf("Update() error = nil, want error")
+	}
+	if storedWatermark, _ := memoryStore.GetRollupWatermark(ctx); !watermark.Equal(date(2)) || !storedWatermark.Equal(date(2)) {
+		t.Errorf("watermark = %v, stored %v, want the end of the first day %v", watermark, storedWatermark, date(2))
+	}
+	if rollups, _ := memoryStore.GetDailyRollups(ctx, "", date(1), date(2)); len(rollups) == 0 {
+		t.Errorf("rollups of the first day are not saved")
+	}
+
+	if watermark, err = Update(ctx, memoryStore, now, 0); err != nil || !watermark.Equal(date(5)) {
+		t.Fatalf("Update() = %v, %v, want %v", watermark, err, date(5))
+	}
+	rollups, _ := memoryStore.GetDailyRollups(ctx, "", time.Time{}, time.Time{})
+	if want := allDaysRollups(t, memoryStore); !reflect.DeepEqual(rollups, want) {
+		t.Errorf("rollups = %+v, want %+v", rollups, want)
+	}
+}
+
+func TestUpdateWithoutEvents(t *testing.T) {
+	store := database.NewMemoryStore()
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+	watermark, err := Update(context.Background(), store, now, 3)
+	if err != nil || !watermark.Equal(date(5)) {
+		t.Errorf("Update() = %v, %v, want %v", watermark, err, date(5))
+	}
+}
@@ -0,0 +1,50 @@
+package tables
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+	"time"
+)
+
+// utf8BOM lets Excel detect UTF-8 encoding of CSV files
+const utf8BOM = "\uFEFF"
+
+// formulaPrefixes are first characters that make spreadsheets read a cell as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// WriteCSV writes table as UTF-8 CSV with a header row
+func WriteCSV(w io.Writer, table Table) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(table.Headers); err != nil {
+		return err
+	}
+	record := make([]string, len(table.Headers))
+	for _, row := range table.Rows {
+		for i, value := range row {
+			record[i] = csvCell(value)
+		}
+		if err := writer.Write(record[:len(row)]); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvCell formats cell value as text. Text cells that spreadsheets would read as formulas,
+// e.g. display names or urls learners control, are prefixed with "'" to be kept as text.
+func csvCell(value interface{}) string {
+	text := formatCell(value)
+	switch value.(type) {
+	case int, int64, float64, bool, time.Time:
+		return text
+	}
+	if text != "" && strings.ContainsRune(formulaPrefixes, rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,53 @@
+package tables
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCSV(t *testing.T) {
+	table := Table{
+		Headers: []string{"Name", "Count", "Score", "Time"},
+		Rows: [][]interface{}{
+			{"Video 1", 3, 0.5, time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)},
+			{"=HYPERLINK(\"http://example.com\")", -2, -1.5, time.Time{}},
+			{"+1", int64(-7), 0.0, ""},
+			{"-2", 0, 0.0, ""},
+			{"@SUM(A1)", 0, 0.0, ""},
+			{"\tcmd", 0, 0.0, ""},
+			{"\r=1", 0, 0.0, ""},
+			{"a=b", 0, 0.0, ""},
+		},
+	}
+	var buffer bytes.Buffer
+	if err := WriteCSV(&buffer, table); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buffer.String(), utf8BOM))).ReadAll()
+	if err != nil {
+		t.Fatalf("can't read written CSV: %v", err)
+	}
+
+	want := [][]string{
+		{"Name", "Count", "Score", "Time"},
+		{"Video 1", "3", "0.5", "2020-03-01 10:00:00"},
+		{"'=HYPERLINK(\"http://example.com\")", "-2", "-1.5", "0001-01-01 00:00:00"},
+		{"'+1", "-7", "0", ""},
+		{"'-2", "0", "0", ""},
+		{"'@SUM(A1)", "0", "0", ""},
+		{"'\tcmd", "0", "0", ""},
+		{"'\r=1", "0", "0", ""},
+		{"a=b", "0", "0", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %v records, want %v", len(records), len(want))
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %v = %q, want %q", i, records[i], want[i])
+		}
+	}
+}
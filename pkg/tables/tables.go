@@ -0,0 +1,191 @@
+package tables
+
+// Tables of analysis results for CSV and XLSX downloads. Nested results are flattened
+// to long tables with a row per learner step, curve point, block or day, headers are
+// meant to be read by people working in spreadsheets and statistical packages.
+
+import (
+	"fmt"
+	"kafka-log-processor/pkg/database"
+	"kafka-log-processor/pkg/models"
+	"strconv"
+	"time"
+)
+
+// Table is a named table. Cells are strings, integers, floats, booleans or times.
+type Table struct {
+	Name    string
+	Headers []string
+	Rows    [][]interface{}
+}
+
+// DisplayNames returns display name of the course block, models.CourseStructureIndex.DisplayName is one.
+// Nil DisplayNames leaves block names empty.
+type DisplayNames func(blockID string) (string, bool)
+
+// wholeCourse is the block name of course-wide rows
+const wholeCourse = "Whole course"
+
+func (names DisplayNames) of(blockID string) string {
+	if names == nil || blockID == "" {
+		return ""
+	}
+	name, _ := names(blockID)
+	return name
+}
+
+// List returns table name of values with a single column header
+func List(name string, header string, values []string) []Table {
+	table := Table{Name: name, Headers: []string{header}}
+	for _, value := range values {
+		table.Rows = append(table.Rows, []interface{}{value})
+	}
+	return []Table{table}
+}
+
+// Videos returns table of video ids with their names
+func Videos(videoIDs []string, names DisplayNames) []Table {
+	table := Table{Name: "videos", Headers: []string{"Video id", "Video"}}
+	for _, videoID := range videoIDs {
+		table.Rows = append(table.Rows, []interface{}{videoID, names.of(videoID)})
+	}
+	return []Table{table}
+}
+
+// Routes returns "steps" table with a row per step of every learner and "learners" table with route metrics
+func Routes(routes []models.UserRoute, names DisplayNames) []Table {
+	families := map[string]string{}
+	for family, indexName := range database.EventFamilyIndexNames {
+		families[indexName] = family
+	}
+	steps := Table{Name: "steps", Headers: []string{"Learner", "Step", "Position", "Block id", "Block", "Event family", "Event type", "Time"}}
+	learners := Table{Name: "learners", Headers: []string{"Learner", "Steps", "Linearity score", "Backward jumps", "Revisits", "Farthest position"}}
+	for _, route := range routes {
+		for i, step := range route.Steps {
+			steps.Rows = append(steps.Rows, []interface{}{
+				route.Username, i + 1, step.Position, step.BlockID, names.of(step.BlockID), families[step.Index], step.EventType, step.Time,
+			})
+		}
+		learners.Rows = append(learners.Rows, []interface{}{
+			route.Username, len(route.Steps), route.LinearityScore, route.BackwardJumps, route.Revisits, route.FarthestPosition,
+		})
+	}
+	return []Table{steps, learners}
+}
+
+// VideoWatchings returns table of the watching curve points
+func VideoWatchings(curve models.CurveFloatToInt) []Table {
+	table := Table{Name: "curve", Headers: []string{"Video second", "Watchers"}}
+	for i := range curve.X {
+		if i < len(curve.Y) {
+			table.Rows = append(table.Rows, []interface{}{curve.X[i], curve.Y[i]})
+		}
+	}
+	return []Table{table}
+}
+
+// ExternalResources returns table of clicks of the course resources followed by clicks in every unit
+func ExternalResources(report models.ExternalResourcesReport) []Table {
+	table := Table{Name: "resources", Headers: []string{"Unit id", "Unit", "Resource", "Clicks"}}
+	for _, resource := range report.Course {
+		table.Rows = append(table.Rows, []interface{}{"", wholeCourse, resource.Resource, resource.Clicks})
+	}
+	for _, unit := range report.Units {
+		for _, resource := range unit.Resources {
+			table.Rows = append(table.Rows, []interface{}{unit.BlockID, unit.DisplayName, resource.Resource, resource.Clicks})
+		}
+	}
+	return []Table{table}
+}
+
+// Bookmarks returns "blocks" table of bookmarked blocks, "timelines" table of active bookmarks
+// of the blocks by days and "summary" table of return rate and delay
+func Bookmarks(report models.BookmarksReport) []Table {
+	blocks := Table{Name: "blocks", Headers: []string{"Block id", "Block", "Active bookmarks", "Added bookmarks", "Returns", "Median return delay, seconds"}}
+	for _, block := range report.Blocks {
+		blocks.Rows = append(blocks.Rows, []interface{}{
+			block.BlockID, block.DisplayName, block.ActiveBookmarks, block.AddedBookmarks, block.Returns, block.MedianReturnDelaySeconds,
+		})
+	}
+	timelines := Table{Name: "timelines", Headers: []string{"Block id", "Block", "Date", "Active bookmarks"}}
+	for _, timeline := range report.Timelines {
+		for i, date := range timeline.Dates {
+			if i < len(timeline.ActiveBookmarks) {
+				timelines.Rows = append(timelines.Rows, []interface{}{timeline.BlockID, timeline.DisplayName, date, timeline.ActiveBookmarks[i]})
+			}
+		}
+	}
+	summary := Table{
+		Name:    "summary",
+		Headers: []string{"Return rate", "Median return delay, seconds"},
+		Rows:    [][]interface{}{{report.ReturnRate, report.MedianReturnDelaySeconds}},
+	}
+	return []Table{blocks, timelines, summary}
+}
+
+// CourseActivity returns table of course-wide activity followed by activity of every block
+func CourseActivity(activity models.CourseActivity, names DisplayNames) []Table {
+	period := "Date"
+	if activity.Granularity == "hour" {
+		period = "Hour"
+	}
+	table := Table{
+		Name: "activity",
+		Headers: []string{period, "Block id", "Block", "Active learners", "Video plays", "Watch seconds",
+			"Submissions", "Mean score", "Bookmarks added", "Bookmarks removed", "Link clicks"},
+	}
+	add := func(blockActivity models.BlockActivity, blockName string) {
+		table.Rows = append(table.Rows, []interface{}{
+			blockActivity.Date, blockActivity.BlockID, blockName, blockActivity.ActiveLearners, blockActivity.VideoPlays,
+			blockActivity.WatchSeconds, blockActivity.Submissions, blockActivity.MeanScore, blockActivity.BookmarksAdded,
+			blockActivity.BookmarksRemoved, blockActivity.LinkClicks,
+		})
+	}
+	for _, courseActivity := range activity.Course {
+		add(courseActivity, wholeCourse)
+	}
+	for _, blockActivity := range activity.Blocks {
+		add(blockActivity, names.of(blockActivity.BlockID))
+	}
+	return []Table{table}
+}
+
+// Problems returns table of the problem statistics
+func Problems(report models.ProblemsReport) []Table {
+	table := Table{
+		Name: "problems",
+		Headers: []string{"Problem id", "Problem", "Position", "Learners", "Submissions", "Mean attempts", "Mean score",
+			"Solved learners", "Solved at first attempt"},
+	}
+	for _, problem := range report.Problems {
+		table.Rows = append(table.Rows, []interface{}{
+			problem.ProblemID, problem.DisplayName, problem.Position, problem.Learners, problem.Submissions,
+			problem.MeanAttempts, problem.MeanScore, problem.SolvedLearners, problem.FirstAttemptSolvedLearners,
+		})
+	}
+	return []Table{table}
+}
+
+// Timeline returns table of the learner events, Details are the stored events as JSON
+func Timeline(timeline models.Timeline) []Table {
+	table := Table{Name: "events", Headers: []string{"Learner", "Time", "Event family", "Event type", "Block id", "Block", "Details"}}
+	for _, event := range timeline.Events {
+		table.Rows = append(table.Rows, []interface{}{
+			timeline.Username, event.Time, event.Family, event.EventType, event.BlockID, event.DisplayName, string(event.Details),
+		})
+	}
+	return []Table{table}
+}
+
+// formatCell formats cell value as text, times are UTC
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,183 @@
+package tables
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCellLength is the longest text Excel keeps in a cell
+const maxCellLength = 32767
+
+// Cell styles of styles.xml: headers are bold, times are formatted as dates
+const (
+	headerStyle = 1
+	timeStyle   = 2
+)
+
+// excelEpoch is the day 0 of Excel date serial numbers
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`%v</Types>`
+
+const xlsxRootRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// WriteXLSX writes Excel workbook with a sheet per table. The first row of every sheet
+// is the bold header row, times are written as Excel dates in UTC.
+func WriteXLSX(w io.Writer, tables []Table) error {
+	archive := zip.NewWriter(w)
+	var overrides, sheets, relationships strings.Builder
+	for i, table := range tables {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%v.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%v" sheetId="%v" r:id="rId%v"/>`, escape(sheetName(table.Name)), i+1, i+1)
+		fmt.Fprintf(&relationships, `<Relationship Id="rId%v" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%v.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&relationships, `<Relationship Id="rId%v" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(tables)+1)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, overrides.String())},
+		{"_rels/.rels", xlsxRootRelationships},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			"<sheets>" + sheets.String() + "</sheets></workbook>"},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + relationships.String() + "</Relationships>"},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, file := range files {
+		fileWriter, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(fileWriter, file.content); err != nil {
+			return err
+		}
+	}
+	for i, table := range tables {
+		fileWriter, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%v.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err = writeSheet(fileWriter, table); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeSheet(w io.Writer, table Table) error {
+	buffer := bufio.NewWriter(w)
+	buffer.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	buffer.WriteString(`<row r="1">`)
+	for column, header := range table.Headers {
+		writeStringCell(buffer, cellReference(column, 1), header, headerStyle)
+	}
+	buffer.WriteString("</row>")
+	for i, row := range table.Rows {
+		rowNumber := i + 2
+		fmt.Fprintf(buffer, `<row r="%v">`, rowNumber)
+		for column, value := range row {
+			writeCell(buffer, cellReference(column, rowNumber), value)
+		}
+		buffer.WriteString("</row>")
+	}
+	buffer.WriteString("</sheetData></worksheet>")
+	return buffer.Flush()
+}
+
+func writeCell(w *bufio.Writer, reference string, value interface{}) {
+	switch v := value.(type) {
+	case int:
+		fmt.Fprintf(w, `<c r="%v"><v>%v</v></c>`, reference, v)
+	case int64:
+		fmt.Fprintf(w, `<c r="%v"><v>%v</v></c>`, reference, v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+		fmt.Fprintf(w, `<c r="%v"><v>%v</v></c>`, reference, strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		number := 0
+		if v {
+			number = 1
+		}
+		fmt.Fprintf(w, `<c r="%v" t="b"><v>%v</v></c>`, reference, number)
+	case time.Time:
+		days := float64(v.UTC().Sub(excelEpoch)) / float64(24*time.Hour)
+		fmt.Fprintf(w, `<c r="%v" s="%v"><v>%v</v></c>`, reference, timeStyle, strconv.FormatFloat(days, 'f', -1, 64))
+	default:
+		if text := formatCell(value); text != "" {
+			writeStringCell(w, reference, text, 0)
+		}
+	}
+}
+
+func writeStringCell(w *bufio.Writer, reference string, value string, style int) {
+	if runes := []rune(value); len(runes) > maxCellLength {
+		value = string(runes[:maxCellLength])
+	}
+	styleAttribute := ""
+	if style != 0 {
+		styleAttribute = fmt.Sprintf(` s="%v"`, style)
+	}
+	fmt.Fprintf(w, `<c r="%v" t="inlineStr"%v><is><t xml:space="preserve">%v</t></is></c>`, reference, styleAttribute, escape(value))
+}
+
+// cellReference returns A1 reference of zero-based column and one-based row
+func cellReference(column int, row int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// sheetName returns name Excel accepts: at most 31 characters without []:*?/\
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	return name
+}
+
+func escape(value string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(value))
+	return builder.String()
+}